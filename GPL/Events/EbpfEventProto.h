@@ -11,6 +11,7 @@
 #define EBPF_EVENTPROBE_EBPFEVENTPROTO_H
 
 #define ARGV_MAX 8192 // See issue #43, quite possibly too small
+#define ENV_MAX 8192
 
 #define PATH_MAX 4096
 // When computing the path we need to allocate twice the size of PATH_MAX
@@ -20,8 +21,18 @@
 
 #define TASK_COMM_LEN 16
 
+// Ancestors whose comm is recorded in exec events
+#define ANCESTORS_MAX 8
+
 #define TTY_OUT_MAX 4096
 
+// Longer tty writes are only partially captured
+#define TTY_OUT_CHUNKS_MAX 4
+
+// Largest DNS message over UDP without EDNS (RFC 1035). Questions are at the
+// start, this is plenty for them either way.
+#define DNS_PAYLOAD_MAX 512
+
 #ifndef __KERNEL__
 #include <stdint.h>
 #else
@@ -42,11 +53,53 @@ enum ebpf_event_type {
     EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED  = (1 << 11),
     EBPF_EVENT_NETWORK_CONNECTION_ATTEMPTED = (1 << 12),
     EBPF_EVENT_NETWORK_CONNECTION_CLOSED    = (1 << 13),
+    EBPF_EVENT_FILE_COPY                    = (1 << 14),
+    EBPF_EVENT_PROCESS_SETSCHED             = (1 << 15),
+    EBPF_EVENT_SECURITY_TAMPER              = (1 << 16),
+    EBPF_EVENT_FILESYSTEM_VIEW_CHANGE       = (1 << 17),
+    EBPF_EVENT_PROCESS_BPF_LINK             = (1 << 18),
+    EBPF_EVENT_DEVICE_ACCESS                = (1 << 19),
+    EBPF_EVENT_PROCESS_MM_SPOOF             = (1 << 20),
+    EBPF_EVENT_NETWORK_UDP_SEND             = (1 << 21),
+    EBPF_EVENT_NETWORK_UDP_RECV             = (1 << 22),
+    EBPF_EVENT_NETWORK_DNS_QUERY            = (1 << 23),
+    EBPF_EVENT_PROCESS_PTRACE               = (1 << 24),
+    EBPF_EVENT_FILE_MODIFY_ATTR             = (1 << 25),
+    EBPF_EVENT_FILE_SYMLINK                 = (1 << 26),
+    EBPF_EVENT_FILE_HARDLINK                = (1 << 27),
+    EBPF_EVENT_FS_MOUNT                     = (1 << 28),
+    EBPF_EVENT_FS_UMOUNT                    = (1 << 29),
+    EBPF_EVENT_PROCESS_SIGNAL               = (1 << 30),
+    EBPF_EVENT_PROCESS_SETCAP               = (1ULL << 31),
+    EBPF_EVENT_PROCESS_MMAP_EXEC            = (1ULL << 32),
+    EBPF_EVENT_PROCESS_MPROTECT             = (1ULL << 33),
+    EBPF_EVENT_KERNEL_MODULE_LOAD           = (1ULL << 34),
+    EBPF_EVENT_PROCESS_BPF_SYSCALL          = (1ULL << 35),
+    EBPF_EVENT_PROCESS_CHDIR                = (1ULL << 36),
+    EBPF_EVENT_FILE_OPEN                    = (1ULL << 37),
+    EBPF_EVENT_NETWORK_LISTEN               = (1ULL << 38),
+    EBPF_EVENT_NETWORK_BIND                 = (1ULL << 39),
+    EBPF_EVENT_FILE_TRUNCATE                = (1ULL << 40),
+    EBPF_EVENT_PROCESS_UNSHARE              = (1ULL << 41),
+    EBPF_EVENT_PROCESS_SETNS                = (1ULL << 42),
+    EBPF_EVENT_NETWORK_DNS_RESPONSE         = (1ULL << 43),
 };
 
 struct ebpf_event_header {
     uint64_t ts;
     uint64_t type;
+    // CPU the event was generated on and a per-CPU sequence number. Within a
+    // CPU, subseq strictly increases in the order events were generated (with
+    // gaps), breaking ties between events with identical timestamps. A probe
+    // nested inside another on the same CPU (softirq, NMI) can rarely get the
+    // same subseq as the event it interrupted.
+    uint32_t cpu;
+    uint64_t subseq;
+    // Per-process sequence number, see ebpf_event_ctx__set_proc_seq. Counts
+    // the subscribed events the generating process (identified by tgid and
+    // start time, like entity IDs) tried to emit, starting at 1, so a gap
+    // means events of that process were dropped. 0 if disabled.
+    uint64_t proc_seq;
 } __attribute__((packed));
 
 struct ebpf_pid_info {
@@ -56,6 +109,13 @@ struct ebpf_pid_info {
     uint32_t ppid;
     uint32_t pgid;
     uint32_t sid;
+    uint64_t parent_start_time_ns; // start_time_ns of ppid
+    // start_time_ns, but on the boottime clock (i.e. counting time spent
+    // suspended)
+    uint64_t start_boottime_ns;
+    // start_boottime_ns of the init process of the process' pid namespace,
+    // i.e. of the container it's in. 0 in the initial pid namespace.
+    uint64_t pidns_init_start_boottime_ns;
 } __attribute__((packed));
 
 struct ebpf_cred_info {
@@ -65,6 +125,20 @@ struct ebpf_cred_info {
     uint32_t egid; // Effective group ID
     uint32_t suid; // Saved user ID
     uint32_t sgid; // Saved group ID
+
+    // The above IDs as seen from within the task's user namespace (the IDs
+    // above are always as seen from the host). (uint32_t)-1 if unmapped.
+    uint32_t container_ruid;
+    uint32_t container_rgid;
+    uint32_t container_euid;
+    uint32_t container_egid;
+    uint32_t container_suid;
+    uint32_t container_sgid;
+
+    // Capability sets, bit n set means capability n (e.g. CAP_NET_RAW = 13)
+    // is in the set
+    uint64_t cap_permitted;
+    uint64_t cap_effective;
 } __attribute__((packed));
 
 struct ebpf_tty_winsize {
@@ -79,6 +153,56 @@ struct ebpf_tty_termios {
     uint32_t c_cflag;
 } __attribute__((packed));
 
+// The process' cgroup on the unified (v2) hierarchy. id is the cgroup ID (the
+// inode number of its directory, as returned by bpf_get_current_cgroup_id),
+// zeroed when only cgroup v1 is in use. Its path, relative to the hierarchy's
+// root, is usually the same as pids_ss_cgroup_path in the event and is only
+// sent as an EBPF_VL_FIELD_CGROUP_PATH field when it isn't.
+struct ebpf_cgroup_info {
+    uint64_t id;
+} __attribute__((packed));
+
+// Optional fields, and ones usually much smaller than their maximum size, are
+// appended to some events as a list of variable-length fields, each only as
+// large as its data. Fields that aren't set are left out.
+//
+// EBPF_VL_FIELD_ROOT_PATH is the root directory of the process relative to the
+// root of its mount namespace, only sent if it's chrooted (i.e. it isn't "/").
+// Paths in events are relative to this root.
+enum ebpf_varlen_field_type {
+    EBPF_VL_FIELD_PARENT_ARGV = 1,
+    EBPF_VL_FIELD_ENV         = 2,
+    EBPF_VL_FIELD_INTERPRETER = 3,
+    EBPF_VL_FIELD_CGROUP_PATH = 4,
+    EBPF_VL_FIELD_EXE_PATH    = 5,
+    EBPF_VL_FIELD_ROOT_PATH   = 6,
+};
+
+struct ebpf_varlen_field {
+    enum ebpf_varlen_field_type type;
+    uint32_t size; // Of data
+    char data[];
+} __attribute__((packed));
+
+// Last member of events with variable-length fields. size is that of data,
+// which holds nfields struct ebpf_varlen_field back to back.
+struct ebpf_varlen_fields_start {
+    uint32_t nfields;
+    uint32_t size;
+    char data[];
+} __attribute__((packed));
+
+// Inode numbers of a process' namespaces, as in the /proc/<pid>/ns/* links
+struct ebpf_namespace_info {
+    uint32_t mnt;
+    uint32_t net;
+    uint32_t pid; // The namespace the process is in, not the one of its future children
+    uint32_t user;
+    uint32_t uts;
+    uint32_t ipc;
+    uint32_t cgroup;
+} __attribute__((packed));
+
 struct ebpf_tty_dev {
     uint16_t minor;
     uint16_t major;
@@ -93,6 +217,14 @@ struct ebpf_file_delete_event {
     char path[PATH_MAX_BUF];
     uint32_t mntns;
     char comm[TASK_COMM_LEN];
+    uint32_t dev; // See ebpf_file_create_event
+    uint64_t inode;
+    uint64_t size;        // As the file was when it was unlinked
+    uint8_t is_last_link; // The inode is gone once the last process closes it
+
+    // EBPF_VL_FIELD_ROOT_PATH and EBPF_VL_FIELD_CGROUP_PATH, see
+    // ebpf_file_create_event
+    struct ebpf_varlen_fields_start vl_fields;
 } __attribute__((packed));
 
 struct ebpf_file_create_event {
@@ -101,8 +233,26 @@ struct ebpf_file_create_event {
     char path[PATH_MAX_BUF];
     uint32_t mntns;
     char comm[TASK_COMM_LEN];
+    uint32_t dev; // Kernel dev_t of the filesystem, (major << 20) | minor
+    uint64_t inode;
+    // i_generation, distinguishes files reusing the same inode number on
+    // filesystems that support it (e.g. ext4), 0 otherwise
+    uint32_t inode_generation;
+
+    // EBPF_VL_FIELD_ROOT_PATH and EBPF_VL_FIELD_CGROUP_PATH, which unlike in
+    // process events is the process' cgroup in the pids controller's hierarchy
+    // (pids_ss_cgroup_path in process events). Not sent if the pids controller
+    // isn't enabled.
+    struct ebpf_varlen_fields_start vl_fields;
 } __attribute__((packed));
 
+// renameat2 flags, same values as the kernel's RENAME_* flags
+enum ebpf_file_rename_flags {
+    EBPF_FILE_RENAME_NOREPLACE = (1 << 0),
+    EBPF_FILE_RENAME_EXCHANGE  = (1 << 1),
+    EBPF_FILE_RENAME_WHITEOUT  = (1 << 2),
+};
+
 struct ebpf_file_rename_event {
     struct ebpf_event_header hdr;
     struct ebpf_pid_info pids;
@@ -110,6 +260,75 @@ struct ebpf_file_rename_event {
     char new_path[PATH_MAX_BUF];
     uint32_t mntns;
     char comm[TASK_COMM_LEN];
+    // Moved to another directory. The kernel refuses renames across mounts
+    // (EXDEV), so both paths are always on the same filesystem.
+    uint8_t cross_directory;
+    // See enum ebpf_file_rename_flags, 0 for rename and renameat. With
+    // EBPF_FILE_RENAME_EXCHANGE the two files swapped places, so new_path
+    // now holds the file that was at old_path and vice versa.
+    uint32_t flags;
+
+    // EBPF_VL_FIELD_ROOT_PATH and EBPF_VL_FIELD_CGROUP_PATH, see
+    // ebpf_file_create_event
+    struct ebpf_varlen_fields_start vl_fields;
+} __attribute__((packed));
+
+// Used for both EBPF_EVENT_FILE_SYMLINK and EBPF_EVENT_FILE_HARDLINK
+struct ebpf_file_link_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    // For symlinks, the target exactly as given to symlink(), it may be
+    // relative (to the link's directory) or not exist. For hardlinks, the
+    // resolved path of the existing file.
+    char target_path[PATH_MAX_BUF];
+    char link_path[PATH_MAX_BUF];
+    uint32_t mntns;
+    char comm[TASK_COMM_LEN];
+
+    // EBPF_VL_FIELD_ROOT_PATH
+    struct ebpf_varlen_fields_start vl_fields;
+} __attribute__((packed));
+
+// Used for both EBPF_EVENT_FS_MOUNT and EBPF_EVENT_FS_UMOUNT
+struct ebpf_fs_mount_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    // As given to mount() (e.g. a device, or the directory of a bind mount),
+    // or from /proc/<pid>/mounts for umounts. Empty if not given.
+    char source[PATH_MAX];
+    // The mount point, resolved
+    char destination[PATH_MAX_BUF];
+    // As in /proc/filesystems. Empty for mounts that don't take one (e.g.
+    // bind mounts, remounts and propagation changes).
+    char fs_type[32];
+    uint64_t flags; // MS_* for mounts, MNT_* and UMOUNT_* for umounts
+    uint32_t mntns;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_file_modify_attr_change {
+    EBPF_FILE_MODIFY_ATTR_CHANGE_MODE  = 1, // chmod, fchmod, fchmodat
+    EBPF_FILE_MODIFY_ATTR_CHANGE_OWNER = 2, // chown, fchown, lchown, fchownat
+};
+
+// A successful permission or ownership change. Both the old and new values
+// of all attributes are reported, those the change didn't touch are equal.
+struct ebpf_file_modify_attr_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    char path[PATH_MAX_BUF];
+    uint32_t mntns;
+    char comm[TASK_COMM_LEN];
+    enum ebpf_file_modify_attr_change change;
+    uint32_t old_mode; // Permission bits only (07777)
+    uint32_t new_mode;
+    uint32_t old_uid; // As seen from the host, like the creds of other events
+    uint32_t new_uid;
+    uint32_t old_gid;
+    uint32_t new_gid;
+
+    // EBPF_VL_FIELD_ROOT_PATH
+    struct ebpf_varlen_fields_start vl_fields;
 } __attribute__((packed));
 
 struct ebpf_process_fork_event {
@@ -117,8 +336,38 @@ struct ebpf_process_fork_event {
     struct ebpf_pid_info parent_pids;
     struct ebpf_pid_info child_pids;
     char pids_ss_cgroup_path[PATH_MAX];
+    struct ebpf_cgroup_info cgroup;
+    struct ebpf_namespace_info namespaces;
+    // The kernel's CLONE_* flags, as passed to clone or clone3 (fork and
+    // vfork imply their own). Doesn't include the exit signal.
+    uint64_t clone_flags;
+    // A new thread of the parent's process (CLONE_THREAD) rather than a new
+    // process, only sent if enabled with ebpf_event_ctx__set_trace_threads
+    uint8_t is_thread;
+
+    // EBPF_VL_FIELD_CGROUP_PATH
+    struct ebpf_varlen_fields_start vl_fields;
 } __attribute__((packed));
 
+// What kind of storage a filesystem is on, as far as can be told from its
+// type. EBPF_FS_CLASS_UNKNOWN for types that could be either (e.g. fuse) or
+// aren't known.
+enum ebpf_fs_class {
+    EBPF_FS_CLASS_UNKNOWN   = 0,
+    EBPF_FS_CLASS_LOCAL     = 1,
+    EBPF_FS_CLASS_NETWORK   = 2, // nfs, cifs, 9p...
+    EBPF_FS_CLASS_REMOVABLE = 3, // Filesystems of USB drives and optical media (vfat, iso9660...)
+};
+
+// How the executed file was specified. A memfd (memfd_create) has no path on
+// any filesystem, executing one is "fileless" whichever syscall was used.
+enum ebpf_process_exec_source {
+    EBPF_PROCESS_EXEC_SOURCE_UNKNOWN  = 0,
+    EBPF_PROCESS_EXEC_SOURCE_EXECVE   = 1,
+    EBPF_PROCESS_EXEC_SOURCE_EXECVEAT = 2,
+    EBPF_PROCESS_EXEC_SOURCE_MEMFD    = 3,
+};
+
 struct ebpf_process_exec_event {
     struct ebpf_event_header hdr;
     struct ebpf_pid_info pids;
@@ -126,20 +375,87 @@ struct ebpf_process_exec_event {
     struct ebpf_tty_dev ctty;
     char filename[PATH_MAX];
     char cwd[PATH_MAX];
+    // NUL-delimited, argv_len bytes of it are set. If argv_truncated, it
+    // didn't fit and the last argument is cut short.
     char argv[ARGV_MAX];
+    uint32_t argv_len;
+    uint8_t argv_truncated;
+    // Of the EBPF_VL_FIELD_PARENT_ARGV field, the argv of the parent as of
+    // when it forked this process, e.g. the "sh -c ..." that ran it.
+    // NUL-delimited like argv. Not sent if this process had already exec'd
+    // since the fork (the pre-exec image isn't the parent's then).
+    uint8_t parent_argv_truncated;
+    // The parent has exec'd since the fork, so parent_argv is no longer what
+    // it's running
+    uint8_t parent_argv_stale;
     char pids_ss_cgroup_path[PATH_MAX];
+    uint32_t exe_dev; // See ebpf_file_create_event
+    uint64_t exe_inode;
+    uint32_t exe_inode_generation;
+    char exe_fs_type[32]; // As in /proc/filesystems
+    enum ebpf_fs_class exe_fs_class;
+    // prctl(PR_SET_NO_NEW_PRIVS), if set setuid/setgid bits and file
+    // capabilities had no effect on this exec
+    uint8_t no_new_privs;
+    // Mount namespace this process, or the process that forked it, left with
+    // setns since its last exec, 0 if none. Container runtimes join a
+    // container's namespaces this way right before exec'ing into it (see
+    // ebpf_filesystem_view_change_event).
+    uint32_t mntns_switched_from;
+    // comm of the parent, its parent and so on up to init, as of the exec.
+    // Entries past init are empty.
+    char ancestor_comms[ANCESTORS_MAX][TASK_COMM_LEN];
+    struct ebpf_cgroup_info cgroup;
+    struct ebpf_namespace_info namespaces;
+    enum ebpf_process_exec_source source;
+    // Of the EBPF_VL_FIELD_ENV field, the environment, NUL-delimited like
+    // argv. Only sent if enabled (see ebpf_event_ctx__set_env_capture).
+    uint8_t env_truncated;
+
+    // EBPF_VL_FIELD_PARENT_ARGV, EBPF_VL_FIELD_ENV, EBPF_VL_FIELD_CGROUP_PATH,
+    // EBPF_VL_FIELD_ROOT_PATH, EBPF_VL_FIELD_INTERPRETER, the #! interpreter
+    // the kernel loaded to run filename if it's a script, and
+    // EBPF_VL_FIELD_EXE_PATH, the path of the file that was exec'd with
+    // symlinks resolved (relative to the root path), the interpreter's for
+    // scripts. The exe_* fields are that file's.
+    struct ebpf_varlen_fields_start vl_fields;
 } __attribute__((packed));
 
 struct ebpf_process_exit_event {
     struct ebpf_event_header hdr;
     struct ebpf_pid_info pids;
     int32_t exit_code;
+    // Signal that terminated the process, 0 if it exited normally
+    int32_t signal;
+    // Nonzero if the process was killed by the OOM killer
+    uint8_t oom_killed;
     char pids_ss_cgroup_path[PATH_MAX];
+    struct ebpf_cgroup_info cgroup;
+    struct ebpf_namespace_info namespaces;
+
+    // EBPF_VL_FIELD_CGROUP_PATH
+    struct ebpf_varlen_fields_start vl_fields;
 } __attribute__((packed));
 
 struct ebpf_process_setsid_event {
     struct ebpf_event_header hdr;
     struct ebpf_pid_info pids;
+    // Before the setsid, the sid and pgid in pids are the process' own tgid
+    // after it
+    struct ebpf_pid_info old_pids;
+} __attribute__((packed));
+
+enum ebpf_process_chdir_syscall {
+    EBPF_PROCESS_CHDIR_SYSCALL_CHDIR  = 1,
+    EBPF_PROCESS_CHDIR_SYSCALL_FCHDIR = 2,
+};
+
+struct ebpf_process_chdir_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_chdir_syscall syscall;
+    char cwd[PATH_MAX]; // The new working directory
+    char comm[TASK_COMM_LEN];
 } __attribute__((packed));
 
 struct ebpf_process_setuid_event {
@@ -149,14 +465,33 @@ struct ebpf_process_setuid_event {
     uint32_t new_euid;
     uint32_t new_rgid;
     uint32_t new_egid;
+    // As seen from within the task's (new) user namespace
+    uint32_t new_container_ruid;
+    uint32_t new_container_euid;
+    uint32_t new_container_rgid;
+    uint32_t new_container_egid;
+    // Saved set-user-ID and filesystem uid, as changed by setresuid and
+    // setfsuid
+    uint32_t new_suid;
+    uint32_t new_fsuid;
+    uint32_t new_container_suid;
+    uint32_t new_container_fsuid;
 } __attribute__((packed));
 
 struct ebpf_process_tty_write_event {
     struct ebpf_event_header hdr;
     struct ebpf_pid_info pids;
     char tty_out[TTY_OUT_MAX];
-    uint64_t tty_out_len;
-    uint64_t tty_out_truncated;
+    uint64_t tty_out_len;       // Bytes of the write in tty_out
+    uint64_t tty_out_truncated; // Bytes of the write after those in tty_out
+    // Writes longer than TTY_OUT_MAX are split over consecutive events, up to
+    // TTY_OUT_CHUNKS_MAX of them, this one's tty_out being tty_out_offset
+    // bytes into the write of tty_out_total_len bytes
+    uint64_t tty_out_offset;
+    uint64_t tty_out_total_len;
+    // Goes up by one with every write to tty, the same for all of a write's
+    // events
+    uint64_t tty_write_seq;
     // Controlling TTY.
     struct ebpf_tty_dev ctty;
     // Destination TTY.
@@ -171,15 +506,240 @@ struct ebpf_process_setgid_event {
     uint32_t new_egid;
     uint32_t new_ruid;
     uint32_t new_euid;
+    // As seen from within the task's (new) user namespace
+    uint32_t new_container_rgid;
+    uint32_t new_container_egid;
+    uint32_t new_container_ruid;
+    uint32_t new_container_euid;
+    // Saved set-group-ID and filesystem gid, as changed by setresgid and
+    // setfsgid
+    uint32_t new_sgid;
+    uint32_t new_fsgid;
+    uint32_t new_container_sgid;
+    uint32_t new_container_fsgid;
+} __attribute__((packed));
+
+// Any change to a task's effective, permitted or inheritable capabilities,
+// with capset or as a side effect of e.g. setuid. Capability sets are as in
+// ebpf_cred_info.
+struct ebpf_process_setcap_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    uint64_t old_cap_effective;
+    uint64_t new_cap_effective;
+    uint64_t old_cap_permitted;
+    uint64_t new_cap_permitted;
+    uint64_t old_cap_inheritable;
+    uint64_t new_cap_inheritable;
+} __attribute__((packed));
+
+enum ebpf_process_setsched_syscall {
+    EBPF_PROCESS_SETSCHED_SYSCALL_SCHED_SETSCHEDULER = 1,
+    EBPF_PROCESS_SETSCHED_SYSCALL_SETPRIORITY        = 2,
+};
+
+// Same values as PRIO_PROCESS, PRIO_PGRP and PRIO_USER
+enum ebpf_process_setsched_target {
+    EBPF_PROCESS_SETSCHED_TARGET_PROCESS       = 0,
+    EBPF_PROCESS_SETSCHED_TARGET_PROCESS_GROUP = 1,
+    EBPF_PROCESS_SETSCHED_TARGET_USER          = 2,
+};
+
+struct ebpf_process_setsched_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_setsched_syscall syscall;
+    enum ebpf_process_setsched_target target_type;
+    // pid, pgid or uid depending on target_type. A process target of 0 (i.e.
+    // the caller) is resolved to the caller's tid, 0 is left as is otherwise.
+    uint32_t target_id;
+    int32_t policy;         // SCHED_* (sched_setscheduler only)
+    int32_t sched_priority; // sched_setscheduler only
+    int32_t nice;           // setpriority only
+} __attribute__((packed));
+
+// bpf(2) commands attaching a program
+enum ebpf_process_bpf_link_cmd {
+    EBPF_PROCESS_BPF_LINK_CMD_LINK_CREATE         = 1,
+    EBPF_PROCESS_BPF_LINK_CMD_RAW_TRACEPOINT_OPEN = 2,
+};
+
+struct ebpf_process_bpf_link_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_bpf_link_cmd cmd;
+    uint32_t attach_type; // enum bpf_attach_type, BPF_TRACE_RAW_TP for raw tracepoints
+    uint32_t prog_id;
+    uint32_t link_id;
+    // What the program was attached to: the tracepoint name for raw
+    // tracepoints, the function name for fentry/fexit/LSM programs, otherwise
+    // the path of the target fd (e.g. a cgroup directory) if there's one
+    char target[PATH_MAX];
+    uint32_t target_ifindex; // BPF_XDP only
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// BPF_OBJ_NAME_LEN in linux/bpf.h
+#define BPF_NAME_MAX 16
+
+// bpf(2) commands creating a program or map
+enum ebpf_process_bpf_syscall_cmd {
+    EBPF_PROCESS_BPF_SYSCALL_CMD_PROG_LOAD  = 1,
+    EBPF_PROCESS_BPF_SYSCALL_CMD_MAP_CREATE = 2,
+};
+
+struct ebpf_process_bpf_syscall_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_bpf_syscall_cmd cmd;
+    uint32_t type; // enum bpf_prog_type or enum bpf_map_type, depending on cmd
+    uint32_t id;   // Program or map id, as listed by bpftool
+    char name[BPF_NAME_MAX];
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// Same values as the PR_SET_MM_* options of prctl(PR_SET_MM)
+enum ebpf_process_mm_field {
+    EBPF_PROCESS_MM_FIELD_START_CODE  = 1,
+    EBPF_PROCESS_MM_FIELD_END_CODE    = 2,
+    EBPF_PROCESS_MM_FIELD_START_DATA  = 3,
+    EBPF_PROCESS_MM_FIELD_END_DATA    = 4,
+    EBPF_PROCESS_MM_FIELD_START_STACK = 5,
+    EBPF_PROCESS_MM_FIELD_START_BRK   = 6,
+    EBPF_PROCESS_MM_FIELD_BRK         = 7,
+    EBPF_PROCESS_MM_FIELD_ARG_START   = 8,
+    EBPF_PROCESS_MM_FIELD_ARG_END     = 9,
+    EBPF_PROCESS_MM_FIELD_ENV_START   = 10,
+    EBPF_PROCESS_MM_FIELD_ENV_END     = 11,
+    EBPF_PROCESS_MM_FIELD_AUXV        = 12,
+    EBPF_PROCESS_MM_FIELD_EXE_FILE    = 13,
+    EBPF_PROCESS_MM_FIELD_MAP         = 14, // All fields at once
+};
+
+// A successful prctl(PR_SET_MM), used to rewrite what /proc/<pid>/cmdline,
+// environ and exe show, e.g. to fake a process' argv
+struct ebpf_process_mm_spoof_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_mm_field field;
+    // New address (or fd for EXE_FILE), 0 for MAP
+    uint64_t value;
+    // Path of the new exe for EXE_FILE and MAP
+    char exe_path[PATH_MAX];
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// Same values as the PTRACE_* requests. Only those taking control of a
+// process or modifying it are reported, not the ones debuggers issue
+// constantly to read state or resume the tracee.
+enum ebpf_process_ptrace_request {
+    EBPF_PROCESS_PTRACE_REQUEST_TRACEME   = 0,
+    EBPF_PROCESS_PTRACE_REQUEST_POKETEXT  = 4,
+    EBPF_PROCESS_PTRACE_REQUEST_POKEDATA  = 5,
+    EBPF_PROCESS_PTRACE_REQUEST_POKEUSER  = 6,
+    EBPF_PROCESS_PTRACE_REQUEST_SETREGS   = 13, // Not on arm64
+    EBPF_PROCESS_PTRACE_REQUEST_SETFPREGS = 15, // Not on arm64
+    EBPF_PROCESS_PTRACE_REQUEST_ATTACH    = 16,
+    EBPF_PROCESS_PTRACE_REQUEST_SETREGSET = 0x4205,
+    EBPF_PROCESS_PTRACE_REQUEST_SEIZE     = 0x4206,
+};
+
+// A successful ptrace() call, pids are those of the caller
+struct ebpf_process_ptrace_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_ptrace_request request;
+    // The pid passed to ptrace(), as seen from the caller's pid namespace. For
+    // TRACEME, where the caller asks its parent to trace it, pids.tid.
+    uint32_t target_pid;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_process_signal_syscall {
+    EBPF_PROCESS_SIGNAL_SYSCALL_KILL   = 1,
+    EBPF_PROCESS_SIGNAL_SYSCALL_TGKILL = 2,
+};
+
+// A successful kill() or tgkill(), pids are those of the sender
+struct ebpf_process_signal_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_signal_syscall syscall;
+    // As passed to the syscall, in the sender's pid namespace. For kill,
+    // target_pid and target_tgid are both the pid argument, which is 0 or
+    // negative for process groups and -1 for every process the sender can
+    // signal. For tgkill they're the tid and tgid arguments.
+    int32_t target_pid;
+    int32_t target_tgid;
+    // 0 if the call only checked that the target exists and can be signaled
+    int32_t signal;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_process_mmap_exec_syscall {
+    EBPF_PROCESS_MMAP_EXEC_SYSCALL_MMAP     = 1,
+    EBPF_PROCESS_MMAP_EXEC_SYSCALL_MPROTECT = 2,
+};
+
+// A successful mmap with PROT_EXEC, or mprotect to a protection including it
+struct ebpf_process_mmap_exec_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_process_mmap_exec_syscall syscall;
+    uint64_t addr;
+    uint64_t len;
+    uint32_t prot;  // PROT_* as passed to the syscall
+    uint32_t flags; // MAP_* as passed to mmap, 0 for mprotect
+    // For mprotect, whether the (first) mapping in the range was writable and
+    // executable before the call. Both 0 for mmap.
+    uint8_t was_writable;
+    uint8_t was_executable;
+    // Path of the file backing the mapping, empty for anonymous memory
+    char path[PATH_MAX];
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// A successful mprotect making memory that wasn't executable executable, or
+// any successful mprotect if verbose (see ebpf_event_ctx__set_mprotect_verbose)
+struct ebpf_process_mprotect_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    uint64_t addr;
+    uint64_t len;
+    // PROT_READ/PROT_WRITE/PROT_EXEC of the (first) mapping in the range
+    // before the call, and the protection passed to it
+    uint32_t old_prot;
+    uint32_t new_prot;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// MODULE_NAME_LEN on 64 bit architectures
+#define MODULE_NAME_MAX 56
+
+enum ebpf_kernel_module_load_syscall {
+    EBPF_KERNEL_MODULE_LOAD_SYSCALL_INIT_MODULE  = 1,
+    EBPF_KERNEL_MODULE_LOAD_SYSCALL_FINIT_MODULE = 2,
+};
+
+// A module successfully loaded with init_module (from a buffer) or
+// finit_module (from a file descriptor)
+struct ebpf_kernel_module_load_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_kernel_module_load_syscall syscall;
+    char name[MODULE_NAME_MAX];
+    char comm[TASK_COMM_LEN];
 } __attribute__((packed));
 
 enum ebpf_net_info_transport {
     EBPF_NETWORK_EVENT_TRANSPORT_TCP = 1,
+    EBPF_NETWORK_EVENT_TRANSPORT_UDP = 2,
 };
 
 enum ebpf_net_info_af {
     EBPF_NETWORK_EVENT_AF_INET  = 1,
     EBPF_NETWORK_EVENT_AF_INET6 = 2,
+    EBPF_NETWORK_EVENT_AF_UNIX  = 3,
 };
 
 struct ebpf_net_info_tcp_close {
@@ -187,6 +747,29 @@ struct ebpf_net_info_tcp_close {
     uint64_t bytes_received;
 } __attribute__((packed));
 
+struct ebpf_net_info_udp_datagram {
+    uint64_t bytes;
+} __attribute__((packed));
+
+// sizeof(((struct sockaddr_un *)0)->sun_path)
+#define SUN_PATH_MAX 108
+
+// Path an AF_UNIX socket is bound to, or its name in the abstract namespace,
+// which starts with a NUL byte. Neither is necessarily NUL-terminated.
+struct ebpf_net_info_unix {
+    uint32_t path_len;
+    char path[SUN_PATH_MAX];
+    // The process at the other end, as SO_PEERCRED reports it: its tgid and
+    // effective uid and gid when it connected, or when it called listen() for
+    // the connecting end. peer_exited is set if it was already gone when the
+    // event was emitted, peer_pid may have been reused then. peer_pid is 0 if
+    // the kernel recorded no peer.
+    uint32_t peer_pid;
+    uint32_t peer_uid;
+    uint32_t peer_gid;
+    uint8_t peer_exited;
+} __attribute__((packed));
+
 struct ebpf_net_info {
     enum ebpf_net_info_transport transport;
     enum ebpf_net_info_af family;
@@ -201,16 +784,232 @@ struct ebpf_net_info {
     uint16_t sport; // Host byte order
     uint16_t dport; // Host byte order
     uint32_t netns;
+    // Inode number of the socket, as in /proc/PID/fd/N -> socket:[INODE], the
+    // same for every event of a socket. 0 if it has no struct socket.
+    uint64_t sock_inode;
     union {
         struct ebpf_net_info_tcp_close close;
     } tcp;
+    union {
+        struct ebpf_net_info_udp_datagram datagram;
+    } udp;
+    struct ebpf_net_info_unix unix_addr; // AF_UNIX only, addresses and ports are unset
 } __attribute__((packed));
 
 struct ebpf_net_event {
     struct ebpf_event_header hdr;
     struct ebpf_pid_info pids;
     struct ebpf_net_info net;
+    // NETWORK_CONNECTION_ACCEPTED only: flags passed to accept4
+    // (SOCK_NONBLOCK, SOCK_CLOEXEC), 0 for accept
+    uint32_t accept_flags;
     char comm[TASK_COMM_LEN];
 } __attribute__((packed));
 
+// UDP datagram sent to port 53. The payload is passed on as is, it's parsed
+// (and dropped if it isn't a well-formed DNS query) in userspace.
+struct ebpf_dns_query_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    struct ebpf_net_info net;
+    uint32_t payload_len; // Bytes in payload, the datagram may have been longer
+    uint8_t payload[DNS_PAYLOAD_MAX];
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// UDP datagram received from port 53, net being from the point of view of the
+// receiving socket like for ebpf_dns_query_event. As with queries, it's
+// parsed (and dropped if it isn't a well-formed DNS response) in userspace.
+struct ebpf_dns_response_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    struct ebpf_net_info net;
+    // Bytes in payload, the datagram (or the part of it the process read)
+    // may have been longer
+    uint32_t payload_len;
+    uint8_t payload[DNS_PAYLOAD_MAX];
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// A socket started listening, net has the address and port it's bound to
+struct ebpf_net_listen_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    struct ebpf_net_info net;
+    int32_t backlog; // As passed to listen, the kernel caps it at somaxconn
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_file_copy_syscall {
+    EBPF_FILE_COPY_SYSCALL_SENDFILE        = 1,
+    EBPF_FILE_COPY_SYSCALL_SPLICE          = 2,
+    EBPF_FILE_COPY_SYSCALL_COPY_FILE_RANGE = 3,
+};
+
+enum ebpf_file_copy_endpoint_type {
+    EBPF_FILE_COPY_ENDPOINT_FILE   = 1, // Anything that isn't a pipe or socket, path is set
+    EBPF_FILE_COPY_ENDPOINT_PIPE   = 2,
+    EBPF_FILE_COPY_ENDPOINT_SOCKET = 3, // net is set if net.transport is non-zero
+};
+
+struct ebpf_file_copy_endpoint {
+    enum ebpf_file_copy_endpoint_type type;
+    uint64_t inode;
+    struct ebpf_net_info net;
+} __attribute__((packed));
+
+// Data moved between two file descriptors in the kernel (sendfile, splice,
+// copy_file_range), bypassing read/write
+struct ebpf_file_copy_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_file_copy_syscall syscall;
+    uint64_t bytes;
+    struct ebpf_file_copy_endpoint source;
+    struct ebpf_file_copy_endpoint destination;
+    char source_path[PATH_MAX_BUF];
+    char destination_path[PATH_MAX_BUF];
+    uint32_t mntns;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_security_tamper_op {
+    // Write to a watched file, or to a file in a watched directory
+    EBPF_SECURITY_TAMPER_OP_WRITE       = 1,
+    // SIGKILL, SIGTERM, SIGINT or SIGSTOP sent to a watched process
+    EBPF_SECURITY_TAMPER_OP_SIGNAL      = 2,
+    // Write to one of the tracer's own pinned objects or config files, or to a
+    // file in one of its watched directories
+    EBPF_SECURITY_TAMPER_OP_SELF_WRITE  = 3,
+    // Unlink of one of the tracer's own files, or of a file in one of its
+    // watched directories
+    EBPF_SECURITY_TAMPER_OP_SELF_UNLINK = 4,
+    // Rename of one of the tracer's own files, or of a file in one of its
+    // watched directories
+    EBPF_SECURITY_TAMPER_OP_SELF_RENAME = 5,
+};
+
+struct ebpf_security_tamper_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_security_tamper_op op;
+    char comm[TASK_COMM_LEN];
+
+    // EBPF_SECURITY_TAMPER_OP_WRITE and the EBPF_SECURITY_TAMPER_OP_SELF_ ops,
+    // for EBPF_SECURITY_TAMPER_OP_SELF_RENAME the path it was renamed from
+    char path[PATH_MAX];
+    uint32_t dev; // See ebpf_file_create_event
+    uint64_t inode;
+
+    // EBPF_SECURITY_TAMPER_OP_SIGNAL
+    uint32_t target_pid;
+    char target_comm[TASK_COMM_LEN];
+    int32_t signal;
+} __attribute__((packed));
+
+// A process switched mount namespace with setns, which changes the filesystem
+// it sees as much as a chroot does
+struct ebpf_filesystem_view_change_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    uint32_t old_mntns;
+    uint32_t new_mntns;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// Used for both EBPF_EVENT_PROCESS_UNSHARE and EBPF_EVENT_PROCESS_SETNS, only
+// sent if the process' namespaces actually changed
+struct ebpf_process_namespace_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    // CLONE_NEW* flags of the namespaces created (unshare) or joined (setns).
+    // For CLONE_NEWPID that's the pid namespace of the process' future
+    // children, the process itself stays in its own, as pid in namespaces.
+    uint64_t ns_flags;
+    struct ebpf_namespace_info old_namespaces;
+    struct ebpf_namespace_info new_namespaces;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_device_class {
+    EBPF_DEVICE_CLASS_ACCELERATOR = 1, // GPUs and other compute accelerators
+};
+
+// Open of a watched device (see ebpf_event_ctx__add_device_path)
+struct ebpf_device_access_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_device_class device_class;
+    char path[PATH_MAX];
+    uint32_t flags; // O_* flags the file was opened with
+    uint32_t rdev;  // Kernel encoding (see ebpf_file_create_event), 0 if not a device file
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+// Only sent when enabled with ebpf_event_ctx__set_trace_opens, optionally
+// restricted to paths under ebpf_event_ctx__add_open_path_prefix prefixes
+struct ebpf_file_open_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    char path[PATH_MAX];
+    uint32_t flags; // O_* flags as passed to open, including O_CREAT, O_TRUNC, ...
+    uint32_t mode;  // Permission bits the file is created with, 0 without O_CREAT/O_TMPFILE
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+enum ebpf_file_truncate_syscall {
+    EBPF_FILE_TRUNCATE_SYSCALL_TRUNCATE  = 1,
+    EBPF_FILE_TRUNCATE_SYSCALL_FTRUNCATE = 2,
+};
+
+// Successful truncate and ftruncate calls, whether they shrink the file or
+// grow it. Truncation by open with O_TRUNC isn't reported.
+struct ebpf_file_truncate_event {
+    struct ebpf_event_header hdr;
+    struct ebpf_pid_info pids;
+    enum ebpf_file_truncate_syscall syscall;
+    char path[PATH_MAX];
+    uint64_t old_size;
+    uint64_t new_size;
+    char comm[TASK_COMM_LEN];
+} __attribute__((packed));
+
+#define OPEN_PATH_PREFIX_MAX 256
+
+// Not an event, key of the LPM trie of path prefixes EBPF_EVENT_FILE_OPEN is
+// restricted to, prefixlen is in bits
+struct ebpf_open_path_prefix {
+    uint32_t prefixlen;
+    char path[OPEN_PATH_PREFIX_MAX];
+} __attribute__((packed));
+
+// Not an event, key of the set of device files and directories watched for
+// EBPF_EVENT_DEVICE_ACCESS, the value being their enum ebpf_device_class
+struct ebpf_device_inode {
+    uint32_t dev;
+    uint64_t inode;
+} __attribute__((packed));
+
+// Not an event, key of the set of files and directories watched for
+// EBPF_SECURITY_TAMPER_OP_WRITE and the EBPF_SECURITY_TAMPER_OP_SELF_ ops (see
+// ebpf_event_ctx__add_tamper_path), the value being their enum
+// ebpf_tamper_inode_owner
+struct ebpf_tamper_inode {
+    uint32_t dev;
+    uint64_t inode;
+} __attribute__((packed));
+
+enum ebpf_tamper_inode_owner {
+    EBPF_TAMPER_INODE_OWNER_SECURITY = 1, // Security tooling, e.g. SELinux
+    EBPF_TAMPER_INODE_OWNER_SELF     = 2, // The tracer itself
+};
+
+// Not an event, counters kept per-CPU by the probes (see
+// ebpf_event_ctx__read_stats)
+struct ebpf_event_stats {
+    uint64_t emitted;         // Events sent up the ringbuffer
+    uint64_t dropped;         // Events lost because the ringbuffer was full
+    uint64_t ringbuf_backlog; // Bytes not yet consumed, as of the last reserve
+} __attribute__((packed));
+
 #endif // EBPF_EVENTPROBE_EBPFEVENTPROTO_H
@@ -9,15 +9,255 @@
 
 #include "vmlinux.h"
 
+#include <bpf/bpf_core_read.h>
 #include <bpf/bpf_helpers.h>
 
+#include "EbpfEventProto.h"
+#include "Varlen.h"
+
 char LICENSE[] SEC("license") = "Dual BSD/GPL";
 
 struct {
     __uint(type, BPF_MAP_TYPE_RINGBUF);
-    __uint(max_entries, 4096 * 64); // 256KB
+    __uint(max_entries, 4096 * 256); // 1MB
 } ringbuf SEC(".maps");
 
+// Events with variable-length fields are built in here, one per CPU, and
+// copied to the ringbuffer at their actual size, as the size of a ringbuffer
+// reservation has to be known when the probes are loaded. Too large for a
+// per-CPU map, so it's indexed by CPU instead, max_entries is set to the
+// number of possible CPUs by userspace.
+struct ebpf_event_buffer {
+    char data[EVENT_BUFFER_SIZE];
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __type(key, u32);
+    __type(value, struct ebpf_event_buffer);
+    __uint(max_entries, 1);
+} elastic_ebpf_events_event_buffer SEC(".maps");
+
+// Counters describing what's been sent up the ringbuffer, summed across CPUs
+// by userspace in ebpf_event_ctx__read_stats
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, struct ebpf_event_stats);
+    __uint(max_entries, 1);
+} elastic_ebpf_events_stats SEC(".maps");
+
+// Per-CPU event sequence numbers, see struct ebpf_event_header
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, u64);
+    __uint(max_entries, 1);
+} elastic_ebpf_events_subseq SEC(".maps");
+
+// Per-process sequence numbers, see struct ebpf_event_header. Entries are
+// deleted when a process exits, the LRU only kicks in if more processes than
+// this are alive at once, in which case an evicted process' sequence restarts.
+struct ebpf_proc_seq_key {
+    u32 tgid;
+    u64 start_time_ns;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, struct ebpf_proc_seq_key);
+    __type(value, u64);
+    __uint(max_entries, 16384);
+} elastic_ebpf_events_proc_seq SEC(".maps");
+
+// Event types counted in per-process sequences, 0 if they're disabled. Set to
+// the types the consumer subscribed to, as unsubscribed ones are filtered out
+// in userspace and counting them would look like drops.
+u64 proc_seq_events = 0;
+
+static __always_inline void ebpf_proc_seq_key__fill(struct ebpf_proc_seq_key *key,
+                                                    const struct task_struct *task)
+{
+    key->tgid          = BPF_CORE_READ(task, tgid);
+    key->start_time_ns = BPF_CORE_READ(task, group_leader, start_time);
+}
+
+// Not atomic, threads of the same process emitting events at the same time on
+// different CPUs can end up with the same number
+static __always_inline u64 ebpf_proc_seq__next()
+{
+    struct ebpf_proc_seq_key key = {};
+    ebpf_proc_seq_key__fill(&key, (struct task_struct *)bpf_get_current_task());
+
+    u64 *seq = bpf_map_lookup_elem(&elastic_ebpf_events_proc_seq, &key);
+    if (seq)
+        return ++(*seq);
+
+    u64 first = 1;
+    bpf_map_update_elem(&elastic_ebpf_events_proc_seq, &key, &first, BPF_NOEXIST);
+    return first;
+}
+
+static __always_inline void ebpf_proc_seq__del(const struct task_struct *task)
+{
+    struct ebpf_proc_seq_key key = {};
+    ebpf_proc_seq_key__fill(&key, task);
+    bpf_map_delete_elem(&elastic_ebpf_events_proc_seq, &key);
+}
+
+// Processes (by tgid) events are emitted for, if pid_filter_enabled is set.
+// Filled in by userspace (see ebpf_event_ctx__add_filter_pid), processes
+// forked by one of them are added on fork and all are removed on exit.
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, u32);
+    __type(value, u8);
+    __uint(max_entries, 16384);
+} elastic_ebpf_events_pid_filter SEC(".maps");
+
+bool pid_filter_enabled = false;
+
+static __always_inline bool ebpf_pid_filter__allowed()
+{
+    if (!pid_filter_enabled)
+        return true;
+
+    u32 tgid = bpf_get_current_pid_tgid() >> 32;
+    return bpf_map_lookup_elem(&elastic_ebpf_events_pid_filter, &tgid) != NULL;
+}
+
+static __always_inline void ebpf_pid_filter__fork(const struct task_struct *parent,
+                                                  const struct task_struct *child)
+{
+    if (!pid_filter_enabled)
+        return;
+
+    u32 parent_tgid = BPF_CORE_READ(parent, tgid);
+    if (!bpf_map_lookup_elem(&elastic_ebpf_events_pid_filter, &parent_tgid))
+        return;
+
+    u32 child_tgid = BPF_CORE_READ(child, tgid);
+    u8 one         = 1;
+    bpf_map_update_elem(&elastic_ebpf_events_pid_filter, &child_tgid, &one, BPF_ANY);
+}
+
+static __always_inline void ebpf_pid_filter__del(const struct task_struct *task)
+{
+    u32 tgid = BPF_CORE_READ(task, tgid);
+    bpf_map_delete_elem(&elastic_ebpf_events_pid_filter, &tgid);
+}
+
+static __always_inline struct ebpf_event_stats *ebpf_event_stats__get()
+{
+    u32 zero = 0;
+    return bpf_map_lookup_elem(&elastic_ebpf_events_stats, &zero);
+}
+
+static __always_inline void ebpf_event_header__stamp(struct ebpf_event_header *hdr)
+{
+    u32 zero    = 0;
+    u64 *subseq = bpf_map_lookup_elem(&elastic_ebpf_events_subseq, &zero);
+
+    hdr->ts  = bpf_ktime_get_ns();
+    hdr->cpu = bpf_get_smp_processor_id();
+    // The map is per-CPU so a plain increment is enough, except for a probe
+    // firing nested inside another on the same CPU (e.g. from softirq or NMI)
+    // in between the read and the write, which can rarely reuse a subseq.
+    // Atomic fetch-and-add would need kernel 5.12.
+    hdr->subseq   = subseq ? (*subseq)++ : 0;
+    hdr->proc_seq = 0;
+}
+
+// All events should be reserved and submitted with these rather than the raw
+// bpf_ringbuf_* helpers so they're accounted for in the stats. They must be
+// inlined, the verifier doesn't allow returning ringbuf memory from a
+// subprogram.
+//
+// The header's timestamp, CPU and sequence number are all filled in here, so
+// they're taken at the same point for every event and the timestamp and
+// sequence number order events on a CPU the same way. The per-process
+// sequence number is filled in on submit, once the type is known. A failed
+// reserve uses one up regardless of type (it isn't known yet), leaving a gap.
+//
+// Events of processes excluded by the PID filter are never reserved, so
+// they're neither counted as drops nor use up a sequence number.
+static __always_inline void *ebpf_ringbuf_reserve(u64 size)
+{
+    if (!ebpf_pid_filter__allowed())
+        return NULL;
+
+    struct ebpf_event_stats *stats = ebpf_event_stats__get();
+    struct ebpf_event_header *hdr  = bpf_ringbuf_reserve(&ringbuf, size, 0);
+
+    if (stats) {
+        if (!hdr)
+            stats->dropped++;
+        stats->ringbuf_backlog = bpf_ringbuf_query(&ringbuf, BPF_RB_AVAIL_DATA);
+    }
+
+    if (!hdr && proc_seq_events)
+        ebpf_proc_seq__next();
+
+    if (hdr)
+        ebpf_event_header__stamp(hdr);
+
+    return hdr;
+}
+
+static __always_inline void ebpf_ringbuf_submit(void *event)
+{
+    struct ebpf_event_stats *stats = ebpf_event_stats__get();
+    struct ebpf_event_header *hdr  = event;
+
+    if (hdr->type & proc_seq_events)
+        hdr->proc_seq = ebpf_proc_seq__next();
+
+    bpf_ringbuf_submit(event, 0);
+    if (stats)
+        stats->emitted++;
+}
+
+// The equivalents of ebpf_ringbuf_reserve and ebpf_ringbuf_submit for events
+// with variable-length fields, which are built in the event buffer (not
+// zeroed) and copied to the ringbuffer. Only one event can be built on a CPU
+// at a time, so these mustn't be used by probes that can fire nested inside
+// one another.
+static __always_inline void *ebpf_event_buffer__get()
+{
+    if (!ebpf_pid_filter__allowed())
+        return NULL;
+
+    u32 cpu                       = bpf_get_smp_processor_id();
+    struct ebpf_event_header *hdr = bpf_map_lookup_elem(&elastic_ebpf_events_event_buffer, &cpu);
+    if (hdr)
+        ebpf_event_header__stamp(hdr);
+
+    return hdr;
+}
+
+// Sends the first size bytes of the event buffer
+static __always_inline void ebpf_ringbuf_output(void *event, u64 size)
+{
+    struct ebpf_event_stats *stats = ebpf_event_stats__get();
+    struct ebpf_event_header *hdr  = event;
+
+    if (hdr->type & proc_seq_events)
+        hdr->proc_seq = ebpf_proc_seq__next();
+
+    // Never larger, but the verifier can't tell
+    long err = -1;
+    if (size <= sizeof(struct ebpf_event_buffer))
+        err = bpf_ringbuf_output(&ringbuf, event, size, 0);
+
+    if (stats) {
+        if (err)
+            stats->dropped++;
+        else
+            stats->emitted++;
+        stats->ringbuf_backlog = bpf_ringbuf_query(&ringbuf, BPF_RB_AVAIL_DATA);
+    }
+}
+
 #include "File/Probe.bpf.c"
 #include "Network/Probe.bpf.c"
 #include "Process/Probe.bpf.c"
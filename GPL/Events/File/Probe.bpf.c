@@ -10,10 +10,12 @@
 #include "vmlinux.h"
 
 #include <bpf/bpf_core_read.h>
+#include <bpf/bpf_endian.h>
 #include <bpf/bpf_helpers.h>
 #include <bpf/bpf_tracing.h>
 
 #include "Helpers.h"
+#include "Network/Network.h"
 #include "PathResolver.h"
 #include "State.h"
 
@@ -25,6 +27,14 @@ DECL_FUNC_ARG(vfs_rename, old_dentry);
 DECL_FUNC_ARG(vfs_rename, new_dentry);
 DECL_FUNC_RET(vfs_rename);
 DECL_FUNC_ARG_EXISTS(vfs_rename, rd);
+/* vfs_symlink */
+DECL_FUNC_ARG(vfs_symlink, dentry);
+DECL_FUNC_ARG(vfs_symlink, oldname);
+DECL_FUNC_RET(vfs_symlink);
+/* vfs_link */
+DECL_FUNC_ARG(vfs_link, old_dentry);
+DECL_FUNC_ARG(vfs_link, new_dentry);
+DECL_FUNC_RET(vfs_link);
 
 static int mntns(const struct task_struct *task)
 {
@@ -79,6 +89,17 @@ static int mnt_want_write__enter(struct vfsmount *mnt)
         goto out;
     }
 
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_SYMLINK);
+    if (!state)
+        state = ebpf_events_state__get(EBPF_EVENTS_STATE_LINK);
+    if (state) {
+        if (state->link.step != LINK_STATE_INIT)
+            goto out;
+        state->link.mnt  = mnt;
+        state->link.step = LINK_STATE_MOUNT_SET;
+        goto out;
+    }
+
 out:
     return 0;
 }
@@ -95,6 +116,79 @@ int BPF_KPROBE(kprobe__mnt_want_write, struct vfsmount *mnt)
     return mnt_want_write__enter(mnt);
 }
 
+// Files and directories watched for tampering, filled in by userspace (see
+// ebpf_event_ctx__add_tamper_path), with their enum ebpf_tamper_inode_owner.
+// Writes are reported for all of them, unlinks and renames only for the
+// tracer's own. Ignored until it's non-empty.
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, struct ebpf_tamper_inode);
+    __type(value, u8);
+    __uint(max_entries, 256);
+} elastic_ebpf_events_tamper_inodes SEC(".maps");
+
+bool tamper_inodes_watched = false;
+
+// Returns the owner of a watched inode, 0 if it isn't watched
+static u8 tamper_inode__owner(struct inode *inode)
+{
+    struct ebpf_tamper_inode key = {};
+    key.dev                      = BPF_CORE_READ(inode, i_sb, s_dev);
+    key.inode                    = BPF_CORE_READ(inode, i_ino);
+
+    u8 *owner = bpf_map_lookup_elem(&elastic_ebpf_events_tamper_inodes, &key);
+    return owner ? *owner : 0;
+}
+
+// Returns the owner of inode if it's watched, otherwise the owner of dir, the
+// directory it's in. Only direct children of a watched directory are covered.
+static u8 tamper_inode__owner_in(struct inode *inode, struct inode *dir)
+{
+    u8 owner = tamper_inode__owner(inode);
+    return owner ? owner : tamper_inode__owner(dir);
+}
+
+// The tracer managing its own pins and config files isn't tampering, but it
+// writing to security tooling's files is
+static bool tamper_inode__tampered(u8 owner)
+{
+    return owner && !(owner == EBPF_TAMPER_INODE_OWNER_SELF && is_consumer());
+}
+
+// Reserves a SECURITY_TAMPER event for the unlink or rename of inode, if it's
+// one of the tracer's own files or in one of its directories, NULL otherwise.
+// The caller fills in the path and submits it.
+static __always_inline struct ebpf_security_tamper_event *
+security_tamper__self_remove(const struct task_struct *task,
+                             enum ebpf_security_tamper_op op,
+                             struct inode *inode,
+                             struct inode *dir)
+{
+    if (!tamper_inodes_watched || is_kernel_thread(task))
+        return NULL;
+
+    u8 owner = tamper_inode__owner_in(inode, dir);
+    if (owner != EBPF_TAMPER_INODE_OWNER_SELF || !tamper_inode__tampered(owner))
+        return NULL;
+
+    struct ebpf_security_tamper_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        return NULL;
+
+    event->hdr.type = EBPF_EVENT_SECURITY_TAMPER;
+    event->op       = op;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+    event->dev   = BPF_CORE_READ(inode, i_sb, s_dev);
+    event->inode = BPF_CORE_READ(inode, i_ino);
+
+    event->target_pid     = 0;
+    event->target_comm[0] = '\0';
+    event->signal         = 0;
+
+    return event;
+}
+
 static int vfs_unlink__exit(int ret)
 {
     if (ret != 0)
@@ -106,26 +200,48 @@ static int vfs_unlink__exit(int ret)
         goto out;
     }
 
+    if (ebpf_events_paused())
+        goto out;
+
     struct task_struct *task = (struct task_struct *)bpf_get_current_task();
 
-    struct ebpf_file_delete_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    struct path p;
+    p.dentry = &state->unlink.de;
+    p.mnt    = state->unlink.mnt;
+
+    struct ebpf_security_tamper_event *tamper =
+        security_tamper__self_remove(task, EBPF_SECURITY_TAMPER_OP_SELF_UNLINK,
+                                     state->unlink.de.d_inode,
+                                     BPF_CORE_READ(state->unlink.de.d_parent, d_inode));
+    if (tamper) {
+        ebpf_resolve_path_to_string(tamper->path, &p, task);
+        ebpf_ringbuf_submit(tamper);
+    }
+
+    struct ebpf_file_delete_event *event = ebpf_event_buffer__get();
     if (!event) {
-        bpf_printk("vfs_unlink__exit: failed to reserve event\n");
+        bpf_printk("vfs_unlink__exit: failed to get event buffer\n");
         goto out;
     }
 
     event->hdr.type = EBPF_EVENT_FILE_DELETE;
-    event->hdr.ts   = bpf_ktime_get_ns();
+    ebpf_vl_fields__init(&event->vl_fields);
     ebpf_pid_info__fill(&event->pids, task);
-
-    struct path p;
-    p.dentry = &state->unlink.de;
-    p.mnt    = state->unlink.mnt;
     ebpf_resolve_path_to_string(event->path, &p, task);
+    ebpf_root_path__fill(&event->vl_fields, task);
+    ebpf_pids_ss_cgroup_path__fill(&event->vl_fields, task);
     event->mntns = mntns(task);
     bpf_get_current_comm(event->comm, TASK_COMM_LEN);
 
-    bpf_ringbuf_submit(event, 0);
+    // do_unlinkat holds a reference to the inode until after vfs_unlink, the
+    // link count has already been dropped by now
+    struct inode *inode = state->unlink.de.d_inode;
+    event->dev          = BPF_CORE_READ(inode, i_sb, s_dev);
+    event->inode        = BPF_CORE_READ(inode, i_ino);
+    event->size         = BPF_CORE_READ(inode, i_size);
+    event->is_last_link = BPF_CORE_READ(inode, i_nlink) == 0;
+
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
 
     // Certain filesystems (eg. overlayfs) call vfs_unlink twice during the same
     // execution context.
@@ -186,7 +302,136 @@ int BPF_KPROBE(kprobe__vfs_unlink)
     return vfs_unlink__enter(de);
 }
 
-static int do_filp_open__exit(struct file *f)
+// Device files and directories of device files watched for opens (see
+// ebpf_event_ctx__add_device_path). Opens are ignored until it's non-empty.
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, struct ebpf_device_inode);
+    __type(value, u8);
+    __uint(max_entries, 256);
+} elastic_ebpf_events_device_inodes SEC(".maps");
+
+bool device_inodes_watched = false;
+
+static u8 *device_inode__class(struct inode *inode)
+{
+    struct ebpf_device_inode key = {};
+    key.dev                      = BPF_CORE_READ(inode, i_sb, s_dev);
+    key.inode                    = BPF_CORE_READ(inode, i_ino);
+
+    return bpf_map_lookup_elem(&elastic_ebpf_events_device_inodes, &key);
+}
+
+static void device_access__open(struct file *f)
+{
+    if (!device_inodes_watched)
+        return;
+
+    // Only direct children of a watched directory are covered
+    struct inode *inode = BPF_CORE_READ(f, f_inode);
+    u8 *device_class    = device_inode__class(inode);
+    if (!device_class)
+        device_class = device_inode__class(BPF_CORE_READ(f, f_path.dentry, d_parent, d_inode));
+    if (!device_class)
+        return;
+
+    struct ebpf_device_access_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        return;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct path p            = BPF_CORE_READ(f, f_path);
+
+    event->hdr.type     = EBPF_EVENT_DEVICE_ACCESS;
+    event->device_class = *device_class;
+    event->flags        = BPF_CORE_READ(f, f_flags);
+    event->rdev         = BPF_CORE_READ(inode, i_rdev);
+    ebpf_resolve_path_to_string(event->path, &p, task);
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+}
+
+// Opens are only reported if set from userspace, see
+// ebpf_event_ctx__set_trace_opens. There are far too many of them otherwise.
+bool trace_opens = false;
+
+// Path prefixes opens are reported under (see
+// ebpf_event_ctx__add_open_path_prefix). Every path is while it's empty.
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __type(key, struct ebpf_open_path_prefix);
+    __type(value, u8);
+    __uint(max_entries, 256);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+} elastic_ebpf_events_open_path_prefixes SEC(".maps");
+
+bool open_path_prefixes_set = false;
+
+// The path of an open being considered and its lookup key for
+// elastic_ebpf_events_open_path_prefixes, too big for the stack. Most opens
+// aren't under a prefix, so the path is resolved here rather than straight
+// into a ringbuffer record that would then mostly be discarded.
+struct file_open_scratch {
+    struct ebpf_open_path_prefix key;
+    char path[PATH_MAX];
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, struct file_open_scratch);
+    __uint(max_entries, 1);
+} elastic_ebpf_events_open_path_scratch SEC(".maps");
+
+static bool file_open__path_allowed(struct file_open_scratch *ss)
+{
+    if (!open_path_prefixes_set)
+        return true;
+
+    // The longest prefix matching all of the path, which is NUL-terminated so
+    // a prefix longer than it can't match
+    ss->key.prefixlen = sizeof(ss->key.path) * 8;
+    bpf_probe_read_kernel_str(ss->key.path, sizeof(ss->key.path), ss->path);
+
+    return bpf_map_lookup_elem(&elastic_ebpf_events_open_path_prefixes, &ss->key) != NULL;
+}
+
+static void file_open__open(struct file *f, u32 flags, u32 mode)
+{
+    if (!trace_opens)
+        return;
+
+    struct file_open_scratch *ss;
+    u32 zero = 0;
+    if (!(ss = bpf_map_lookup_elem(&elastic_ebpf_events_open_path_scratch, &zero)))
+        return;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct path p            = BPF_CORE_READ(f, f_path);
+    ebpf_resolve_path_to_string(ss->path, &p, task);
+
+    if (!file_open__path_allowed(ss))
+        return;
+
+    struct ebpf_file_open_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        return;
+
+    event->hdr.type = EBPF_EVENT_FILE_OPEN;
+    event->flags    = flags;
+    event->mode     = mode & 07777; // Without the S_IFREG added when creating
+    bpf_probe_read_kernel_str(event->path, sizeof(event->path), ss->path);
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+}
+
+// open_flags are the O_* flags and mode the file was opened with, f_flags
+// has already had O_CREAT, O_TRUNC, O_EXCL and O_NOCTTY cleared
+static int do_filp_open__exit(struct file *f, u32 open_flags, u32 mode)
 {
     /*
     'ret' fields such f_mode and f_path should be obtained via BPF_CORE_READ
@@ -194,29 +439,37 @@ static int do_filp_open__exit(struct file *f)
     Read more: github.com/torvalds/linux/commit/588a25e92458c6efeb7a261d5ca5726f5de89184
     */
 
-    if (IS_ERR_OR_NULL(f))
+    if (IS_ERR_OR_NULL(f) || ebpf_events_paused())
         goto out;
 
     fmode_t fmode = BPF_CORE_READ(f, f_mode);
     if (fmode & (fmode_t)0x100000) // FMODE_CREATED
     {
-        struct ebpf_file_create_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+        struct ebpf_file_create_event *event = ebpf_event_buffer__get();
         if (!event)
             goto out;
 
         event->hdr.type = EBPF_EVENT_FILE_CREATE;
-        event->hdr.ts   = bpf_ktime_get_ns();
+        ebpf_vl_fields__init(&event->vl_fields);
 
         struct task_struct *task = (struct task_struct *)bpf_get_current_task();
         struct path p            = BPF_CORE_READ(f, f_path);
         ebpf_resolve_path_to_string(event->path, &p, task);
+        ebpf_root_path__fill(&event->vl_fields, task);
+        ebpf_pids_ss_cgroup_path__fill(&event->vl_fields, task);
         ebpf_pid_info__fill(&event->pids, task);
         event->mntns = mntns(task);
         bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+        event->dev              = BPF_CORE_READ(f, f_inode, i_sb, s_dev);
+        event->inode            = BPF_CORE_READ(f, f_inode, i_ino);
+        event->inode_generation = BPF_CORE_READ(f, f_inode, i_generation);
 
-        bpf_ringbuf_submit(event, 0);
+        ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
     }
 
+    device_access__open(f);
+    file_open__open(f, open_flags, mode);
+
 out:
     return 0;
 }
@@ -228,19 +481,50 @@ int BPF_PROG(fexit__do_filp_open,
              const struct open_flags *op,
              struct file *ret)
 {
-    return do_filp_open__exit(ret);
+    return do_filp_open__exit(ret, BPF_CORE_READ(op, open_flag), BPF_CORE_READ(op, mode));
+}
+
+// The open_flags aren't available anymore on return, so they're kept in the
+// state for the kretprobe
+SEC("kprobe/do_filp_open")
+int BPF_KPROBE(kprobe__do_filp_open,
+               int dfd,
+               struct filename *pathname,
+               const struct open_flags *op)
+{
+    if (!trace_opens)
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.file_open.flags          = BPF_CORE_READ(op, open_flag);
+    state.file_open.mode           = BPF_CORE_READ(op, mode);
+    ebpf_events_state__set(EBPF_EVENTS_STATE_FILE_OPEN, &state);
+
+out:
+    return 0;
 }
 
 SEC("kretprobe/do_filp_open")
 int BPF_KRETPROBE(kretprobe__do_filp_open, struct file *ret)
 {
-    return do_filp_open__exit(ret);
+    u32 flags = 0;
+    u32 mode  = 0;
+
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_FILE_OPEN);
+    if (state) {
+        flags = state->file_open.flags;
+        mode  = state->file_open.mode;
+        ebpf_events_state__del(EBPF_EVENTS_STATE_FILE_OPEN);
+    }
+
+    return do_filp_open__exit(ret, flags, mode);
 }
 
-static int do_renameat2__enter()
+static int do_renameat2__enter(u32 flags)
 {
     struct ebpf_events_state state = {};
     state.rename.step              = RENAME_STATE_INIT;
+    state.rename.flags             = flags;
     ebpf_events_state__set(EBPF_EVENTS_STATE_RENAME, &state);
 
     u32 zero = 0;
@@ -255,15 +539,25 @@ out:
 }
 
 SEC("fentry/do_renameat2")
-int BPF_PROG(fentry__do_renameat2)
+int BPF_PROG(fentry__do_renameat2,
+             int olddfd,
+             void *from,
+             int newdfd,
+             void *to,
+             unsigned int flags)
 {
-    return do_renameat2__enter();
+    return do_renameat2__enter(flags);
 }
 
 SEC("kprobe/do_renameat2")
-int BPF_KPROBE(kprobe__do_renameat2)
+int BPF_KPROBE(kprobe__do_renameat2,
+               int olddfd,
+               void *from,
+               int newdfd,
+               void *to,
+               unsigned int flags)
 {
-    return do_renameat2__enter();
+    return do_renameat2__enter(flags);
 }
 
 static int vfs_rename__enter(struct dentry *old_dentry, struct dentry *new_dentry)
@@ -290,7 +584,11 @@ static int vfs_rename__enter(struct dentry *old_dentry, struct dentry *new_dentr
     p.dentry = new_dentry;
     ebpf_resolve_path_to_string(ss->rename.new_path, &p, task);
 
-    state->rename.step = RENAME_STATE_PATHS_SET;
+    state->rename.cross_directory =
+        BPF_CORE_READ(old_dentry, d_parent) != BPF_CORE_READ(new_dentry, d_parent);
+    state->rename.old_inode = BPF_CORE_READ(old_dentry, d_inode);
+    state->rename.old_dir   = BPF_CORE_READ(old_dentry, d_parent, d_inode);
+    state->rename.step      = RENAME_STATE_PATHS_SET;
 
 out:
     return 0;
@@ -361,21 +659,36 @@ static int vfs_rename__exit(int ret)
         goto out;
     }
 
-    struct ebpf_file_rename_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
-    if (!event)
+    if (ebpf_events_paused())
         goto out;
 
     struct task_struct *task = (struct task_struct *)bpf_get_current_task();
 
+    struct ebpf_security_tamper_event *tamper =
+        security_tamper__self_remove(task, EBPF_SECURITY_TAMPER_OP_SELF_RENAME,
+                                     state->rename.old_inode, state->rename.old_dir);
+    if (tamper) {
+        bpf_probe_read_kernel_str(tamper->path, PATH_MAX, ss->rename.old_path);
+        ebpf_ringbuf_submit(tamper);
+    }
+
+    struct ebpf_file_rename_event *event = ebpf_event_buffer__get();
+    if (!event)
+        goto out;
+
     event->hdr.type = EBPF_EVENT_FILE_RENAME;
-    event->hdr.ts   = bpf_ktime_get_ns();
+    ebpf_vl_fields__init(&event->vl_fields);
     ebpf_pid_info__fill(&event->pids, task);
     bpf_probe_read_kernel_str(event->old_path, PATH_MAX_BUF, ss->rename.old_path);
     bpf_probe_read_kernel_str(event->new_path, PATH_MAX_BUF, ss->rename.new_path);
-    event->mntns = mntns(task);
+    ebpf_root_path__fill(&event->vl_fields, task);
+    ebpf_pids_ss_cgroup_path__fill(&event->vl_fields, task);
+    event->mntns           = mntns(task);
+    event->cross_directory = state->rename.cross_directory;
+    event->flags           = state->rename.flags;
     bpf_get_current_comm(event->comm, TASK_COMM_LEN);
 
-    bpf_ringbuf_submit(event, 0);
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
 
     // Certain filesystems (eg. overlayfs) call vfs_rename twice during the same
     // execution context.
@@ -398,3 +711,771 @@ int BPF_KRETPROBE(kretprobe__vfs_rename, int ret)
 {
     return vfs_rename__exit(ret);
 }
+
+static int link__enter(enum ebpf_events_state_op op)
+{
+    struct ebpf_events_state state = {};
+    state.link.step                = LINK_STATE_INIT;
+    ebpf_events_state__set(op, &state);
+
+    u32 zero = 0;
+    struct ebpf_events_scratch_space *ss =
+        bpf_map_lookup_elem(&elastic_ebpf_events_init_buffer, &zero);
+    if (!ss)
+        goto out;
+    ebpf_events_scratch_space__set(op, ss);
+
+out:
+    return 0;
+}
+
+SEC("fentry/do_symlinkat")
+int BPF_PROG(fentry__do_symlinkat)
+{
+    return link__enter(EBPF_EVENTS_STATE_SYMLINK);
+}
+
+SEC("kprobe/do_symlinkat")
+int BPF_KPROBE(kprobe__do_symlinkat)
+{
+    return link__enter(EBPF_EVENTS_STATE_SYMLINK);
+}
+
+SEC("fentry/do_linkat")
+int BPF_PROG(fentry__do_linkat)
+{
+    return link__enter(EBPF_EVENTS_STATE_LINK);
+}
+
+SEC("kprobe/do_linkat")
+int BPF_KPROBE(kprobe__do_linkat)
+{
+    return link__enter(EBPF_EVENTS_STATE_LINK);
+}
+
+// For symlinks, target_dentry is NULL and target the string the link points
+// to. For hardlinks, target_dentry is the existing file, on the same mount as
+// the link.
+static int vfs_link__enter(enum ebpf_events_state_op op,
+                           const char *target,
+                           struct dentry *target_dentry,
+                           struct dentry *link_dentry)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(op);
+    if (!state || state->link.step != LINK_STATE_MOUNT_SET) {
+        // Omit logging as this happens in the happy path.
+        goto out;
+    }
+
+    struct ebpf_events_scratch_space *ss = ebpf_events_scratch_space__get(op);
+    if (!ss) {
+        bpf_printk("vfs_link__enter: scratch space missing\n");
+        goto out;
+    }
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    struct path p;
+    p.mnt = state->link.mnt;
+    if (target_dentry) {
+        p.dentry = target_dentry;
+        ebpf_resolve_path_to_string(ss->link.target_path, &p, task);
+    } else {
+        bpf_probe_read_kernel_str(ss->link.target_path, PATH_MAX, target);
+    }
+    p.dentry = link_dentry;
+    ebpf_resolve_path_to_string(ss->link.link_path, &p, task);
+
+    state->link.step = LINK_STATE_PATHS_SET;
+
+out:
+    return 0;
+}
+
+static int vfs_link__exit(enum ebpf_events_state_op op, enum ebpf_event_type type, int ret)
+{
+    if (ret)
+        goto out;
+
+    struct ebpf_events_state *state = ebpf_events_state__get(op);
+    if (!state || state->link.step != LINK_STATE_PATHS_SET) {
+        // Omit logging as this happens in the happy path.
+        goto out;
+    }
+
+    struct ebpf_events_scratch_space *ss = ebpf_events_scratch_space__get(op);
+    if (!ss) {
+        bpf_printk("vfs_link__exit: scratch space missing\n");
+        goto out;
+    }
+
+    if (ebpf_events_paused())
+        goto out;
+
+    struct ebpf_file_link_event *event = ebpf_event_buffer__get();
+    if (!event)
+        goto out;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type = type;
+    ebpf_vl_fields__init(&event->vl_fields);
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_probe_read_kernel_str(event->target_path, PATH_MAX_BUF, ss->link.target_path);
+    bpf_probe_read_kernel_str(event->link_path, PATH_MAX_BUF, ss->link.link_path);
+    ebpf_root_path__fill(&event->vl_fields, task);
+    event->mntns = mntns(task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
+
+    // Like vfs_rename, vfs_symlink and vfs_link can be called twice in the
+    // same execution context on overlayfs
+    ebpf_events_state__del(op);
+
+out:
+    return 0;
+}
+
+SEC("fentry/vfs_symlink")
+int BPF_PROG(fentry__vfs_symlink)
+{
+    struct dentry *dentry = FUNC_ARG_READ(___type(dentry), vfs_symlink, dentry);
+    const char *oldname   = FUNC_ARG_READ(___type(oldname), vfs_symlink, oldname);
+    return vfs_link__enter(EBPF_EVENTS_STATE_SYMLINK, oldname, NULL, dentry);
+}
+
+SEC("kprobe/vfs_symlink")
+int BPF_KPROBE(kprobe__vfs_symlink)
+{
+    struct dentry *dentry;
+    const char *oldname;
+
+    if (FUNC_ARG_READ_PTREGS_NODEREF(dentry, vfs_symlink, dentry)) {
+        bpf_printk("kprobe__vfs_symlink: error reading dentry\n");
+        return 0;
+    }
+    if (FUNC_ARG_READ_PTREGS_NODEREF(oldname, vfs_symlink, oldname)) {
+        bpf_printk("kprobe__vfs_symlink: error reading oldname\n");
+        return 0;
+    }
+
+    return vfs_link__enter(EBPF_EVENTS_STATE_SYMLINK, oldname, NULL, dentry);
+}
+
+SEC("fexit/vfs_symlink")
+int BPF_PROG(fexit__vfs_symlink)
+{
+    int ret = FUNC_RET_READ(___type(ret), vfs_symlink);
+    return vfs_link__exit(EBPF_EVENTS_STATE_SYMLINK, EBPF_EVENT_FILE_SYMLINK, ret);
+}
+
+SEC("kretprobe/vfs_symlink")
+int BPF_KRETPROBE(kretprobe__vfs_symlink, int ret)
+{
+    return vfs_link__exit(EBPF_EVENTS_STATE_SYMLINK, EBPF_EVENT_FILE_SYMLINK, ret);
+}
+
+SEC("fentry/vfs_link")
+int BPF_PROG(fentry__vfs_link)
+{
+    struct dentry *old_dentry = FUNC_ARG_READ(___type(old_dentry), vfs_link, old_dentry);
+    struct dentry *new_dentry = FUNC_ARG_READ(___type(new_dentry), vfs_link, new_dentry);
+    return vfs_link__enter(EBPF_EVENTS_STATE_LINK, NULL, old_dentry, new_dentry);
+}
+
+SEC("kprobe/vfs_link")
+int BPF_KPROBE(kprobe__vfs_link)
+{
+    struct dentry *old_dentry, *new_dentry;
+
+    if (FUNC_ARG_READ_PTREGS_NODEREF(old_dentry, vfs_link, old_dentry)) {
+        bpf_printk("kprobe__vfs_link: error reading old_dentry\n");
+        return 0;
+    }
+    if (FUNC_ARG_READ_PTREGS_NODEREF(new_dentry, vfs_link, new_dentry)) {
+        bpf_printk("kprobe__vfs_link: error reading new_dentry\n");
+        return 0;
+    }
+
+    return vfs_link__enter(EBPF_EVENTS_STATE_LINK, NULL, old_dentry, new_dentry);
+}
+
+SEC("fexit/vfs_link")
+int BPF_PROG(fexit__vfs_link)
+{
+    int ret = FUNC_RET_READ(___type(ret), vfs_link);
+    return vfs_link__exit(EBPF_EVENTS_STATE_LINK, EBPF_EVENT_FILE_HARDLINK, ret);
+}
+
+SEC("kretprobe/vfs_link")
+int BPF_KRETPROBE(kretprobe__vfs_link, int ret)
+{
+    return vfs_link__exit(EBPF_EVENTS_STATE_LINK, EBPF_EVENT_FILE_HARDLINK, ret);
+}
+
+// linux/mount.h, mount() flags for which the filesystem type is ignored
+#define MS_REMOUNT 32
+#define MS_BIND 4096
+#define MS_MOVE 8192
+#define MS_UNBINDABLE (1 << 17)
+#define MS_PRIVATE (1 << 18)
+#define MS_SLAVE (1 << 19)
+#define MS_SHARED (1 << 20)
+
+// path_mount and path_umount back mount() and umount2() once the mount point
+// has been looked up. The paths are resolved on entry as the umounted mount
+// is gone by the time path_umount returns.
+static int mount__enter(enum ebpf_events_state_op op,
+                        const char *source,
+                        struct path *path,
+                        const char *fs_type,
+                        u64 flags)
+{
+    u32 zero = 0;
+    struct ebpf_events_scratch_space *ss =
+        bpf_map_lookup_elem(&elastic_ebpf_events_init_buffer, &zero);
+    if (!ss)
+        goto out;
+    ebpf_events_scratch_space__set(op, ss);
+
+    ss = ebpf_events_scratch_space__get(op);
+    if (!ss)
+        goto out;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    ebpf_resolve_path_to_string(ss->mount.destination, path, task);
+
+    if (op == EBPF_EVENTS_STATE_UMOUNT) {
+        struct vfsmount *vfsmnt = BPF_CORE_READ(path, mnt);
+        struct mount *mnt       = container_of(vfsmnt, struct mount, mnt);
+        source                  = BPF_CORE_READ(mnt, mnt_devname);
+        fs_type                 = BPF_CORE_READ(vfsmnt, mnt_sb, s_type, name);
+    } else if (flags & (MS_REMOUNT | MS_BIND | MS_MOVE | MS_UNBINDABLE | MS_PRIVATE | MS_SLAVE |
+                        MS_SHARED)) {
+        fs_type = NULL;
+    }
+    if (source)
+        bpf_probe_read_kernel_str(ss->mount.source, sizeof(ss->mount.source), source);
+    if (fs_type)
+        bpf_probe_read_kernel_str(ss->mount.fs_type, sizeof(ss->mount.fs_type), fs_type);
+
+    struct ebpf_events_state state = {};
+    state.mount.flags              = flags;
+    ebpf_events_state__set(op, &state);
+
+out:
+    return 0;
+}
+
+static int mount__exit(enum ebpf_events_state_op op, enum ebpf_event_type type, int ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(op);
+    if (!state)
+        goto out;
+
+    if (ret || ebpf_events_paused())
+        goto out_del;
+
+    struct ebpf_events_scratch_space *ss = ebpf_events_scratch_space__get(op);
+    if (!ss) {
+        bpf_printk("mount__exit: scratch space missing\n");
+        goto out_del;
+    }
+
+    struct ebpf_fs_mount_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type = type;
+    event->flags    = state->mount.flags;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_probe_read_kernel_str(event->source, sizeof(event->source), ss->mount.source);
+    bpf_probe_read_kernel_str(event->destination, PATH_MAX_BUF, ss->mount.destination);
+    bpf_probe_read_kernel_str(event->fs_type, sizeof(event->fs_type), ss->mount.fs_type);
+    event->mntns = mntns(task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(op);
+out:
+    return 0;
+}
+
+SEC("fentry/path_mount")
+int BPF_PROG(fentry__path_mount,
+             const char *dev_name,
+             struct path *path,
+             const char *type_page,
+             unsigned long flags)
+{
+    return mount__enter(EBPF_EVENTS_STATE_MOUNT, dev_name, path, type_page, flags);
+}
+
+SEC("fexit/path_mount")
+int BPF_PROG(fexit__path_mount,
+             const char *dev_name,
+             struct path *path,
+             const char *type_page,
+             unsigned long flags,
+             void *data_page,
+             int ret)
+{
+    return mount__exit(EBPF_EVENTS_STATE_MOUNT, EBPF_EVENT_FS_MOUNT, ret);
+}
+
+SEC("kprobe/path_mount")
+int BPF_KPROBE(kprobe__path_mount,
+               const char *dev_name,
+               struct path *path,
+               const char *type_page,
+               unsigned long flags)
+{
+    return mount__enter(EBPF_EVENTS_STATE_MOUNT, dev_name, path, type_page, flags);
+}
+
+SEC("kretprobe/path_mount")
+int BPF_KRETPROBE(kretprobe__path_mount, int ret)
+{
+    return mount__exit(EBPF_EVENTS_STATE_MOUNT, EBPF_EVENT_FS_MOUNT, ret);
+}
+
+SEC("fentry/path_umount")
+int BPF_PROG(fentry__path_umount, struct path *path, int flags)
+{
+    return mount__enter(EBPF_EVENTS_STATE_UMOUNT, NULL, path, NULL, flags);
+}
+
+SEC("fexit/path_umount")
+int BPF_PROG(fexit__path_umount, struct path *path, int flags, int ret)
+{
+    return mount__exit(EBPF_EVENTS_STATE_UMOUNT, EBPF_EVENT_FS_UMOUNT, ret);
+}
+
+SEC("kprobe/path_umount")
+int BPF_KPROBE(kprobe__path_umount, struct path *path, int flags)
+{
+    return mount__enter(EBPF_EVENTS_STATE_UMOUNT, NULL, path, NULL, flags);
+}
+
+SEC("kretprobe/path_umount")
+int BPF_KRETPROBE(kretprobe__path_umount, int ret)
+{
+    return mount__exit(EBPF_EVENTS_STATE_UMOUNT, EBPF_EVENT_FS_UMOUNT, ret);
+}
+
+// chmod_common and chown_common back all the chmod and chown variants, after
+// the path (or fd) has been resolved
+static int modify_attr__enter(enum ebpf_file_modify_attr_change change, const struct path *path)
+{
+    struct inode *inode = BPF_CORE_READ(path, dentry, d_inode);
+
+    struct ebpf_events_state state = {};
+    state.modify_attr.change       = change;
+    state.modify_attr.path         = path;
+    state.modify_attr.old_mode     = BPF_CORE_READ(inode, i_mode) & 07777;
+    state.modify_attr.old_uid      = BPF_CORE_READ(inode, i_uid.val);
+    state.modify_attr.old_gid      = BPF_CORE_READ(inode, i_gid.val);
+    ebpf_events_state__set(EBPF_EVENTS_STATE_MODIFY_ATTR, &state);
+
+    return 0;
+}
+
+static int modify_attr__exit(int ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MODIFY_ATTR);
+    if (!state)
+        goto out;
+
+    if (ret || ebpf_events_paused())
+        goto out_del;
+
+    struct ebpf_file_modify_attr_event *event = ebpf_event_buffer__get();
+    if (!event)
+        goto out_del;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct path p;
+    bpf_core_read(&p, sizeof(p), state->modify_attr.path);
+    struct inode *inode = BPF_CORE_READ(&p, dentry, d_inode);
+
+    event->hdr.type = EBPF_EVENT_FILE_MODIFY_ATTR;
+    ebpf_vl_fields__init(&event->vl_fields);
+    event->change   = state->modify_attr.change;
+    event->old_mode = state->modify_attr.old_mode;
+    event->new_mode = BPF_CORE_READ(inode, i_mode) & 07777;
+    event->old_uid  = state->modify_attr.old_uid;
+    event->new_uid  = BPF_CORE_READ(inode, i_uid.val);
+    event->old_gid  = state->modify_attr.old_gid;
+    event->new_gid  = BPF_CORE_READ(inode, i_gid.val);
+    ebpf_pid_info__fill(&event->pids, task);
+    ebpf_resolve_path_to_string(event->path, &p, task);
+    ebpf_root_path__fill(&event->vl_fields, task);
+    event->mntns = mntns(task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_MODIFY_ATTR);
+out:
+    return 0;
+}
+
+SEC("fentry/chmod_common")
+int BPF_PROG(fentry__chmod_common, const struct path *path)
+{
+    return modify_attr__enter(EBPF_FILE_MODIFY_ATTR_CHANGE_MODE, path);
+}
+
+SEC("fexit/chmod_common")
+int BPF_PROG(fexit__chmod_common, const struct path *path, umode_t mode, int ret)
+{
+    return modify_attr__exit(ret);
+}
+
+SEC("kprobe/chmod_common")
+int BPF_KPROBE(kprobe__chmod_common, const struct path *path)
+{
+    return modify_attr__enter(EBPF_FILE_MODIFY_ATTR_CHANGE_MODE, path);
+}
+
+SEC("kretprobe/chmod_common")
+int BPF_KRETPROBE(kretprobe__chmod_common, int ret)
+{
+    return modify_attr__exit(ret);
+}
+
+SEC("fentry/chown_common")
+int BPF_PROG(fentry__chown_common, const struct path *path)
+{
+    return modify_attr__enter(EBPF_FILE_MODIFY_ATTR_CHANGE_OWNER, path);
+}
+
+SEC("fexit/chown_common")
+int BPF_PROG(fexit__chown_common, const struct path *path, uid_t user, gid_t group, int ret)
+{
+    return modify_attr__exit(ret);
+}
+
+SEC("kprobe/chown_common")
+int BPF_KPROBE(kprobe__chown_common, const struct path *path)
+{
+    return modify_attr__enter(EBPF_FILE_MODIFY_ATTR_CHANGE_OWNER, path);
+}
+
+SEC("kretprobe/chown_common")
+int BPF_KRETPROBE(kretprobe__chown_common, int ret)
+{
+    return modify_attr__exit(ret);
+}
+
+// linux/stat.h
+#define S_IFMT 00170000
+#define S_IFSOCK 0140000
+#define S_IFIFO 0010000
+
+static struct file *fd_to_file(const struct task_struct *task, int fd)
+{
+    struct file *f      = NULL;
+    struct fdtable *fdt = BPF_CORE_READ(task, files, fdt);
+
+    if (fd < 0 || fd >= BPF_CORE_READ(fdt, max_fds))
+        goto out;
+
+    struct file **fds = BPF_CORE_READ(fdt, fd);
+    bpf_core_read(&f, sizeof(f), &fds[fd]);
+
+out:
+    return f;
+}
+
+static void file_copy_endpoint__fill(struct ebpf_file_copy_endpoint *ep,
+                                     char *path,
+                                     struct file *f,
+                                     const struct task_struct *task)
+{
+    umode_t mode = BPF_CORE_READ(f, f_inode, i_mode);
+
+    path[0]   = '\0';
+    ep->inode = BPF_CORE_READ(f, f_inode, i_ino);
+
+    switch (mode & S_IFMT) {
+    case S_IFIFO:
+        ep->type = EBPF_FILE_COPY_ENDPOINT_PIPE;
+        break;
+    case S_IFSOCK: {
+        struct socket *sock = BPF_CORE_READ(f, private_data);
+        struct sock *sk     = BPF_CORE_READ(sock, sk);
+
+        ep->type = EBPF_FILE_COPY_ENDPOINT_SOCKET;
+        // Only TCP sockets are supported by ebpf_sock_info__fill, leave the
+        // transport zeroed for anything else (e.g. AF_UNIX) so userspace knows
+        // there's no network info
+        if (!sk || ebpf_sock_info__fill(&ep->net, sk))
+            ep->net.transport = 0;
+        break;
+    }
+    default: {
+        struct path p = BPF_CORE_READ(f, f_path);
+
+        ep->type = EBPF_FILE_COPY_ENDPOINT_FILE;
+        ebpf_resolve_path_to_string(path, &p, task);
+        break;
+    }
+    }
+}
+
+static int file_copy__enter(enum ebpf_file_copy_syscall syscall, int fd_in, int fd_out)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.file_copy.syscall        = syscall;
+    state.file_copy.fd_in          = fd_in;
+    state.file_copy.fd_out         = fd_out;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_FILE_COPY, &state);
+
+out:
+    return 0;
+}
+
+static int file_copy__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_FILE_COPY);
+    if (!state)
+        goto out;
+
+    // Nothing was moved on errors or an empty copy, don't bother
+    if (ret <= 0)
+        goto out_del;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct file *in          = fd_to_file(task, state->file_copy.fd_in);
+    struct file *out         = fd_to_file(task, state->file_copy.fd_out);
+    if (!in || !out)
+        goto out_del;
+
+    struct ebpf_file_copy_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    event->hdr.type = EBPF_EVENT_FILE_COPY;
+    ebpf_pid_info__fill(&event->pids, task);
+    event->syscall = state->file_copy.syscall;
+    event->bytes   = ret;
+    file_copy_endpoint__fill(&event->source, event->source_path, in, task);
+    file_copy_endpoint__fill(&event->destination, event->destination_path, out, task);
+    event->mntns = mntns(task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_FILE_COPY);
+out:
+    return 0;
+}
+
+// The fds are only available on syscall entry and the number of bytes moved
+// only on exit, so stash the fds in between. Hooking the syscalls rather than
+// do_splice_direct and friends also keeps kernel-internal copies (e.g.
+// overlayfs copy-up) from being reported.
+SEC("tracepoint/syscalls/sys_enter_sendfile64")
+int tracepoint_syscalls_sys_enter_sendfile64(struct trace_event_raw_sys_enter *args)
+{
+    // sendfile(out_fd, in_fd, offset, count)
+    return file_copy__enter(EBPF_FILE_COPY_SYSCALL_SENDFILE, BPF_CORE_READ(args, args[1]),
+                            BPF_CORE_READ(args, args[0]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_sendfile64")
+int tracepoint_syscalls_sys_exit_sendfile64(struct trace_event_raw_sys_exit *args)
+{
+    return file_copy__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_splice")
+int tracepoint_syscalls_sys_enter_splice(struct trace_event_raw_sys_enter *args)
+{
+    // splice(fd_in, off_in, fd_out, off_out, len, flags)
+    return file_copy__enter(EBPF_FILE_COPY_SYSCALL_SPLICE, BPF_CORE_READ(args, args[0]),
+                            BPF_CORE_READ(args, args[2]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_splice")
+int tracepoint_syscalls_sys_exit_splice(struct trace_event_raw_sys_exit *args)
+{
+    return file_copy__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_copy_file_range")
+int tracepoint_syscalls_sys_enter_copy_file_range(struct trace_event_raw_sys_enter *args)
+{
+    // copy_file_range(fd_in, off_in, fd_out, off_out, len, flags)
+    return file_copy__enter(EBPF_FILE_COPY_SYSCALL_COPY_FILE_RANGE, BPF_CORE_READ(args, args[0]),
+                            BPF_CORE_READ(args, args[2]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_copy_file_range")
+int tracepoint_syscalls_sys_exit_copy_file_range(struct trace_event_raw_sys_exit *args)
+{
+    return file_copy__exit(BPF_CORE_READ(args, ret));
+}
+
+static int truncate__enter(enum ebpf_file_truncate_syscall syscall, struct path *path, u64 length)
+{
+    struct ebpf_events_state state = {};
+    state.truncate.syscall         = syscall;
+    state.truncate.path            = *path;
+    state.truncate.old_size        = BPF_CORE_READ(path->dentry, d_inode, i_size);
+    state.truncate.new_size        = length;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_TRUNCATE, &state);
+    return 0;
+}
+
+static int truncate__exit(int ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_TRUNCATE);
+    if (!state)
+        goto out;
+
+    if (ret || ebpf_events_paused())
+        goto out_del;
+
+    struct ebpf_file_truncate_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    event->hdr.type          = EBPF_EVENT_FILE_TRUNCATE;
+    event->syscall           = state->truncate.syscall;
+    event->old_size          = state->truncate.old_size;
+    event->new_size          = state->truncate.new_size;
+    ebpf_pid_info__fill(&event->pids, task);
+    ebpf_resolve_path_to_string(event->path, &state->truncate.path, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_TRUNCATE);
+out:
+    return 0;
+}
+
+// truncate resolves its path in vfs_truncate, which is the first place it's
+// available. Opens with O_TRUNC don't go through it.
+SEC("fentry/vfs_truncate")
+int BPF_PROG(fentry__vfs_truncate, const struct path *path, loff_t length)
+{
+    struct path p;
+    bpf_core_read(&p, sizeof(p), path);
+    return truncate__enter(EBPF_FILE_TRUNCATE_SYSCALL_TRUNCATE, &p, length);
+}
+
+SEC("fexit/vfs_truncate")
+int BPF_PROG(fexit__vfs_truncate, const struct path *path, loff_t length, long ret)
+{
+    return truncate__exit(ret);
+}
+
+SEC("kprobe/vfs_truncate")
+int BPF_KPROBE(kprobe__vfs_truncate, const struct path *path, loff_t length)
+{
+    struct path p;
+    bpf_core_read(&p, sizeof(p), path);
+    return truncate__enter(EBPF_FILE_TRUNCATE_SYSCALL_TRUNCATE, &p, length);
+}
+
+SEC("kretprobe/vfs_truncate")
+int BPF_KRETPROBE(kretprobe__vfs_truncate, long ret)
+{
+    return truncate__exit(ret);
+}
+
+SEC("tracepoint/syscalls/sys_enter_ftruncate")
+int tracepoint_syscalls_sys_enter_ftruncate(struct trace_event_raw_sys_enter *args)
+{
+    // ftruncate(fd, length)
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct file *f           = fd_to_file(task, BPF_CORE_READ(args, args[0]));
+    if (!f)
+        return 0;
+
+    struct path p = BPF_CORE_READ(f, f_path);
+    return truncate__enter(EBPF_FILE_TRUNCATE_SYSCALL_FTRUNCATE, &p, BPF_CORE_READ(args, args[1]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_ftruncate")
+int tracepoint_syscalls_sys_exit_ftruncate(struct trace_event_raw_sys_exit *args)
+{
+    return truncate__exit(BPF_CORE_READ(args, ret));
+}
+
+static int security_tamper__write(int fd)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (!tamper_inodes_watched || is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct file *f = fd_to_file(task, fd);
+    if (!f)
+        goto out;
+
+    struct inode *inode = BPF_CORE_READ(f, f_inode);
+    struct inode *dir   = BPF_CORE_READ(f, f_path.dentry, d_parent, d_inode);
+    u8 owner            = tamper_inode__owner_in(inode, dir);
+    if (!tamper_inode__tampered(owner))
+        goto out;
+
+    struct ebpf_security_tamper_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    event->hdr.type = EBPF_EVENT_SECURITY_TAMPER;
+    event->op       = owner == EBPF_TAMPER_INODE_OWNER_SELF ? EBPF_SECURITY_TAMPER_OP_SELF_WRITE
+                                                            : EBPF_SECURITY_TAMPER_OP_WRITE;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    struct path p = BPF_CORE_READ(f, f_path);
+    ebpf_resolve_path_to_string(event->path, &p, task);
+    event->dev   = BPF_CORE_READ(inode, i_sb, s_dev);
+    event->inode = BPF_CORE_READ(inode, i_ino);
+
+    event->target_pid     = 0;
+    event->target_comm[0] = '\0';
+    event->signal         = 0;
+
+    ebpf_ringbuf_submit(event);
+
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_write")
+int tracepoint_syscalls_sys_enter_write(struct trace_event_raw_sys_enter *args)
+{
+    return security_tamper__write(BPF_CORE_READ(args, args[0]));
+}
+
+SEC("tracepoint/syscalls/sys_enter_pwrite64")
+int tracepoint_syscalls_sys_enter_pwrite64(struct trace_event_raw_sys_enter *args)
+{
+    return security_tamper__write(BPF_CORE_READ(args, args[0]));
+}
+
+SEC("tracepoint/syscalls/sys_enter_writev")
+int tracepoint_syscalls_sys_enter_writev(struct trace_event_raw_sys_enter *args)
+{
+    return security_tamper__write(BPF_CORE_READ(args, args[0]));
+}
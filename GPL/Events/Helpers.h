@@ -14,6 +14,11 @@
 
 const volatile int consumer_pid = 0;
 
+// Toggled by userspace at runtime (see ebpf_event_ctx__set_paused). While set,
+// probes still run (so any state they track stays consistent) but no events
+// are sent up the ringbuffer.
+bool events_paused = false;
+
 #if BPF_DEBUG_TRACE == 0
 #undef bpf_printk
 #define bpf_printk(fmt, ...)
@@ -120,6 +125,58 @@ const volatile int consumer_pid = 0;
 // From linux/err.h
 #define MAX_ERRNO 4095
 
+// From include/uapi/asm-generic/signal.h
+#define SIGINT 2
+#define SIGKILL 9
+#define SIGTERM 15
+#define SIGSTOP 19
+
+// From include/uapi/linux/sched.h
+#define CLONE_NEWNS 0x00020000
+#define CLONE_NEWCGROUP 0x02000000
+#define CLONE_NEWUTS 0x04000000
+#define CLONE_NEWIPC 0x08000000
+#define CLONE_NEWUSER 0x10000000
+#define CLONE_NEWPID 0x20000000
+#define CLONE_NEWNET 0x40000000
+
+// From include/uapi/linux/prctl.h
+#define PR_SET_MM 35
+#define PR_SET_MM_MAP_SIZE 15
+
+// From include/uapi/linux/magic.h and fs/*/ for those not in there
+#define EXT4_SUPER_MAGIC 0xEF53 // Also ext2 and ext3
+#define XFS_SB_MAGIC 0x58465342
+#define BTRFS_SUPER_MAGIC 0x9123683E
+#define F2FS_SUPER_MAGIC 0xF2F52010
+#define TMPFS_MAGIC 0x01021994
+#define RAMFS_MAGIC 0x858458f6
+#define HUGETLBFS_MAGIC 0x958458f6
+#define OVERLAYFS_SUPER_MAGIC 0x794c7630
+#define SQUASHFS_MAGIC 0x73717368
+#define NFS_SUPER_MAGIC 0x6969
+#define SMB_SUPER_MAGIC 0x517B
+#define CIFS_SUPER_MAGIC 0xFF534D42
+#define SMB2_SUPER_MAGIC 0xFE534D42
+#define V9FS_MAGIC 0x01021997
+#define CEPH_SUPER_MAGIC 0x00c36400
+#define AFS_SUPER_MAGIC 0x5346414F
+#define MSDOS_SUPER_MAGIC 0x4d44 // Also vfat
+#define EXFAT_SUPER_MAGIC 0x2011BAB0
+#define ISOFS_SUPER_MAGIC 0x9660
+#define UDF_SUPER_MAGIC 0x15013346
+
+// From include/linux/sched.h, bit number in task->atomic_flags
+#define PFA_NO_NEW_PRIVS 0
+
+// From include/linux/user_namespace.h
+#define UID_GID_MAP_MAX_BASE_EXTENTS 5
+
+// The kernel allows up to 340 extents in a uid_map/gid_map, but maps with more
+// than a handful are vanishingly rare and every extent we walk costs verifier
+// instructions, so stop looking past this many.
+#define UID_GID_MAP_MAX_WALKED_EXTENTS 32
+
 // From include/linux/tty_driver.h
 #define TTY_DRIVER_TYPE_PTY 0x0004
 #define PTY_TYPE_MASTER 0x0001
@@ -204,6 +261,81 @@ static void ebpf_pid_info__fill(struct ebpf_pid_info *pi, const struct task_stru
     pi->pgid = BPF_CORE_READ(task, group_leader, signal, pids[PIDTYPE_PGID], numbers[0].nr);
     pi->sid  = BPF_CORE_READ(task, group_leader, signal, pids[PIDTYPE_SID], numbers[0].nr);
     pi->start_time_ns = BPF_CORE_READ(task, group_leader, start_time);
+    pi->parent_start_time_ns =
+        BPF_CORE_READ(task, group_leader, real_parent, group_leader, start_time);
+    pi->start_boottime_ns = BPF_CORE_READ(task, group_leader, start_boottime);
+
+    // The pid namespace a process is in is the one its pid was allocated in
+    // last, i.e. the one at its pid's level
+    struct pid *pid    = BPF_CORE_READ(task, group_leader, thread_pid);
+    unsigned int level = BPF_CORE_READ(pid, level);
+    struct upid upid   = {};
+    if (level > 0)
+        bpf_core_read(&upid, sizeof(upid), &pid->numbers[level]);
+    pi->pidns_init_start_boottime_ns =
+        upid.ns ? BPF_CORE_READ(upid.ns, child_reaper, start_boottime) : 0;
+}
+
+static void ebpf_namespace_info__fill(struct ebpf_namespace_info *ni,
+                                      const struct task_struct *task)
+{
+    ni->mnt    = BPF_CORE_READ(task, nsproxy, mnt_ns, ns.inum);
+    ni->net    = BPF_CORE_READ(task, nsproxy, net_ns, ns.inum);
+    ni->uts    = BPF_CORE_READ(task, nsproxy, uts_ns, ns.inum);
+    ni->ipc    = BPF_CORE_READ(task, nsproxy, ipc_ns, ns.inum);
+    ni->cgroup = BPF_CORE_READ(task, nsproxy, cgroup_ns, ns.inum);
+    ni->user   = BPF_CORE_READ(task, cred, user_ns, ns.inum);
+
+    // Like for ebpf_pid_info__fill, the one at the level of the task's pid.
+    // nsproxy's pid_ns_for_children is where its children will be.
+    struct pid *pid    = BPF_CORE_READ(task, thread_pid);
+    unsigned int level = BPF_CORE_READ(pid, level);
+    struct upid upid   = {};
+    bpf_core_read(&upid, sizeof(upid), &pid->numbers[level]);
+    ni->pid = upid.ns ? BPF_CORE_READ(upid.ns, ns.inum) : 0;
+}
+
+// BPF equivalent of the kernel's map_id_up. Maps a kernel id (i.e. the id as
+// seen from the initial user namespace) to the id it corresponds to in the
+// user namespace owning map. Returns (u32)-1 if the id is unmapped.
+//
+// The kernel translates the lower ids of a nested namespace's map into kernel
+// ids when the map is written, so the extents are always relative to the
+// host, no matter how deeply nested the namespace is.
+static u32 ebpf_map_id_up(const struct uid_gid_map *map, u32 id)
+{
+    const struct uid_gid_extent *extents = map->extent;
+    u32 nr_extents                       = BPF_CORE_READ(map, nr_extents);
+
+    if (nr_extents > UID_GID_MAP_MAX_BASE_EXTENTS)
+        extents = BPF_CORE_READ(map, reverse);
+
+    for (int i = 0; i < UID_GID_MAP_MAX_WALKED_EXTENTS; i++) {
+        if (i >= nr_extents)
+            break;
+
+        struct uid_gid_extent extent;
+        bpf_core_read(&extent, sizeof(extent), &extents[i]);
+
+        if (id >= extent.lower_first && id - extent.lower_first < extent.count)
+            return extent.first + (id - extent.lower_first);
+    }
+
+    return -1;
+}
+
+static u32 ebpf_from_kuid(const struct user_namespace *ns, u32 kuid)
+{
+    if (BPF_CORE_READ(ns, level) == 0)
+        return kuid;
+    return ebpf_map_id_up(&ns->uid_map, kuid);
+}
+
+static u32 ebpf_from_kgid(const struct user_namespace *ns, u32 kgid)
+{
+    if (BPF_CORE_READ(ns, level) == 0)
+        return kgid;
+    return ebpf_map_id_up(&ns->gid_map, kgid);
 }
 
 static void ebpf_cred_info__fill(struct ebpf_cred_info *ci, const struct task_struct *task)
@@ -214,6 +346,20 @@ static void ebpf_cred_info__fill(struct ebpf_cred_info *ci, const struct task_st
     ci->rgid = BPF_CORE_READ(task, cred, gid.val);
     ci->egid = BPF_CORE_READ(task, cred, egid.val);
     ci->sgid = BPF_CORE_READ(task, cred, sgid.val);
+
+    // kernel_cap_t is a u32[2] prior to Linux 6.3 and a u64 after, both of
+    // which are the same 8 bytes on little-endian architectures
+    const struct cred *cred = BPF_CORE_READ(task, cred);
+    bpf_core_read(&ci->cap_permitted, sizeof(ci->cap_permitted), &cred->cap_permitted);
+    bpf_core_read(&ci->cap_effective, sizeof(ci->cap_effective), &cred->cap_effective);
+
+    const struct user_namespace *ns = BPF_CORE_READ(task, cred, user_ns);
+    ci->container_ruid              = ebpf_from_kuid(ns, ci->ruid);
+    ci->container_euid              = ebpf_from_kuid(ns, ci->euid);
+    ci->container_suid              = ebpf_from_kuid(ns, ci->suid);
+    ci->container_rgid              = ebpf_from_kgid(ns, ci->rgid);
+    ci->container_egid              = ebpf_from_kgid(ns, ci->egid);
+    ci->container_sgid              = ebpf_from_kgid(ns, ci->sgid);
 }
 
 static bool is_kernel_thread(const struct task_struct *task)
@@ -235,4 +381,9 @@ static bool is_consumer()
     return consumer_pid == pid;
 }
 
+static bool ebpf_events_paused()
+{
+    return events_paused;
+}
+
 #endif // EBPF_EVENTPROBE_HELPERS_H
@@ -11,8 +11,21 @@
 #define EBPF_EVENTPROBE_NETWORK_H
 
 // linux/socket.h
+#define AF_UNIX 1
 #define AF_INET 2
 #define AF_INET6 10
+#define MSG_ERRQUEUE 0x2000
+
+static u64 ebpf_sock_inode(struct sock *sk)
+{
+    struct socket *sock = BPF_CORE_READ(sk, sk_socket);
+    if (!sock)
+        return 0;
+
+    // sock_alloc allocates the socket along with its inode
+    struct socket_alloc *alloc = container_of(sock, struct socket_alloc, socket);
+    return BPF_CORE_READ(alloc, vfs_inode.i_ino);
+}
 
 static int ebpf_sock_info__fill(struct ebpf_net_info *net, struct sock *sk)
 {
@@ -61,12 +74,16 @@ static int ebpf_sock_info__fill(struct ebpf_net_info *net, struct sock *sk)
     u16 dport              = BPF_CORE_READ(sk, __sk_common.skc_dport);
     net->dport             = bpf_ntohs(dport);
     net->netns             = BPF_CORE_READ(sk, __sk_common.skc_net.net, ns.inum);
+    net->sock_inode        = ebpf_sock_inode(sk);
 
     u16 proto = BPF_CORE_READ(sk, sk_protocol);
     switch (proto) {
     case IPPROTO_TCP:
         net->transport = EBPF_NETWORK_EVENT_TRANSPORT_TCP;
         break;
+    case IPPROTO_UDP:
+        net->transport = EBPF_NETWORK_EVENT_TRANSPORT_UDP;
+        break;
     default:
         err = -1;
         goto out;
@@ -76,6 +93,135 @@ out:
     return err;
 }
 
+// Datagrams on unconnected sockets carry their peer in msg_name (sendto,
+// sendmsg), or get it filled in there on receipt (recvfrom, recvmsg). By the
+// time the protocol sees the msghdr it points to a kernel copy of the
+// sockaddr. Leaves the socket's own peer in net if there's none.
+static void ebpf_sock_info__fill_msg_peer(struct ebpf_net_info *net, struct msghdr *msg)
+{
+    struct sockaddr *addr = BPF_CORE_READ(msg, msg_name);
+    if (!addr)
+        return;
+
+    u16 family = BPF_CORE_READ(addr, sa_family);
+    if (family == AF_INET) {
+        struct sockaddr_in *sin = (struct sockaddr_in *)addr;
+        if (net->family == EBPF_NETWORK_EVENT_AF_INET6) {
+            // IPv4 peer of a dual-stack socket, make it IPv4-mapped
+            // (::ffff:a.b.c.d) as the kernel does
+            u8 v4[4];
+            BPF_CORE_READ_INTO(&v4, sin, sin_addr);
+            __builtin_memset(net->daddr6, 0, 10);
+            net->daddr6[10] = 0xff;
+            net->daddr6[11] = 0xff;
+            __builtin_memcpy(&net->daddr6[12], v4, sizeof(v4));
+        } else {
+            BPF_CORE_READ_INTO(&net->daddr, sin, sin_addr);
+        }
+        net->dport = bpf_ntohs(BPF_CORE_READ(sin, sin_port));
+    } else if (family == AF_INET6 && net->family == EBPF_NETWORK_EVENT_AF_INET6) {
+        struct sockaddr_in6 *sin6 = (struct sockaddr_in6 *)addr;
+        BPF_CORE_READ_INTO(&net->daddr6, sin6, sin6_addr);
+        net->dport = bpf_ntohs(BPF_CORE_READ(sin6, sin6_port));
+    }
+}
+
+// struct iov_iter as of 6.0, which added ITER_UBUF for single user buffers
+// (e.g. those of send and sendto)
+struct iov_iter___ubuf {
+    u8 iter_type;
+    void *ubuf;
+} __attribute__((preserve_access_index));
+
+enum iter_type___ubuf {
+    ITER_UBUF = 0,
+};
+
+// struct iov_iter as of 6.4, iov was renamed
+struct iov_iter___iov {
+    const struct iovec *__iov;
+} __attribute__((preserve_access_index));
+
+// Start of the data left in a msghdr from userspace. Only the first iovec
+// of a scatter/gather array is looked at.
+static const u8 *ebpf_msghdr__user_buf(struct msghdr *msg, size_t *len)
+{
+    struct iov_iter *iter = &msg->msg_iter;
+    size_t offset         = BPF_CORE_READ(iter, iov_offset);
+    *len                  = BPF_CORE_READ(iter, count);
+
+    struct iov_iter___ubuf *ubuf_iter = (void *)iter;
+    if (bpf_core_field_exists(ubuf_iter->ubuf) &&
+        BPF_CORE_READ(ubuf_iter, iter_type) == bpf_core_enum_value(enum iter_type___ubuf, ITER_UBUF))
+        return (const u8 *)BPF_CORE_READ(ubuf_iter, ubuf) + offset;
+
+    const struct iovec *iov;
+    struct iov_iter___iov *iov_iter = (void *)iter;
+    if (bpf_core_field_exists(iov_iter->__iov))
+        iov = BPF_CORE_READ(iov_iter, __iov);
+    else
+        iov = BPF_CORE_READ(iter, iov);
+
+    size_t iov_len = BPF_CORE_READ(iov, iov_len);
+    if (iov_len - offset < *len)
+        *len = iov_len - offset;
+    return (const u8 *)BPF_CORE_READ(iov, iov_base) + offset;
+}
+
+// sk_peer_pid and sk_peer_cred are what SO_PEERCRED reads, set on connect()
+// for both ends. The pid is the one in the initial pid namespace, like the
+// event's own.
+static void ebpf_unix_peer__fill(struct ebpf_net_info_unix *unix_addr, struct sock *sk)
+{
+    struct pid *pid = BPF_CORE_READ(sk, sk_peer_pid);
+    if (!pid) {
+        unix_addr->peer_pid    = 0;
+        unix_addr->peer_uid    = 0;
+        unix_addr->peer_gid    = 0;
+        unix_addr->peer_exited = 0;
+        return;
+    }
+
+    const struct cred *cred = BPF_CORE_READ(sk, sk_peer_cred);
+    unix_addr->peer_pid     = BPF_CORE_READ(pid, numbers[0].nr);
+    unix_addr->peer_uid     = BPF_CORE_READ(cred, euid.val);
+    unix_addr->peer_gid     = BPF_CORE_READ(cred, egid.val);
+
+    // The struct pid outlives the process, it's detached from it once it's
+    // reaped
+    unix_addr->peer_exited = BPF_CORE_READ(pid, tasks[PIDTYPE_PID].first) == NULL;
+}
+
+// AF_UNIX sockets have no addresses or ports, just the path (or abstract name)
+// the socket is bound to. Both ends of a connection share the one the
+// listening socket was bound to. The peer credentials are read from peer_sk.
+static int
+ebpf_unix_sock_info__fill(struct ebpf_net_info *net, struct sock *sk, struct sock *peer_sk)
+{
+    struct unix_address *addr = BPF_CORE_READ((struct unix_sock *)sk, addr);
+    if (!addr)
+        return -1;
+
+    // addr->len covers sun_family too
+    int len = BPF_CORE_READ(addr, len) - (int)offsetof(struct sockaddr_un, sun_path);
+    if (len < 0)
+        len = 0;
+    if (len > SUN_PATH_MAX)
+        len = SUN_PATH_MAX;
+    net->unix_addr.path_len = len;
+    if (bpf_core_read(net->unix_addr.path, len, &addr->name[0].sun_path))
+        return -1;
+
+    ebpf_unix_peer__fill(&net->unix_addr, peer_sk);
+
+    // Not a transport, event memory isn't zeroed so it must be cleared
+    net->transport = 0;
+    net->family    = EBPF_NETWORK_EVENT_AF_UNIX;
+    net->netns      = BPF_CORE_READ(sk, __sk_common.skc_net.net, ns.inum);
+    net->sock_inode = ebpf_sock_inode(sk);
+    return 0;
+}
+
 static int ebpf_network_event__fill(struct ebpf_net_event *evt, struct sock *sk)
 {
     int err = 0;
@@ -88,7 +234,6 @@ static int ebpf_network_event__fill(struct ebpf_net_event *evt, struct sock *sk)
     struct task_struct *task = (struct task_struct *)bpf_get_current_task();
     ebpf_pid_info__fill(&evt->pids, task);
     bpf_get_current_comm(evt->comm, TASK_COMM_LEN);
-    evt->hdr.ts = bpf_ktime_get_ns();
 
 out:
     return err;
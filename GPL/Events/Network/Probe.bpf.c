@@ -18,12 +18,52 @@
 #include "Network.h"
 #include "State.h"
 
-static int inet_csk_accept__exit(struct sock *sk)
+// udp_recvmsg lost its noblock argument in 5.19, moving the return value
+DECL_FUNC_RET(udp_recvmsg);
+DECL_FUNC_RET(udpv6_recvmsg);
+// unix_accept and inet_accept took a struct proto_accept_arg in place of flags
+// and kern in 6.10
+DECL_FUNC_RET(unix_accept);
+DECL_FUNC_RET(inet_accept);
+
+// The accept4 flags never make it down to the protocol's accept, so stash
+// them for the duration of the syscall
+SEC("tracepoint/syscalls/sys_enter_accept4")
+int tracepoint_syscalls_sys_enter_accept4(struct trace_event_raw_sys_enter *args)
 {
+    // accept4(fd, upeer_sockaddr, upeer_addrlen, flags)
+    struct ebpf_events_state state = {};
+    state.accept4.flags            = BPF_CORE_READ(args, args[3]);
+    ebpf_events_state__set(EBPF_EVENTS_STATE_ACCEPT4, &state);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_exit_accept4")
+int tracepoint_syscalls_sys_exit_accept4(struct trace_event_raw_sys_exit *args)
+{
+    ebpf_events_state__del(EBPF_EVENTS_STATE_ACCEPT4);
+    return 0;
+}
+
+static u32 accept4__flags()
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_ACCEPT4);
+    return state ? state->accept4.flags : 0;
+}
+
+// TCP accepts, IPv4 and IPv6 alike. Hooked in inet_accept rather than
+// inet_csk_accept so the new sock is grafted onto its struct socket, which
+// sock_inode comes from.
+static int inet_accept__exit(struct socket *newsock, int ret)
+{
+    if (ret || ebpf_events_paused())
+        goto out;
+
+    struct sock *sk = BPF_CORE_READ(newsock, sk);
     if (!sk)
         goto out;
 
-    struct ebpf_net_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    struct ebpf_net_event *event = ebpf_ringbuf_reserve(sizeof(*event));
     if (!event)
         goto out;
 
@@ -32,32 +72,48 @@ static int inet_csk_accept__exit(struct sock *sk)
         goto out;
     }
 
-    event->hdr.type = EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED;
-    bpf_ringbuf_submit(event, 0);
+    event->accept_flags = accept4__flags();
+    event->hdr.type     = EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED;
+    ebpf_ringbuf_submit(event);
 
 out:
     return 0;
 }
 
-SEC("fexit/inet_csk_accept")
-int BPF_PROG(
-    fexit__inet_csk_accept, struct sock *sk, int flags, int *err, bool kern, struct sock *ret)
+SEC("fexit/inet_accept")
+int BPF_PROG(fexit__inet_accept, struct socket *sock, struct socket *newsock)
 {
-    return inet_csk_accept__exit(ret);
+    int ret = FUNC_RET_READ(___type(ret), inet_accept);
+    return inet_accept__exit(newsock, ret);
+}
+
+SEC("kprobe/inet_accept")
+int BPF_KPROBE(kprobe__inet_accept, struct socket *sock, struct socket *newsock)
+{
+    struct ebpf_events_state state = {};
+    state.inet_accept.sock         = newsock;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_INET_ACCEPT, &state);
+    return 0;
 }
 
-SEC("kretprobe/inet_csk_accept")
-int BPF_KRETPROBE(kretprobe__inet_csk_accept, struct sock *ret)
+SEC("kretprobe/inet_accept")
+int BPF_KRETPROBE(kretprobe__inet_accept, int ret)
 {
-    return inet_csk_accept__exit(ret);
+    struct ebpf_events_state *state;
+
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_INET_ACCEPT);
+    if (!state)
+        return 0;
+
+    return inet_accept__exit(state->inet_accept.sock, ret);
 }
 
 static int tcp_connect(struct sock *sk, int ret)
 {
-    if (ret)
+    if (ret || ebpf_events_paused())
         goto out;
 
-    struct ebpf_net_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    struct ebpf_net_event *event = ebpf_ringbuf_reserve(sizeof(*event));
     if (!event)
         goto out;
 
@@ -67,16 +123,27 @@ static int tcp_connect(struct sock *sk, int ret)
     }
 
     event->hdr.type = EBPF_EVENT_NETWORK_CONNECTION_ATTEMPTED;
-    bpf_ringbuf_submit(event, 0);
+    ebpf_ringbuf_submit(event);
 
 out:
     return 0;
 }
 
+// tcp_v6_connect calls tcp_v4_connect for IPv4-mapped destinations, those
+// are only reported on the tcp_v6_connect exit, once the IPv6 source address
+// has been set
+static int tcp_v4_connect__exit(struct sock *sk, int ret)
+{
+    if (BPF_CORE_READ(sk, __sk_common.skc_family) == AF_INET6)
+        return 0;
+
+    return tcp_connect(sk, ret);
+}
+
 SEC("fexit/tcp_v4_connect")
 int BPF_PROG(fexit__tcp_v4_connect, struct sock *sk, struct sockaddr *uaddr, int addr_len, int ret)
 {
-    return tcp_connect(sk, ret);
+    return tcp_v4_connect__exit(sk, ret);
 }
 
 SEC("kprobe/tcp_v4_connect")
@@ -97,7 +164,7 @@ int BPF_KRETPROBE(kretprobe__tcp_v4_connect, int ret)
     if (!state)
         return 0;
 
-    return tcp_connect(state->tcp_v4_connect.sk, ret);
+    return tcp_v4_connect__exit(state->tcp_v4_connect.sk, ret);
 }
 
 SEC("fexit/tcp_v6_connect")
@@ -127,9 +194,255 @@ int BPF_KRETPROBE(kretprobe__tcp_v6_connect, int ret)
     return tcp_connect(state->tcp_v6_connect.sk, ret);
 }
 
+static int unix_sock__emit(struct sock *sk, struct sock *peer_sk, enum ebpf_event_type type)
+{
+    if (!sk || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_net_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    if (ebpf_unix_sock_info__fill(&event->net, sk, peer_sk)) {
+        bpf_ringbuf_discard(event, 0);
+        goto out;
+    }
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    if (type == EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED)
+        event->accept_flags = accept4__flags();
+    event->hdr.type = type;
+    ebpf_ringbuf_submit(event);
+
+out:
+    return 0;
+}
+
+// The connecting socket usually isn't bound, its peer (the socket the
+// listener hands out on accept) carries the listener's path. The connecting
+// socket got the listener's credentials, the peer was given the connecting
+// process'.
+static int unix_stream_connect__exit(struct socket *sock, int ret)
+{
+    if (ret)
+        return 0;
+
+    struct sock *sk   = BPF_CORE_READ(sock, sk);
+    struct sock *peer = BPF_CORE_READ((struct unix_sock *)sk, peer);
+    return unix_sock__emit(peer, sk, EBPF_EVENT_NETWORK_CONNECTION_ATTEMPTED);
+}
+
+SEC("fexit/unix_stream_connect")
+int BPF_PROG(fexit__unix_stream_connect,
+             struct socket *sock,
+             struct sockaddr *uaddr,
+             int addr_len,
+             int flags,
+             int ret)
+{
+    return unix_stream_connect__exit(sock, ret);
+}
+
+SEC("kprobe/unix_stream_connect")
+int BPF_KPROBE(kprobe__unix_stream_connect, struct socket *sock)
+{
+    struct ebpf_events_state state = {};
+    state.unix_connect.sock        = sock;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_UNIX_CONNECT, &state);
+    return 0;
+}
+
+SEC("kretprobe/unix_stream_connect")
+int BPF_KRETPROBE(kretprobe__unix_stream_connect, int ret)
+{
+    struct ebpf_events_state *state;
+
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_UNIX_CONNECT);
+    if (!state)
+        return 0;
+
+    return unix_stream_connect__exit(state->unix_connect.sock, ret);
+}
+
+static int unix_accept__exit(struct socket *newsock, int ret)
+{
+    if (ret)
+        return 0;
+
+    struct sock *sk = BPF_CORE_READ(newsock, sk);
+    return unix_sock__emit(sk, sk, EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED);
+}
+
+SEC("fexit/unix_accept")
+int BPF_PROG(fexit__unix_accept, struct socket *sock, struct socket *newsock)
+{
+    int ret = FUNC_RET_READ(___type(ret), unix_accept);
+    return unix_accept__exit(newsock, ret);
+}
+
+SEC("kprobe/unix_accept")
+int BPF_KPROBE(kprobe__unix_accept, struct socket *sock, struct socket *newsock)
+{
+    struct ebpf_events_state state = {};
+    state.unix_accept.sock         = newsock;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_UNIX_ACCEPT, &state);
+    return 0;
+}
+
+SEC("kretprobe/unix_accept")
+int BPF_KRETPROBE(kretprobe__unix_accept, int ret)
+{
+    struct ebpf_events_state *state;
+
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_UNIX_ACCEPT);
+    if (!state)
+        return 0;
+
+    return unix_accept__exit(state->unix_accept.sock, ret);
+}
+
+// listen on TCP sockets, IPv4 and IPv6 alike. The port is bound by now if it
+// wasn't already.
+static int inet_listen__exit(struct socket *sock, int backlog, int ret)
+{
+    if (ret || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_net_listen_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    if (ebpf_sock_info__fill(&event->net, BPF_CORE_READ(sock, sk))) {
+        bpf_ringbuf_discard(event, 0);
+        goto out;
+    }
+
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    event->backlog  = backlog;
+    event->hdr.type = EBPF_EVENT_NETWORK_LISTEN;
+    ebpf_ringbuf_submit(event);
+
+out:
+    return 0;
+}
+
+SEC("fexit/inet_listen")
+int BPF_PROG(fexit__inet_listen, struct socket *sock, int backlog, int ret)
+{
+    return inet_listen__exit(sock, backlog, ret);
+}
+
+SEC("kprobe/inet_listen")
+int BPF_KPROBE(kprobe__inet_listen, struct socket *sock, int backlog)
+{
+    struct ebpf_events_state state = {};
+    state.inet_listen.sock         = sock;
+    state.inet_listen.backlog      = backlog;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_INET_LISTEN, &state);
+    return 0;
+}
+
+SEC("kretprobe/inet_listen")
+int BPF_KRETPROBE(kretprobe__inet_listen, int ret)
+{
+    struct ebpf_events_state *state;
+
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_INET_LISTEN);
+    if (!state)
+        return 0;
+
+    return inet_listen__exit(state->inet_listen.sock, state->inet_listen.backlog, ret);
+}
+
+// The port is set by now, including one picked by the kernel for port 0
+static int inet_bind__exit(struct socket *sock, int ret)
+{
+    if (ret || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_net_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    if (ebpf_network_event__fill(event, BPF_CORE_READ(sock, sk))) {
+        bpf_ringbuf_discard(event, 0);
+        goto out;
+    }
+
+    event->hdr.type = EBPF_EVENT_NETWORK_BIND;
+    ebpf_ringbuf_submit(event);
+
+out:
+    return 0;
+}
+
+static int inet_bind__enter(struct socket *sock)
+{
+    struct ebpf_events_state state = {};
+    state.inet_bind.sock           = sock;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_INET_BIND, &state);
+    return 0;
+}
+
+static int inet_bind__ret(int ret)
+{
+    struct ebpf_events_state *state;
+
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_INET_BIND);
+    if (!state)
+        return 0;
+
+    return inet_bind__exit(state->inet_bind.sock, ret);
+}
+
+SEC("fexit/inet_bind")
+int BPF_PROG(fexit__inet_bind, struct socket *sock, struct sockaddr *uaddr, int addr_len, int ret)
+{
+    return inet_bind__exit(sock, ret);
+}
+
+SEC("kprobe/inet_bind")
+int BPF_KPROBE(kprobe__inet_bind, struct socket *sock)
+{
+    return inet_bind__enter(sock);
+}
+
+SEC("kretprobe/inet_bind")
+int BPF_KRETPROBE(kretprobe__inet_bind, int ret)
+{
+    return inet_bind__ret(ret);
+}
+
+SEC("fexit/inet6_bind")
+int BPF_PROG(fexit__inet6_bind, struct socket *sock, struct sockaddr *uaddr, int addr_len, int ret)
+{
+    return inet_bind__exit(sock, ret);
+}
+
+SEC("kprobe/inet6_bind")
+int BPF_KPROBE(kprobe__inet6_bind, struct socket *sock)
+{
+    return inet_bind__enter(sock);
+}
+
+SEC("kretprobe/inet6_bind")
+int BPF_KRETPROBE(kretprobe__inet6_bind, int ret)
+{
+    return inet_bind__ret(ret);
+}
+
 static int tcp_close__enter(struct sock *sk)
 {
-    struct ebpf_net_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    if (ebpf_events_paused())
+        goto out;
+
+    struct ebpf_net_event *event = ebpf_ringbuf_reserve(sizeof(*event));
     if (!event)
         goto out;
 
@@ -152,7 +465,7 @@ static int tcp_close__enter(struct sock *sk)
     event->net.tcp.close.bytes_received = bytes_received;
 
     event->hdr.type = EBPF_EVENT_NETWORK_CONNECTION_CLOSED;
-    bpf_ringbuf_submit(event, 0);
+    ebpf_ringbuf_submit(event);
 
 out:
     return 0;
@@ -169,3 +482,260 @@ int BPF_KPROBE(kprobe__tcp_close, struct sock *sk, long timeout)
 {
     return tcp_close__enter(sk);
 }
+
+static int udp_msg__exit(struct sock *sk, struct msghdr *msg, int ret, enum ebpf_event_type type)
+{
+    if (ret < 0 || ebpf_events_paused())
+        goto out;
+
+    // Queued errors (e.g. ICMP port unreachable) read with MSG_ERRQUEUE
+    if (type == EBPF_EVENT_NETWORK_UDP_RECV && BPF_CORE_READ(msg, msg_flags) & MSG_ERRQUEUE)
+        goto out;
+
+    struct ebpf_net_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    if (ebpf_network_event__fill(event, sk)) {
+        bpf_ringbuf_discard(event, 0);
+        goto out;
+    }
+
+    ebpf_sock_info__fill_msg_peer(&event->net, msg);
+    event->net.udp.datagram.bytes = ret;
+
+    event->hdr.type = type;
+    ebpf_ringbuf_submit(event);
+
+out:
+    return 0;
+}
+
+// udpv6_sendmsg hands datagrams to IPv4 peers of dual-stack sockets over to
+// udp_sendmsg, they're reported by the udpv6_sendmsg probes
+static bool udp_sendmsg__is_from_v6(struct sock *sk)
+{
+    return BPF_CORE_READ(sk, __sk_common.skc_family) == AF_INET6;
+}
+
+// Called on entry to udp_sendmsg, the iov_iter has been consumed by the time
+// it returns. Queries are thus reported whether or not they were sent.
+static int dns_query__enter(struct sock *sk, struct msghdr *msg)
+{
+    if (ebpf_events_paused())
+        goto out;
+
+    struct ebpf_dns_query_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    if (ebpf_sock_info__fill(&event->net, sk))
+        goto out_discard;
+    ebpf_sock_info__fill_msg_peer(&event->net, msg);
+    if (event->net.dport != 53)
+        goto out_discard;
+
+    size_t count;
+    const u8 *buf      = ebpf_msghdr__user_buf(msg, &count);
+    u64 len            = count > DNS_PAYLOAD_MAX ? DNS_PAYLOAD_MAX : count;
+    event->payload_len = len;
+    if (bpf_probe_read_user(event->payload, len, buf))
+        goto out_discard;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    event->hdr.type = EBPF_EVENT_NETWORK_DNS_QUERY;
+    ebpf_ringbuf_submit(event);
+    goto out;
+
+out_discard:
+    bpf_ringbuf_discard(event, 0);
+out:
+    return 0;
+}
+
+// Called on exit from udp_recvmsg with the user buffer it was given, msg_name
+// has the peer of unconnected sockets by then. Responses are reported as
+// they're read, those the process peeks at (MSG_PEEK) first are reported twice.
+static int
+dns_response__exit(struct sock *sk, struct msghdr *msg, const u8 *buf, u64 buf_len, int ret)
+{
+    if (ret <= 0 || ebpf_events_paused())
+        goto out;
+
+    if (BPF_CORE_READ(msg, msg_flags) & MSG_ERRQUEUE)
+        goto out;
+
+    struct ebpf_dns_response_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    if (ebpf_sock_info__fill(&event->net, sk))
+        goto out_discard;
+    ebpf_sock_info__fill_msg_peer(&event->net, msg);
+    if (event->net.dport != 53)
+        goto out_discard;
+
+    // With MSG_TRUNC ret is the length of the datagram, which can be more than
+    // the buffer holds
+    u64 len = (u64)ret < buf_len ? (u64)ret : buf_len;
+    if (len > DNS_PAYLOAD_MAX)
+        len = DNS_PAYLOAD_MAX;
+    event->payload_len = len;
+    if (bpf_probe_read_user(event->payload, len, buf))
+        goto out_discard;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    event->hdr.type = EBPF_EVENT_NETWORK_DNS_RESPONSE;
+    ebpf_ringbuf_submit(event);
+    goto out;
+
+out_discard:
+    bpf_ringbuf_discard(event, 0);
+out:
+    return 0;
+}
+
+static int udp_msg__enter(enum ebpf_events_state_op op, struct sock *sk, struct msghdr *msg)
+{
+    struct ebpf_events_state state = {};
+    state.udp_msg.sk               = sk;
+    state.udp_msg.msg              = msg;
+    if (op == EBPF_EVENTS_STATE_UDP_RECVMSG) {
+        size_t len;
+        state.udp_msg.buf     = ebpf_msghdr__user_buf(msg, &len);
+        state.udp_msg.buf_len = len;
+    }
+    ebpf_events_state__set(op, &state);
+    return 0;
+}
+
+static int udp_msg__ret(enum ebpf_events_state_op op, int ret, enum ebpf_event_type type)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(op);
+    if (!state)
+        return 0;
+
+    udp_msg__exit(state->udp_msg.sk, state->udp_msg.msg, ret, type);
+    if (op == EBPF_EVENTS_STATE_UDP_RECVMSG)
+        dns_response__exit(state->udp_msg.sk, state->udp_msg.msg, state->udp_msg.buf,
+                           state->udp_msg.buf_len, ret);
+    ebpf_events_state__del(op);
+    return 0;
+}
+
+SEC("fentry/udp_sendmsg")
+int BPF_PROG(fentry__udp_sendmsg, struct sock *sk, struct msghdr *msg)
+{
+    if (udp_sendmsg__is_from_v6(sk))
+        return 0;
+
+    return dns_query__enter(sk, msg);
+}
+
+SEC("fexit/udp_sendmsg")
+int BPF_PROG(fexit__udp_sendmsg, struct sock *sk, struct msghdr *msg, size_t len, int ret)
+{
+    if (udp_sendmsg__is_from_v6(sk))
+        return 0;
+
+    return udp_msg__exit(sk, msg, ret, EBPF_EVENT_NETWORK_UDP_SEND);
+}
+
+SEC("kprobe/udp_sendmsg")
+int BPF_KPROBE(kprobe__udp_sendmsg, struct sock *sk, struct msghdr *msg)
+{
+    if (udp_sendmsg__is_from_v6(sk))
+        return 0;
+
+    dns_query__enter(sk, msg);
+    return udp_msg__enter(EBPF_EVENTS_STATE_UDP_SENDMSG, sk, msg);
+}
+
+SEC("kretprobe/udp_sendmsg")
+int BPF_KRETPROBE(kretprobe__udp_sendmsg, int ret)
+{
+    return udp_msg__ret(EBPF_EVENTS_STATE_UDP_SENDMSG, ret, EBPF_EVENT_NETWORK_UDP_SEND);
+}
+
+SEC("fentry/udpv6_sendmsg")
+int BPF_PROG(fentry__udpv6_sendmsg, struct sock *sk, struct msghdr *msg)
+{
+    return dns_query__enter(sk, msg);
+}
+
+SEC("fexit/udpv6_sendmsg")
+int BPF_PROG(fexit__udpv6_sendmsg, struct sock *sk, struct msghdr *msg, size_t len, int ret)
+{
+    return udp_msg__exit(sk, msg, ret, EBPF_EVENT_NETWORK_UDP_SEND);
+}
+
+SEC("kprobe/udpv6_sendmsg")
+int BPF_KPROBE(kprobe__udpv6_sendmsg, struct sock *sk, struct msghdr *msg)
+{
+    dns_query__enter(sk, msg);
+    return udp_msg__enter(EBPF_EVENTS_STATE_UDP_SENDMSG, sk, msg);
+}
+
+SEC("kretprobe/udpv6_sendmsg")
+int BPF_KRETPROBE(kretprobe__udpv6_sendmsg, int ret)
+{
+    return udp_msg__ret(EBPF_EVENTS_STATE_UDP_SENDMSG, ret, EBPF_EVENT_NETWORK_UDP_SEND);
+}
+
+// The user buffer is needed for DNS responses, it's gone by the time
+// udp_recvmsg returns
+SEC("fentry/udp_recvmsg")
+int BPF_PROG(fentry__udp_recvmsg, struct sock *sk, struct msghdr *msg)
+{
+    return udp_msg__enter(EBPF_EVENTS_STATE_UDP_RECVMSG, sk, msg);
+}
+
+SEC("fexit/udp_recvmsg")
+int BPF_PROG(fexit__udp_recvmsg, struct sock *sk, struct msghdr *msg)
+{
+    int ret = FUNC_RET_READ(___type(ret), udp_recvmsg);
+    return udp_msg__ret(EBPF_EVENTS_STATE_UDP_RECVMSG, ret, EBPF_EVENT_NETWORK_UDP_RECV);
+}
+
+SEC("kprobe/udp_recvmsg")
+int BPF_KPROBE(kprobe__udp_recvmsg, struct sock *sk, struct msghdr *msg)
+{
+    return udp_msg__enter(EBPF_EVENTS_STATE_UDP_RECVMSG, sk, msg);
+}
+
+SEC("kretprobe/udp_recvmsg")
+int BPF_KRETPROBE(kretprobe__udp_recvmsg, int ret)
+{
+    return udp_msg__ret(EBPF_EVENTS_STATE_UDP_RECVMSG, ret, EBPF_EVENT_NETWORK_UDP_RECV);
+}
+
+SEC("fentry/udpv6_recvmsg")
+int BPF_PROG(fentry__udpv6_recvmsg, struct sock *sk, struct msghdr *msg)
+{
+    return udp_msg__enter(EBPF_EVENTS_STATE_UDP_RECVMSG, sk, msg);
+}
+
+SEC("fexit/udpv6_recvmsg")
+int BPF_PROG(fexit__udpv6_recvmsg, struct sock *sk, struct msghdr *msg)
+{
+    int ret = FUNC_RET_READ(___type(ret), udpv6_recvmsg);
+    return udp_msg__ret(EBPF_EVENTS_STATE_UDP_RECVMSG, ret, EBPF_EVENT_NETWORK_UDP_RECV);
+}
+
+SEC("kprobe/udpv6_recvmsg")
+int BPF_KPROBE(kprobe__udpv6_recvmsg, struct sock *sk, struct msghdr *msg)
+{
+    return udp_msg__enter(EBPF_EVENTS_STATE_UDP_RECVMSG, sk, msg);
+}
+
+SEC("kretprobe/udpv6_recvmsg")
+int BPF_KRETPROBE(kretprobe__udpv6_recvmsg, int ret)
+{
+    return udp_msg__ret(EBPF_EVENTS_STATE_UDP_RECVMSG, ret, EBPF_EVENT_NETWORK_UDP_RECV);
+}
@@ -28,6 +28,7 @@
 #include "vmlinux.h"
 
 #include "Helpers.h"
+#include "Varlen.h"
 
 #define PATH_MAX 4096
 #define PATH_MAX_INDEX_MASK 4095
@@ -51,14 +52,14 @@ struct {
     __uint(max_entries, 1);
 } path_resolver_dentry_scratch_map SEC(".maps");
 
-static void
-ebpf_resolve_path_to_string(char *buf, struct path *path, const struct task_struct *task)
+// Resolves path relative to root, i.e. the walk up the dentry chain stops
+// when root is reached. Returns the size of the resolved path, including the
+// terminating NUL.
+static u32 ebpf_resolve_path_to_string_from(char *buf, struct path *path, struct path root)
 {
     long size      = 0;
     bool truncated = true;
 
-    struct fs_struct *fs_struct    = BPF_CORE_READ(task, fs);
-    struct path root               = BPF_CORE_READ(fs_struct, root);
     struct vfsmount *curr_vfsmount = BPF_CORE_READ(path, mnt);
 
     // All struct vfsmount's are stored in a struct mount. We need fields in
@@ -162,12 +163,52 @@ ebpf_resolve_path_to_string(char *buf, struct path *path, const struct task_stru
     if (buf[0] == '\0') {
         buf[0] = '/';
         buf[1] = '\0';
+        return 2;
     }
 
-    return;
+    return size + 1;
 
 out_err:
     buf[0] = '\0';
+    return 1;
+}
+
+// Resolves path as seen by task, i.e. relative to its (possibly chrooted) root
+static u32 ebpf_resolve_path_to_string(char *buf, struct path *path, const struct task_struct *task)
+{
+    struct fs_struct *fs_struct = BPF_CORE_READ(task, fs);
+    struct path root            = BPF_CORE_READ(fs_struct, root);
+
+    return ebpf_resolve_path_to_string_from(buf, path, root);
+}
+
+// Resolves the root directory of task (as changed by chroot) relative to the
+// root of its mount namespace and adds it to fields as an
+// EBPF_VL_FIELD_ROOT_PATH field, unless it's "/" (task isn't chrooted).
+// Prefixing it to a path resolved with ebpf_resolve_path_to_string gives that
+// path as seen from outside the chroot.
+static void ebpf_root_path__fill(struct ebpf_varlen_fields_start *fields,
+                                 const struct task_struct *task)
+{
+    struct fs_struct *fs_struct = BPF_CORE_READ(task, fs);
+    struct path root            = BPF_CORE_READ(fs_struct, root);
+
+    struct mount *ns_root = BPF_CORE_READ(task, nsproxy, mnt_ns, root);
+    struct path ns_root_path;
+    ns_root_path.mnt    = (struct vfsmount *)&ns_root->mnt;
+    ns_root_path.dentry = BPF_CORE_READ(ns_root, mnt.mnt_root);
+
+    struct ebpf_varlen_field *field = ebpf_vl_field__add(fields, EBPF_VL_FIELD_ROOT_PATH);
+    if (!field)
+        return;
+
+    // The root of the namespace is often mounted over (e.g. the initramfs'
+    // rootfs), so comparing the paths themselves doesn't tell if it's "/"
+    u32 size = ebpf_resolve_path_to_string_from(field->data, &root, ns_root_path);
+    if (size == 2 && field->data[0] == '/')
+        return;
+
+    ebpf_vl_field__commit(fields, field, size);
 }
 
 struct {
@@ -177,7 +218,8 @@ struct {
     __uint(max_entries, 1);
 } path_resolver_kernfs_node_scratch_map SEC(".maps");
 
-static void ebpf_resolve_kernfs_node_to_string(char *buf, struct kernfs_node *kn)
+// Returns the size of the resolved path, including the terminating NUL
+static u32 ebpf_resolve_kernfs_node_to_string(char *buf, struct kernfs_node *kn)
 {
     long cur  = 0;
     int depth = 0, zero = 0, read_len, name_len;
@@ -230,30 +272,84 @@ static void ebpf_resolve_kernfs_node_to_string(char *buf, struct kernfs_node *kn
         cur += name_len & PATH_MAX_INDEX_MASK;
     }
 
-    return;
+    return cur + 1;
 
 out_err:
     buf[0] = '\0';
+    return 1;
 }
 
-static void ebpf_resolve_pids_ss_cgroup_path_to_string(char *buf, const struct task_struct *task)
+// Returns NULL if the pids controller isn't enabled on this kernel
+static struct cgroup *ebpf_pids_ss_cgroup__get(const struct task_struct *task)
 {
     /*
      * Since pids_cgrp_id is an enum value, we need to get it at runtime as it
      * can change kernel-to-kernel depending on the kconfig or possibly not be
      * enabled at all.
      */
-    int cgrp_id;
-    if (bpf_core_enum_value_exists(enum cgroup_subsys_id, pids_cgrp_id)) {
-        cgrp_id = bpf_core_enum_value(enum cgroup_subsys_id, pids_cgrp_id);
-    } else {
-        /* Pids cgroup is not enabled on this kernel */
+    if (!bpf_core_enum_value_exists(enum cgroup_subsys_id, pids_cgrp_id))
+        return NULL;
+
+    int cgrp_id = bpf_core_enum_value(enum cgroup_subsys_id, pids_cgrp_id);
+    return BPF_CORE_READ(task, cgroups, subsys[cgrp_id], cgroup);
+}
+
+static void ebpf_resolve_pids_ss_cgroup_path_to_string(char *buf, const struct task_struct *task)
+{
+    struct cgroup *cgrp = ebpf_pids_ss_cgroup__get(task);
+    if (!cgrp) {
         buf[0] = '\0';
         return;
     }
 
-    struct kernfs_node *kn = BPF_CORE_READ(task, cgroups, subsys[cgrp_id], cgroup, kn);
-    ebpf_resolve_kernfs_node_to_string(buf, kn);
+    ebpf_resolve_kernfs_node_to_string(buf, BPF_CORE_READ(cgrp, kn));
+}
+
+// For events without a fixed pids_ss_cgroup_path, adds it to fields as an
+// EBPF_VL_FIELD_CGROUP_PATH field instead
+static void ebpf_pids_ss_cgroup_path__fill(struct ebpf_varlen_fields_start *fields,
+                                           const struct task_struct *task)
+{
+    struct cgroup *cgrp = ebpf_pids_ss_cgroup__get(task);
+    if (!cgrp)
+        return;
+
+    struct ebpf_varlen_field *field = ebpf_vl_field__add(fields, EBPF_VL_FIELD_CGROUP_PATH);
+    if (!field)
+        return;
+    u32 size = ebpf_resolve_kernfs_node_to_string(field->data, BPF_CORE_READ(cgrp, kn));
+    ebpf_vl_field__commit(fields, field, size);
+}
+
+// The path is only added to fields if it's not the same cgroup as the one of
+// pids_ss_cgroup_path, which it is when the pids controller is on the unified
+// hierarchy and enabled for the process' cgroup
+static void ebpf_cgroup_info__fill(struct ebpf_cgroup_info *info,
+                                   struct ebpf_varlen_fields_start *fields,
+                                   const struct task_struct *task)
+{
+    struct cgroup *cgrp = BPF_CORE_READ(task, cgroups, dfl_cgrp);
+
+    // Every process is in the root of the unified hierarchy when it isn't
+    // mounted (or has no controllers and only its root is used, as with
+    // systemd's legacy mode), which can't be told apart from a v2 setup with
+    // the process in the root, both are reported as v1
+    if (BPF_CORE_READ(cgrp, level) == 0 && BPF_CORE_READ(cgrp, root, subsys_mask) == 0) {
+        info->id = 0;
+        return;
+    }
+
+    struct kernfs_node *kn = BPF_CORE_READ(cgrp, kn);
+    info->id               = BPF_CORE_READ(kn, id);
+
+    if (cgrp == ebpf_pids_ss_cgroup__get(task))
+        return;
+
+    struct ebpf_varlen_field *field = ebpf_vl_field__add(fields, EBPF_VL_FIELD_CGROUP_PATH);
+    if (!field)
+        return;
+    u32 size = ebpf_resolve_kernfs_node_to_string(field->data, kn);
+    ebpf_vl_field__commit(fields, field, size);
 }
 
 #endif // EBPF_EVENTPROBE_PATHRESOLVER_H
@@ -15,37 +15,330 @@
 
 #include "Helpers.h"
 #include "PathResolver.h"
+#include "State.h"
+
+// Processes that switched mount namespace with setns since they last exec'd,
+// keyed by tgid, see mntns_switched_from in ebpf_process_exec_event. Entries
+// are inherited on fork and consumed by exec.
+struct ebpf_mntns_switch {
+    u64 start_time_ns; // Of the process, tells a reused tgid apart
+    u32 old_mntns;
+};
+
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, u32);
+    __type(value, struct ebpf_mntns_switch);
+    __uint(max_entries, 4096);
+} elastic_ebpf_events_mntns_switches SEC(".maps");
+
+static struct ebpf_mntns_switch *ebpf_mntns_switch__get(const struct task_struct *task)
+{
+    u32 tgid                     = BPF_CORE_READ(task, tgid);
+    struct ebpf_mntns_switch *sw = bpf_map_lookup_elem(&elastic_ebpf_events_mntns_switches, &tgid);
+    if (!sw || sw->start_time_ns != BPF_CORE_READ(task, group_leader, start_time))
+        return NULL;
+    return sw;
+}
+
+static void ebpf_mntns_switch__set(const struct task_struct *task, u32 old_mntns)
+{
+    u32 tgid                    = BPF_CORE_READ(task, tgid);
+    struct ebpf_mntns_switch sw = {};
+    sw.start_time_ns            = BPF_CORE_READ(task, group_leader, start_time);
+    sw.old_mntns                = old_mntns;
+    bpf_map_update_elem(&elastic_ebpf_events_mntns_switches, &tgid, &sw, BPF_ANY);
+}
+
+static void ebpf_mntns_switch__del(const struct task_struct *task)
+{
+    u32 tgid = BPF_CORE_READ(task, tgid);
+    bpf_map_delete_elem(&elastic_ebpf_events_mntns_switches, &tgid);
+}
+
+// Thread creations (CLONE_THREAD) are only sent up as PROCESS_FORK events when
+// enabled from userspace, see ebpf_event_ctx__set_trace_threads.
+bool trace_threads = false;
 
 SEC("tp_btf/sched_process_fork")
 int BPF_PROG(sched_process_fork, const struct task_struct *parent, const struct task_struct *child)
 {
-    // Ignore the !is_thread_group_leader(child) case as we want to ignore
-    // thread creations in the same thread group.
+    if (is_kernel_thread(child))
+        goto out;
+
+    // A !is_thread_group_leader(child) is a new thread in the parent's
+    // thread group, which is ignored unless trace_threads is set.
     //
     // Note that a non-thread-group-leader can perform a fork(2), or a clone(2)
     // (without CLONE_THREAD), in which case the child will be in a new thread
-    // group. That is something we want to capture, so we only ignore the
-    // !is_thread_group_leader(child) case and not the
+    // group. That is something we always want to capture, so only the
+    // !is_thread_group_leader(child) case is treated as a thread and not the
     // !is_thread_group_leader(parent) case
-    if (!is_thread_group_leader(child) || is_kernel_thread(child))
+    bool is_thread = !is_thread_group_leader(child);
+    if (is_thread && !trace_threads)
+        goto out;
+
+    // Tracked while paused too, so descendants aren't lost across a pause.
+    // Both are keyed by tgid, which a new thread shares with its parent.
+    if (!is_thread)
+        ebpf_pid_filter__fork(parent, child);
+
+    if (ebpf_events_paused())
         goto out;
 
-    struct ebpf_process_fork_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    // Runtimes typically join a container's namespaces in one process and
+    // exec in a child of it
+    struct ebpf_mntns_switch *sw = is_thread ? NULL : ebpf_mntns_switch__get(parent);
+    if (sw)
+        ebpf_mntns_switch__set(child, sw->old_mntns);
+
+    struct ebpf_process_fork_event *event = ebpf_event_buffer__get();
     if (!event)
         goto out;
 
     event->hdr.type = EBPF_EVENT_PROCESS_FORK;
-    event->hdr.ts   = bpf_ktime_get_ns();
+    ebpf_vl_fields__init(&event->vl_fields);
     ebpf_pid_info__fill(&event->parent_pids, parent);
     ebpf_pid_info__fill(&event->child_pids, child);
     ebpf_resolve_pids_ss_cgroup_path_to_string(event->pids_ss_cgroup_path, child);
+    ebpf_cgroup_info__fill(&event->cgroup, &event->vl_fields, child);
+    ebpf_namespace_info__fill(&event->namespaces, child);
+
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_CLONE);
+    event->clone_flags              = state ? state->clone.flags : 0;
+    event->is_thread                = is_thread;
+
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
+
+out:
+    return 0;
+}
+
+// sched_process_fork doesn't have the clone flags, so stash them for the
+// duration of kernel_clone, which fork, vfork, clone and clone3 all go through
+static int kernel_clone__enter(struct kernel_clone_args *args)
+{
+    struct ebpf_events_state state = {};
+    state.clone.flags              = BPF_CORE_READ(args, flags);
+    ebpf_events_state__set(EBPF_EVENTS_STATE_CLONE, &state);
+    return 0;
+}
+
+SEC("fentry/kernel_clone")
+int BPF_PROG(fentry__kernel_clone, struct kernel_clone_args *args)
+{
+    return kernel_clone__enter(args);
+}
+
+SEC("kprobe/kernel_clone")
+int BPF_KPROBE(kprobe__kernel_clone, struct kernel_clone_args *args)
+{
+    return kernel_clone__enter(args);
+}
+
+SEC("fexit/kernel_clone")
+int BPF_PROG(fexit__kernel_clone)
+{
+    ebpf_events_state__del(EBPF_EVENTS_STATE_CLONE);
+    return 0;
+}
+
+SEC("kretprobe/kernel_clone")
+int BPF_KRETPROBE(kretprobe__kernel_clone)
+{
+    ebpf_events_state__del(EBPF_EVENTS_STATE_CLONE);
+    return 0;
+}
+
+// Until exec replaces it, the address space of a forked process is a copy of
+// its parent's, so the parent's argv can be snapshotted from it on entry to
+// execve. That only holds if the process hasn't already exec'd since the fork,
+// i.e. if self_exec_id (bumped on every exec) still matches parent_exec_id
+// (the parent's self_exec_id as of the fork).
+//
+// The syscall is recorded regardless, sched_process_exec can't tell them
+// apart.
+static int exec__enter(enum ebpf_process_exec_source source)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.exec.source              = source;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_EXEC, &state);
+
+    u64 parent_exec_id = BPF_CORE_READ(task, parent_exec_id);
+    if (BPF_CORE_READ(task, self_exec_id) != parent_exec_id)
+        goto out;
 
-    bpf_ringbuf_submit(event, 0);
+    u32 zero = 0;
+    struct ebpf_events_scratch_space *ss =
+        bpf_map_lookup_elem(&elastic_ebpf_events_init_buffer, &zero);
+    if (!ss)
+        goto out;
+    ebpf_events_scratch_space__set(EBPF_EVENTS_STATE_EXEC, ss);
+
+    ss = ebpf_events_scratch_space__get(EBPF_EVENTS_STATE_EXEC);
+    if (!ss)
+        goto out;
+
+    unsigned long arg_start = BPF_CORE_READ(task, mm, arg_start);
+    unsigned long arg_end   = BPF_CORE_READ(task, mm, arg_end);
+    ebpf_argv__fill(ss->exec.parent_argv, sizeof(ss->exec.parent_argv), task);
+    ss->exec.parent_argv_truncated = arg_end - arg_start > sizeof(ss->exec.parent_argv);
+    ss->exec.parent_argv_len =
+        ss->exec.parent_argv_truncated ? sizeof(ss->exec.parent_argv) : arg_end - arg_start;
+    ss->exec.parent_argv_stale =
+        BPF_CORE_READ(task, real_parent, self_exec_id) != parent_exec_id;
 
 out:
     return 0;
 }
 
+// A successful exec has already consumed the state and parent_argv snapshot
+// in sched_process_exec, a failed one leaves them behind
+static int exec__exit(long ret)
+{
+    if (ret) {
+        ebpf_events_state__del(EBPF_EVENTS_STATE_EXEC);
+        ebpf_events_scratch_space__del(EBPF_EVENTS_STATE_EXEC);
+    }
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_execve")
+int tracepoint_syscalls_sys_enter_execve(struct trace_event_raw_sys_enter *args)
+{
+    return exec__enter(EBPF_PROCESS_EXEC_SOURCE_EXECVE);
+}
+
+SEC("tracepoint/syscalls/sys_exit_execve")
+int tracepoint_syscalls_sys_exit_execve(struct trace_event_raw_sys_exit *args)
+{
+    return exec__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_execveat")
+int tracepoint_syscalls_sys_enter_execveat(struct trace_event_raw_sys_enter *args)
+{
+    return exec__enter(EBPF_PROCESS_EXEC_SOURCE_EXECVEAT);
+}
+
+SEC("tracepoint/syscalls/sys_exit_execveat")
+int tracepoint_syscalls_sys_exit_execveat(struct trace_event_raw_sys_exit *args)
+{
+    return exec__exit(BPF_CORE_READ(args, ret));
+}
+
+// memfd_create names the file's dentry "memfd:<name>" and backs it with an
+// inode on the internal shmem (or hugetlbfs) mount that has no links. The
+// name alone would also match any file on disk called "memfd:<something>".
+static bool ebpf_file_is_memfd(const struct file *f)
+{
+    const struct inode *inode = BPF_CORE_READ(f, f_inode);
+    unsigned long magic       = BPF_CORE_READ(inode, i_sb, s_magic);
+    if ((magic != TMPFS_MAGIC && magic != HUGETLBFS_MAGIC) || BPF_CORE_READ(inode, i_nlink) != 0)
+        return false;
+
+    const char prefix[]       = "memfd:";
+    char name[sizeof(prefix)] = {};
+    bpf_probe_read_kernel_str(name, sizeof(name), BPF_CORE_READ(f, f_path.dentry, d_name.name));
+
+    for (int i = 0; i < sizeof(prefix) - 1; i++) {
+        if (name[i] != prefix[i])
+            return false;
+    }
+    return true;
+}
+
+// Walked at exec time, as by the time userspace reads the event the
+// ancestors may be gone, or the process reparented
+static void ebpf_ancestor_comms__fill(struct ebpf_process_exec_event *event,
+                                      const struct task_struct *task)
+{
+    const struct task_struct *t = BPF_CORE_READ(task, group_leader);
+    for (int i = 0; i < ANCESTORS_MAX; i++) {
+        // init's parent is the idle task, pid 0
+        t = t ? BPF_CORE_READ(t, real_parent, group_leader) : NULL;
+        if (t && BPF_CORE_READ(t, tgid) == 0)
+            t = NULL;
+
+        if (t)
+            bpf_probe_read_kernel_str(event->ancestor_comms[i], TASK_COMM_LEN, t->comm);
+        else
+            event->ancestor_comms[i][0] = '\0';
+    }
+}
+
+static enum ebpf_fs_class ebpf_fs_class__get(const struct super_block *sb)
+{
+    switch (BPF_CORE_READ(sb, s_magic)) {
+    case EXT4_SUPER_MAGIC:
+    case XFS_SB_MAGIC:
+    case BTRFS_SUPER_MAGIC:
+    case F2FS_SUPER_MAGIC:
+    case TMPFS_MAGIC:
+    case RAMFS_MAGIC:
+    case OVERLAYFS_SUPER_MAGIC:
+    case SQUASHFS_MAGIC:
+        return EBPF_FS_CLASS_LOCAL;
+    case NFS_SUPER_MAGIC:
+    case SMB_SUPER_MAGIC:
+    case CIFS_SUPER_MAGIC:
+    case SMB2_SUPER_MAGIC:
+    case V9FS_MAGIC:
+    case CEPH_SUPER_MAGIC:
+    case AFS_SUPER_MAGIC:
+        return EBPF_FS_CLASS_NETWORK;
+    case MSDOS_SUPER_MAGIC:
+    case EXFAT_SUPER_MAGIC:
+    case ISOFS_SUPER_MAGIC:
+    case UDF_SUPER_MAGIC:
+        return EBPF_FS_CLASS_REMOVABLE;
+    default:
+        return EBPF_FS_CLASS_UNKNOWN;
+    }
+}
+
+// Bytes of the environment captured on exec, 0 if it isn't. Set by userspace,
+// see ebpf_event_ctx__set_env_capture.
+u32 env_capture_max = 0;
+
+// Copied in one read and split up in userspace, looping over the strings
+// here would cost a lot of instructions for large environments
+static void ebpf_env__fill(struct ebpf_process_exec_event *event, const struct task_struct *task)
+{
+    event->env_truncated = 0;
+    if (!env_capture_max)
+        return;
+
+    unsigned long start = BPF_CORE_READ(task, mm, env_start);
+    unsigned long size  = BPF_CORE_READ(task, mm, env_end) - start;
+
+    event->env_truncated = size > env_capture_max;
+    size                 = event->env_truncated ? env_capture_max : size;
+    size                 = size > ENV_MAX ? ENV_MAX : size;
+
+    struct ebpf_varlen_field *field = ebpf_vl_field__add(&event->vl_fields, EBPF_VL_FIELD_ENV);
+    if (field && bpf_probe_read_user(field->data, size, (void *)start) == 0)
+        ebpf_vl_field__commit(&event->vl_fields, field, size);
+}
+
+static void ebpf_parent_argv__fill(struct ebpf_process_exec_event *event,
+                                   const struct ebpf_events_exec_scratch_space *ss)
+{
+    u32 size = ss->parent_argv_len > ARGV_MAX ? ARGV_MAX : ss->parent_argv_len;
+    if (!size)
+        return;
+
+    struct ebpf_varlen_field *field =
+        ebpf_vl_field__add(&event->vl_fields, EBPF_VL_FIELD_PARENT_ARGV);
+    if (field && bpf_probe_read_kernel(field->data, size, ss->parent_argv) == 0)
+        ebpf_vl_field__commit(&event->vl_fields, field, size);
+}
+
 SEC("tp_btf/sched_process_exec")
 int BPF_PROG(sched_process_exec,
              const struct task_struct *task,
@@ -57,25 +350,94 @@ int BPF_PROG(sched_process_exec,
     // pid info of the thread group leader, all other threads are terminated,
     // and it performs the exec. Thus a non-thread-group-leader performing an
     // exec is valid and something we want to capture
-    if (is_kernel_thread(task))
+    //
+    // Everything in the event is read from kernel memory here, at exec time.
+    // Nothing is left to be filled in later from /proc, as extremely
+    // short-lived processes will often be gone by the time userspace reads
+    // the event.
+    if (is_kernel_thread(task) || ebpf_events_paused())
         goto out;
 
-    struct ebpf_process_exec_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    struct ebpf_process_exec_event *event = ebpf_event_buffer__get();
     if (!event)
         goto out;
 
     event->hdr.type = EBPF_EVENT_PROCESS_EXEC;
-    event->hdr.ts   = bpf_ktime_get_ns();
+    ebpf_vl_fields__init(&event->vl_fields);
 
     ebpf_pid_info__fill(&event->pids, task);
     ebpf_cred_info__fill(&event->creds, task);
     ebpf_ctty__fill(&event->ctty, task);
     ebpf_argv__fill(event->argv, sizeof(event->argv), task);
+    unsigned long argv_len = BPF_CORE_READ(task, mm, arg_end) - BPF_CORE_READ(task, mm, arg_start);
+    event->argv_truncated  = argv_len > sizeof(event->argv);
+    event->argv_len        = event->argv_truncated ? sizeof(event->argv) : argv_len;
+    ebpf_env__fill(event, task);
     ebpf_resolve_path_to_string(event->cwd, &task->fs->pwd, task);
+    ebpf_root_path__fill(&event->vl_fields, task);
     ebpf_resolve_pids_ss_cgroup_path_to_string(event->pids_ss_cgroup_path, task);
+    ebpf_cgroup_info__fill(&event->cgroup, &event->vl_fields, task);
+    ebpf_namespace_info__fill(&event->namespaces, task);
     bpf_probe_read_kernel_str(event->filename, sizeof(event->filename), binprm->filename);
 
-    bpf_ringbuf_submit(event, 0);
+    // interp starts out as filename and is replaced each time a #! interpreter
+    // is loaded, so with nested scripts it's the last one, the one running
+    const char *interp = BPF_CORE_READ(binprm, interp);
+    if (interp != BPF_CORE_READ(binprm, filename)) {
+        struct ebpf_varlen_field *field =
+            ebpf_vl_field__add(&event->vl_fields, EBPF_VL_FIELD_INTERPRETER);
+        long size = field ? bpf_probe_read_kernel_str(field->data, PATH_MAX, interp) : 0;
+        if (size > 0)
+            ebpf_vl_field__commit(&event->vl_fields, field, size);
+    }
+
+    struct ebpf_varlen_field *field =
+        ebpf_vl_field__add(&event->vl_fields, EBPF_VL_FIELD_EXE_PATH);
+    if (field) {
+        u32 size = ebpf_resolve_path_to_string(field->data, &binprm->file->f_path, task);
+        ebpf_vl_field__commit(&event->vl_fields, field, size);
+    }
+
+    event->exe_dev              = BPF_CORE_READ(binprm, file, f_inode, i_sb, s_dev);
+    event->exe_inode            = BPF_CORE_READ(binprm, file, f_inode, i_ino);
+    event->exe_inode_generation = BPF_CORE_READ(binprm, file, f_inode, i_generation);
+    event->no_new_privs         = (BPF_CORE_READ(task, atomic_flags) >> PFA_NO_NEW_PRIVS) & 1;
+
+    const struct super_block *sb = BPF_CORE_READ(binprm, file, f_inode, i_sb);
+    bpf_probe_read_kernel_str(event->exe_fs_type, sizeof(event->exe_fs_type),
+                              BPF_CORE_READ(sb, s_type, name));
+    event->exe_fs_class = ebpf_fs_class__get(sb);
+
+    struct ebpf_mntns_switch *sw = ebpf_mntns_switch__get(task);
+    event->mntns_switched_from   = sw ? sw->old_mntns : 0;
+    ebpf_mntns_switch__del(task);
+    ebpf_ancestor_comms__fill(event, task);
+
+    // The snapshot was keyed by the exec'ing thread's pid, which changes if
+    // it wasn't the thread group leader
+    struct ebpf_events_key key = {};
+    key.pid_tgid               = ((u64)BPF_CORE_READ(task, tgid) << 32) | (u32)old_pid;
+    key.op                     = EBPF_EVENTS_STATE_EXEC;
+
+    struct ebpf_events_scratch_space *ss =
+        bpf_map_lookup_elem(&elastic_ebpf_events_scratch_space, &key);
+    if (ss) {
+        ebpf_parent_argv__fill(event, &ss->exec);
+        event->parent_argv_truncated = ss->exec.parent_argv_truncated;
+        event->parent_argv_stale     = ss->exec.parent_argv_stale;
+    } else {
+        event->parent_argv_truncated = 0;
+        event->parent_argv_stale     = 0;
+    }
+    bpf_map_delete_elem(&elastic_ebpf_events_scratch_space, &key);
+
+    struct ebpf_events_state *state = bpf_map_lookup_elem(&elastic_ebpf_events_state, &key);
+    event->source = state ? state->exec.source : EBPF_PROCESS_EXEC_SOURCE_UNKNOWN;
+    if (ebpf_file_is_memfd(BPF_CORE_READ(binprm, file)))
+        event->source = EBPF_PROCESS_EXEC_SOURCE_MEMFD;
+    bpf_map_delete_elem(&elastic_ebpf_events_state, &key);
+
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
 
 out:
     return 0;
@@ -101,25 +463,44 @@ out:
 // as true once, which signifies the last thread in a thread group exiting.
 static int taskstats_exit__enter(const struct task_struct *task, int group_dead)
 {
-    if (!group_dead || is_kernel_thread(task))
+    if (!group_dead || is_kernel_thread(task) || ebpf_events_paused())
         goto out;
 
-    struct ebpf_process_exit_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    struct ebpf_process_exit_event *event = ebpf_event_buffer__get();
     if (!event)
         goto out;
 
     event->hdr.type = EBPF_EVENT_PROCESS_EXIT;
-    event->hdr.ts   = bpf_ktime_get_ns();
+    ebpf_vl_fields__init(&event->vl_fields);
 
-    // The exit _status_ is stored in the second byte of task->exit_code
+    // The exit _status_ is stored in the second byte of task->exit_code and
+    // the terminating signal (if any) in the low 7 bits
     int exit_code    = BPF_CORE_READ(task, exit_code);
     event->exit_code = (exit_code >> 8) & 0xFF;
+    event->signal    = exit_code & 0x7F;
+
+    // mark_oom_victim sets signal->oom_mm on the victim and it's never cleared
+    // for the lifetime of the signal_struct. A task that was already exiting
+    // when the OOM killer ran may be marked too (see task_will_free_mem), so
+    // also require a SIGKILL to avoid flagging processes that exited on their
+    // own.
+    event->oom_killed = event->signal == SIGKILL && BPF_CORE_READ(task, signal, oom_mm) != NULL;
     ebpf_pid_info__fill(&event->pids, task);
     ebpf_resolve_pids_ss_cgroup_path_to_string(event->pids_ss_cgroup_path, task);
+    ebpf_cgroup_info__fill(&event->cgroup, &event->vl_fields, task);
+    ebpf_namespace_info__fill(&event->namespaces, task);
 
-    bpf_ringbuf_submit(event, 0);
+    ebpf_ringbuf_output(event, EBPF_VL_EVENT_SIZE(event));
 
 out:
+    // The exit is the last event of a process. A process reusing its pid gets
+    // a fresh sequence anyway (its start time differs), this just frees the
+    // map entry.
+    if (group_dead) {
+        ebpf_proc_seq__del(task);
+        ebpf_mntns_switch__del(task);
+        ebpf_pid_filter__del(task);
+    }
     return 0;
 }
 
@@ -137,52 +518,154 @@ int BPF_KPROBE(kprobe__taskstats_exit, const struct task_struct *task, int group
 
 // tracepoint/syscalls/sys_[enter/exit]_[name] tracepoints are not available
 // with BTF type information, so we must use a non-BTF tracepoint
+SEC("tracepoint/syscalls/sys_enter_setsid")
+int tracepoint_syscalls_sys_enter_setsid(struct trace_event_raw_sys_enter *args)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    ebpf_pid_info__fill(&state.setsid.old_pids, task);
+    ebpf_events_state__set(EBPF_EVENTS_STATE_SETSID, &state);
+
+out:
+    return 0;
+}
+
 SEC("tracepoint/syscalls/sys_exit_setsid")
 int tracepoint_syscalls_sys_exit_setsid(struct trace_event_raw_sys_exit *args)
 {
     const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
 
-    if (is_kernel_thread(task))
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_SETSID);
+    if (!state)
         goto out;
 
+    // Fails with EPERM if the process is already a process group leader
+    // (which includes session leaders), nothing changed then
     if (BPF_CORE_READ(args, ret) < 0)
-        goto out;
+        goto out_del;
 
-    struct ebpf_process_setsid_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+    struct ebpf_process_setsid_event *event = ebpf_ringbuf_reserve(sizeof(*event));
     if (!event)
-        goto out;
+        goto out_del;
 
     event->hdr.type = EBPF_EVENT_PROCESS_SETSID;
-    event->hdr.ts   = bpf_ktime_get_ns();
 
     ebpf_pid_info__fill(&event->pids, task);
+    event->old_pids = state->setsid.old_pids;
 
-    bpf_ringbuf_submit(event, 0);
+    ebpf_ringbuf_submit(event);
 
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_SETSID);
 out:
     return 0;
 }
 
-static int commit_creds__enter(struct cred *new)
+static int chdir__enter(enum ebpf_process_chdir_syscall syscall, int fd)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.chdir.syscall            = syscall;
+    state.chdir.fd                 = fd;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_CHDIR, &state);
+
+out:
+    return 0;
+}
+
+static int chdir__exit(long ret)
 {
     const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
-    const struct cred *old         = BPF_CORE_READ(task, real_cred);
 
-    // NB: We check for a changed fsuid/fsgid despite not sending it up.  This
-    // keeps this implementation in-line with the existing endpoint behaviour
-    // for the kprobes/tracefs events implementation.
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_CHDIR);
+    if (!state)
+        goto out;
+
+    if (ret < 0)
+        goto out_del;
+
+    struct ebpf_process_chdir_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    event->hdr.type = EBPF_EVENT_PROCESS_CHDIR;
+    event->syscall  = state->chdir.syscall;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    // fchdir switched to the directory the fd refers to, chdir's path may
+    // have been relative or gone through symlinks, so take the new pwd
+    struct file *dir = NULL;
+    if (state->chdir.syscall == EBPF_PROCESS_CHDIR_SYSCALL_FCHDIR)
+        dir = fd_to_file(task, state->chdir.fd);
+    if (dir)
+        ebpf_resolve_path_to_string(event->cwd, &dir->f_path, task);
+    else
+        ebpf_resolve_path_to_string(event->cwd, &task->fs->pwd, task);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_CHDIR);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_chdir")
+int tracepoint_syscalls_sys_enter_chdir(struct trace_event_raw_sys_enter *args)
+{
+    return chdir__enter(EBPF_PROCESS_CHDIR_SYSCALL_CHDIR, -1);
+}
+
+SEC("tracepoint/syscalls/sys_exit_chdir")
+int tracepoint_syscalls_sys_exit_chdir(struct trace_event_raw_sys_exit *args)
+{
+    return chdir__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_fchdir")
+int tracepoint_syscalls_sys_enter_fchdir(struct trace_event_raw_sys_enter *args)
+{
+    // fchdir(fd)
+    return chdir__enter(EBPF_PROCESS_CHDIR_SYSCALL_FCHDIR, BPF_CORE_READ(args, args[0]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_fchdir")
+int tracepoint_syscalls_sys_exit_fchdir(struct trace_event_raw_sys_exit *args)
+{
+    return chdir__exit(BPF_CORE_READ(args, ret));
+}
+
+static int commit_creds__enter(struct cred *new)
+{
+    const struct task_struct *task  = (struct task_struct *)bpf_get_current_task();
+    const struct cred *old          = BPF_CORE_READ(task, real_cred);
+    const struct user_namespace *ns = BPF_CORE_READ(new, user_ns);
+
+    if (ebpf_events_paused())
+        goto out;
+
+    // Any change to the credentials is reported with all of their new values,
+    // arguments of -1 (e.g. to setresuid) leave the old value in new
 
     if (BPF_CORE_READ(new, uid.val) != BPF_CORE_READ(old, uid.val) ||
         BPF_CORE_READ(new, euid.val) != BPF_CORE_READ(old, euid.val) ||
         BPF_CORE_READ(new, suid.val) != BPF_CORE_READ(old, suid.val) ||
         BPF_CORE_READ(new, fsuid.val) != BPF_CORE_READ(old, fsuid.val)) {
 
-        struct ebpf_process_setuid_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+        struct ebpf_process_setuid_event *event = ebpf_ringbuf_reserve(sizeof(*event));
         if (!event)
             goto out;
 
         event->hdr.type = EBPF_EVENT_PROCESS_SETUID;
-        event->hdr.ts   = bpf_ktime_get_ns();
 
         ebpf_pid_info__fill(&event->pids, task);
 
@@ -194,7 +677,17 @@ static int commit_creds__enter(struct cred *new)
         event->new_rgid = BPF_CORE_READ(new, gid.val);
         event->new_egid = BPF_CORE_READ(new, egid.val);
 
-        bpf_ringbuf_submit(event, 0);
+        event->new_container_ruid = ebpf_from_kuid(ns, event->new_ruid);
+        event->new_container_euid = ebpf_from_kuid(ns, event->new_euid);
+        event->new_container_rgid = ebpf_from_kgid(ns, event->new_rgid);
+        event->new_container_egid = ebpf_from_kgid(ns, event->new_egid);
+
+        event->new_suid            = BPF_CORE_READ(new, suid.val);
+        event->new_fsuid           = BPF_CORE_READ(new, fsuid.val);
+        event->new_container_suid  = ebpf_from_kuid(ns, event->new_suid);
+        event->new_container_fsuid = ebpf_from_kuid(ns, event->new_fsuid);
+
+        ebpf_ringbuf_submit(event);
     }
 
     if (BPF_CORE_READ(new, gid.val) != BPF_CORE_READ(old, gid.val) ||
@@ -202,12 +695,11 @@ static int commit_creds__enter(struct cred *new)
         BPF_CORE_READ(new, sgid.val) != BPF_CORE_READ(old, sgid.val) ||
         BPF_CORE_READ(new, fsgid.val) != BPF_CORE_READ(old, fsgid.val)) {
 
-        struct ebpf_process_setgid_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
+        struct ebpf_process_setgid_event *event = ebpf_ringbuf_reserve(sizeof(*event));
         if (!event)
             goto out;
 
         event->hdr.type = EBPF_EVENT_PROCESS_SETGID;
-        event->hdr.ts   = bpf_ktime_get_ns();
 
         ebpf_pid_info__fill(&event->pids, task);
 
@@ -216,7 +708,45 @@ static int commit_creds__enter(struct cred *new)
         event->new_ruid = BPF_CORE_READ(new, uid.val);
         event->new_euid = BPF_CORE_READ(new, euid.val);
 
-        bpf_ringbuf_submit(event, 0);
+        event->new_container_rgid = ebpf_from_kgid(ns, event->new_rgid);
+        event->new_container_egid = ebpf_from_kgid(ns, event->new_egid);
+        event->new_container_ruid = ebpf_from_kuid(ns, event->new_ruid);
+        event->new_container_euid = ebpf_from_kuid(ns, event->new_euid);
+
+        event->new_sgid            = BPF_CORE_READ(new, sgid.val);
+        event->new_fsgid           = BPF_CORE_READ(new, fsgid.val);
+        event->new_container_sgid  = ebpf_from_kgid(ns, event->new_sgid);
+        event->new_container_fsgid = ebpf_from_kgid(ns, event->new_fsgid);
+
+        ebpf_ringbuf_submit(event);
+    }
+
+    // kernel_cap_t is 8 bytes either way, see ebpf_cred_info__fill
+    u64 old_eff, new_eff, old_prm, new_prm, old_inh, new_inh;
+    bpf_core_read(&old_eff, sizeof(old_eff), &old->cap_effective);
+    bpf_core_read(&new_eff, sizeof(new_eff), &new->cap_effective);
+    bpf_core_read(&old_prm, sizeof(old_prm), &old->cap_permitted);
+    bpf_core_read(&new_prm, sizeof(new_prm), &new->cap_permitted);
+    bpf_core_read(&old_inh, sizeof(old_inh), &old->cap_inheritable);
+    bpf_core_read(&new_inh, sizeof(new_inh), &new->cap_inheritable);
+
+    if (old_eff != new_eff || old_prm != new_prm || old_inh != new_inh) {
+        struct ebpf_process_setcap_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+        if (!event)
+            goto out;
+
+        event->hdr.type = EBPF_EVENT_PROCESS_SETCAP;
+
+        ebpf_pid_info__fill(&event->pids, task);
+
+        event->old_cap_effective   = old_eff;
+        event->new_cap_effective   = new_eff;
+        event->old_cap_permitted   = old_prm;
+        event->new_cap_permitted   = new_prm;
+        event->old_cap_inheritable = old_inh;
+        event->new_cap_inheritable = new_inh;
+
+        ebpf_ringbuf_submit(event);
     }
 
 out:
@@ -235,22 +765,76 @@ int BPF_KPROBE(kprobe__commit_creds, struct cred *new)
     return commit_creds__enter(new);
 }
 
+// Per-tty write sequence numbers, see struct ebpf_process_tty_write_event.
+// Concurrent writes to the same tty are only serialized by the kernel after
+// tty_write is entered, so they may rarely end up with the same number.
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, u32); // major << 20 | minor
+    __type(value, u64);
+    __uint(max_entries, 1024);
+} elastic_ebpf_events_tty_write_seq SEC(".maps");
+
+static u64 tty_write__next_seq(const struct ebpf_tty_dev *tty)
+{
+    u32 key  = (u32)tty->major << 20 | tty->minor;
+    u64 *seq = bpf_map_lookup_elem(&elastic_ebpf_events_tty_write_seq, &key);
+    if (seq)
+        return ++*seq;
+
+    u64 first = 0;
+    bpf_map_update_elem(&elastic_ebpf_events_tty_write_seq, &key, &first, BPF_NOEXIST);
+    return first;
+}
+
+// Returns whether the rest of the write should be emitted too
+static bool tty_write__emit_chunk(const char *buf,
+                                  u64 count,
+                                  u64 offset,
+                                  u64 seq,
+                                  const struct ebpf_tty_dev *tty)
+{
+    struct ebpf_process_tty_write_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        return false;
+
+    u64 len = count - offset > TTY_OUT_MAX ? TTY_OUT_MAX : count - offset;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type          = EBPF_EVENT_PROCESS_TTY_WRITE;
+    event->tty_out_len       = len;
+    event->tty_out_truncated = count - offset - len;
+    event->tty_out_offset    = offset;
+    event->tty_out_total_len = count;
+    event->tty_write_seq     = seq;
+    event->tty               = *tty;
+    ebpf_pid_info__fill(&event->pids, task);
+    ebpf_ctty__fill(&event->ctty, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    if (bpf_probe_read_user(event->tty_out, len, (void *)(buf + offset))) {
+        bpf_printk("tty_write__emit_chunk: error reading buf\n");
+        bpf_ringbuf_discard(event, 0);
+        return false;
+    }
+
+    ebpf_ringbuf_submit(event);
+    return true;
+}
+
 static int tty_write__enter(struct kiocb *iocb, struct iov_iter *from)
 {
     const char *buf = BPF_CORE_READ(from, iov, iov_base);
     ssize_t count   = BPF_CORE_READ(from, iov, iov_len);
     struct file *f  = BPF_CORE_READ(iocb, ki_filp);
 
-    if (is_consumer())
+    if (is_consumer() || ebpf_events_paused())
         goto out;
 
     if (count <= 0)
         goto out;
 
-    struct ebpf_process_tty_write_event *event = bpf_ringbuf_reserve(&ringbuf, sizeof(*event), 0);
-    if (!event)
-        goto out;
-
     struct tty_file_private *tfp = (struct tty_file_private *)BPF_CORE_READ(f, private_data);
     struct tty_struct *tty       = BPF_CORE_READ(tfp, tty);
 
@@ -259,49 +843,32 @@ static int tty_write__enter(struct kiocb *iocb, struct iov_iter *from)
     // @link: link to another pty (master -> slave and vice versa)
     //
     // https://elixir.bootlin.com/linux/v5.19.9/source/drivers/tty/tty_io.c#L2643
-    bool is_master             = false;
-    struct ebpf_tty_dev master = {};
+    bool is_master              = false;
+    struct ebpf_tty_dev master  = {};
+    struct ebpf_tty_dev tty_dev = {};
     if (BPF_CORE_READ(tty, driver, type) == TTY_DRIVER_TYPE_PTY &&
         BPF_CORE_READ(tty, driver, subtype) == PTY_TYPE_MASTER) {
         struct tty_struct *tmp = BPF_CORE_READ(tty, link);
         ebpf_tty_dev__fill(&master, tty);
-        ebpf_tty_dev__fill(&event->tty, tmp);
+        ebpf_tty_dev__fill(&tty_dev, tmp);
         is_master = true;
     } else {
-        ebpf_tty_dev__fill(&event->tty, tty);
+        ebpf_tty_dev__fill(&tty_dev, tty);
     }
 
-    event->hdr.type = EBPF_EVENT_PROCESS_TTY_WRITE;
-    event->hdr.ts   = bpf_ktime_get_ns();
-
-    u64 len                  = count > TTY_OUT_MAX ? TTY_OUT_MAX : count;
-    event->tty_out_len       = len;
-    event->tty_out_truncated = count > TTY_OUT_MAX ? count - TTY_OUT_MAX : 0;
-
-    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
-    ebpf_pid_info__fill(&event->pids, task);
-    ebpf_ctty__fill(&event->ctty, task);
-    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
-
-    if (event->tty.major == 0 && event->tty.minor == 0) {
-        bpf_ringbuf_discard(event, 0);
+    if (tty_dev.major == 0 && tty_dev.minor == 0)
         goto out;
-    }
 
-    if (bpf_probe_read_user(event->tty_out, len, (void *)buf)) {
-        bpf_printk("tty_write__enter: error reading buf\n");
-        bpf_ringbuf_discard(event, 0);
+    if ((is_master && !(master.termios.c_lflag & ECHO)) && !(tty_dev.termios.c_lflag & ECHO))
         goto out;
-    }
 
-    if ((is_master && !(master.termios.c_lflag & ECHO)) && !(event->tty.termios.c_lflag & ECHO)) {
-        bpf_printk("tty_write__enter: discarding %s\n", event->tty_out);
-        bpf_ringbuf_discard(event, 0);
-        goto out;
+    u64 seq = tty_write__next_seq(&tty_dev);
+    for (int i = 0; i < TTY_OUT_CHUNKS_MAX; i++) {
+        u64 offset = (u64)i * TTY_OUT_MAX;
+        if (offset >= count || !tty_write__emit_chunk(buf, count, offset, seq, &tty_dev))
+            break;
     }
 
-    bpf_ringbuf_submit(event, 0);
-
 out:
     return 0;
 }
@@ -317,3 +884,985 @@ int BPF_KPROBE(kprobe__tty_write, struct kiocb *iocb, struct iov_iter *from)
 {
     return tty_write__enter(iocb, from);
 }
+
+// sched_setscheduler and setpriority only tell whether they succeeded on exit,
+// so the arguments are stashed on entry and the event emitted on exit
+static int setsched__enter(struct ebpf_events_setsched_state *setsched)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    if (setsched->target_type == EBPF_PROCESS_SETSCHED_TARGET_PROCESS && setsched->target_id == 0)
+        setsched->target_id = (u32)bpf_get_current_pid_tgid();
+
+    struct ebpf_events_state state = {};
+    state.setsched                 = *setsched;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_SETSCHED, &state);
+
+out:
+    return 0;
+}
+
+static int setsched__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_SETSCHED);
+    if (!state)
+        goto out;
+
+    if (ret < 0)
+        goto out_del;
+
+    struct ebpf_process_setsched_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type       = EBPF_EVENT_PROCESS_SETSCHED;
+    event->syscall        = state->setsched.syscall;
+    event->target_type    = state->setsched.target_type;
+    event->target_id      = state->setsched.target_id;
+    event->policy         = state->setsched.policy;
+    event->sched_priority = state->setsched.sched_priority;
+    event->nice           = state->setsched.nice;
+    ebpf_pid_info__fill(&event->pids, task);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_SETSCHED);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_sched_setscheduler")
+int tracepoint_syscalls_sys_enter_sched_setscheduler(struct trace_event_raw_sys_enter *args)
+{
+    // sched_setscheduler(pid, policy, param)
+    struct ebpf_events_setsched_state setsched = {};
+    setsched.syscall     = EBPF_PROCESS_SETSCHED_SYSCALL_SCHED_SETSCHEDULER;
+    setsched.target_type = EBPF_PROCESS_SETSCHED_TARGET_PROCESS;
+    setsched.target_id   = BPF_CORE_READ(args, args[0]);
+    setsched.policy      = BPF_CORE_READ(args, args[1]);
+
+    // struct sched_param only holds sched_priority
+    const void *param = (const void *)BPF_CORE_READ(args, args[2]);
+    bpf_probe_read_user(&setsched.sched_priority, sizeof(setsched.sched_priority), param);
+
+    return setsched__enter(&setsched);
+}
+
+SEC("tracepoint/syscalls/sys_exit_sched_setscheduler")
+int tracepoint_syscalls_sys_exit_sched_setscheduler(struct trace_event_raw_sys_exit *args)
+{
+    return setsched__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_setpriority")
+int tracepoint_syscalls_sys_enter_setpriority(struct trace_event_raw_sys_enter *args)
+{
+    // setpriority(which, who, niceval)
+    struct ebpf_events_setsched_state setsched = {};
+    setsched.syscall     = EBPF_PROCESS_SETSCHED_SYSCALL_SETPRIORITY;
+    setsched.target_type = BPF_CORE_READ(args, args[0]);
+    setsched.target_id   = BPF_CORE_READ(args, args[1]);
+    setsched.nice        = BPF_CORE_READ(args, args[2]);
+
+    return setsched__enter(&setsched);
+}
+
+SEC("tracepoint/syscalls/sys_exit_setpriority")
+int tracepoint_syscalls_sys_exit_setpriority(struct trace_event_raw_sys_exit *args)
+{
+    return setsched__exit(BPF_CORE_READ(args, ret));
+}
+
+static u32 pid_for_children(const struct task_struct *task)
+{
+    return BPF_CORE_READ(task, nsproxy, pid_ns_for_children, ns.inum);
+}
+
+// Records the namespaces of the current task before a setns or unshare
+static void namespaces__enter(enum ebpf_events_state_op op)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        return;
+
+    struct ebpf_events_state state = {};
+    ebpf_namespace_info__fill(&state.namespaces.ns, task);
+    state.namespaces.pid_for_children = pid_for_children(task);
+    ebpf_events_state__set(op, &state);
+}
+
+// CLONE_NEW* flags of the namespaces that differ from those in old
+static u64 namespaces__changed(const struct ebpf_events_namespace_state *old,
+                               const struct ebpf_namespace_info *new,
+                               u32 new_pid_for_children)
+{
+    u64 flags = 0;
+
+    if (new->mnt != old->ns.mnt)
+        flags |= CLONE_NEWNS;
+    if (new->cgroup != old->ns.cgroup)
+        flags |= CLONE_NEWCGROUP;
+    if (new->uts != old->ns.uts)
+        flags |= CLONE_NEWUTS;
+    if (new->ipc != old->ns.ipc)
+        flags |= CLONE_NEWIPC;
+    if (new->user != old->ns.user)
+        flags |= CLONE_NEWUSER;
+    if (new_pid_for_children != old->pid_for_children)
+        flags |= CLONE_NEWPID;
+    if (new->net != old->ns.net)
+        flags |= CLONE_NEWNET;
+
+    return flags;
+}
+
+static void namespace_event__emit(enum ebpf_event_type type,
+                                  const struct ebpf_events_namespace_state *old,
+                                  const struct task_struct *task)
+{
+    struct ebpf_namespace_info new;
+    ebpf_namespace_info__fill(&new, task);
+    u64 flags = namespaces__changed(old, &new, pid_for_children(task));
+    if (!flags)
+        return;
+
+    struct ebpf_process_namespace_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        return;
+
+    event->hdr.type       = type;
+    event->ns_flags       = flags;
+    event->old_namespaces = old->ns;
+    event->new_namespaces = new;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+}
+
+SEC("tracepoint/syscalls/sys_enter_setns")
+int tracepoint_syscalls_sys_enter_setns(struct trace_event_raw_sys_enter *args)
+{
+    // setns(fd, nstype), a nstype of 0 allows any namespace type (and a pidfd
+    // can join several at once), so which namespaces changed is only known on
+    // exit
+    namespaces__enter(EBPF_EVENTS_STATE_SETNS);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_exit_setns")
+int tracepoint_syscalls_sys_exit_setns(struct trace_event_raw_sys_exit *args)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_SETNS);
+    if (!state)
+        goto out;
+
+    if (BPF_CORE_READ(args, ret) < 0)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    namespace_event__emit(EBPF_EVENT_PROCESS_SETNS, &state->namespaces, task);
+
+    u32 old_mntns = state->namespaces.ns.mnt;
+    u32 new_mntns = mntns(task);
+    if (new_mntns == old_mntns)
+        goto out_del;
+
+    ebpf_mntns_switch__set(task, old_mntns);
+
+    struct ebpf_filesystem_view_change_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    event->hdr.type  = EBPF_EVENT_FILESYSTEM_VIEW_CHANGE;
+    event->old_mntns = old_mntns;
+    event->new_mntns = new_mntns;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_SETNS);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_unshare")
+int tracepoint_syscalls_sys_enter_unshare(struct trace_event_raw_sys_enter *args)
+{
+    // unshare(flags), which may not ask for any new namespace at all (e.g.
+    // only unshare the file descriptor table), events are only sent for those
+    // that changed, as for setns
+    namespaces__enter(EBPF_EVENTS_STATE_UNSHARE);
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_exit_unshare")
+int tracepoint_syscalls_sys_exit_unshare(struct trace_event_raw_sys_exit *args)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_UNSHARE);
+    if (!state)
+        goto out;
+
+    if (BPF_CORE_READ(args, ret) >= 0) {
+        const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+        namespace_event__emit(EBPF_EVENT_PROCESS_UNSHARE, &state->namespaces, task);
+    }
+
+    ebpf_events_state__del(EBPF_EVENTS_STATE_UNSHARE);
+out:
+    return 0;
+}
+
+static void bpf_link__enter(int cmd, const union bpf_attr *uattr)
+{
+    struct ebpf_events_state state = {};
+
+    if (cmd == BPF_LINK_CREATE) {
+        state.bpf_link.cmd = EBPF_PROCESS_BPF_LINK_CMD_LINK_CREATE;
+        bpf_probe_read_user(&state.bpf_link.prog_fd, sizeof(u32), &uattr->link_create.prog_fd);
+        bpf_probe_read_user(&state.bpf_link.target_fd, sizeof(u32),
+                            &uattr->link_create.target_fd);
+        bpf_probe_read_user(&state.bpf_link.attach_type, sizeof(u32),
+                            &uattr->link_create.attach_type);
+    } else if (cmd == BPF_RAW_TRACEPOINT_OPEN) {
+        state.bpf_link.cmd         = EBPF_PROCESS_BPF_LINK_CMD_RAW_TRACEPOINT_OPEN;
+        state.bpf_link.target_fd   = -1;
+        state.bpf_link.attach_type = BPF_TRACE_RAW_TP;
+        bpf_probe_read_user(&state.bpf_link.prog_fd, sizeof(u32), &uattr->raw_tracepoint.prog_fd);
+        bpf_probe_read_user(&state.bpf_link.tp_name, sizeof(u64), &uattr->raw_tracepoint.name);
+    } else {
+        return;
+    }
+
+    ebpf_events_state__set(EBPF_EVENTS_STATE_BPF_LINK, &state);
+}
+
+static void bpf_syscall__enter(int cmd, const union bpf_attr *uattr)
+{
+    struct ebpf_events_state state = {};
+
+    if (cmd == BPF_PROG_LOAD) {
+        state.bpf_syscall.cmd = EBPF_PROCESS_BPF_SYSCALL_CMD_PROG_LOAD;
+        bpf_probe_read_user(&state.bpf_syscall.type, sizeof(u32), &uattr->prog_type);
+        bpf_probe_read_user(state.bpf_syscall.name, BPF_NAME_MAX, &uattr->prog_name);
+    } else if (cmd == BPF_MAP_CREATE) {
+        state.bpf_syscall.cmd = EBPF_PROCESS_BPF_SYSCALL_CMD_MAP_CREATE;
+        bpf_probe_read_user(&state.bpf_syscall.type, sizeof(u32), &uattr->map_type);
+        bpf_probe_read_user(state.bpf_syscall.name, BPF_NAME_MAX, &uattr->map_name);
+    } else {
+        return;
+    }
+
+    ebpf_events_state__set(EBPF_EVENTS_STATE_BPF_SYSCALL, &state);
+}
+
+SEC("tracepoint/syscalls/sys_enter_bpf")
+int tracepoint_syscalls_sys_enter_bpf(struct trace_event_raw_sys_enter *args)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    // Skip the programs, maps and links of our own probes
+    if (is_consumer() || is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    // bpf(cmd, attr, size)
+    int cmd                     = BPF_CORE_READ(args, args[0]);
+    const union bpf_attr *uattr = (const union bpf_attr *)BPF_CORE_READ(args, args[1]);
+
+    bpf_link__enter(cmd, uattr);
+    bpf_syscall__enter(cmd, uattr);
+
+out:
+    return 0;
+}
+
+static int bpf_link__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_BPF_LINK);
+    if (!state)
+        goto out;
+
+    // The link's fd on success
+    if (ret < 0)
+        goto out_del;
+
+    struct ebpf_process_bpf_link_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    struct file *prog_file = fd_to_file(task, state->bpf_link.prog_fd);
+    struct bpf_prog *prog  = prog_file ? BPF_CORE_READ(prog_file, private_data) : NULL;
+    struct file *link_file = fd_to_file(task, ret);
+    struct bpf_link *link  = link_file ? BPF_CORE_READ(link_file, private_data) : NULL;
+
+    event->hdr.type       = EBPF_EVENT_PROCESS_BPF_LINK;
+    event->cmd            = state->bpf_link.cmd;
+    event->attach_type    = state->bpf_link.attach_type;
+    event->prog_id        = prog ? BPF_CORE_READ(prog, aux, id) : 0;
+    event->link_id        = link ? BPF_CORE_READ(link, id) : 0;
+    event->target_ifindex = 0;
+    event->target[0]      = '\0';
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    // Tracing programs (fentry, fexit, LSM, ...) are bound to their target
+    // function at load time
+    const char *func_name = prog ? BPF_CORE_READ(prog, aux, attach_func_name) : NULL;
+
+    if (state->bpf_link.tp_name) {
+        bpf_probe_read_user_str(event->target, sizeof(event->target),
+                                (const char *)state->bpf_link.tp_name);
+    } else if (func_name) {
+        bpf_probe_read_kernel_str(event->target, sizeof(event->target), func_name);
+    } else if (event->attach_type == BPF_XDP) {
+        event->target_ifindex = state->bpf_link.target_fd;
+    } else {
+        struct file *target = fd_to_file(task, state->bpf_link.target_fd);
+        if (target)
+            ebpf_resolve_path_to_string(event->target, &target->f_path, task);
+    }
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_BPF_LINK);
+out:
+    return 0;
+}
+
+static int bpf_syscall__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_BPF_SYSCALL);
+    if (!state)
+        goto out;
+
+    // The program's or map's fd on success
+    if (ret < 0)
+        goto out_del;
+
+    struct ebpf_process_bpf_syscall_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    struct file *file              = fd_to_file(task, ret);
+
+    event->hdr.type = EBPF_EVENT_PROCESS_BPF_SYSCALL;
+    event->cmd      = state->bpf_syscall.cmd;
+    event->type     = state->bpf_syscall.type;
+    event->id       = 0;
+    if (file && event->cmd == EBPF_PROCESS_BPF_SYSCALL_CMD_PROG_LOAD) {
+        struct bpf_prog *prog = BPF_CORE_READ(file, private_data);
+        event->id             = BPF_CORE_READ(prog, aux, id);
+    } else if (file) {
+        struct bpf_map *map = BPF_CORE_READ(file, private_data);
+        event->id           = BPF_CORE_READ(map, id);
+    }
+    __builtin_memcpy(event->name, state->bpf_syscall.name, BPF_NAME_MAX);
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_BPF_SYSCALL);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_exit_bpf")
+int tracepoint_syscalls_sys_exit_bpf(struct trace_event_raw_sys_exit *args)
+{
+    long ret = BPF_CORE_READ(args, ret);
+
+    bpf_link__exit(ret);
+    bpf_syscall__exit(ret);
+
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_prctl")
+int tracepoint_syscalls_sys_enter_prctl(struct trace_event_raw_sys_enter *args)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    // prctl(PR_SET_MM, field, value, ...), PR_SET_MM_MAP_SIZE only queries
+    // the size of struct prctl_mm_map
+    int option = BPF_CORE_READ(args, args[0]);
+    int field  = BPF_CORE_READ(args, args[1]);
+    if (option != PR_SET_MM || field == PR_SET_MM_MAP_SIZE)
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.prctl_set_mm.field       = field;
+    if (field != EBPF_PROCESS_MM_FIELD_MAP)
+        state.prctl_set_mm.value = BPF_CORE_READ(args, args[2]);
+    ebpf_events_state__set(EBPF_EVENTS_STATE_PRCTL_SET_MM, &state);
+
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_exit_prctl")
+int tracepoint_syscalls_sys_exit_prctl(struct trace_event_raw_sys_exit *args)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_PRCTL_SET_MM);
+    if (!state)
+        goto out;
+
+    if (BPF_CORE_READ(args, ret) < 0)
+        goto out_del;
+
+    struct ebpf_process_mm_spoof_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type    = EBPF_EVENT_PROCESS_MM_SPOOF;
+    event->field       = state->prctl_set_mm.field;
+    event->value       = state->prctl_set_mm.value;
+    event->exe_path[0] = '\0';
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    // The exe has been replaced by now
+    if (event->field == EBPF_PROCESS_MM_FIELD_EXE_FILE ||
+        event->field == EBPF_PROCESS_MM_FIELD_MAP) {
+        struct path p = BPF_CORE_READ(task, mm, exe_file, f_path);
+        ebpf_resolve_path_to_string(event->exe_path, &p, task);
+    }
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_PRCTL_SET_MM);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_ptrace")
+int tracepoint_syscalls_sys_enter_ptrace(struct trace_event_raw_sys_enter *args)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    // ptrace(request, pid, addr, data)
+    long request = BPF_CORE_READ(args, args[0]);
+    switch (request) {
+    case EBPF_PROCESS_PTRACE_REQUEST_TRACEME:
+    case EBPF_PROCESS_PTRACE_REQUEST_POKETEXT:
+    case EBPF_PROCESS_PTRACE_REQUEST_POKEDATA:
+    case EBPF_PROCESS_PTRACE_REQUEST_POKEUSER:
+    case EBPF_PROCESS_PTRACE_REQUEST_SETREGS:
+    case EBPF_PROCESS_PTRACE_REQUEST_SETFPREGS:
+    case EBPF_PROCESS_PTRACE_REQUEST_ATTACH:
+    case EBPF_PROCESS_PTRACE_REQUEST_SETREGSET:
+    case EBPF_PROCESS_PTRACE_REQUEST_SEIZE:
+        break;
+    default:
+        goto out;
+    }
+
+    struct ebpf_events_state state = {};
+    state.ptrace.request           = request;
+    state.ptrace.target_pid        = BPF_CORE_READ(args, args[1]);
+    if (request == EBPF_PROCESS_PTRACE_REQUEST_TRACEME)
+        state.ptrace.target_pid = (u32)bpf_get_current_pid_tgid();
+    ebpf_events_state__set(EBPF_EVENTS_STATE_PTRACE, &state);
+
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_exit_ptrace")
+int tracepoint_syscalls_sys_exit_ptrace(struct trace_event_raw_sys_exit *args)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_PTRACE);
+    if (!state)
+        goto out;
+
+    if (BPF_CORE_READ(args, ret) < 0)
+        goto out_del;
+
+    struct ebpf_process_ptrace_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type   = EBPF_EVENT_PROCESS_PTRACE;
+    event->request    = state->ptrace.request;
+    event->target_pid = state->ptrace.target_pid;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_PTRACE);
+out:
+    return 0;
+}
+
+static int signal__enter(enum ebpf_process_signal_syscall syscall,
+                         s32 target_pid,
+                         s32 target_tgid,
+                         s32 sig)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.signal.syscall           = syscall;
+    state.signal.target_pid        = target_pid;
+    state.signal.target_tgid       = target_tgid;
+    state.signal.signal            = sig;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_SIGNAL, &state);
+
+out:
+    return 0;
+}
+
+static int signal__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_SIGNAL);
+    if (!state)
+        goto out;
+
+    if (ret < 0)
+        goto out_del;
+
+    struct ebpf_process_signal_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type    = EBPF_EVENT_PROCESS_SIGNAL;
+    event->syscall     = state->signal.syscall;
+    event->target_pid  = state->signal.target_pid;
+    event->target_tgid = state->signal.target_tgid;
+    event->signal      = state->signal.signal;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_SIGNAL);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_kill")
+int tracepoint_syscalls_sys_enter_kill(struct trace_event_raw_sys_enter *args)
+{
+    // kill(pid, sig)
+    s32 pid = BPF_CORE_READ(args, args[0]);
+    return signal__enter(EBPF_PROCESS_SIGNAL_SYSCALL_KILL, pid, pid, BPF_CORE_READ(args, args[1]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_kill")
+int tracepoint_syscalls_sys_exit_kill(struct trace_event_raw_sys_exit *args)
+{
+    return signal__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_tgkill")
+int tracepoint_syscalls_sys_enter_tgkill(struct trace_event_raw_sys_enter *args)
+{
+    // tgkill(tgid, tid, sig)
+    return signal__enter(EBPF_PROCESS_SIGNAL_SYSCALL_TGKILL, BPF_CORE_READ(args, args[1]),
+                         BPF_CORE_READ(args, args[0]), BPF_CORE_READ(args, args[2]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_tgkill")
+int tracepoint_syscalls_sys_exit_tgkill(struct trace_event_raw_sys_exit *args)
+{
+    return signal__exit(BPF_CORE_READ(args, ret));
+}
+
+// Process names (comm) watched for signals, filled in by userspace (see
+// ebpf_event_ctx__add_tamper_comm)
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, char[TASK_COMM_LEN]);
+    __type(value, u8);
+    __uint(max_entries, 64);
+} elastic_ebpf_events_tamper_comms SEC(".maps");
+
+SEC("tracepoint/signal/signal_generate")
+int tracepoint_signal_signal_generate(struct trace_event_raw_signal_generate *args)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    int sig = BPF_CORE_READ(args, sig);
+    if (sig != SIGKILL && sig != SIGTERM && sig != SIGINT && sig != SIGSTOP)
+        goto out;
+
+    char target_comm[TASK_COMM_LEN] = {};
+    bpf_probe_read_kernel_str(target_comm, sizeof(target_comm), args->comm);
+    if (!bpf_map_lookup_elem(&elastic_ebpf_events_tamper_comms, target_comm))
+        goto out;
+
+    struct ebpf_security_tamper_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out;
+
+    event->hdr.type = EBPF_EVENT_SECURITY_TAMPER;
+    event->op       = EBPF_SECURITY_TAMPER_OP_SIGNAL;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    event->path[0] = '\0';
+    event->dev     = 0;
+    event->inode   = 0;
+
+    event->target_pid = BPF_CORE_READ(args, pid);
+    __builtin_memcpy(event->target_comm, target_comm, TASK_COMM_LEN);
+    event->signal = sig;
+
+    ebpf_ringbuf_submit(event);
+
+out:
+    return 0;
+}
+
+// linux/mman.h and linux/mm.h
+#define PROT_EXEC 0x4
+#define VM_READ 0x00000001
+#define VM_WRITE 0x00000002
+#define VM_EXEC 0x00000004
+
+// Only executable mappings are of interest, everything else is skipped as
+// early as possible. mmap and mprotect are called a lot.
+static int mmap_exec__enter(enum ebpf_process_mmap_exec_syscall syscall,
+                            u64 addr,
+                            u64 len,
+                            u32 prot,
+                            u32 flags)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (!(prot & PROT_EXEC) || is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.mmap_exec.syscall        = syscall;
+    state.mmap_exec.addr           = addr;
+    state.mmap_exec.len            = len;
+    state.mmap_exec.prot           = prot;
+    state.mmap_exec.flags          = flags;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_MMAP_EXEC, &state);
+
+out:
+    return 0;
+}
+
+static int mmap_exec__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MMAP_EXEC);
+    if (!state)
+        goto out;
+
+    // mmap returns the address of the mapping or a negative errno
+    if (ret < 0 && ret >= -4095)
+        goto out_del;
+    if (state->mmap_exec.syscall == EBPF_PROCESS_MMAP_EXEC_SYSCALL_MPROTECT && ret != 0)
+        goto out_del;
+
+    struct ebpf_process_mmap_exec_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type       = EBPF_EVENT_PROCESS_MMAP_EXEC;
+    event->syscall        = state->mmap_exec.syscall;
+    event->addr           = state->mmap_exec.addr;
+    event->len            = state->mmap_exec.len;
+    event->prot           = state->mmap_exec.prot;
+    event->flags          = state->mmap_exec.flags;
+    event->was_writable   = state->mmap_exec.was_writable;
+    event->was_executable = state->mmap_exec.was_executable;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    // The address asked for is only a hint to mmap
+    if (event->syscall == EBPF_PROCESS_MMAP_EXEC_SYSCALL_MMAP)
+        event->addr = ret;
+
+    event->path[0] = '\0';
+    if (state->mmap_exec.file) {
+        struct path p;
+        bpf_core_read(&p, sizeof(p), &state->mmap_exec.file->f_path);
+        ebpf_resolve_path_to_string(event->path, &p, task);
+    }
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_MMAP_EXEC);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_mmap")
+int tracepoint_syscalls_sys_enter_mmap(struct trace_event_raw_sys_enter *args)
+{
+    // mmap(addr, len, prot, flags, fd, off)
+    return mmap_exec__enter(EBPF_PROCESS_MMAP_EXEC_SYSCALL_MMAP, BPF_CORE_READ(args, args[0]),
+                            BPF_CORE_READ(args, args[1]), BPF_CORE_READ(args, args[2]),
+                            BPF_CORE_READ(args, args[3]));
+}
+
+SEC("tracepoint/syscalls/sys_exit_mmap")
+int tracepoint_syscalls_sys_exit_mmap(struct trace_event_raw_sys_exit *args)
+{
+    return mmap_exec__exit(BPF_CORE_READ(args, ret));
+}
+
+// Report every mprotect, not just those making memory executable. Set by
+// userspace, see ebpf_event_ctx__set_mprotect_verbose.
+bool mprotect_verbose = false;
+
+static int mprotect__enter(u64 addr, u64 len, u32 prot)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if ((!(prot & PROT_EXEC) && !mprotect_verbose) || is_kernel_thread(task) ||
+        ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.mprotect.addr            = addr;
+    state.mprotect.len             = len;
+    state.mprotect.prot            = prot;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_MPROTECT, &state);
+
+out:
+    return 0;
+}
+
+static int mprotect__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MPROTECT);
+    if (!state)
+        goto out;
+
+    if (ret != 0 || !state->mprotect.vma_seen)
+        goto out_del;
+
+    // Memory that was already executable staying so isn't interesting
+    if (!mprotect_verbose && (state->mprotect.old_prot & PROT_EXEC))
+        goto out_del;
+
+    struct ebpf_process_mprotect_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type = EBPF_EVENT_PROCESS_MPROTECT;
+    event->addr     = state->mprotect.addr;
+    event->len      = state->mprotect.len;
+    event->old_prot = state->mprotect.old_prot;
+    event->new_prot = state->mprotect.prot;
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_MPROTECT);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_mprotect")
+int tracepoint_syscalls_sys_enter_mprotect(struct trace_event_raw_sys_enter *args)
+{
+    // mprotect(start, len, prot)
+    u64 addr = BPF_CORE_READ(args, args[0]);
+    u64 len  = BPF_CORE_READ(args, args[1]);
+    u32 prot = BPF_CORE_READ(args, args[2]);
+
+    mmap_exec__enter(EBPF_PROCESS_MMAP_EXEC_SYSCALL_MPROTECT, addr, len, prot, 0);
+    return mprotect__enter(addr, len, prot);
+}
+
+SEC("tracepoint/syscalls/sys_exit_mprotect")
+int tracepoint_syscalls_sys_exit_mprotect(struct trace_event_raw_sys_exit *args)
+{
+    long ret = BPF_CORE_READ(args, ret);
+
+    mmap_exec__exit(ret);
+    return mprotect__exit(ret);
+}
+
+// The backing file of a new mapping. Also called when the kernel maps files
+// itself (e.g. on exec), there's no state then.
+static int mmap_exec__mmap_file(struct file *file)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MMAP_EXEC);
+    if (!state || state->mmap_exec.syscall != EBPF_PROCESS_MMAP_EXEC_SYSCALL_MMAP)
+        goto out;
+
+    state->mmap_exec.file = file;
+
+out:
+    return 0;
+}
+
+// Called for each mapping in the range, only the first one is recorded
+static int mmap_exec__mprotect(struct vm_area_struct *vma)
+{
+    unsigned long vm_flags = BPF_CORE_READ(vma, vm_flags);
+
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MMAP_EXEC);
+    if (state && state->mmap_exec.syscall == EBPF_PROCESS_MMAP_EXEC_SYSCALL_MPROTECT &&
+        !state->mmap_exec.vma_seen) {
+        state->mmap_exec.vma_seen       = true;
+        state->mmap_exec.was_writable   = (vm_flags & VM_WRITE) != 0;
+        state->mmap_exec.was_executable = (vm_flags & VM_EXEC) != 0;
+        state->mmap_exec.file           = BPF_CORE_READ(vma, vm_file);
+    }
+
+    // VM_READ/VM_WRITE/VM_EXEC have the same values as their PROT_ equivalents
+    state = ebpf_events_state__get(EBPF_EVENTS_STATE_MPROTECT);
+    if (state && !state->mprotect.vma_seen) {
+        state->mprotect.vma_seen = true;
+        state->mprotect.old_prot = vm_flags & (VM_READ | VM_WRITE | VM_EXEC);
+    }
+
+    return 0;
+}
+
+SEC("fentry/security_mmap_file")
+int BPF_PROG(fentry__security_mmap_file, struct file *file)
+{
+    return mmap_exec__mmap_file(file);
+}
+
+SEC("kprobe/security_mmap_file")
+int BPF_KPROBE(kprobe__security_mmap_file, struct file *file)
+{
+    return mmap_exec__mmap_file(file);
+}
+
+SEC("fentry/security_file_mprotect")
+int BPF_PROG(fentry__security_file_mprotect, struct vm_area_struct *vma)
+{
+    return mmap_exec__mprotect(vma);
+}
+
+SEC("kprobe/security_file_mprotect")
+int BPF_KPROBE(kprobe__security_file_mprotect, struct vm_area_struct *vma)
+{
+    return mmap_exec__mprotect(vma);
+}
+
+static int module_load__enter(enum ebpf_kernel_module_load_syscall syscall)
+{
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    if (is_kernel_thread(task) || ebpf_events_paused())
+        goto out;
+
+    struct ebpf_events_state state = {};
+    state.module_load.syscall      = syscall;
+    ebpf_events_state__set(EBPF_EVENTS_STATE_MODULE_LOAD, &state);
+
+out:
+    return 0;
+}
+
+// The module's init function runs after this, and can still fail the load
+SEC("tp_btf/module_load")
+int BPF_PROG(module_load, struct module *mod)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MODULE_LOAD);
+    if (!state)
+        goto out;
+
+    bpf_probe_read_kernel_str(state->module_load.name, sizeof(state->module_load.name),
+                              mod->name);
+
+out:
+    return 0;
+}
+
+static int module_load__exit(long ret)
+{
+    struct ebpf_events_state *state = ebpf_events_state__get(EBPF_EVENTS_STATE_MODULE_LOAD);
+    if (!state)
+        goto out;
+
+    if (ret != 0 || state->module_load.name[0] == '\0')
+        goto out_del;
+
+    struct ebpf_kernel_module_load_event *event = ebpf_ringbuf_reserve(sizeof(*event));
+    if (!event)
+        goto out_del;
+
+    const struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+
+    event->hdr.type = EBPF_EVENT_KERNEL_MODULE_LOAD;
+    event->syscall  = state->module_load.syscall;
+    bpf_probe_read_kernel_str(event->name, sizeof(event->name), state->module_load.name);
+    ebpf_pid_info__fill(&event->pids, task);
+    bpf_get_current_comm(event->comm, TASK_COMM_LEN);
+
+    ebpf_ringbuf_submit(event);
+
+out_del:
+    ebpf_events_state__del(EBPF_EVENTS_STATE_MODULE_LOAD);
+out:
+    return 0;
+}
+
+SEC("tracepoint/syscalls/sys_enter_init_module")
+int tracepoint_syscalls_sys_enter_init_module(struct trace_event_raw_sys_enter *args)
+{
+    return module_load__enter(EBPF_KERNEL_MODULE_LOAD_SYSCALL_INIT_MODULE);
+}
+
+SEC("tracepoint/syscalls/sys_exit_init_module")
+int tracepoint_syscalls_sys_exit_init_module(struct trace_event_raw_sys_exit *args)
+{
+    return module_load__exit(BPF_CORE_READ(args, ret));
+}
+
+SEC("tracepoint/syscalls/sys_enter_finit_module")
+int tracepoint_syscalls_sys_enter_finit_module(struct trace_event_raw_sys_enter *args)
+{
+    return module_load__enter(EBPF_KERNEL_MODULE_LOAD_SYSCALL_FINIT_MODULE);
+}
+
+SEC("tracepoint/syscalls/sys_exit_finit_module")
+int tracepoint_syscalls_sys_exit_finit_module(struct trace_event_raw_sys_exit *args)
+{
+    return module_load__exit(BPF_CORE_READ(args, ret));
+}
@@ -16,6 +16,37 @@ enum ebpf_events_state_op {
     EBPF_EVENTS_STATE_RENAME         = 2,
     EBPF_EVENTS_STATE_TCP_V4_CONNECT = 3,
     EBPF_EVENTS_STATE_TCP_V6_CONNECT = 4,
+    EBPF_EVENTS_STATE_FILE_COPY      = 5,
+    EBPF_EVENTS_STATE_SETSCHED       = 6,
+    EBPF_EVENTS_STATE_EXEC           = 7,
+    EBPF_EVENTS_STATE_SETNS          = 8,
+    EBPF_EVENTS_STATE_BPF_LINK       = 9,
+    EBPF_EVENTS_STATE_PRCTL_SET_MM   = 10,
+    EBPF_EVENTS_STATE_SETSID         = 11,
+    EBPF_EVENTS_STATE_UDP_SENDMSG    = 12,
+    EBPF_EVENTS_STATE_UDP_RECVMSG    = 13,
+    EBPF_EVENTS_STATE_PTRACE         = 14,
+    EBPF_EVENTS_STATE_MODIFY_ATTR    = 15,
+    EBPF_EVENTS_STATE_SYMLINK        = 16,
+    EBPF_EVENTS_STATE_LINK           = 17,
+    EBPF_EVENTS_STATE_MOUNT          = 18,
+    EBPF_EVENTS_STATE_UMOUNT         = 19,
+    EBPF_EVENTS_STATE_SIGNAL         = 20,
+    EBPF_EVENTS_STATE_MMAP_EXEC      = 21,
+    EBPF_EVENTS_STATE_MPROTECT       = 22,
+    EBPF_EVENTS_STATE_MODULE_LOAD    = 23,
+    EBPF_EVENTS_STATE_BPF_SYSCALL    = 24,
+    EBPF_EVENTS_STATE_CHDIR          = 25,
+    EBPF_EVENTS_STATE_FILE_OPEN      = 26,
+    EBPF_EVENTS_STATE_UNIX_CONNECT   = 27,
+    EBPF_EVENTS_STATE_UNIX_ACCEPT    = 28,
+    EBPF_EVENTS_STATE_INET_LISTEN    = 29,
+    EBPF_EVENTS_STATE_INET_BIND      = 30,
+    EBPF_EVENTS_STATE_ACCEPT4        = 31,
+    EBPF_EVENTS_STATE_TRUNCATE       = 32,
+    EBPF_EVENTS_STATE_CLONE          = 33,
+    EBPF_EVENTS_STATE_UNSHARE        = 34,
+    EBPF_EVENTS_STATE_INET_ACCEPT    = 35,
 };
 
 struct ebpf_events_key {
@@ -44,18 +75,205 @@ enum ebpf_events_rename_state_step {
 struct ebpf_events_rename_state {
     enum ebpf_events_rename_state_step step;
     struct vfsmount *mnt;
+    u8 cross_directory;
+    u32 flags;
+    // Checked against the tamper inodes on exit
+    struct inode *old_inode;
+    struct inode *old_dir;
+};
+
+enum ebpf_events_link_state_step {
+    LINK_STATE_INIT      = 0,
+    LINK_STATE_MOUNT_SET = 1,
+    LINK_STATE_PATHS_SET = 2,
+};
+
+// Used for both symlinks and hardlinks
+struct ebpf_events_link_state {
+    enum ebpf_events_link_state_step step;
+    struct vfsmount *mnt;
+};
+
+// Used for both mounts and umounts, the paths are in the scratch space
+struct ebpf_events_mount_state {
+    u64 flags;
+};
+
+struct ebpf_events_modify_attr_state {
+    enum ebpf_file_modify_attr_change change;
+    const struct path *path;
+    u32 old_mode;
+    u32 old_uid;
+    u32 old_gid;
 };
 
 struct ebpf_events_tcp_connect_state {
     struct sock *sk;
 };
 
+struct ebpf_events_socket_state {
+    struct socket *sock;
+};
+
+struct ebpf_events_inet_listen_state {
+    struct socket *sock;
+    int backlog;
+};
+
+struct ebpf_events_accept4_state {
+    u32 flags;
+};
+
+struct ebpf_events_udp_msg_state {
+    struct sock *sk;
+    struct msghdr *msg;
+    // udp_recvmsg only: the user buffer as of entry, the iov_iter has been
+    // consumed by the time it returns
+    const u8 *buf;
+    u64 buf_len;
+};
+
+struct ebpf_events_file_copy_state {
+    enum ebpf_file_copy_syscall syscall;
+    int fd_in;
+    int fd_out;
+};
+
+struct ebpf_events_setsched_state {
+    enum ebpf_process_setsched_syscall syscall;
+    enum ebpf_process_setsched_target target_type;
+    uint32_t target_id;
+    int32_t policy;
+    int32_t sched_priority;
+    int32_t nice;
+};
+
+// Namespaces before a setns or unshare
+struct ebpf_events_namespace_state {
+    struct ebpf_namespace_info ns;
+    uint32_t pid_for_children;
+};
+
+struct ebpf_events_bpf_link_state {
+    enum ebpf_process_bpf_link_cmd cmd;
+    int prog_fd;
+    int target_fd; // Or ifindex for BPF_XDP
+    u32 attach_type;
+    u64 tp_name; // User pointer, BPF_RAW_TRACEPOINT_OPEN only
+};
+
+struct ebpf_events_bpf_syscall_state {
+    enum ebpf_process_bpf_syscall_cmd cmd;
+    u32 type;
+    char name[BPF_NAME_MAX];
+};
+
+struct ebpf_events_prctl_set_mm_state {
+    enum ebpf_process_mm_field field;
+    u64 value;
+};
+
+struct ebpf_events_ptrace_state {
+    enum ebpf_process_ptrace_request request;
+    u32 target_pid;
+};
+
+struct ebpf_events_signal_state {
+    enum ebpf_process_signal_syscall syscall;
+    s32 target_pid;
+    s32 target_tgid;
+    s32 signal;
+};
+
+struct ebpf_events_exec_state {
+    enum ebpf_process_exec_source source;
+};
+
+struct ebpf_events_mmap_exec_state {
+    enum ebpf_process_mmap_exec_syscall syscall;
+    u64 addr;
+    u64 len;
+    u32 prot;
+    u32 flags;
+    // Set from the LSM hooks the syscalls go through
+    bool vma_seen;
+    u8 was_writable;
+    u8 was_executable;
+    struct file *file;
+};
+
+struct ebpf_events_mprotect_state {
+    u64 addr;
+    u64 len;
+    u32 prot;
+    bool vma_seen;
+    u32 old_prot;
+};
+
+struct ebpf_events_module_load_state {
+    enum ebpf_kernel_module_load_syscall syscall;
+    // Set once the module is loaded, it still has to be initialized
+    char name[MODULE_NAME_MAX];
+};
+
+struct ebpf_events_setsid_state {
+    struct ebpf_pid_info old_pids;
+};
+
+struct ebpf_events_file_open_state {
+    u32 flags;
+    u32 mode;
+};
+
+struct ebpf_events_chdir_state {
+    enum ebpf_process_chdir_syscall syscall;
+    int fd; // fchdir only
+};
+
+struct ebpf_events_truncate_state {
+    enum ebpf_file_truncate_syscall syscall;
+    struct path path;
+    u64 old_size;
+    u64 new_size;
+};
+
+struct ebpf_events_clone_state {
+    u64 flags;
+};
+
 struct ebpf_events_state {
     union {
         struct ebpf_events_unlink_state unlink;
         struct ebpf_events_rename_state rename;
+        struct ebpf_events_link_state link;
+        struct ebpf_events_modify_attr_state modify_attr;
+        struct ebpf_events_mount_state mount;
         struct ebpf_events_tcp_connect_state tcp_v4_connect;
         struct ebpf_events_tcp_connect_state tcp_v6_connect;
+        struct ebpf_events_socket_state unix_connect;
+        struct ebpf_events_socket_state unix_accept;
+        struct ebpf_events_socket_state inet_accept;
+        struct ebpf_events_inet_listen_state inet_listen;
+        struct ebpf_events_socket_state inet_bind;
+        struct ebpf_events_accept4_state accept4;
+        struct ebpf_events_udp_msg_state udp_msg;
+        struct ebpf_events_file_copy_state file_copy;
+        struct ebpf_events_setsched_state setsched;
+        struct ebpf_events_namespace_state namespaces; // setns and unshare
+        struct ebpf_events_bpf_link_state bpf_link;
+        struct ebpf_events_bpf_syscall_state bpf_syscall;
+        struct ebpf_events_prctl_set_mm_state prctl_set_mm;
+        struct ebpf_events_setsid_state setsid;
+        struct ebpf_events_chdir_state chdir;
+        struct ebpf_events_file_open_state file_open;
+        struct ebpf_events_truncate_state truncate;
+        struct ebpf_events_clone_state clone;
+        struct ebpf_events_ptrace_state ptrace;
+        struct ebpf_events_signal_state signal;
+        struct ebpf_events_mmap_exec_state mmap_exec;
+        struct ebpf_events_mprotect_state mprotect;
+        struct ebpf_events_module_load_state module_load;
+        struct ebpf_events_exec_state exec;
     };
 };
 
@@ -100,9 +318,30 @@ struct ebpf_events_rename_scratch_space {
     char new_path[BUF];
 };
 
+struct ebpf_events_link_scratch_space {
+    char target_path[BUF];
+    char link_path[BUF];
+};
+
+struct ebpf_events_mount_scratch_space {
+    char source[PATH_MAX];
+    char destination[BUF];
+    char fs_type[32];
+};
+
+struct ebpf_events_exec_scratch_space {
+    char parent_argv[ARGV_MAX];
+    uint32_t parent_argv_len;
+    uint8_t parent_argv_truncated;
+    uint8_t parent_argv_stale;
+};
+
 struct ebpf_events_scratch_space {
     union {
         struct ebpf_events_rename_scratch_space rename;
+        struct ebpf_events_link_scratch_space link;
+        struct ebpf_events_mount_scratch_space mount;
+        struct ebpf_events_exec_scratch_space exec;
     };
 };
 
@@ -137,4 +376,10 @@ static long ebpf_events_scratch_space__set(enum ebpf_events_state_op op,
     return bpf_map_update_elem(&elastic_ebpf_events_scratch_space, &key, ss, BPF_ANY);
 }
 
+static long ebpf_events_scratch_space__del(enum ebpf_events_state_op op)
+{
+    struct ebpf_events_key key = ebpf_events_state__key(op);
+    return bpf_map_delete_elem(&elastic_ebpf_events_scratch_space, &key);
+}
+
 #endif // EBPF_EVENTPROBE_EVENTS_STATE_H
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: GPL-2.0-only OR BSD-2-Clause
+
+/*
+ * Copyright (C) 2021 Elasticsearch BV
+ *
+ * This software is dual-licensed under the BSD 2-Clause and GPL v2 licenses.
+ * You may choose either one of them if you use this software.
+ */
+
+/*
+ * Variable-length fields
+ *
+ * Fields are appended one after the other to the struct
+ * ebpf_varlen_fields_start at the end of an event built in the event buffer
+ * (see ebpf_event_buffer__get), which is then sent with only as many bytes as
+ * were used. A field is added by getting a pointer to it with
+ * ebpf_vl_field__add, filling in its data and committing it with
+ * ebpf_vl_field__commit. One that isn't committed is overwritten by the next.
+ */
+
+#ifndef EBPF_EVENTPROBE_VARLEN_H
+#define EBPF_EVENTPROBE_VARLEN_H
+
+#include "vmlinux.h"
+
+#include "EbpfEventProto.h"
+
+// Largest variable-length field
+#define VL_FIELD_MAX ARGV_MAX
+
+// Upper bound on all of an event's variable-length fields together, those of
+// PROCESS_EXEC events (parent_argv, env, interpreter, the cgroup path, the root
+// path and the exe path)
+#define VL_FIELDS_MAX (ARGV_MAX + ENV_MAX + 4 * PATH_MAX + 6 * sizeof(struct ebpf_varlen_field))
+
+// The verifier only knows a field starts at most VL_FIELDS_MAX bytes in, so
+// there has to be room for the largest one past that. PROCESS_EXEC is also the
+// largest event built in the buffer.
+#define EVENT_BUFFER_SIZE                                                                          \
+    (sizeof(struct ebpf_process_exec_event) + VL_FIELDS_MAX + sizeof(struct ebpf_varlen_field) +   \
+     VL_FIELD_MAX)
+
+static void ebpf_vl_fields__init(struct ebpf_varlen_fields_start *fields)
+{
+    fields->nfields = 0;
+    fields->size    = 0;
+}
+
+// Returns NULL if there's no room left, which can't happen with fields that
+// are within their maximum size
+static struct ebpf_varlen_field *ebpf_vl_field__add(struct ebpf_varlen_fields_start *fields,
+                                                    enum ebpf_varlen_field_type type)
+{
+    u32 off = fields->size;
+    if (off > VL_FIELDS_MAX)
+        return NULL;
+
+    struct ebpf_varlen_field *field = (struct ebpf_varlen_field *)(fields->data + off);
+    field->type                     = type;
+    field->size                     = 0;
+    return field;
+}
+
+static void ebpf_vl_field__commit(struct ebpf_varlen_fields_start *fields,
+                                  struct ebpf_varlen_field *field,
+                                  u32 size)
+{
+    field->size = size;
+    fields->nfields++;
+    fields->size += sizeof(*field) + size;
+}
+
+// Size of an event built in the event buffer, including its fields
+#define EBPF_VL_EVENT_SIZE(event) (sizeof(*(event)) + (event)->vl_fields.size)
+
+#endif // EBPF_EVENTPROBE_VARLEN_H
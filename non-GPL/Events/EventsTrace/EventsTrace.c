@@ -10,14 +10,27 @@
 #include <argp.h>
 #include <ctype.h>
 #include <errno.h>
+#include <fcntl.h>
+#include <glob.h>
+#include <inttypes.h>
 #include <signal.h>
 #include <stdbool.h>
 #include <stdio.h>
+#include <stdlib.h>
 #include <string.h>
+#include <strings.h>
+#include <sys/mman.h>
 #include <sys/resource.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/sysmacros.h>
 #include <sys/time.h>
+#include <time.h>
+#include <unistd.h>
 
 #include <arpa/inet.h>
+#include <linux/bpf.h>
+#include <linux/sched.h>
 #include <linux/termios.h>
 #include <netinet/in.h>
 
@@ -29,11 +42,28 @@ const char argp_program_doc[] =
     "\n"
     "Prints process, network and file events sourced from the Elastic ebpf events library\n"
     "\n"
-    "USAGE: ./EventsTrace [--all|-a] [--file-delete] [--file-create] [--file-rename]\n"
+    "USAGE: ./EventsTrace [--all|-a] [--file-delete] [--file-create] [--file-rename] "
+    "[--file-copy] [--file-modify-attr] [--file-symlink] [--file-hardlink]\n"
     "[--process-fork] [--process-exec] [--process-exit] [--process-setsid] [--process-setuid] "
-    "[--process-setgid] [--process-tty-write]\n"
-    "[--net-conn-accept] [--net-conn-attempt] [--net-conn-closed]\n"
-    "[--print-features-on-init] [--unbuffer-stdout] [--libbpf-verbose]\n";
+    "[--process-setgid] [--process-setsched] [--process-tty-write] [--process-bpf-link]\n"
+    "[--process-mm-spoof] [--process-ptrace] [--process-signal] [--process-setcap]\n"
+    "[--process-mmap-exec] [--process-mprotect] [--process-bpf-syscall] [--process-chdir]\n"
+    "[--process-unshare] [--process-setns]\n"
+    "[--net-conn-accept] [--net-conn-attempt] [--net-conn-closed] [--net-udp-send] "
+    "[--net-udp-recv] [--net-dns-query] [--net-dns-response]\n"
+    "[--security-tamper] [--filesystem-view-change] [--fs-mount] [--fs-umount] "
+    "[--device-access] [--kernel-module-load]\n"
+    "[--print-features-on-init] [--stats-interval=SECONDS] [--net-summary-interval=SECONDS]\n"
+    "[--drop-and-run-window=SECONDS] [--expected-object-sha256=HASH] [--resolved-via]\n"
+    "[--lolbin-list=FILE] [--file-category=CATEGORIES] [--file-category-magic]\n"
+    "[--tamper-paths=PATHS] [--tamper-comms=NAMES] [--self-paths=PATHS] [--device-paths=PATHS]\n"
+    "[--proc-seq] [--ptrace-ignore-traceme] [--pid-filter=PIDS] [--capture-env]\n"
+    "[--capture-env-max=BYTES] [--hash-execs] [--mprotect-verbose] [--trace-opens]\n"
+    "[--open-paths=PREFIXES] [--no-threads] [--dump-filter-maps] [--unbuffer-stdout]\n"
+    "[--libbpf-verbose]\n"
+    "\n"
+    "Send SIGUSR1 to pause event emission and SIGUSR2 to resume it, SIGHUP to dump the filter "
+    "maps\n";
 
 // Somewhat kludgy way of ensuring argp doesn't print the EBPF_* constants that
 // happen to be valid ASCII values as short options. We pass these enum values
@@ -44,16 +74,45 @@ enum cmdline_opts {
     FILE_DELETE = 0x80,
     FILE_CREATE,
     FILE_RENAME,
+    FILE_COPY,
+    FILE_MODIFY_ATTR,
+    FILE_SYMLINK,
+    FILE_HARDLINK,
+    FILE_TRUNCATE,
     PROCESS_FORK,
     PROCESS_EXEC,
     PROCESS_EXIT,
     PROCESS_SETSID,
     PROCESS_SETUID,
     PROCESS_SETGID,
+    PROCESS_SETSCHED,
     PROCESS_TTY_WRITE,
+    PROCESS_BPF_LINK,
+    PROCESS_MM_SPOOF,
+    PROCESS_PTRACE,
+    PROCESS_SIGNAL,
+    PROCESS_SETCAP,
+    PROCESS_MMAP_EXEC,
+    PROCESS_MPROTECT,
+    PROCESS_BPF_SYSCALL,
+    PROCESS_CHDIR,
+    PROCESS_UNSHARE,
+    PROCESS_SETNS,
     NETWORK_CONNECTION_ATTEMPTED,
     NETWORK_CONNECTION_ACCEPTED,
     NETWORK_CONNECTION_CLOSED,
+    NETWORK_UDP_SEND,
+    NETWORK_UDP_RECV,
+    NETWORK_DNS_QUERY,
+    NETWORK_DNS_RESPONSE,
+    NETWORK_LISTEN,
+    NETWORK_BIND,
+    SECURITY_TAMPER,
+    FILESYSTEM_VIEW_CHANGE,
+    FS_MOUNT,
+    FS_UMOUNT,
+    DEVICE_ACCESS,
+    KERNEL_MODULE_LOAD,
     CMDLINE_MAX
 };
 
@@ -63,16 +122,94 @@ static uint64_t cmdline_to_lib[CMDLINE_MAX] = {
     x(FILE_DELETE)
     x(FILE_CREATE)
     x(FILE_RENAME)
+    x(FILE_COPY)
+    x(FILE_MODIFY_ATTR)
+    x(FILE_SYMLINK)
+    x(FILE_HARDLINK)
+    x(FILE_TRUNCATE)
+    x(PROCESS_FORK)
+    x(PROCESS_EXEC)
+    x(PROCESS_EXIT)
+    x(PROCESS_SETSID)
+    x(PROCESS_SETUID)
+    x(PROCESS_SETGID)
+    x(PROCESS_SETSCHED)
+    x(PROCESS_TTY_WRITE)
+    x(PROCESS_BPF_LINK)
+    x(PROCESS_MM_SPOOF)
+    x(PROCESS_PTRACE)
+    x(PROCESS_SIGNAL)
+    x(PROCESS_SETCAP)
+    x(PROCESS_MMAP_EXEC)
+    x(PROCESS_MPROTECT)
+    x(PROCESS_BPF_SYSCALL)
+    x(PROCESS_CHDIR)
+    x(PROCESS_UNSHARE)
+    x(PROCESS_SETNS)
+    x(NETWORK_CONNECTION_ATTEMPTED)
+    x(NETWORK_CONNECTION_ACCEPTED)
+    x(NETWORK_CONNECTION_CLOSED)
+    x(NETWORK_UDP_SEND)
+    x(NETWORK_UDP_RECV)
+    x(NETWORK_DNS_QUERY)
+    x(NETWORK_DNS_RESPONSE)
+    x(NETWORK_LISTEN)
+    x(NETWORK_BIND)
+    x(SECURITY_TAMPER)
+    x(FILESYSTEM_VIEW_CHANGE)
+    x(FS_MOUNT)
+    x(FS_UMOUNT)
+    x(DEVICE_ACCESS)
+    x(KERNEL_MODULE_LOAD)
+#undef x
+    // clang-format on
+};
+
+static const char *cmdline_names[CMDLINE_MAX] = {
+// clang-format off
+#define x(name) [name] = #name,
+    x(FILE_DELETE)
+    x(FILE_CREATE)
+    x(FILE_RENAME)
+    x(FILE_COPY)
+    x(FILE_MODIFY_ATTR)
+    x(FILE_SYMLINK)
+    x(FILE_HARDLINK)
+    x(FILE_TRUNCATE)
     x(PROCESS_FORK)
     x(PROCESS_EXEC)
     x(PROCESS_EXIT)
     x(PROCESS_SETSID)
     x(PROCESS_SETUID)
     x(PROCESS_SETGID)
+    x(PROCESS_SETSCHED)
     x(PROCESS_TTY_WRITE)
+    x(PROCESS_BPF_LINK)
+    x(PROCESS_MM_SPOOF)
+    x(PROCESS_PTRACE)
+    x(PROCESS_SIGNAL)
+    x(PROCESS_SETCAP)
+    x(PROCESS_MMAP_EXEC)
+    x(PROCESS_MPROTECT)
+    x(PROCESS_BPF_SYSCALL)
+    x(PROCESS_CHDIR)
+    x(PROCESS_UNSHARE)
+    x(PROCESS_SETNS)
     x(NETWORK_CONNECTION_ATTEMPTED)
     x(NETWORK_CONNECTION_ACCEPTED)
     x(NETWORK_CONNECTION_CLOSED)
+    x(NETWORK_UDP_SEND)
+    x(NETWORK_UDP_RECV)
+    x(NETWORK_DNS_QUERY)
+    x(NETWORK_DNS_RESPONSE)
+    x(NETWORK_LISTEN)
+    x(NETWORK_BIND)
+    x(SECURITY_TAMPER)
+    x(FILESYSTEM_VIEW_CHANGE)
+    x(FS_MOUNT)
+    x(FS_UMOUNT)
+    x(DEVICE_ACCESS)
+    x(KERNEL_MODULE_LOAD)
 #undef x
     // clang-format on
 };
@@ -82,21 +219,135 @@ static const struct argp_option opts[] = {
     {"file-delete", FILE_DELETE, NULL, false, "Print file delete events", 0},
     {"file-create", FILE_CREATE, NULL, false, "Print file create events", 0},
     {"file-rename", FILE_RENAME, NULL, false, "Print file rename events", 0},
+    {"file-copy", FILE_COPY, NULL, false,
+     "Print file copy (sendfile, splice, copy_file_range) events", 0},
+    {"file-modify-attr", FILE_MODIFY_ATTR, NULL, false,
+     "Print file permission (chmod) and ownership (chown) change events", 0},
+    {"file-symlink", FILE_SYMLINK, NULL, false, "Print symbolic link creation events", 0},
+    {"file-hardlink", FILE_HARDLINK, NULL, false, "Print hard link creation events", 0},
+    {"file-truncate", FILE_TRUNCATE, NULL, false, "Print truncate and ftruncate calls", 0},
     {"process-fork", PROCESS_FORK, NULL, false, "Print process fork events", 0},
     {"process-exec", PROCESS_EXEC, NULL, false, "Print process exec events", 0},
     {"process-exit", PROCESS_EXIT, NULL, false, "Print process exit events", 0},
     {"process-setsid", PROCESS_SETSID, NULL, false, "Print process setsid events", 0},
     {"process-setuid", PROCESS_SETUID, NULL, false, "Print process setuid events", 0},
     {"process-setgid", PROCESS_SETGID, NULL, false, "Print process setgid events", 0},
+    {"process-setsched", PROCESS_SETSCHED, NULL, false,
+     "Print process scheduling policy and nice change events", 0},
     {"process-tty-write", PROCESS_TTY_WRITE, NULL, false, "Print process tty-write events", 0},
+    {"process-bpf-link", PROCESS_BPF_LINK, NULL, false,
+     "Print BPF program attachment (bpf_link) events", 0},
+    {"process-mm-spoof", PROCESS_MM_SPOOF, NULL, false,
+     "Print prctl(PR_SET_MM) events, used to fake a process' argv or exe", 0},
+    {"process-ptrace", PROCESS_PTRACE, NULL, false,
+     "Print ptrace attach and tracee modification events", 0},
+    {"process-signal", PROCESS_SIGNAL, NULL, false, "Print signals sent with kill and tgkill", 0},
+    {"process-setcap", PROCESS_SETCAP, NULL, false, "Print capability set changes", 0},
+    {"process-mmap-exec", PROCESS_MMAP_EXEC, NULL, false,
+     "Print executable memory mappings made with mmap or mprotect", 0},
+    {"process-mprotect", PROCESS_MPROTECT, NULL, false,
+     "Print mprotect calls making memory executable", 0},
+    {"process-bpf-syscall", PROCESS_BPF_SYSCALL, NULL, false,
+     "Print BPF program loads and map creations", 0},
+    {"process-chdir", PROCESS_CHDIR, NULL, false, "Print working directory changes", 0},
+    {"process-unshare", PROCESS_UNSHARE, NULL, false,
+     "Print unshare calls creating new namespaces", 0},
+    {"process-setns", PROCESS_SETNS, NULL, false, "Print setns calls joining namespaces", 0},
     {"net-conn-accept", NETWORK_CONNECTION_ACCEPTED, NULL, false,
      "Print network connection accepted events", 0},
     {"net-conn-attempt", NETWORK_CONNECTION_ATTEMPTED, NULL, false,
      "Print network connection attempted events", 0},
     {"net-conn-closed", NETWORK_CONNECTION_CLOSED, NULL, false,
      "Print network connection closed events", 0},
+    {"net-udp-send", NETWORK_UDP_SEND, NULL, false, "Print UDP datagram send events", 0},
+    {"net-udp-recv", NETWORK_UDP_RECV, NULL, false, "Print UDP datagram receive events", 0},
+    {"net-dns-query", NETWORK_DNS_QUERY, NULL, false, "Print DNS queries sent over UDP", 0},
+    {"net-dns-response", NETWORK_DNS_RESPONSE, NULL, false,
+     "Print DNS responses received over UDP, with the A, AAAA and CNAME records they carry", 0},
+    {"net-listen", NETWORK_LISTEN, NULL, false, "Print sockets starting to listen", 0},
+    {"net-bind", NETWORK_BIND, NULL, false, "Print sockets being bound to an address", 0},
+    {"security-tamper", SECURITY_TAMPER, NULL, false,
+     "Print writes to security module control files and signals sent to security daemons", 0},
+    {"filesystem-view-change", FILESYSTEM_VIEW_CHANGE, NULL, false,
+     "Print mount namespace switch (setns) events", 0},
+    {"fs-mount", FS_MOUNT, NULL, false, "Print filesystem mount events", 0},
+    {"fs-umount", FS_UMOUNT, NULL, false, "Print filesystem umount events", 0},
+    {"device-access", DEVICE_ACCESS, NULL, false,
+     "Print opens of GPU/accelerator devices (see --device-paths)", 0},
+    {"kernel-module-load", KERNEL_MODULE_LOAD, NULL, false, "Print kernel module loads", 0},
     {"print-features-on-init", 'i', NULL, false,
      "Print a message with feature information when probes have been successfully loaded", 1},
+    {"stats-interval", 's', "SECONDS", false,
+     "Print a STATS message with event counts and resource usage every SECONDS seconds", 1},
+    {"net-summary-interval", 'n', "SECONDS", false,
+     "Print a NETWORK_PROCESS_SUMMARY message per process with network activity every SECONDS "
+     "seconds",
+     1},
+    {"drop-and-run-window", 'd', "SECONDS", false,
+     "Print a DROP_AND_RUN message when a file is executed within SECONDS seconds of being "
+     "created",
+     1},
+    {"expected-object-sha256", 'e', "HASH", false,
+     "Refuse to load the BPF object if its SHA256 (hex encoded) is not HASH", 1},
+    {"resolved-via", 'R', NULL, false,
+     "Include the name a DNS response last resolved the destination address to in "
+     "NETWORK_CONNECTION_ATTEMPTED events (resolved_via), until its TTL runs out",
+     1},
+    {"lolbin-list", 'l', "FILE", false,
+     "Flag execs matching the LOLBin list in FILE instead of the default list", 1},
+    {"file-category", 'c', "CATEGORIES", false,
+     "Only print file events for files in CATEGORIES (comma separated, any of executable, "
+     "script, archive, document, other)",
+     1},
+    {"file-category-magic", 'm', NULL, false,
+     "Classify files with an unknown extension by their first few bytes", 1},
+    {"tamper-paths", 'w', "PATHS", false,
+     "Watch PATHS (comma separated files or directories) for security tamper writes instead of "
+     "the default list",
+     1},
+    {"self-paths", 'P', "PATHS", false,
+     "Watch PATHS (comma separated files or directories), the tracer's own pinned objects and "
+     "config files, for SELF_WRITE tampering instead of the default list. The --lolbin-list "
+     "file is always watched",
+     1},
+    {"tamper-comms", 'k', "NAMES", false,
+     "Watch processes named NAMES (comma separated) for security tamper signals instead of the "
+     "default list",
+     1},
+    {"device-paths", 'g', "PATHS", false,
+     "Report opens of PATHS (comma separated device files or directories, globs allowed) as "
+     "accelerator device accesses instead of the default list",
+     1},
+    {"proc-seq", 'q', NULL, false,
+     "Number each process' events in a per-process sequence (proc_seq), to detect per-process "
+     "drops",
+     1},
+    {"ptrace-ignore-traceme", 'p', NULL, false,
+     "Don't print PTRACE_TRACEME ptrace events, a self-trace commonly used as an anti-debugging "
+     "check",
+     1},
+    {"pid-filter", 'f', "PIDS", false,
+     "Only print events of PIDS (comma separated) and of processes they fork from then on", 1},
+    {"capture-env", 'E', NULL, false,
+     "Include the environment of exec'ing processes in PROCESS_EXEC events, makes execs more "
+     "expensive",
+     1},
+    {"capture-env-max", 'b', "BYTES", false,
+     "Capture at most BYTES of the environment with --capture-env (default 4096, at most 8192)",
+     1},
+    {"hash-execs", 'H', NULL, false,
+     "Include the SHA256 of the executed file in PROCESS_EXEC events, computed in userspace", 1},
+    {"mprotect-verbose", 'M', NULL, false,
+     "Print PROCESS_MPROTECT events for every mprotect, not only those making memory executable",
+     1},
+    {"trace-opens", 'O', NULL, false,
+     "Print FILE_OPEN events for every successful open, very high volume (see --open-paths)", 1},
+    {"open-paths", 'o', "PREFIXES", false,
+     "Only print FILE_OPEN events for paths starting with one of PREFIXES (comma separated)", 1},
+    {"no-threads", 'T', NULL, false,
+     "Don't print PROCESS_FORK events for new threads, only for new processes", 1},
+    {"dump-filter-maps", 'D', NULL, false,
+     "Print the contents of the filter maps once set up, as on SIGHUP", 1},
     {"unbuffer-stdout", 'u', NULL, false, "Disable userspace stdout buffering", 2},
     {"libbpf-verbose", 'v', NULL, false, "Log verbose libbpf logs to stderr", 2},
     {},
@@ -105,9 +356,82 @@ static const struct argp_option opts[] = {
 uint64_t g_events_env   = 0;
 uint64_t g_features_env = 0;
 
-bool g_print_features_init = 0;
-bool g_unbuffer_stdout     = 0;
-bool g_libbpf_verbose      = 0;
+bool g_print_features_init   = 0;
+bool g_unbuffer_stdout       = 0;
+bool g_libbpf_verbose        = 0;
+bool g_proc_seq              = 0;
+bool g_ptrace_ignore_traceme = 0;
+bool g_capture_env           = 0;
+long g_capture_env_max       = 4096;
+bool g_hash_execs            = 0;
+bool g_mprotect_verbose      = 0;
+bool g_trace_opens           = 0;
+bool g_no_threads            = 0;
+long g_stats_interval        = 0;
+long g_net_summary_interval  = 0;
+long g_drop_and_run_window   = 0;
+bool g_resolved_via          = 0;
+
+const char *g_expected_object_sha256 = NULL;
+const char *g_lolbin_list_path       = NULL;
+
+// Security module control files (AppArmor, SELinux) and audit configuration
+const char *g_tamper_paths = "/sys/kernel/security/apparmor/.remove,/sys/fs/selinux/enforce,"
+                             "/sys/fs/selinux/disable,/etc/audit/auditd.conf,"
+                             "/etc/audit/audit.rules";
+const char *g_tamper_comms = "auditd,auditbeat,elastic-agent,elastic-endpoint,EventsTrace";
+
+// Where host isolation pins its maps (see EBPF_MAP_DIRECTORY)
+const char *g_self_paths = "/sys/fs/bpf/elastic/endpoint";
+
+const char *g_pid_filter = "";
+const char *g_open_paths = "";
+
+// NVIDIA, AMD (ROCm), DRM render/card nodes and the generic accel subsystem
+const char *g_device_paths = "/dev/nvidia*,/dev/kfd,/dev/dri,/dev/accel";
+
+uint64_t g_events_processed = 0;
+
+enum file_category {
+    FILE_CATEGORY_OTHER,
+    FILE_CATEGORY_EXECUTABLE,
+    FILE_CATEGORY_SCRIPT,
+    FILE_CATEGORY_ARCHIVE,
+    FILE_CATEGORY_DOCUMENT,
+    FILE_CATEGORY_MAX,
+};
+
+static const char *file_category_names[FILE_CATEGORY_MAX] = {
+    [FILE_CATEGORY_OTHER]      = "other",
+    [FILE_CATEGORY_EXECUTABLE] = "executable",
+    [FILE_CATEGORY_SCRIPT]     = "script",
+    [FILE_CATEGORY_ARCHIVE]    = "archive",
+    [FILE_CATEGORY_DOCUMENT]   = "document",
+};
+
+// Bitmask of (1 << enum file_category), 0 if file events aren't filtered
+uint32_t g_file_categories = 0;
+bool g_file_category_magic = 0;
+bool g_dump_filter_maps    = 0;
+
+static int parse_file_categories(char *arg)
+{
+    char *saveptr;
+    for (char *tok = strtok_r(arg, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        int i;
+        for (i = 0; i < FILE_CATEGORY_MAX; i++) {
+            if (strcmp(tok, file_category_names[i]) == 0)
+                break;
+        }
+
+        if (i == FILE_CATEGORY_MAX)
+            return -EINVAL;
+
+        g_file_categories |= 1 << i;
+    }
+
+    return 0;
+}
 
 static error_t parse_arg(int key, char *arg, struct argp_state *state)
 {
@@ -121,22 +445,134 @@ static error_t parse_arg(int key, char *arg, struct argp_state *state)
     case 'v':
         g_libbpf_verbose = 1;
         break;
+    case 'e':
+        g_expected_object_sha256 = arg;
+        break;
+    case 'l':
+        g_lolbin_list_path = arg;
+        break;
+    case 'c':
+        if (parse_file_categories(arg) < 0)
+            argp_error(state, "Invalid file categories: %s", arg);
+        break;
+    case 'm':
+        g_file_category_magic = 1;
+        break;
+    case 'D':
+        g_dump_filter_maps = 1;
+        break;
+    case 'w':
+        g_tamper_paths = arg;
+        break;
+    case 'k':
+        g_tamper_comms = arg;
+        break;
+    case 'P':
+        g_self_paths = arg;
+        break;
+    case 'g':
+        g_device_paths = arg;
+        break;
+    case 'q':
+        g_proc_seq = 1;
+        break;
+    case 'p':
+        g_ptrace_ignore_traceme = 1;
+        break;
+    case 'f':
+        g_pid_filter = arg;
+        break;
+    case 'E':
+        g_capture_env = 1;
+        break;
+    case 'b':
+        errno             = 0;
+        g_capture_env_max = strtol(arg, NULL, 10);
+        if (errno != 0 || g_capture_env_max <= 0 || g_capture_env_max > ENV_MAX)
+            argp_error(state, "Invalid environment capture limit: %s", arg);
+        break;
+    case 'H':
+        g_hash_execs = 1;
+        break;
+    case 'M':
+        g_mprotect_verbose = 1;
+        break;
+    case 'O':
+        g_trace_opens = 1;
+        g_events_env |= EBPF_EVENT_FILE_OPEN;
+        break;
+    case 'o':
+        g_open_paths = arg;
+        break;
+    case 'T':
+        g_no_threads = 1;
+        break;
+    case 's':
+        errno            = 0;
+        g_stats_interval = strtol(arg, NULL, 10);
+        if (errno != 0 || g_stats_interval <= 0)
+            argp_error(state, "Invalid stats interval: %s", arg);
+        break;
+    case 'n':
+        errno                  = 0;
+        g_net_summary_interval = strtol(arg, NULL, 10);
+        if (errno != 0 || g_net_summary_interval <= 0)
+            argp_error(state, "Invalid network summary interval: %s", arg);
+        break;
+    case 'd':
+        errno                 = 0;
+        g_drop_and_run_window = strtol(arg, NULL, 10);
+        if (errno != 0 || g_drop_and_run_window <= 0)
+            argp_error(state, "Invalid drop and run window: %s", arg);
+        break;
+    case 'R':
+        g_resolved_via = 1;
+        break;
     case 'a':
         g_events_env = UINT64_MAX;
         break;
     case FILE_DELETE:
     case FILE_CREATE:
     case FILE_RENAME:
+    case FILE_COPY:
+    case FILE_MODIFY_ATTR:
+    case FILE_SYMLINK:
+    case FILE_HARDLINK:
+    case FILE_TRUNCATE:
     case PROCESS_FORK:
     case PROCESS_EXEC:
     case PROCESS_EXIT:
     case PROCESS_SETSID:
     case PROCESS_SETUID:
     case PROCESS_SETGID:
+    case PROCESS_SETSCHED:
     case PROCESS_TTY_WRITE:
+    case PROCESS_BPF_LINK:
+    case PROCESS_MM_SPOOF:
+    case PROCESS_PTRACE:
+    case PROCESS_SIGNAL:
+    case PROCESS_SETCAP:
+    case PROCESS_MMAP_EXEC:
+    case PROCESS_MPROTECT:
+    case PROCESS_BPF_SYSCALL:
+    case PROCESS_CHDIR:
+    case PROCESS_UNSHARE:
+    case PROCESS_SETNS:
     case NETWORK_CONNECTION_ACCEPTED:
     case NETWORK_CONNECTION_ATTEMPTED:
     case NETWORK_CONNECTION_CLOSED:
+    case NETWORK_UDP_SEND:
+    case NETWORK_UDP_RECV:
+    case NETWORK_DNS_QUERY:
+    case NETWORK_DNS_RESPONSE:
+    case NETWORK_LISTEN:
+    case NETWORK_BIND:
+    case SECURITY_TAMPER:
+    case FILESYSTEM_VIEW_CHANGE:
+    case FS_MOUNT:
+    case FS_UMOUNT:
+    case DEVICE_ACCESS:
+    case KERNEL_MODULE_LOAD:
         g_events_env |= cmdline_to_lib[key];
         break;
     case ARGP_KEY_ARG:
@@ -165,6 +601,504 @@ static void sig_int(int signo)
     fprintf(stdout, "Received SIGINT, exiting...\n");
 }
 
+static volatile sig_atomic_t pause_changed   = 0;
+static volatile sig_atomic_t pause_requested = 0;
+
+static void sig_usr(int signo)
+{
+    pause_requested = signo == SIGUSR1;
+    pause_changed   = 1;
+}
+
+static volatile sig_atomic_t dump_requested = 0;
+
+static void sig_hup(int signo)
+{
+    dump_requested = 1;
+}
+
+static int update_paused(struct ebpf_event_ctx *ctx)
+{
+    int err       = 0;
+    pause_changed = 0;
+
+    err = ebpf_event_ctx__set_paused(ctx, pause_requested);
+    if (err < 0) {
+        fprintf(stderr, "Could not %s events\n", pause_requested ? "pause" : "resume");
+        goto out;
+    }
+
+    fprintf(stderr, "Events %s\n", pause_requested ? "paused" : "resumed");
+
+out:
+    return err;
+}
+
+// Living-off-the-land binaries: legitimate tools commonly abused by
+// attackers. An exec matches an entry if the basename of the executed file is
+// name and, if arg is non-empty, one of its arguments is exactly arg.
+#define LOLBIN_MAX 256
+#define LOLBIN_FIELD_MAX 64
+
+struct lolbin {
+    char category[LOLBIN_FIELD_MAX];
+    char name[LOLBIN_FIELD_MAX];
+    char arg[LOLBIN_FIELD_MAX];
+};
+
+static const struct lolbin default_lolbins[] = {
+    {"download", "curl", ""},    {"download", "wget", ""},   {"network", "nc", ""},
+    {"network", "ncat", ""},     {"network", "socat", ""},   {"encoding", "base64", ""},
+    {"encoding", "xxd", ""},     {"script", "python", "-c"}, {"script", "python2", "-c"},
+    {"script", "python3", "-c"}, {"script", "perl", "-e"},   {"script", "ruby", "-e"},
+    {"script", "php", "-r"},
+};
+
+static struct lolbin loaded_lolbins[LOLBIN_MAX];
+
+static const struct lolbin *g_lolbins = default_lolbins;
+static int g_lolbins_len = sizeof(default_lolbins) / sizeof(default_lolbins[0]);
+
+// One entry per line, in the form "<category> <name> [arg]". Blank lines and
+// lines starting with '#' are ignored. Replaces the default list entirely.
+static int load_lolbin_list(const char *path)
+{
+    int err = 0;
+    char line[256];
+
+    FILE *f = fopen(path, "r");
+    if (!f) {
+        err = -errno;
+        fprintf(stderr, "Could not open LOLBin list %s: %s\n", path, strerror(-err));
+        return err;
+    }
+
+    int len = 0;
+    while (fgets(line, sizeof(line), f)) {
+        struct lolbin lb = {};
+
+        if (line[0] == '#' || sscanf(line, "%63s %63s %63s", lb.category, lb.name, lb.arg) < 2)
+            continue;
+
+        if (len == LOLBIN_MAX) {
+            fprintf(stderr, "Too many entries in LOLBin list %s (max %d)\n", path, LOLBIN_MAX);
+            err = -E2BIG;
+            goto out;
+        }
+
+        loaded_lolbins[len++] = lb;
+    }
+
+    g_lolbins     = loaded_lolbins;
+    g_lolbins_len = len;
+
+out:
+    fclose(f);
+    return err;
+}
+
+// Returns NULL if the event has no field of this type
+static struct ebpf_varlen_field *vl_field(struct ebpf_varlen_fields_start *fields,
+                                          enum ebpf_varlen_field_type type)
+{
+    char *cursor = fields->data;
+    for (uint32_t i = 0; i < fields->nfields; i++) {
+        struct ebpf_varlen_field *field = (struct ebpf_varlen_field *)cursor;
+        if (field->type == type)
+            return field;
+        cursor += sizeof(*field) + field->size;
+    }
+
+    return NULL;
+}
+
+// For fields holding a string, "" if there's none
+static const char *vl_field_string(struct ebpf_varlen_fields_start *fields,
+                                   enum ebpf_varlen_field_type type)
+{
+    struct ebpf_varlen_field *field = vl_field(fields, type);
+    return field ? field->data : "";
+}
+
+// The process' root directory, only sent if it's chrooted
+static const char *vl_root_path(struct ebpf_varlen_fields_start *fields)
+{
+    struct ebpf_varlen_field *field = vl_field(fields, EBPF_VL_FIELD_ROOT_PATH);
+    return field ? field->data : "/";
+}
+
+static bool argv_contains(const char *argv, size_t argv_size, const char *arg)
+{
+    // argv is '\0' delimited, with the unused part of the buffer zeroed
+    size_t i = 0;
+    while (i < argv_size && argv[i] != '\0') {
+        if (strncmp(argv + i, arg, argv_size - i) == 0)
+            return true;
+        i += strnlen(argv + i, argv_size - i) + 1;
+    }
+
+    return false;
+}
+
+// A versioned name, e.g. python3.11 for python3, also matches, as the
+// unversioned one is usually a symlink to it
+static bool lolbin_name_matches(const char *name, const char *lolbin_name)
+{
+    size_t len = strlen(lolbin_name);
+    if (strncmp(name, lolbin_name, len) != 0)
+        return false;
+
+    return strspn(name + len, "0123456789.") == strlen(name + len);
+}
+
+// Matched on the file that was actually exec'd rather than on filename, which
+// a symlink or a copy under another name would change
+static const struct lolbin *match_lolbin(struct ebpf_process_exec_event *evt)
+{
+    const char *exe  = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_EXE_PATH);
+    const char *name = strrchr(exe, '/');
+    name             = name ? name + 1 : exe;
+
+    for (int i = 0; i < g_lolbins_len; i++) {
+        const struct lolbin *lb = &g_lolbins[i];
+
+        if (!lolbin_name_matches(name, lb->name))
+            continue;
+
+        if (lb->arg[0] == '\0' || argv_contains(evt->argv, sizeof(evt->argv), lb->arg))
+            return lb;
+    }
+
+    return NULL;
+}
+
+// Container runtime processes that spawn processes into running containers
+// (e.g. on `docker exec` or `kubectl exec`). Matched as prefixes of comm, which
+// is at most 15 characters.
+static const char *container_runtimes[] = {"containerd-shim", "runc", "crun", "conmon"};
+
+#define CONTAINER_ID_LEN 64
+
+// Runtimes name a container's cgroup after its 64 hex character ID, e.g.
+// /docker/<id> or /system.slice/docker-<id>.scope (docker),
+// /system.slice/cri-containerd-<id>.scope (containerd), /crio-<id>.scope
+// (CRI-O), or, under Kubernetes, /kubepods/burstable/pod<uid>/<id> and
+// /kubepods.slice/.../kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+// Pod UIDs contain dashes (or underscores), so they're never mistaken for an
+// ID. The last ID is the innermost container's, e.g. for a pod in a kind node.
+static bool container_id_from_cgroup(const char *path, char id[CONTAINER_ID_LEN + 1])
+{
+    bool found = false;
+    size_t run = 0;
+    for (const char *c = path;; c++) {
+        if (isdigit(*c) || (*c >= 'a' && *c <= 'f')) {
+            run++;
+            continue;
+        }
+
+        if (run == CONTAINER_ID_LEN) {
+            memcpy(id, c - run, run);
+            id[run] = '\0';
+            found   = true;
+        }
+
+        if (*c == '\0')
+            return found;
+        run = 0;
+    }
+}
+
+static bool has_container_runtime_ancestor(struct ebpf_process_exec_event *evt)
+{
+    for (int i = 0; i < ANCESTORS_MAX; i++) {
+        for (size_t j = 0; j < sizeof(container_runtimes) / sizeof(container_runtimes[0]); j++) {
+            if (strncmp(evt->ancestor_comms[i], container_runtimes[j],
+                        strlen(container_runtimes[j])) == 0)
+                return true;
+        }
+    }
+
+    return false;
+}
+
+// An exec is a container exec if the process is in a container's cgroup, a
+// container runtime is among its ancestors, and it, or the process that
+// forked it, joined another mount namespace with setns since its last exec.
+// That's how runtimes spawn a process into a running container (e.g. on
+// `docker exec` or `kubectl exec`), whereas the processes of a container being
+// started are in namespaces created for it and those it spawns itself never
+// switch. The ancestry alone isn't enough, as runtimes are the parents of
+// container inits too, and the switch alone would also match a plain nsenter.
+// Both are recorded in the probes at exec time.
+static bool is_container_exec(struct ebpf_process_exec_event *evt)
+{
+    return evt->mntns_switched_from != 0 && has_container_runtime_ancestor(evt);
+}
+
+// Opens path for reading if it's a regular file, returning the fd and filling
+// in st. Paths come from events, and anyone can put a FIFO or a device node
+// where one points: opening or reading those could block the event loop
+// forever or have side effects.
+static int open_regular_file(const char *path, struct stat *st)
+{
+    if (stat(path, st) < 0 || !S_ISREG(st->st_mode))
+        return -1;
+
+    // The file can be swapped between the stat and the open. O_NONBLOCK keeps
+    // the open of a FIFO from blocking, fstat then catches it.
+    int fd = open(path, O_RDONLY | O_NONBLOCK | O_NOCTTY | O_CLOEXEC);
+    if (fd < 0)
+        return -1;
+
+    if (fstat(fd, st) < 0 || !S_ISREG(st->st_mode)) {
+        close(fd);
+        return -1;
+    }
+
+    return fd;
+}
+
+#define EXEC_HASH_CACHE_MAX 1024
+#define SHA256_HEX_LEN (EBPF_OBJECT_SHA256_LEN * 2)
+
+// Hashing is done inline when printing the exec event, holding up every event
+// behind it, so bigger files aren't hashed at all
+#define EXEC_HASH_SIZE_MAX (64 * 1024 * 1024)
+
+struct exec_hash {
+    uint32_t dev;
+    uint64_t inode;
+    struct timespec mtime;
+    char hex[SHA256_HEX_LEN + 1];
+};
+
+// Direct-mapped on the inode, a collision just means hashing the file again
+static struct exec_hash exec_hashes[EXEC_HASH_CACHE_MAX];
+
+// Hashes the executed file by opening the path it was exec'd by, relative to
+// the cwd at exec time. That's a different file (or none) if it's been
+// replaced or removed since, or was exec'd relative to a dirfd or chroot, so
+// the opened file has to be the same inode as the one that was exec'd.
+// Hashes are cached by inode and mtime, so a file modified in place with an
+// unchanged mtime isn't rehashed.
+//
+// Returns false if the exec'd file can't be hashed any more.
+static bool exec_sha256(struct ebpf_process_exec_event *evt, char hex[SHA256_HEX_LEN + 1])
+{
+    char path[PATH_MAX * 2];
+    struct stat st;
+    uint8_t hash[EBPF_OBJECT_SHA256_LEN];
+    bool ok = false;
+
+    // For scripts, the exe_* fields are the interpreter's
+    const char *interpreter = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_INTERPRETER);
+    const char *exe         = interpreter[0] ? interpreter : evt->filename;
+    if (exe[0] == '/')
+        snprintf(path, sizeof(path), "%s", exe);
+    else
+        snprintf(path, sizeof(path), "%s/%s", evt->cwd, exe);
+
+    int fd = open_regular_file(path, &st);
+    if (fd < 0)
+        return false;
+
+    // exe_dev is in the kernel's encoding
+    uint32_t dev = (major(st.st_dev) << 20) | minor(st.st_dev);
+    if (dev != evt->exe_dev || st.st_ino != evt->exe_inode || st.st_size > EXEC_HASH_SIZE_MAX)
+        goto out;
+
+    struct exec_hash *h = &exec_hashes[st.st_ino % EXEC_HASH_CACHE_MAX];
+    if (h->hex[0] && h->dev == dev && h->inode == st.st_ino &&
+        h->mtime.tv_sec == st.st_mtim.tv_sec && h->mtime.tv_nsec == st.st_mtim.tv_nsec) {
+        memcpy(hex, h->hex, sizeof(h->hex));
+        ok = true;
+        goto out;
+    }
+
+    if (ebpf_fd_sha256(fd, hash) < 0)
+        goto out;
+
+    for (int i = 0; i < EBPF_OBJECT_SHA256_LEN; i++)
+        sprintf(hex + i * 2, "%02x", hash[i]);
+
+    h->dev   = dev;
+    h->inode = st.st_ino;
+    h->mtime = st.st_mtim;
+    memcpy(h->hex, hex, sizeof(h->hex));
+    ok = true;
+
+out:
+    close(fd);
+    return ok;
+}
+
+#define ENV_TRAMPOLINE_MAX 256
+
+struct env_trampoline {
+    uint32_t tgid;
+    char *script;
+};
+
+static struct env_trampoline env_trampolines[ENV_TRAMPOLINE_MAX];
+static int env_trampolines_next = 0;
+
+static bool is_env_interpreter(const char *interpreter)
+{
+    const char *base = strrchr(interpreter, '/');
+    return strcmp(base ? base + 1 : interpreter, "env") == 0;
+}
+
+// A "#!/usr/bin/env NAME" script is run by env, which looks up and execs NAME
+// with the script as an argument, in the same process. The kernel only ever
+// sees env as the interpreter, so scripts run by env are remembered until
+// their process execs again.
+//
+// Returns the script evt is the env'd interpreter of, NULL if it isn't one.
+// The caller frees it.
+static char *env_trampoline__exec(struct ebpf_process_exec_event *evt)
+{
+    const char *interpreter = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_INTERPRETER);
+    char *script            = NULL;
+
+    for (int i = 0; i < ENV_TRAMPOLINE_MAX; i++) {
+        struct env_trampoline *t = &env_trampolines[i];
+        if (!t->script || t->tgid != evt->pids.tgid)
+            continue;
+
+        // env could've failed and the process exec'd something else
+        if (argv_contains(evt->argv, evt->argv_len, t->script))
+            script = t->script;
+        else
+            free(t->script);
+        t->script = NULL;
+        break;
+    }
+
+    if (interpreter[0] && is_env_interpreter(interpreter)) {
+        struct env_trampoline *t = &env_trampolines[env_trampolines_next];
+        env_trampolines_next     = (env_trampolines_next + 1) % ENV_TRAMPOLINE_MAX;
+
+        free(t->script);
+        t->tgid   = evt->pids.tgid;
+        t->script = strdup(evt->filename);
+    }
+
+    return script;
+}
+
+struct file_extension {
+    const char *ext;
+    enum file_category category;
+};
+
+static const struct file_extension file_extensions[] = {
+    {"exe", FILE_CATEGORY_EXECUTABLE}, {"elf", FILE_CATEGORY_EXECUTABLE},
+    {"so", FILE_CATEGORY_EXECUTABLE},  {"bin", FILE_CATEGORY_EXECUTABLE},
+    {"sh", FILE_CATEGORY_SCRIPT},      {"bash", FILE_CATEGORY_SCRIPT},
+    {"py", FILE_CATEGORY_SCRIPT},      {"pl", FILE_CATEGORY_SCRIPT},
+    {"rb", FILE_CATEGORY_SCRIPT},      {"php", FILE_CATEGORY_SCRIPT},
+    {"js", FILE_CATEGORY_SCRIPT},      {"ps1", FILE_CATEGORY_SCRIPT},
+    {"zip", FILE_CATEGORY_ARCHIVE},    {"tar", FILE_CATEGORY_ARCHIVE},
+    {"gz", FILE_CATEGORY_ARCHIVE},     {"tgz", FILE_CATEGORY_ARCHIVE},
+    {"bz2", FILE_CATEGORY_ARCHIVE},    {"xz", FILE_CATEGORY_ARCHIVE},
+    {"7z", FILE_CATEGORY_ARCHIVE},     {"rar", FILE_CATEGORY_ARCHIVE},
+    {"pdf", FILE_CATEGORY_DOCUMENT},   {"doc", FILE_CATEGORY_DOCUMENT},
+    {"docx", FILE_CATEGORY_DOCUMENT},  {"xls", FILE_CATEGORY_DOCUMENT},
+    {"xlsx", FILE_CATEGORY_DOCUMENT},  {"odt", FILE_CATEGORY_DOCUMENT},
+    {"txt", FILE_CATEGORY_DOCUMENT},
+};
+
+// Only the first FILE_MAGIC_LEN bytes of a file are ever read
+#define FILE_MAGIC_LEN 4
+
+struct file_magic {
+    const char *magic;
+    size_t len;
+    enum file_category category;
+};
+
+static const struct file_magic file_magics[] = {
+    {"\x7f" "ELF", 4, FILE_CATEGORY_EXECUTABLE},
+    {"#!", 2, FILE_CATEGORY_SCRIPT},
+    {"PK\x03\x04", 4, FILE_CATEGORY_ARCHIVE},
+    {"\x1f\x8b", 2, FILE_CATEGORY_ARCHIVE},
+    {"%PDF", 4, FILE_CATEGORY_DOCUMENT},
+};
+
+// The mount namespace EventsTrace runs in, 0 if it can't be told
+static uint32_t own_mntns(void)
+{
+    static uint32_t mntns = 0;
+    struct stat st;
+
+    if (!mntns && stat("/proc/self/ns/mnt", &st) == 0)
+        mntns = st.st_ino;
+    return mntns;
+}
+
+// path is relative to root_path in mount namespace mntns, as in events. The
+// file can only be found if that's EventsTrace's mount namespace, root_path
+// is NULL if unknown.
+static enum file_category
+file_category_by_magic(const char *path, const char *root_path, uint32_t mntns)
+{
+    char full_path[PATH_MAX * 2];
+    char buf[FILE_MAGIC_LEN];
+    struct stat st;
+
+    if (!root_path || mntns != own_mntns())
+        return FILE_CATEGORY_OTHER;
+
+    if (strcmp(root_path, "/") != 0)
+        snprintf(full_path, sizeof(full_path), "%s%s", root_path, path);
+    else
+        snprintf(full_path, sizeof(full_path), "%s", path);
+
+    // The file may well be gone by now (e.g. on delete), or not readable by
+    // us, in which case it's just unclassified
+    int fd = open_regular_file(full_path, &st);
+    if (fd < 0)
+        return FILE_CATEGORY_OTHER;
+
+    ssize_t len = read(fd, buf, sizeof(buf));
+    close(fd);
+
+    for (size_t i = 0; i < sizeof(file_magics) / sizeof(file_magics[0]); i++) {
+        const struct file_magic *m = &file_magics[i];
+        if (len >= (ssize_t)m->len && memcmp(buf, m->magic, m->len) == 0)
+            return m->category;
+    }
+
+    return FILE_CATEGORY_OTHER;
+}
+
+// Extension first as it's free, magic bytes only if asked for and the
+// extension didn't tell us anything. See file_category_by_magic for the
+// arguments.
+static enum file_category file_category(const char *path, const char *root_path, uint32_t mntns)
+{
+    const char *name = strrchr(path, '/');
+    name             = name ? name + 1 : path;
+
+    const char *ext = strrchr(name, '.');
+    if (ext && ext != name) {
+        for (size_t i = 0; i < sizeof(file_extensions) / sizeof(file_extensions[0]); i++) {
+            if (strcasecmp(ext + 1, file_extensions[i].ext) == 0)
+                return file_extensions[i].category;
+        }
+    }
+
+    if (g_file_category_magic)
+        return file_category_by_magic(path, root_path, mntns);
+
+    return FILE_CATEGORY_OTHER;
+}
+
+static bool file_category_wanted(enum file_category category)
+{
+    return g_file_categories == 0 || (g_file_categories & (1 << category));
+}
+
 static void out_comma()
 {
     printf(",");
@@ -190,6 +1124,12 @@ static void out_event_type(const char *type)
     printf("\"event_type\":\"%s\"", type);
 }
 
+static void out_event_hdr(struct ebpf_event_header *hdr)
+{
+    printf("\"ktime_ns\":%" PRIu64 ",\"cpu\":%u,\"subseq\":%" PRIu64 ",\"proc_seq\":%" PRIu64,
+           hdr->ts, hdr->cpu, hdr->subseq, hdr->proc_seq);
+}
+
 static void out_uint(const char *name, const unsigned long value)
 {
     printf("\"%s\":%lu", name, value);
@@ -205,9 +1145,35 @@ static void out_bool(const char *name, const bool value)
     printf("\"%s\":\"%s\"", name, value ? "TRUE" : "FALSE");
 }
 
-static void out_string(const char *name, const char *value)
+struct flag_name {
+    const char *name;
+    uint64_t flag;
+};
+
+// Prints the names of the flags set in flags as a JSON array
+static void out_flags(const char *name,
+                      uint64_t flags,
+                      const struct flag_name *names,
+                      size_t names_len)
+{
+    printf("\"%s\":[", name);
+
+    bool first = true;
+    for (size_t i = 0; i < names_len; i++) {
+        if (!(flags & names[i].flag))
+            continue;
+
+        if (!first)
+            out_comma();
+        printf("\"%s\"", names[i].name);
+        first = false;
+    }
+    printf("]");
+}
+
+static void out_escaped(const char *value)
 {
-    printf("\"%s\":\"", name);
+    printf("\"");
     for (size_t i = 0; i < strlen(value); i++) {
         char c = value[i];
         switch (c) {
@@ -240,6 +1206,12 @@ static void out_string(const char *name, const char *value)
     printf("\"");
 }
 
+static void out_string(const char *name, const char *value)
+{
+    printf("\"%s\":", name);
+    out_escaped(value);
+}
+
 static void out_tty_dev(const char *name, struct ebpf_tty_dev *tty_dev)
 {
     printf("\"%s\":", name);
@@ -257,24 +1229,173 @@ static void out_tty_dev(const char *name, struct ebpf_tty_dev *tty_dev)
     out_object_end();
 }
 
-static void out_pid_info(const char *name, struct ebpf_pid_info *pid_info)
+// The path is only sent if it differs from pids_ss_cgroup_path
+static void out_cgroup_info(const char *name,
+                            struct ebpf_cgroup_info *cgroup,
+                            const char *pids_ss_cgroup_path,
+                            struct ebpf_varlen_fields_start *fields)
 {
+    struct ebpf_varlen_field *path = vl_field(fields, EBPF_VL_FIELD_CGROUP_PATH);
+
     printf("\"%s\":", name);
     out_object_start();
-    out_int("tid", pid_info->tid);
-    out_comma();
-    out_int("tgid", pid_info->tgid);
-    out_comma();
-    out_int("ppid", pid_info->ppid);
-    out_comma();
-    out_int("pgid", pid_info->pgid);
+    out_uint("id", cgroup->id);
+    out_comma();
+    out_string("path", !cgroup->id ? "" : path ? path->data : pids_ss_cgroup_path);
+
+    out_object_end();
+}
+
+static void out_namespace_info(const char *name, struct ebpf_namespace_info *ns)
+{
+    printf("\"%s\":", name);
+    out_object_start();
+    out_uint("mnt", ns->mnt);
+    out_comma();
+    out_uint("net", ns->net);
+    out_comma();
+    out_uint("pid", ns->pid);
+    out_comma();
+    out_uint("user", ns->user);
+    out_comma();
+    out_uint("uts", ns->uts);
+    out_comma();
+    out_uint("ipc", ns->ipc);
+    out_comma();
+    out_uint("cgroup", ns->cgroup);
+
+    out_object_end();
+}
+
+// Empty if the cgroup isn't a container's
+static void out_container_id(const char *name, const char *cgroup_path)
+{
+    char container_id[CONTAINER_ID_LEN + 1] = "";
+    container_id_from_cgroup(cgroup_path, container_id);
+    out_string(name, container_id);
+}
+
+// Opaque, so printed as a string. Empty if it couldn't be computed.
+static void out_entity_id(const char *name, uint32_t tgid, uint64_t start_time_ns)
+{
+    uint64_t id;
+
+    if (ebpf_entity_id(tgid, start_time_ns, &id) < 0) {
+        out_string(name, "");
+        return;
+    }
+
+    printf("\"%s\":\"%016" PRIx64 "\"", name, id);
+}
+
+static void out_pid_info(const char *name, struct ebpf_pid_info *pid_info)
+{
+    printf("\"%s\":", name);
+    out_object_start();
+    out_int("tid", pid_info->tid);
+    out_comma();
+    out_int("tgid", pid_info->tgid);
+    out_comma();
+    out_int("ppid", pid_info->ppid);
+    out_comma();
+    out_int("pgid", pid_info->pgid);
     out_comma();
     out_int("sid", pid_info->sid);
     out_comma();
     out_uint("start_time_ns", pid_info->start_time_ns);
+    out_comma();
+    out_uint("start_boottime_ns", pid_info->start_boottime_ns);
+    out_comma();
+
+    // Only meaningful for processes in a container, i.e. with their own pid
+    // namespace, where it's the time between the container's init starting
+    // and this process starting
+    if (pid_info->pidns_init_start_boottime_ns) {
+        out_uint("container_start_time_ns",
+                 pid_info->start_boottime_ns - pid_info->pidns_init_start_boottime_ns);
+        out_comma();
+    }
+
+    out_entity_id("entity_id", pid_info->tgid, pid_info->start_time_ns);
+    out_comma();
+
+    // Processes with no parent (init and kthreadd) get an empty parent entity
+    // ID rather than one derived from the idle task
+    if (pid_info->ppid == 0)
+        out_string("parent_entity_id", "");
+    else
+        out_entity_id("parent_entity_id", pid_info->ppid, pid_info->parent_start_time_ns);
     out_object_end();
 }
 
+// Indexed by capability number, from include/uapi/linux/capability.h
+static const char *cap_names[] = {
+    "CAP_CHOWN",
+    "CAP_DAC_OVERRIDE",
+    "CAP_DAC_READ_SEARCH",
+    "CAP_FOWNER",
+    "CAP_FSETID",
+    "CAP_KILL",
+    "CAP_SETGID",
+    "CAP_SETUID",
+    "CAP_SETPCAP",
+    "CAP_LINUX_IMMUTABLE",
+    "CAP_NET_BIND_SERVICE",
+    "CAP_NET_BROADCAST",
+    "CAP_NET_ADMIN",
+    "CAP_NET_RAW",
+    "CAP_IPC_LOCK",
+    "CAP_IPC_OWNER",
+    "CAP_SYS_MODULE",
+    "CAP_SYS_RAWIO",
+    "CAP_SYS_CHROOT",
+    "CAP_SYS_PTRACE",
+    "CAP_SYS_PACCT",
+    "CAP_SYS_ADMIN",
+    "CAP_SYS_BOOT",
+    "CAP_SYS_NICE",
+    "CAP_SYS_RESOURCE",
+    "CAP_SYS_TIME",
+    "CAP_SYS_TTY_CONFIG",
+    "CAP_MKNOD",
+    "CAP_LEASE",
+    "CAP_AUDIT_WRITE",
+    "CAP_AUDIT_CONTROL",
+    "CAP_SETFCAP",
+    "CAP_MAC_OVERRIDE",
+    "CAP_MAC_ADMIN",
+    "CAP_SYSLOG",
+    "CAP_WAKE_ALARM",
+    "CAP_BLOCK_SUSPEND",
+    "CAP_AUDIT_READ",
+    "CAP_PERFMON",
+    "CAP_BPF",
+    "CAP_CHECKPOINT_RESTORE",
+};
+
+// Prints a capability set as an array of names. Capabilities newer than
+// cap_names are printed as CAP_<number>.
+static void out_cap_set(const char *name, uint64_t caps)
+{
+    bool first = true;
+
+    printf("\"%s\":[", name);
+    for (int i = 0; i < 64; i++) {
+        if (!(caps & (1ULL << i)))
+            continue;
+
+        if (!first)
+            out_comma();
+        first = false;
+
+        if (i < sizeof(cap_names) / sizeof(cap_names[0]))
+            printf("\"%s\"", cap_names[i]);
+        else
+            printf("\"CAP_%d\"", i);
+    }
+    printf("]");
+}
+
 static void out_cred_info(const char *name, struct ebpf_cred_info *cred_info)
 {
     printf("\"%s\":", name);
@@ -290,6 +1411,22 @@ static void out_cred_info(const char *name, struct ebpf_cred_info *cred_info)
     out_int("suid", cred_info->suid);
     out_comma();
     out_int("sgid", cred_info->sgid);
+    out_comma();
+    out_int("container_ruid", cred_info->container_ruid);
+    out_comma();
+    out_int("container_rgid", cred_info->container_rgid);
+    out_comma();
+    out_int("container_euid", cred_info->container_euid);
+    out_comma();
+    out_int("container_egid", cred_info->container_egid);
+    out_comma();
+    out_int("container_suid", cred_info->container_suid);
+    out_comma();
+    out_int("container_sgid", cred_info->container_sgid);
+    out_comma();
+    out_cap_set("cap_permitted", cred_info->cap_permitted);
+    out_comma();
+    out_cap_set("cap_effective", cred_info->cap_effective);
     out_object_end();
 }
 
@@ -315,21 +1452,70 @@ static void out_argv(const char *name, char *buf, size_t buf_size)
     out_string(name, scratch_space);
 }
 
+// Unlike out_argv, keeps arguments containing spaces (or empty ones) apart
+static void out_argv_array(const char *name, const char *buf, size_t len)
+{
+    printf("\"%s\":[", name);
+    for (size_t i = 0; i < len; i += strnlen(buf + i, len - i) + 1) {
+        if (i != 0)
+            out_comma();
+
+        // The last argument isn't terminated if argv was truncated
+        char arg[len - i + 1];
+        memcpy(arg, buf + i, len - i);
+        arg[len - i] = '\0';
+        out_escaped(arg);
+    }
+    printf("]");
+}
+
 static void out_file_delete(struct ebpf_file_delete_event *evt)
 {
+    enum file_category category = file_category(evt->path, vl_root_path(&evt->vl_fields), evt->mntns);
+    if (!file_category_wanted(category))
+        return;
+
     out_object_start();
     out_event_type("FILE_DELETE");
     out_comma();
 
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
     out_pid_info("pids", &evt->pids);
     out_comma();
 
     out_string("path", evt->path);
     out_comma();
 
+    out_string("root_path", vl_root_path(&evt->vl_fields));
+    out_comma();
+
+    out_string("file_category", file_category_names[category]);
+    out_comma();
+
+    out_uint("dev", evt->dev);
+    out_comma();
+
+    out_uint("inode", evt->inode);
+    out_comma();
+
+    out_uint("size", evt->size);
+    out_comma();
+
+    out_bool("is_last_link", evt->is_last_link);
+    out_comma();
+
     out_int("mount_namespace", evt->mntns);
     out_comma();
 
+    const char *pids_ss_cgroup_path = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_CGROUP_PATH);
+    out_string("pids_ss_cgroup_path", pids_ss_cgroup_path);
+    out_comma();
+
+    out_container_id("container_id", pids_ss_cgroup_path);
+    out_comma();
+
     out_string("comm", (const char *)&evt->comm);
 
     out_object_end();
@@ -338,38 +1524,80 @@ static void out_file_delete(struct ebpf_file_delete_event *evt)
 
 static void out_file_create(struct ebpf_file_create_event *evt)
 {
+    enum file_category category = file_category(evt->path, vl_root_path(&evt->vl_fields), evt->mntns);
+    if (!file_category_wanted(category))
+        return;
+
     out_object_start();
     out_event_type("FILE_CREATE");
     out_comma();
 
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
     out_pid_info("pids", &evt->pids);
     out_comma();
 
     out_string("path", evt->path);
     out_comma();
 
+    out_string("root_path", vl_root_path(&evt->vl_fields));
+    out_comma();
+
+    out_string("file_category", file_category_names[category]);
+    out_comma();
+
+    out_uint("dev", evt->dev);
+    out_comma();
+
+    out_uint("inode", evt->inode);
+    out_comma();
+
+    out_uint("inode_generation", evt->inode_generation);
+    out_comma();
+
     out_int("mount_namespace", evt->mntns);
     out_comma();
 
+    const char *pids_ss_cgroup_path = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_CGROUP_PATH);
+    out_string("pids_ss_cgroup_path", pids_ss_cgroup_path);
+    out_comma();
+
+    out_container_id("container_id", pids_ss_cgroup_path);
+    out_comma();
+
     out_string("comm", (const char *)&evt->comm);
 
     out_object_end();
     out_newline();
 }
 
-static void out_file_rename(struct ebpf_file_rename_event *evt)
+static void out_file_link(const char *name, struct ebpf_file_link_event *evt)
 {
+    enum file_category category = file_category(evt->link_path, vl_root_path(&evt->vl_fields), evt->mntns);
+    if (!file_category_wanted(category))
+        return;
+
     out_object_start();
-    out_event_type("FILE_RENAME");
+    out_event_type(name);
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
     out_comma();
 
     out_pid_info("pids", &evt->pids);
     out_comma();
 
-    out_string("old_path", evt->old_path);
+    out_string("target_path", evt->target_path);
     out_comma();
 
-    out_string("new_path", evt->new_path);
+    out_string("link_path", evt->link_path);
+    out_comma();
+
+    out_string("root_path", vl_root_path(&evt->vl_fields));
+    out_comma();
+
+    out_string("file_category", file_category_names[category]);
     out_comma();
 
     out_int("mount_namespace", evt->mntns);
@@ -381,300 +1609,3273 @@ static void out_file_rename(struct ebpf_file_rename_event *evt)
     out_newline();
 }
 
-static void out_process_fork(struct ebpf_process_fork_event *evt)
+static void out_file_modify_attr_change(const char *name, enum ebpf_file_modify_attr_change change)
+{
+    switch (change) {
+    case EBPF_FILE_MODIFY_ATTR_CHANGE_MODE:
+        out_string(name, "MODE");
+        break;
+    case EBPF_FILE_MODIFY_ATTR_CHANGE_OWNER:
+        out_string(name, "OWNER");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_file_modify_attr(struct ebpf_file_modify_attr_event *evt)
 {
+    enum file_category category = file_category(evt->path, vl_root_path(&evt->vl_fields), evt->mntns);
+    if (!file_category_wanted(category))
+        return;
+
     out_object_start();
-    out_event_type("PROCESS_FORK");
+    out_event_type("FILE_MODIFY_ATTR");
     out_comma();
 
-    out_pid_info("parent_pids", &evt->parent_pids);
+    out_event_hdr(&evt->hdr);
     out_comma();
 
-    out_pid_info("child_pids", &evt->child_pids);
+    out_pid_info("pids", &evt->pids);
     out_comma();
 
-    out_string("pids_ss_cgroup_path", evt->pids_ss_cgroup_path);
+    out_string("path", evt->path);
+    out_comma();
 
-    out_object_end();
-    out_newline();
-}
+    out_string("root_path", vl_root_path(&evt->vl_fields));
+    out_comma();
 
-static void out_process_exec(struct ebpf_process_exec_event *evt)
-{
-    out_object_start();
-    out_event_type("PROCESS_EXEC");
+    out_string("file_category", file_category_names[category]);
     out_comma();
 
-    out_pid_info("pids", &evt->pids);
+    out_file_modify_attr_change("change", evt->change);
     out_comma();
 
-    out_cred_info("creds", &evt->creds);
+    out_uint("old_mode", evt->old_mode);
     out_comma();
 
-    out_tty_dev("ctty", &evt->ctty);
+    out_uint("new_mode", evt->new_mode);
     out_comma();
 
-    out_string("filename", evt->filename);
+    out_uint("old_uid", evt->old_uid);
     out_comma();
 
-    out_string("cwd", evt->cwd);
+    out_uint("new_uid", evt->new_uid);
     out_comma();
 
-    out_string("pids_ss_cgroup_path", evt->pids_ss_cgroup_path);
+    out_uint("old_gid", evt->old_gid);
     out_comma();
 
-    out_argv("argv", evt->argv, sizeof(evt->argv));
+    out_uint("new_gid", evt->new_gid);
+    out_comma();
+
+    out_int("mount_namespace", evt->mntns);
+    out_comma();
+
+    out_string("comm", (const char *)&evt->comm);
 
     out_object_end();
     out_newline();
 }
 
-static void out_process_setsid(struct ebpf_process_setsid_event *evt)
+static const struct flag_name rename_flag_names[] = {
+    {"RENAME_NOREPLACE", EBPF_FILE_RENAME_NOREPLACE},
+    {"RENAME_EXCHANGE", EBPF_FILE_RENAME_EXCHANGE},
+    {"RENAME_WHITEOUT", EBPF_FILE_RENAME_WHITEOUT},
+};
+
+static void out_file_rename(struct ebpf_file_rename_event *evt)
 {
+    enum file_category category = file_category(evt->new_path, vl_root_path(&evt->vl_fields), evt->mntns);
+    if (!file_category_wanted(category))
+        return;
+
     out_object_start();
-    out_event_type("PROCESS_SETSID");
+    out_event_type("FILE_RENAME");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
     out_comma();
 
     out_pid_info("pids", &evt->pids);
+    out_comma();
 
-    out_object_end();
-    out_newline();
-}
+    out_string("old_path", evt->old_path);
+    out_comma();
 
-static void out_process_setuid(struct ebpf_process_setuid_event *evt)
-{
-    out_object_start();
-    out_event_type("PROCESS_SETUID");
+    out_string("new_path", evt->new_path);
     out_comma();
 
-    out_pid_info("pids", &evt->pids);
+    out_string("root_path", vl_root_path(&evt->vl_fields));
     out_comma();
-    out_uint("new_ruid", evt->new_ruid);
+
+    out_string("file_category", file_category_names[category]);
     out_comma();
-    out_uint("new_euid", evt->new_euid);
 
-    out_object_end();
-    out_newline();
-}
+    out_bool("cross_directory", evt->cross_directory);
+    out_comma();
 
-static void out_process_setgid(struct ebpf_process_setgid_event *evt)
-{
-    out_object_start();
-    out_event_type("PROCESS_SETGID");
+    out_flags("flags", evt->flags, rename_flag_names,
+              sizeof(rename_flag_names) / sizeof(rename_flag_names[0]));
     out_comma();
 
-    out_pid_info("pids", &evt->pids);
+    out_int("mount_namespace", evt->mntns);
     out_comma();
-    out_uint("new_rgid", evt->new_rgid);
+
+    const char *pids_ss_cgroup_path = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_CGROUP_PATH);
+    out_string("pids_ss_cgroup_path", pids_ss_cgroup_path);
     out_comma();
-    out_uint("new_egid", evt->new_egid);
+
+    out_container_id("container_id", pids_ss_cgroup_path);
+    out_comma();
+
+    out_string("comm", (const char *)&evt->comm);
 
     out_object_end();
     out_newline();
 }
 
-static void out_process_tty_write(struct ebpf_process_tty_write_event *evt)
+static const struct flag_name clone_flag_names[] = {
+    {"CLONE_VM", CLONE_VM},
+    {"CLONE_FS", CLONE_FS},
+    {"CLONE_FILES", CLONE_FILES},
+    {"CLONE_SIGHAND", CLONE_SIGHAND},
+    {"CLONE_PIDFD", CLONE_PIDFD},
+    {"CLONE_PTRACE", CLONE_PTRACE},
+    {"CLONE_VFORK", CLONE_VFORK},
+    {"CLONE_PARENT", CLONE_PARENT},
+    {"CLONE_THREAD", CLONE_THREAD},
+    {"CLONE_NEWNS", CLONE_NEWNS},
+    {"CLONE_SYSVSEM", CLONE_SYSVSEM},
+    {"CLONE_SETTLS", CLONE_SETTLS},
+    {"CLONE_PARENT_SETTID", CLONE_PARENT_SETTID},
+    {"CLONE_CHILD_CLEARTID", CLONE_CHILD_CLEARTID},
+    {"CLONE_UNTRACED", CLONE_UNTRACED},
+    {"CLONE_CHILD_SETTID", CLONE_CHILD_SETTID},
+    {"CLONE_NEWCGROUP", CLONE_NEWCGROUP},
+    {"CLONE_NEWUTS", CLONE_NEWUTS},
+    {"CLONE_NEWIPC", CLONE_NEWIPC},
+    {"CLONE_NEWUSER", CLONE_NEWUSER},
+    {"CLONE_NEWPID", CLONE_NEWPID},
+    {"CLONE_NEWNET", CLONE_NEWNET},
+    {"CLONE_IO", CLONE_IO},
+    {"CLONE_NEWTIME", CLONE_NEWTIME},
+    {"CLONE_CLEAR_SIGHAND", CLONE_CLEAR_SIGHAND},
+    {"CLONE_INTO_CGROUP", CLONE_INTO_CGROUP},
+};
+
+static void out_process_fork(struct ebpf_process_fork_event *evt)
 {
     out_object_start();
-    out_event_type("PROCESS_TTY_WRITE");
+    out_event_type("PROCESS_FORK");
     out_comma();
 
-    out_pid_info("pids", &evt->pids);
+    out_event_hdr(&evt->hdr);
     out_comma();
-    out_uint("tty_out_len", evt->tty_out_len);
-    out_comma();
-    out_uint("tty_out_truncated", evt->tty_out_truncated);
+
+    out_pid_info("parent_pids", &evt->parent_pids);
     out_comma();
-    out_tty_dev("tty", &evt->tty);
+
+    out_pid_info("child_pids", &evt->child_pids);
     out_comma();
-    out_string("tty_out", evt->tty_out);
+
+    out_string("pids_ss_cgroup_path", evt->pids_ss_cgroup_path);
     out_comma();
-    out_string("comm", (const char *)&evt->comm);
 
-    out_object_end();
-    out_newline();
-}
+    out_container_id("container_id", evt->pids_ss_cgroup_path);
+    out_comma();
 
-static void out_process_exit(struct ebpf_process_exit_event *evt)
-{
-    out_object_start();
-    out_event_type("PROCESS_EXIT");
+    out_flags("clone_flags", evt->clone_flags, clone_flag_names,
+              sizeof(clone_flag_names) / sizeof(clone_flag_names[0]));
     out_comma();
 
-    out_pid_info("pids", &evt->pids);
+    out_bool("is_thread", evt->is_thread);
     out_comma();
 
-    out_string("pids_ss_cgroup_path", evt->pids_ss_cgroup_path);
+    out_cgroup_info("cgroup", &evt->cgroup, evt->pids_ss_cgroup_path, &evt->vl_fields);
     out_comma();
 
-    out_int("exit_code", evt->exit_code);
+    out_namespace_info("namespaces", &evt->namespaces);
 
     out_object_end();
     out_newline();
 }
 
-static void out_ip_addr(const char *name, const void *addr)
+static void out_process_exec_source(const char *name, enum ebpf_process_exec_source source)
 {
-    char buf[INET_ADDRSTRLEN];
-    inet_ntop(AF_INET, addr, buf, sizeof(buf));
-    printf("\"%s\":\"%s\"", name, buf);
+    switch (source) {
+    case EBPF_PROCESS_EXEC_SOURCE_EXECVE:
+        out_string(name, "execve");
+        break;
+    case EBPF_PROCESS_EXEC_SOURCE_EXECVEAT:
+        out_string(name, "execveat");
+        break;
+    case EBPF_PROCESS_EXEC_SOURCE_MEMFD:
+        out_string(name, "memfd");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
 }
 
-static void out_ip6_addr(const char *name, const void *addr)
+static void out_process_exec(struct ebpf_process_exec_event *evt)
 {
-    char buf[INET6_ADDRSTRLEN];
-    inet_ntop(AF_INET6, addr, buf, sizeof(buf));
-    printf("\"%s\":\"%s\"", name, buf);
-}
+    out_object_start();
+    out_event_type("PROCESS_EXEC");
+    out_comma();
 
-static void out_net_info(const char *name, struct ebpf_net_event *evt)
-{
-    struct ebpf_net_info *net = &evt->net;
+    out_event_hdr(&evt->hdr);
+    out_comma();
 
-    printf("\"%s\":", name);
-    out_object_start();
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_cred_info("creds", &evt->creds);
+    out_comma();
+
+    out_tty_dev("ctty", &evt->ctty);
+    out_comma();
+
+    out_string("filename", evt->filename);
+    out_comma();
+
+    out_process_exec_source("exec_source", evt->source);
+    out_comma();
+
+    const char *interpreter = vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_INTERPRETER);
+    char *env_script        = env_trampoline__exec(evt);
+    if (env_script) {
+        out_string("interpreter", interpreter[0] ? interpreter : evt->filename);
+        out_comma();
+        out_string("script_path", env_script);
+    } else {
+        out_string("interpreter", interpreter);
+        out_comma();
+        out_string("script_path", interpreter[0] ? evt->filename : "");
+    }
+    out_comma();
+    out_bool("interpreter_via_env", env_script != NULL);
+    out_comma();
+    free(env_script);
+
+    out_string("exe_path", vl_field_string(&evt->vl_fields, EBPF_VL_FIELD_EXE_PATH));
+    out_comma();
+
+    out_uint("exe_dev", evt->exe_dev);
+    out_comma();
+
+    out_uint("exe_inode", evt->exe_inode);
+    out_comma();
+
+    out_uint("exe_inode_generation", evt->exe_inode_generation);
+    out_comma();
+
+    out_string("exe_fs_type", evt->exe_fs_type);
+    out_comma();
+
+    // Left out if the type doesn't say, exe_fs_type is all there is then
+    if (evt->exe_fs_class != EBPF_FS_CLASS_UNKNOWN) {
+        out_bool("exe_on_network_fs", evt->exe_fs_class == EBPF_FS_CLASS_NETWORK);
+        out_comma();
+
+        out_bool("exe_on_removable_fs", evt->exe_fs_class == EBPF_FS_CLASS_REMOVABLE);
+        out_comma();
+    }
+
+    out_bool("no_new_privs", evt->no_new_privs);
+    out_comma();
+
+    out_uint("mntns_switched_from", evt->mntns_switched_from);
+    out_comma();
+
+    out_string("cwd", evt->cwd);
+    out_comma();
+
+    out_string("root_path", vl_root_path(&evt->vl_fields));
+    out_comma();
+
+    out_string("pids_ss_cgroup_path", evt->pids_ss_cgroup_path);
+    out_comma();
+
+    out_cgroup_info("cgroup", &evt->cgroup, evt->pids_ss_cgroup_path, &evt->vl_fields);
+    out_comma();
+
+    out_namespace_info("namespaces", &evt->namespaces);
+    out_comma();
+
+    out_argv("argv", evt->argv, sizeof(evt->argv));
+    out_comma();
+
+    out_argv_array("argv_array", evt->argv, evt->argv_len);
+    out_comma();
+
+    out_bool("argv_truncated", evt->argv_truncated);
+    out_comma();
+
+    struct ebpf_varlen_field *parent_argv = vl_field(&evt->vl_fields, EBPF_VL_FIELD_PARENT_ARGV);
+    if (parent_argv)
+        out_argv("parent_argv", parent_argv->data, parent_argv->size);
+    else
+        out_string("parent_argv", "");
+    out_comma();
+
+    out_bool("parent_argv_truncated", evt->parent_argv_truncated);
+    out_comma();
+
+    out_bool("parent_argv_stale", evt->parent_argv_stale);
+    out_comma();
+
+    if (g_capture_env) {
+        struct ebpf_varlen_field *env = vl_field(&evt->vl_fields, EBPF_VL_FIELD_ENV);
+        out_argv_array("env", env ? env->data : "", env ? env->size : 0);
+        out_comma();
+
+        out_bool("env_truncated", evt->env_truncated);
+        out_comma();
+    }
+
+    if (g_hash_execs) {
+        char sha256[SHA256_HEX_LEN + 1] = "";
+        bool hashed                     = exec_sha256(evt, sha256);
+        out_string("sha256", sha256);
+        out_comma();
+
+        out_bool("sha256_error", !hashed);
+        out_comma();
+    }
+
+    const struct lolbin *lb = match_lolbin(evt);
+    out_bool("lolbin", lb != NULL);
+    out_comma();
+    out_string("lolbin_category", lb ? lb->category : "");
+    out_comma();
+
+    char container_id[CONTAINER_ID_LEN + 1] = "";
+    bool container_exec                     = false;
+    if (container_id_from_cgroup(evt->pids_ss_cgroup_path, container_id))
+        container_exec = is_container_exec(evt);
+    out_string("container_id", container_id);
+    out_comma();
+    out_bool("container_exec", container_exec);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_chdir(struct ebpf_process_chdir_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_CHDIR");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    switch (evt->syscall) {
+    case EBPF_PROCESS_CHDIR_SYSCALL_CHDIR:
+        out_string("syscall", "chdir");
+        break;
+    case EBPF_PROCESS_CHDIR_SYSCALL_FCHDIR:
+        out_string("syscall", "fchdir");
+        break;
+    default:
+        out_string("syscall", "UNKNOWN");
+        break;
+    }
+    out_comma();
+
+    out_string("cwd", evt->cwd);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+// Used for both PROCESS_UNSHARE and PROCESS_SETNS
+static void out_process_namespace(const char *name, struct ebpf_process_namespace_event *evt)
+{
+    out_object_start();
+    out_event_type(name);
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_flags("ns_flags", evt->ns_flags, clone_flag_names,
+              sizeof(clone_flag_names) / sizeof(clone_flag_names[0]));
+    out_comma();
+
+    out_namespace_info("old_namespaces", &evt->old_namespaces);
+    out_comma();
+
+    out_namespace_info("new_namespaces", &evt->new_namespaces);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_setsid(struct ebpf_process_setsid_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_SETSID");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_pid_info("old_pids", &evt->old_pids);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_setuid(struct ebpf_process_setuid_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_SETUID");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+    out_uint("new_ruid", evt->new_ruid);
+    out_comma();
+    out_uint("new_euid", evt->new_euid);
+    out_comma();
+    out_uint("new_container_ruid", evt->new_container_ruid);
+    out_comma();
+    out_uint("new_container_euid", evt->new_container_euid);
+    out_comma();
+    out_uint("new_suid", evt->new_suid);
+    out_comma();
+    out_uint("new_fsuid", evt->new_fsuid);
+    out_comma();
+    out_uint("new_container_suid", evt->new_container_suid);
+    out_comma();
+    out_uint("new_container_fsuid", evt->new_container_fsuid);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_setgid(struct ebpf_process_setgid_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_SETGID");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+    out_uint("new_rgid", evt->new_rgid);
+    out_comma();
+    out_uint("new_egid", evt->new_egid);
+    out_comma();
+    out_uint("new_container_rgid", evt->new_container_rgid);
+    out_comma();
+    out_uint("new_container_egid", evt->new_container_egid);
+    out_comma();
+    out_uint("new_sgid", evt->new_sgid);
+    out_comma();
+    out_uint("new_fsgid", evt->new_fsgid);
+    out_comma();
+    out_uint("new_container_sgid", evt->new_container_sgid);
+    out_comma();
+    out_uint("new_container_fsgid", evt->new_container_fsgid);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_setcap(struct ebpf_process_setcap_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_SETCAP");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+    out_cap_set("old_cap_effective", evt->old_cap_effective);
+    out_comma();
+    out_cap_set("new_cap_effective", evt->new_cap_effective);
+    out_comma();
+    out_cap_set("old_cap_permitted", evt->old_cap_permitted);
+    out_comma();
+    out_cap_set("new_cap_permitted", evt->new_cap_permitted);
+    out_comma();
+    out_cap_set("old_cap_inheritable", evt->old_cap_inheritable);
+    out_comma();
+    out_cap_set("new_cap_inheritable", evt->new_cap_inheritable);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_setsched_syscall(const char *name,
+                                        enum ebpf_process_setsched_syscall syscall)
+{
+    switch (syscall) {
+    case EBPF_PROCESS_SETSCHED_SYSCALL_SCHED_SETSCHEDULER:
+        out_string(name, "sched_setscheduler");
+        break;
+    case EBPF_PROCESS_SETSCHED_SYSCALL_SETPRIORITY:
+        out_string(name, "setpriority");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_process_setsched_target_type(const char *name,
+                                             enum ebpf_process_setsched_target target_type)
+{
+    switch (target_type) {
+    case EBPF_PROCESS_SETSCHED_TARGET_PROCESS:
+        out_string(name, "PROCESS");
+        break;
+    case EBPF_PROCESS_SETSCHED_TARGET_PROCESS_GROUP:
+        out_string(name, "PROCESS_GROUP");
+        break;
+    case EBPF_PROCESS_SETSCHED_TARGET_USER:
+        out_string(name, "USER");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+// SCHED_RESET_ON_FORK can be OR'd into the policy passed to sched_setscheduler
+#define SCHED_RESET_ON_FORK_FLAG 0x40000000
+
+static void out_sched_policy(const char *name, int32_t policy)
+{
+    switch (policy & ~SCHED_RESET_ON_FORK_FLAG) {
+    case 0:
+        out_string(name, "SCHED_OTHER");
+        break;
+    case 1:
+        out_string(name, "SCHED_FIFO");
+        break;
+    case 2:
+        out_string(name, "SCHED_RR");
+        break;
+    case 3:
+        out_string(name, "SCHED_BATCH");
+        break;
+    case 5:
+        out_string(name, "SCHED_IDLE");
+        break;
+    case 6:
+        out_string(name, "SCHED_DEADLINE");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_process_setsched(struct ebpf_process_setsched_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_SETSCHED");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+    out_process_setsched_syscall("syscall", evt->syscall);
+    out_comma();
+    out_process_setsched_target_type("target_type", evt->target_type);
+    out_comma();
+    out_uint("target_id", evt->target_id);
+    out_comma();
+
+    if (evt->syscall == EBPF_PROCESS_SETSCHED_SYSCALL_SCHED_SETSCHEDULER) {
+        out_sched_policy("policy", evt->policy);
+        out_comma();
+        out_bool("reset_on_fork", evt->policy & SCHED_RESET_ON_FORK_FLAG);
+        out_comma();
+        out_int("sched_priority", evt->sched_priority);
+    } else {
+        out_int("nice", evt->nice);
+    }
+
+    out_object_end();
+    out_newline();
+}
+
+static const char *bpf_attach_type_names[] = {
+// clang-format off
+#define x(name) [BPF_##name] = #name,
+    x(CGROUP_INET_INGRESS)
+    x(CGROUP_INET_EGRESS)
+    x(CGROUP_INET_SOCK_CREATE)
+    x(CGROUP_SOCK_OPS)
+    x(SK_SKB_STREAM_PARSER)
+    x(SK_SKB_STREAM_VERDICT)
+    x(CGROUP_DEVICE)
+    x(SK_MSG_VERDICT)
+    x(CGROUP_INET4_BIND)
+    x(CGROUP_INET6_BIND)
+    x(CGROUP_INET4_CONNECT)
+    x(CGROUP_INET6_CONNECT)
+    x(CGROUP_INET4_POST_BIND)
+    x(CGROUP_INET6_POST_BIND)
+    x(CGROUP_UDP4_SENDMSG)
+    x(CGROUP_UDP6_SENDMSG)
+    x(LIRC_MODE2)
+    x(FLOW_DISSECTOR)
+    x(CGROUP_SYSCTL)
+    x(CGROUP_UDP4_RECVMSG)
+    x(CGROUP_UDP6_RECVMSG)
+    x(CGROUP_GETSOCKOPT)
+    x(CGROUP_SETSOCKOPT)
+    x(TRACE_RAW_TP)
+    x(TRACE_FENTRY)
+    x(TRACE_FEXIT)
+    x(MODIFY_RETURN)
+    x(LSM_MAC)
+    x(TRACE_ITER)
+    x(CGROUP_INET4_GETPEERNAME)
+    x(CGROUP_INET6_GETPEERNAME)
+    x(CGROUP_INET4_GETSOCKNAME)
+    x(CGROUP_INET6_GETSOCKNAME)
+    x(XDP_DEVMAP)
+    x(CGROUP_INET_SOCK_RELEASE)
+    x(XDP_CPUMAP)
+    x(SK_LOOKUP)
+    x(XDP)
+    x(SK_SKB_VERDICT)
+    x(SK_REUSEPORT_SELECT)
+    x(SK_REUSEPORT_SELECT_OR_MIGRATE)
+    x(PERF_EVENT)
+#undef x
+    // clang-format on
+};
+
+static void out_bpf_attach_type(const char *name, uint32_t attach_type)
+{
+    size_t n = sizeof(bpf_attach_type_names) / sizeof(bpf_attach_type_names[0]);
+
+    if (attach_type < n && bpf_attach_type_names[attach_type])
+        out_string(name, bpf_attach_type_names[attach_type]);
+    else
+        out_string(name, "UNKNOWN");
+}
+
+static void out_process_bpf_link(struct ebpf_process_bpf_link_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_BPF_LINK");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    switch (evt->cmd) {
+    case EBPF_PROCESS_BPF_LINK_CMD_LINK_CREATE:
+        out_string("cmd", "BPF_LINK_CREATE");
+        break;
+    case EBPF_PROCESS_BPF_LINK_CMD_RAW_TRACEPOINT_OPEN:
+        out_string("cmd", "BPF_RAW_TRACEPOINT_OPEN");
+        break;
+    default:
+        out_string("cmd", "UNKNOWN");
+        break;
+    }
+    out_comma();
+
+    out_bpf_attach_type("attach_type", evt->attach_type);
+    out_comma();
+
+    out_uint("prog_id", evt->prog_id);
+    out_comma();
+
+    out_uint("link_id", evt->link_id);
+    out_comma();
+
+    out_string("target", evt->target);
+    out_comma();
+
+    out_uint("target_ifindex", evt->target_ifindex);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static const char *bpf_prog_type_names[] = {
+// clang-format off
+#define x(name) [BPF_PROG_TYPE_##name] = #name,
+    x(UNSPEC)
+    x(SOCKET_FILTER)
+    x(KPROBE)
+    x(SCHED_CLS)
+    x(SCHED_ACT)
+    x(TRACEPOINT)
+    x(XDP)
+    x(PERF_EVENT)
+    x(CGROUP_SKB)
+    x(CGROUP_SOCK)
+    x(LWT_IN)
+    x(LWT_OUT)
+    x(LWT_XMIT)
+    x(SOCK_OPS)
+    x(SK_SKB)
+    x(CGROUP_DEVICE)
+    x(SK_MSG)
+    x(RAW_TRACEPOINT)
+    x(CGROUP_SOCK_ADDR)
+    x(LWT_SEG6LOCAL)
+    x(LIRC_MODE2)
+    x(SK_REUSEPORT)
+    x(FLOW_DISSECTOR)
+    x(CGROUP_SYSCTL)
+    x(RAW_TRACEPOINT_WRITABLE)
+    x(CGROUP_SOCKOPT)
+    x(TRACING)
+    x(STRUCT_OPS)
+    x(EXT)
+    x(LSM)
+    x(SK_LOOKUP)
+    x(SYSCALL)
+#undef x
+    // clang-format on
+};
+
+static const char *bpf_map_type_names[] = {
+// clang-format off
+#define x(name) [BPF_MAP_TYPE_##name] = #name,
+    x(UNSPEC)
+    x(HASH)
+    x(ARRAY)
+    x(PROG_ARRAY)
+    x(PERF_EVENT_ARRAY)
+    x(PERCPU_HASH)
+    x(PERCPU_ARRAY)
+    x(STACK_TRACE)
+    x(CGROUP_ARRAY)
+    x(LRU_HASH)
+    x(LRU_PERCPU_HASH)
+    x(LPM_TRIE)
+    x(ARRAY_OF_MAPS)
+    x(HASH_OF_MAPS)
+    x(DEVMAP)
+    x(SOCKMAP)
+    x(CPUMAP)
+    x(XSKMAP)
+    x(SOCKHASH)
+    x(CGROUP_STORAGE)
+    x(REUSEPORT_SOCKARRAY)
+    x(PERCPU_CGROUP_STORAGE)
+    x(QUEUE)
+    x(STACK)
+    x(SK_STORAGE)
+    x(DEVMAP_HASH)
+    x(STRUCT_OPS)
+    x(RINGBUF)
+    x(INODE_STORAGE)
+    x(TASK_STORAGE)
+    x(BLOOM_FILTER)
+#undef x
+    // clang-format on
+};
+
+static void out_bpf_type(const char *name, const char **names, size_t n, uint32_t type)
+{
+    if (type < n && names[type])
+        out_string(name, names[type]);
+    else
+        out_string(name, "UNKNOWN");
+}
+
+static void out_process_bpf_syscall(struct ebpf_process_bpf_syscall_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_BPF_SYSCALL");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    switch (evt->cmd) {
+    case EBPF_PROCESS_BPF_SYSCALL_CMD_PROG_LOAD:
+        out_string("cmd", "BPF_PROG_LOAD");
+        out_comma();
+        out_bpf_type("prog_type", bpf_prog_type_names,
+                     sizeof(bpf_prog_type_names) / sizeof(bpf_prog_type_names[0]), evt->type);
+        out_comma();
+        out_uint("prog_id", evt->id);
+        break;
+    case EBPF_PROCESS_BPF_SYSCALL_CMD_MAP_CREATE:
+        out_string("cmd", "BPF_MAP_CREATE");
+        out_comma();
+        out_bpf_type("map_type", bpf_map_type_names,
+                     sizeof(bpf_map_type_names) / sizeof(bpf_map_type_names[0]), evt->type);
+        out_comma();
+        out_uint("map_id", evt->id);
+        break;
+    default:
+        out_string("cmd", "UNKNOWN");
+        break;
+    }
+    out_comma();
+
+    // The kernel rejects unterminated names, but don't rely on it
+    char name[BPF_NAME_MAX + 1];
+    memcpy(name, evt->name, BPF_NAME_MAX);
+    name[BPF_NAME_MAX] = '\0';
+    out_string("name", name);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static const char *process_mm_field_names[] = {
+// clang-format off
+#define x(name) [EBPF_PROCESS_MM_FIELD_##name] = #name,
+    x(START_CODE)
+    x(END_CODE)
+    x(START_DATA)
+    x(END_DATA)
+    x(START_STACK)
+    x(START_BRK)
+    x(BRK)
+    x(ARG_START)
+    x(ARG_END)
+    x(ENV_START)
+    x(ENV_END)
+    x(AUXV)
+    x(EXE_FILE)
+    x(MAP)
+#undef x
+    // clang-format on
+};
+
+static void out_process_mm_spoof(struct ebpf_process_mm_spoof_event *evt)
+{
+    size_t n = sizeof(process_mm_field_names) / sizeof(process_mm_field_names[0]);
+
+    out_object_start();
+    out_event_type("PROCESS_MM_SPOOF");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    if (evt->field < n && process_mm_field_names[evt->field])
+        out_string("field", process_mm_field_names[evt->field]);
+    else
+        out_string("field", "UNKNOWN");
+    out_comma();
+
+    // /proc/<pid>/cmdline is read from between arg_start and arg_end
+    out_bool("argv_spoofed", evt->field == EBPF_PROCESS_MM_FIELD_ARG_START ||
+                                 evt->field == EBPF_PROCESS_MM_FIELD_ARG_END ||
+                                 evt->field == EBPF_PROCESS_MM_FIELD_MAP);
+    out_comma();
+
+    out_uint("value", evt->value);
+    out_comma();
+
+    out_string("exe_path", evt->exe_path);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_ptrace_request(const char *name, enum ebpf_process_ptrace_request request)
+{
+    switch (request) {
+    case EBPF_PROCESS_PTRACE_REQUEST_TRACEME:
+        out_string(name, "TRACEME");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_POKETEXT:
+        out_string(name, "POKETEXT");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_POKEDATA:
+        out_string(name, "POKEDATA");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_POKEUSER:
+        out_string(name, "POKEUSER");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_SETREGS:
+        out_string(name, "SETREGS");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_SETFPREGS:
+        out_string(name, "SETFPREGS");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_ATTACH:
+        out_string(name, "ATTACH");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_SETREGSET:
+        out_string(name, "SETREGSET");
+        break;
+    case EBPF_PROCESS_PTRACE_REQUEST_SEIZE:
+        out_string(name, "SEIZE");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_process_ptrace(struct ebpf_process_ptrace_event *evt)
+{
+    if (g_ptrace_ignore_traceme && evt->request == EBPF_PROCESS_PTRACE_REQUEST_TRACEME)
+        return;
+
+    out_object_start();
+    out_event_type("PROCESS_PTRACE");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_process_ptrace_request("request", evt->request);
+    out_comma();
+
+    out_uint("request_number", evt->request);
+    out_comma();
+
+    out_uint("target_pid", evt->target_pid);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_signal_syscall(const char *name, enum ebpf_process_signal_syscall syscall)
+{
+    switch (syscall) {
+    case EBPF_PROCESS_SIGNAL_SYSCALL_KILL:
+        out_string(name, "kill");
+        break;
+    case EBPF_PROCESS_SIGNAL_SYSCALL_TGKILL:
+        out_string(name, "tgkill");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_process_signal(struct ebpf_process_signal_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_SIGNAL");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_process_signal_syscall("syscall", evt->syscall);
+    out_comma();
+
+    out_int("target_pid", evt->target_pid);
+    out_comma();
+
+    out_int("target_tgid", evt->target_tgid);
+    out_comma();
+
+    out_int("signal", evt->signal);
+    out_comma();
+
+    // kill(-1, sig) signals every process the sender is allowed to
+    out_bool("broadcast",
+             evt->syscall == EBPF_PROCESS_SIGNAL_SYSCALL_KILL && evt->target_pid == -1);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_mmap_exec_syscall(const char *name,
+                                          enum ebpf_process_mmap_exec_syscall syscall)
+{
+    switch (syscall) {
+    case EBPF_PROCESS_MMAP_EXEC_SYSCALL_MMAP:
+        out_string(name, "mmap");
+        break;
+    case EBPF_PROCESS_MMAP_EXEC_SYSCALL_MPROTECT:
+        out_string(name, "mprotect");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_process_mmap_exec(struct ebpf_process_mmap_exec_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_MMAP_EXEC");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_process_mmap_exec_syscall("syscall", evt->syscall);
+    out_comma();
+
+    out_uint("addr", evt->addr);
+    out_comma();
+
+    out_uint("len", evt->len);
+    out_comma();
+
+    out_uint("prot", evt->prot);
+    out_comma();
+
+    out_uint("flags", evt->flags);
+    out_comma();
+
+    out_bool("anonymous", evt->path[0] == '\0');
+    out_comma();
+
+    // Memory that's writable and executable at once, or that was written to
+    // and is now made executable, is what loaded shellcode and JITs look like
+    out_bool("writable_executable", (evt->prot & PROT_WRITE) && (evt->prot & PROT_EXEC));
+    out_comma();
+
+    out_bool("write_to_exec", evt->was_writable && !evt->was_executable);
+    out_comma();
+
+    out_string("path", evt->path);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_mprotect(struct ebpf_process_mprotect_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_MPROTECT");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_uint("addr", evt->addr);
+    out_comma();
+
+    out_uint("len", evt->len);
+    out_comma();
+
+    out_uint("old_prot", evt->old_prot);
+    out_comma();
+
+    out_uint("new_prot", evt->new_prot);
+    out_comma();
+
+    out_bool("made_executable", !(evt->old_prot & PROT_EXEC) && (evt->new_prot & PROT_EXEC));
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_tty_write(struct ebpf_process_tty_write_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_TTY_WRITE");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+    out_uint("tty_out_len", evt->tty_out_len);
+    out_comma();
+    out_uint("tty_out_truncated", evt->tty_out_truncated);
+    out_comma();
+    out_uint("tty_out_offset", evt->tty_out_offset);
+    out_comma();
+    out_uint("tty_out_total_len", evt->tty_out_total_len);
+    out_comma();
+    out_uint("tty_write_seq", evt->tty_write_seq);
+    out_comma();
+    out_tty_dev("tty", &evt->tty);
+    out_comma();
+
+    // A full tty_out isn't NUL-terminated
+    char tty_out[TTY_OUT_MAX + 1];
+    size_t len = evt->tty_out_len < TTY_OUT_MAX ? evt->tty_out_len : TTY_OUT_MAX;
+    memcpy(tty_out, evt->tty_out, len);
+    tty_out[len] = '\0';
+    out_string("tty_out", tty_out);
+    out_comma();
+    out_string("comm", (const char *)&evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_process_exit(struct ebpf_process_exit_event *evt)
+{
+    out_object_start();
+    out_event_type("PROCESS_EXIT");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_string("pids_ss_cgroup_path", evt->pids_ss_cgroup_path);
+    out_comma();
+
+    out_container_id("container_id", evt->pids_ss_cgroup_path);
+    out_comma();
+
+    out_cgroup_info("cgroup", &evt->cgroup, evt->pids_ss_cgroup_path, &evt->vl_fields);
+    out_comma();
+
+    out_namespace_info("namespaces", &evt->namespaces);
+    out_comma();
+
+    out_int("exit_code", evt->exit_code);
+    out_comma();
+
+    out_int("signal", evt->signal);
+    out_comma();
+
+    out_bool("oom_killed", evt->oom_killed);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_ip_addr(const char *name, const void *addr)
+{
+    char buf[INET_ADDRSTRLEN];
+    inet_ntop(AF_INET, addr, buf, sizeof(buf));
+    printf("\"%s\":\"%s\"", name, buf);
+}
+
+static void out_ip6_addr(const char *name, const void *addr)
+{
+    char buf[INET6_ADDRSTRLEN];
+    inet_ntop(AF_INET6, addr, buf, sizeof(buf));
+    printf("\"%s\":\"%s\"", name, buf);
+}
+
+static bool in_ip_prefix(const uint8_t *addr, const uint8_t *prefix, int prefix_len)
+{
+    int bytes = prefix_len / 8, bits = prefix_len % 8;
+
+    if (memcmp(addr, prefix, bytes) != 0)
+        return false;
+
+    return bits == 0 || ((addr[bytes] ^ prefix[bytes]) & (0xFF << (8 - bits))) == 0;
+}
+
+struct ip_scope_range {
+    uint8_t prefix[16];
+    int prefix_len;
+    const char *scope;
+};
+
+// Ranges don't overlap, anything unmatched is PUBLIC
+static const struct ip_scope_range ip_scope_ranges[] = {
+    {{0, 0, 0, 0}, 32, "UNSPECIFIED"},
+    {{127}, 8, "LOOPBACK"},
+    {{10}, 8, "PRIVATE"},
+    {{172, 16}, 12, "PRIVATE"},
+    {{192, 168}, 16, "PRIVATE"},
+    {{169, 254}, 16, "LINK_LOCAL"},
+    {{100, 64}, 10, "CGNAT"},
+    {{192, 0, 2}, 24, "DOCUMENTATION"},
+    {{198, 51, 100}, 24, "DOCUMENTATION"},
+    {{203, 0, 113}, 24, "DOCUMENTATION"},
+    {{224}, 4, "MULTICAST"},
+    {{240}, 4, "RESERVED"},
+};
+
+static const struct ip_scope_range ip6_scope_ranges[] = {
+    {{0}, 128, "UNSPECIFIED"},
+    {{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, 128, "LOOPBACK"},
+    {{0xfc}, 7, "PRIVATE"}, // Unique local
+    {{0xfe, 0x80}, 10, "LINK_LOCAL"},
+    {{0x20, 0x01, 0x0d, 0xb8}, 32, "DOCUMENTATION"},
+    {{0x3f, 0xff}, 20, "DOCUMENTATION"},
+    {{0xff}, 8, "MULTICAST"},
+};
+
+static const char *ip_addr_scope(const uint8_t addr[4])
+{
+    for (size_t i = 0; i < sizeof(ip_scope_ranges) / sizeof(ip_scope_ranges[0]); i++) {
+        if (in_ip_prefix(addr, ip_scope_ranges[i].prefix, ip_scope_ranges[i].prefix_len))
+            return ip_scope_ranges[i].scope;
+    }
+
+    return "PUBLIC";
+}
+
+// IPv4-mapped (::ffff:a.b.c.d), i.e. an IPv4 connection on an IPv6 socket
+#define V4_MAPPED_PREFIX_LEN 12
+
+static bool ip6_addr_is_v4_mapped(const uint8_t addr[16])
+{
+    static const uint8_t v4_mapped[V4_MAPPED_PREFIX_LEN] = {
+        0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff,
+    };
+    return memcmp(addr, v4_mapped, sizeof(v4_mapped)) == 0;
+}
+
+static const char *ip6_addr_scope(const uint8_t addr[16])
+{
+    if (ip6_addr_is_v4_mapped(addr))
+        return ip_addr_scope(addr + V4_MAPPED_PREFIX_LEN);
+
+    for (size_t i = 0; i < sizeof(ip6_scope_ranges) / sizeof(ip6_scope_ranges[0]); i++) {
+        if (in_ip_prefix(addr, ip6_scope_ranges[i].prefix, ip6_scope_ranges[i].prefix_len))
+            return ip6_scope_ranges[i].scope;
+    }
+
+    return "PUBLIC";
+}
+
+// Names in the abstract namespace are rendered with a leading @ in place of
+// their leading NUL, like ss and /proc/net/unix do
+static void out_unix_path(const char *name, struct ebpf_net_info_unix *unix_addr)
+{
+    char buf[SUN_PATH_MAX + 1] = {0};
+    size_t len                 = unix_addr->path_len;
+    if (len > SUN_PATH_MAX)
+        len = SUN_PATH_MAX;
+
+    memcpy(buf, unix_addr->path, len);
+    if (len > 0 && buf[0] == '\0')
+        buf[0] = '@';
+
+    out_string(name, buf);
+}
+
+static void out_net_info(const char *name, struct ebpf_net_info *net, uint64_t event_type)
+{
+    printf("\"%s\":", name);
+    out_object_start();
 
     switch (net->transport) {
     case EBPF_NETWORK_EVENT_TRANSPORT_TCP:
         out_string("transport", "TCP");
         out_comma();
         break;
+    case EBPF_NETWORK_EVENT_TRANSPORT_UDP:
+        out_string("transport", "UDP");
+        out_comma();
+        break;
+    }
+
+    switch (net->family) {
+    case EBPF_NETWORK_EVENT_AF_INET:
+        out_string("family", "AF_INET");
+        out_comma();
+
+        out_ip_addr("source_address", &net->saddr);
+        out_comma();
+
+        out_int("source_port", net->sport);
+        out_comma();
+
+        out_ip_addr("destination_address", &net->daddr);
+        out_comma();
+
+        out_string("destination_address_scope", ip_addr_scope(net->daddr));
+        out_comma();
+
+        out_int("destination_port", net->dport);
+        break;
+    case EBPF_NETWORK_EVENT_AF_INET6:
+        out_string("family", "AF_INET6");
+        out_comma();
+
+        out_ip6_addr("source_address", &net->saddr6);
+        out_comma();
+
+        out_int("source_port", net->sport);
+        out_comma();
+
+        out_ip6_addr("destination_address", &net->daddr6);
+        out_comma();
+
+        out_string("destination_address_scope", ip6_addr_scope(net->daddr6));
+        out_comma();
+
+        out_int("destination_port", net->dport);
+        out_comma();
+
+        // The dotted-quad form of IPv4-mapped addresses, so consumers don't
+        // have to unwrap them to match the AF_INET events of the other end
+        bool mapped_v4 = ip6_addr_is_v4_mapped(net->daddr6);
+        out_bool("mapped_v4", mapped_v4);
+        if (mapped_v4) {
+            if (ip6_addr_is_v4_mapped(net->saddr6)) {
+                out_comma();
+                out_ip_addr("source_address_v4", net->saddr6 + V4_MAPPED_PREFIX_LEN);
+            }
+            out_comma();
+            out_ip_addr("destination_address_v4", net->daddr6 + V4_MAPPED_PREFIX_LEN);
+        }
+        break;
+    case EBPF_NETWORK_EVENT_AF_UNIX:
+        out_string("family", "AF_UNIX");
+        out_comma();
+
+        out_unix_path("unix_path", &net->unix_addr);
+        out_comma();
+
+        out_uint("peer_pid", net->unix_addr.peer_pid);
+        out_comma();
+
+        out_uint("peer_uid", net->unix_addr.peer_uid);
+        out_comma();
+
+        out_uint("peer_gid", net->unix_addr.peer_gid);
+        out_comma();
+
+        out_bool("peer_exited", net->unix_addr.peer_exited);
+        break;
+    }
+
+    out_comma();
+    out_int("network_namespace", net->netns);
+
+    out_comma();
+    out_uint("sock_inode", net->sock_inode);
+
+    switch (event_type) {
+    case EBPF_EVENT_NETWORK_CONNECTION_CLOSED:
+        out_comma();
+        out_uint("bytes_sent", net->tcp.close.bytes_sent);
+
+        out_comma();
+        out_uint("bytes_received", net->tcp.close.bytes_received);
+        break;
+    case EBPF_EVENT_NETWORK_UDP_SEND:
+    case EBPF_EVENT_NETWORK_UDP_RECV:
+        out_comma();
+        out_uint("bytes", net->udp.datagram.bytes);
+        break;
+    }
+
+    out_object_end();
+}
+
+static const struct flag_name accept_flag_names[] = {
+    {"SOCK_NONBLOCK", SOCK_NONBLOCK},
+    {"SOCK_CLOEXEC", SOCK_CLOEXEC},
+};
+
+// resolved_via is left out if NULL
+static void out_network_event(const char *name,
+                              struct ebpf_net_event *evt,
+                              const char *resolved_via)
+{
+    out_object_start();
+    out_event_type(name);
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_net_info("net", &evt->net, evt->hdr.type);
+    out_comma();
+
+    if (evt->hdr.type == EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED) {
+        out_flags("accept_flags", evt->accept_flags, accept_flag_names,
+                  sizeof(accept_flag_names) / sizeof(accept_flag_names[0]));
+        out_comma();
+    }
+
+    if (resolved_via) {
+        out_string("resolved_via", resolved_via);
+        out_comma();
+    }
+
+    out_string("comm", (const char *)&evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_network_connection_accepted_event(struct ebpf_net_event *evt)
+{
+    out_network_event("NETWORK_CONNECTION_ACCEPTED", evt, NULL);
+}
+
+static void out_network_connection_closed_event(struct ebpf_net_event *evt)
+{
+    out_network_event("NETWORK_CONNECTION_CLOSED", evt, NULL);
+}
+
+static void out_network_udp_send_event(struct ebpf_net_event *evt)
+{
+    out_network_event("NETWORK_UDP_SEND", evt, NULL);
+}
+
+static void out_network_udp_recv_event(struct ebpf_net_event *evt)
+{
+    out_network_event("NETWORK_UDP_RECV", evt, NULL);
+}
+
+static void out_network_bind_event(struct ebpf_net_event *evt)
+{
+    out_network_event("NETWORK_BIND", evt, NULL);
+}
+
+static void out_network_listen_event(struct ebpf_net_listen_event *evt)
+{
+    out_object_start();
+    out_event_type("NETWORK_LISTEN");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_net_info("net", &evt->net, evt->hdr.type);
+    out_comma();
+
+    out_int("backlog", evt->backlog);
+    out_comma();
+
+    out_string("comm", (const char *)&evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+#define DNS_HEADER_LEN 12
+#define DNS_NAME_MAX 253   // In dotted form, without the trailing dot
+#define DNS_ANSWERS_MAX 16 // Answer records parsed per response
+#define DNS_QUERIES_MAX 256
+#define RESOLVED_ADDRS_MAX 1024
+
+static const struct {
+    uint16_t type;
+    const char *name;
+} dns_qtype_names[] = {
+    {1, "A"},
+    {2, "NS"},
+    {5, "CNAME"},
+    {6, "SOA"},
+    {12, "PTR"},
+    {15, "MX"},
+    {16, "TXT"},
+    {28, "AAAA"},
+    {33, "SRV"},
+    {64, "SVCB"},
+    {65, "HTTPS"},
+    {255, "ANY"},
+};
+
+#define DNS_TYPE_A 1
+#define DNS_TYPE_CNAME 5
+#define DNS_TYPE_AAAA 28
+#define DNS_CLASS_IN 1
+
+// Unknown types as in RFC 3597
+static const char *dns_type_name(uint16_t type, char buf[16])
+{
+    for (size_t i = 0; i < sizeof(dns_qtype_names) / sizeof(dns_qtype_names[0]); i++) {
+        if (dns_qtype_names[i].type == type)
+            return dns_qtype_names[i].name;
+    }
+
+    snprintf(buf, 16, "TYPE%u", type);
+    return buf;
+}
+
+static const char *dns_rcode_names[] = {"NOERROR", "FORMERR", "SERVFAIL",
+                                        "NXDOMAIN", "NOTIMP", "REFUSED"};
+
+// Reads the name at *off in dotted form and moves *off past it. Compression
+// pointers must point before the part of the name that led to them, so they
+// can't loop, which also rules them out in a message's first name. Returns
+// false if the name is malformed or runs past the end of the payload.
+static bool
+parse_dns_name(const uint8_t *payload, size_t len, size_t *off, char name[DNS_NAME_MAX + 1])
+{
+    size_t pos = *off, start = *off, name_len = 0;
+    bool jumped = false;
+
+    for (;;) {
+        if (pos >= len)
+            return false;
+
+        uint8_t label_len = payload[pos++];
+        if (label_len == 0)
+            break;
+
+        if ((label_len & 0xC0) == 0xC0) {
+            if (pos >= len)
+                return false;
+
+            size_t target = (label_len & 0x3F) << 8 | payload[pos++];
+            if (target < DNS_HEADER_LEN || target >= start)
+                return false;
+
+            if (!jumped)
+                *off = pos;
+            jumped = true;
+            pos = start = target;
+            continue;
+        }
+
+        // The reserved 0x40/0x80 label types
+        if (label_len & 0xC0)
+            return false;
+
+        if (pos + label_len > len || name_len + (name_len > 0) + label_len > DNS_NAME_MAX)
+            return false;
+
+        if (name_len > 0)
+            name[name_len++] = '.';
+        for (size_t i = 0; i < label_len; i++) {
+            if (payload[pos + i] == '\0')
+                return false;
+            name[name_len++] = payload[pos + i];
+        }
+        pos += label_len;
+    }
+    name[name_len] = '\0';
+
+    if (!jumped)
+        *off = pos;
+    return true;
+}
+
+// Parses the header and first question of a DNS message, a response if
+// response is set, a query otherwise, and sets *end to the offset right after
+// the question. Returns false if the payload is of the other kind, is
+// malformed or was cut off before the end of the question.
+static bool parse_dns_question(const uint8_t *payload,
+                               size_t len,
+                               bool response,
+                               char qname[DNS_NAME_MAX + 1],
+                               uint16_t *qtype,
+                               size_t *end)
+{
+    if (len < DNS_HEADER_LEN)
+        return false;
+
+    // QR bit set for responses
+    uint16_t flags   = payload[2] << 8 | payload[3];
+    uint16_t qdcount = payload[4] << 8 | payload[5];
+    if ((bool)(flags & 0x8000) != response || qdcount == 0)
+        return false;
+
+    size_t off = DNS_HEADER_LEN;
+    if (!parse_dns_name(payload, len, &off, qname) || off + 4 > len)
+        return false;
+    *qtype = payload[off] << 8 | payload[off + 1];
+    *end   = off + 4;
+
+    return true;
+}
+
+struct dns_answer {
+    char name[DNS_NAME_MAX + 1];
+    uint16_t type; // DNS_TYPE_A, DNS_TYPE_AAAA or DNS_TYPE_CNAME
+    uint32_t ttl;
+    union {
+        uint8_t addr[4];
+        uint8_t addr6[16];
+        char cname[DNS_NAME_MAX + 1];
+    };
+};
+
+// Parses the A, AAAA and CNAME records of a response's answer section, up to
+// DNS_ANSWERS_MAX of them, skipping the questions after the first, which ends
+// at off. Other records are skipped. Returns the number of records parsed,
+// *complete is false if there were more, or the rest was cut off or
+// malformed.
+static size_t parse_dns_answers(const uint8_t *payload,
+                                size_t len,
+                                size_t off,
+                                struct dns_answer answers[DNS_ANSWERS_MAX],
+                                bool *complete)
+{
+    uint16_t qdcount = payload[4] << 8 | payload[5];
+    uint16_t ancount = payload[6] << 8 | payload[7];
+    char name[DNS_NAME_MAX + 1];
+    size_t n = 0;
+
+    *complete = false;
+    for (uint16_t i = 1; i < qdcount; i++) {
+        if (!parse_dns_name(payload, len, &off, name) || off + 4 > len)
+            return n;
+        off += 4;
+    }
+
+    for (uint16_t i = 0; i < ancount; i++) {
+        if (n == DNS_ANSWERS_MAX)
+            return n;
+
+        struct dns_answer *a = &answers[n];
+        if (!parse_dns_name(payload, len, &off, a->name) || off + 10 > len)
+            return n;
+
+        uint32_t ttl;
+        memcpy(&ttl, &payload[off + 4], sizeof(ttl));
+        a->ttl            = ntohl(ttl);
+        a->type           = payload[off] << 8 | payload[off + 1];
+        uint16_t class    = payload[off + 2] << 8 | payload[off + 3];
+        uint16_t rdlength = payload[off + 8] << 8 | payload[off + 9];
+        off += 10;
+        if (off + rdlength > len)
+            return n;
+
+        if (class == DNS_CLASS_IN) {
+            size_t rdoff = off;
+            switch (a->type) {
+            case DNS_TYPE_A:
+                if (rdlength != sizeof(a->addr))
+                    return n;
+                memcpy(a->addr, &payload[off], sizeof(a->addr));
+                n++;
+                break;
+            case DNS_TYPE_AAAA:
+                if (rdlength != sizeof(a->addr6))
+                    return n;
+                memcpy(a->addr6, &payload[off], sizeof(a->addr6));
+                n++;
+                break;
+            case DNS_TYPE_CNAME:
+                if (!parse_dns_name(payload, len, &rdoff, a->cname) || rdoff != off + rdlength)
+                    return n;
+                n++;
+                break;
+            }
+        }
+        off += rdlength;
+    }
+
+    *complete = true;
+    return n;
+}
+
+// Queries seen while DNS responses are printed, so responses can be linked
+// to theirs. Once it's full, the oldest query is overwritten.
+static struct dns_query_ref {
+    bool used;
+    uint16_t transaction_id;
+    struct ebpf_net_info net;
+    uint64_t ts;
+} dns_queries[DNS_QUERIES_MAX];
+static size_t dns_queries_next;
+
+// Same socket addresses and ports, in the same network namespace. A query and
+// its response are both seen from the querying socket.
+static bool net_info_same_flow(const struct ebpf_net_info *a, const struct ebpf_net_info *b)
+{
+    size_t addr_len = a->family == EBPF_NETWORK_EVENT_AF_INET6 ? 16 : 4;
+    return a->family == b->family && a->netns == b->netns && a->sport == b->sport &&
+           a->dport == b->dport && memcmp(a->saddr6, b->saddr6, addr_len) == 0 &&
+           memcmp(a->daddr6, b->daddr6, addr_len) == 0;
+}
+
+static void dns_query__remember(struct ebpf_dns_query_event *evt)
+{
+    struct dns_query_ref *q = &dns_queries[dns_queries_next];
+    dns_queries_next        = (dns_queries_next + 1) % DNS_QUERIES_MAX;
+
+    q->used           = true;
+    q->transaction_id = evt->payload[0] << 8 | evt->payload[1];
+    q->net            = evt->net;
+    q->ts             = evt->hdr.ts;
+}
+
+// Returns the ktime_ns of the query a response answers, by transaction ID and
+// 5-tuple, and forgets it. 0 if it wasn't seen.
+static uint64_t dns_query__take(uint16_t transaction_id, struct ebpf_net_info *net)
+{
+    for (size_t i = 0; i < DNS_QUERIES_MAX; i++) {
+        struct dns_query_ref *q = &dns_queries[i];
+        if (q->used && q->transaction_id == transaction_id && net_info_same_flow(&q->net, net)) {
+            q->used = false;
+            return q->ts;
+        }
+    }
+
+    return 0;
+}
+
+static void out_network_dns_query_event(struct ebpf_dns_query_event *evt)
+{
+    char qname[DNS_NAME_MAX + 1];
+    uint16_t qtype;
+    size_t end;
+    size_t len = evt->payload_len < DNS_PAYLOAD_MAX ? evt->payload_len : DNS_PAYLOAD_MAX;
+    if (!parse_dns_question(evt->payload, len, false, qname, &qtype, &end))
+        return;
+
+    if (g_events_env & EBPF_EVENT_NETWORK_DNS_RESPONSE)
+        dns_query__remember(evt);
+
+    // May only have been turned on to link responses to queries
+    if (!(g_events_env & EBPF_EVENT_NETWORK_DNS_QUERY))
+        return;
+
+    out_object_start();
+    out_event_type("NETWORK_DNS_QUERY");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_net_info("net", &evt->net, evt->hdr.type);
+    out_comma();
+
+    out_uint("transaction_id", evt->payload[0] << 8 | evt->payload[1]);
+    out_comma();
+
+    out_string("qname", qname);
+    out_comma();
+
+    char qtype_buf[16];
+    out_string("qtype", dns_type_name(qtype, qtype_buf));
+    out_comma();
+
+    out_string("comm", (const char *)&evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_dns_answer(struct dns_answer *a)
+{
+    out_object_start();
+    out_string("name", a->name);
+    out_comma();
+
+    char type_buf[16];
+    out_string("type", dns_type_name(a->type, type_buf));
+    out_comma();
+
+    out_uint("ttl", a->ttl);
+    out_comma();
+
+    switch (a->type) {
+    case DNS_TYPE_A:
+        out_ip_addr("address", a->addr);
+        break;
+    case DNS_TYPE_AAAA:
+        out_ip6_addr("address", a->addr6);
+        break;
+    case DNS_TYPE_CNAME:
+        out_string("cname", a->cname);
+        break;
+    }
+
+    out_object_end();
+}
+
+static void out_network_dns_response_event(struct ebpf_dns_response_event *evt)
+{
+    char qname[DNS_NAME_MAX + 1];
+    uint16_t qtype;
+    size_t end;
+    size_t len = evt->payload_len < DNS_PAYLOAD_MAX ? evt->payload_len : DNS_PAYLOAD_MAX;
+    if (!parse_dns_question(evt->payload, len, true, qname, &qtype, &end))
+        return;
+
+    struct dns_answer answers[DNS_ANSWERS_MAX];
+    bool complete;
+    size_t n = parse_dns_answers(evt->payload, len, end, answers, &complete);
+
+    uint16_t transaction_id = evt->payload[0] << 8 | evt->payload[1];
+    uint16_t flags          = evt->payload[2] << 8 | evt->payload[3];
+
+    out_object_start();
+    out_event_type("NETWORK_DNS_RESPONSE");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_net_info("net", &evt->net, evt->hdr.type);
+    out_comma();
+
+    out_uint("transaction_id", transaction_id);
+    out_comma();
+
+    out_uint("query_ktime_ns", dns_query__take(transaction_id, &evt->net));
+    out_comma();
+
+    out_string("qname", qname);
+    out_comma();
+
+    char qtype_buf[16];
+    out_string("qtype", dns_type_name(qtype, qtype_buf));
+    out_comma();
+
+    uint8_t rcode = flags & 0xF;
+    char rcode_buf[16];
+    snprintf(rcode_buf, sizeof(rcode_buf), "RCODE%u", rcode);
+    out_string("rcode", rcode < sizeof(dns_rcode_names) / sizeof(dns_rcode_names[0])
+                            ? dns_rcode_names[rcode]
+                            : rcode_buf);
+    out_comma();
+
+    // TC bit, the server couldn't fit the whole response in the datagram
+    out_bool("truncated", flags & 0x0200);
+    out_comma();
+
+    printf("\"answers\":[");
+    for (size_t i = 0; i < n; i++) {
+        if (i > 0)
+            out_comma();
+        out_dns_answer(&answers[i]);
+    }
+    printf("]");
+    out_comma();
+
+    out_bool("answers_truncated", !complete);
+    out_comma();
+
+    out_string("comm", (const char *)&evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+// Addresses seen in DNS responses with --resolved-via and the name that was
+// looked up, the one asked about rather than the end of a CNAME chain. Once
+// it's full, the entry closest to expiring is overwritten.
+static struct resolved_addr {
+    uint64_t expires; // ktime_ns, 0 if unused
+    uint32_t netns;
+    enum ebpf_net_info_af family;
+    uint8_t addr[16];
+    char name[DNS_NAME_MAX + 1];
+} resolved_addrs[RESOLVED_ADDRS_MAX];
+
+static struct resolved_addr *
+resolved_addr__find(uint32_t netns, enum ebpf_net_info_af family, const uint8_t *addr)
+{
+    size_t addr_len = family == EBPF_NETWORK_EVENT_AF_INET6 ? 16 : 4;
+    for (size_t i = 0; i < RESOLVED_ADDRS_MAX; i++) {
+        struct resolved_addr *r = &resolved_addrs[i];
+        if (r->expires && r->netns == netns && r->family == family &&
+            memcmp(r->addr, addr, addr_len) == 0)
+            return r;
+    }
+
+    return NULL;
+}
+
+static void resolved_addr__add(uint32_t netns,
+                               enum ebpf_net_info_af family,
+                               const uint8_t *addr,
+                               const char *name,
+                               uint64_t expires)
+{
+    struct resolved_addr *r = resolved_addr__find(netns, family, addr);
+    if (!r) {
+        r = &resolved_addrs[0];
+        for (size_t i = 1; i < RESOLVED_ADDRS_MAX && r->expires; i++) {
+            if (resolved_addrs[i].expires < r->expires)
+                r = &resolved_addrs[i];
+        }
+    }
+
+    r->expires = expires;
+    r->netns   = netns;
+    r->family  = family;
+    memcpy(r->addr, addr, family == EBPF_NETWORK_EVENT_AF_INET6 ? 16 : 4);
+    strcpy(r->name, name);
+}
+
+static void resolved_via__add(struct ebpf_dns_response_event *evt)
+{
+    char qname[DNS_NAME_MAX + 1];
+    uint16_t qtype;
+    size_t end;
+    size_t len = evt->payload_len < DNS_PAYLOAD_MAX ? evt->payload_len : DNS_PAYLOAD_MAX;
+    if (!parse_dns_question(evt->payload, len, true, qname, &qtype, &end))
+        return;
+
+    struct dns_answer answers[DNS_ANSWERS_MAX];
+    bool complete;
+    size_t n = parse_dns_answers(evt->payload, len, end, answers, &complete);
+
+    for (size_t i = 0; i < n; i++) {
+        struct dns_answer *a = &answers[i];
+        uint64_t expires     = evt->hdr.ts + a->ttl * 1000000000ULL;
+
+        switch (a->type) {
+        case DNS_TYPE_A:
+            resolved_addr__add(evt->net.netns, EBPF_NETWORK_EVENT_AF_INET, a->addr, qname,
+                               expires);
+            break;
+        case DNS_TYPE_AAAA:
+            resolved_addr__add(evt->net.netns, EBPF_NETWORK_EVENT_AF_INET6, a->addr6, qname,
+                               expires);
+            break;
+        }
+    }
+}
+
+// "" if no unexpired response resolved the destination address. Connections
+// to IPv4-mapped addresses are looked up by their IPv4 address.
+static const char *resolved_via__lookup(struct ebpf_net_event *evt)
+{
+    struct ebpf_net_info *net = &evt->net;
+    struct resolved_addr *r   = NULL;
+
+    switch (net->family) {
+    case EBPF_NETWORK_EVENT_AF_INET:
+        r = resolved_addr__find(net->netns, net->family, net->daddr);
+        break;
+    case EBPF_NETWORK_EVENT_AF_INET6:
+        if (ip6_addr_is_v4_mapped(net->daddr6))
+            r = resolved_addr__find(net->netns, EBPF_NETWORK_EVENT_AF_INET,
+                                    net->daddr6 + V4_MAPPED_PREFIX_LEN);
+        else
+            r = resolved_addr__find(net->netns, net->family, net->daddr6);
+        break;
+    case EBPF_NETWORK_EVENT_AF_UNIX:
+        break;
+    }
+
+    return r && r->expires > evt->hdr.ts ? r->name : "";
+}
+
+static void out_network_connection_attempted_event(struct ebpf_net_event *evt)
+{
+    out_network_event("NETWORK_CONNECTION_ATTEMPTED", evt,
+                      g_resolved_via ? resolved_via__lookup(evt) : NULL);
+}
+
+static void out_file_copy_syscall(const char *name, enum ebpf_file_copy_syscall syscall)
+{
+    switch (syscall) {
+    case EBPF_FILE_COPY_SYSCALL_SENDFILE:
+        out_string(name, "sendfile");
+        break;
+    case EBPF_FILE_COPY_SYSCALL_SPLICE:
+        out_string(name, "splice");
+        break;
+    case EBPF_FILE_COPY_SYSCALL_COPY_FILE_RANGE:
+        out_string(name, "copy_file_range");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_file_copy_endpoint(const char *name,
+                                   struct ebpf_file_copy_endpoint *ep,
+                                   const char *path,
+                                   uint64_t event_type)
+{
+    printf("\"%s\":", name);
+    out_object_start();
+
+    switch (ep->type) {
+    case EBPF_FILE_COPY_ENDPOINT_FILE:
+        out_string("type", "FILE");
+        out_comma();
+
+        out_string("path", path);
+        out_comma();
+        break;
+    case EBPF_FILE_COPY_ENDPOINT_PIPE:
+        out_string("type", "PIPE");
+        out_comma();
+        break;
+    case EBPF_FILE_COPY_ENDPOINT_SOCKET:
+        out_string("type", "SOCKET");
+        out_comma();
+
+        if (ep->net.transport != 0) {
+            out_net_info("net", &ep->net, event_type);
+            out_comma();
+        }
+        break;
+    default:
+        out_string("type", "UNKNOWN");
+        out_comma();
+        break;
+    }
+
+    out_uint("inode", ep->inode);
+
+    out_object_end();
+}
+
+static void out_file_copy(struct ebpf_file_copy_event *evt)
+{
+    // Classified by whichever end is a file, preferring the source
+    const char *path = "";
+    if (evt->source.type == EBPF_FILE_COPY_ENDPOINT_FILE)
+        path = evt->source_path;
+    else if (evt->destination.type == EBPF_FILE_COPY_ENDPOINT_FILE)
+        path = evt->destination_path;
+
+    // Copy events don't carry the process' root, so they're only classified
+    // by extension
+    enum file_category category = file_category(path, NULL, evt->mntns);
+    if (!file_category_wanted(category))
+        return;
+
+    out_object_start();
+    out_event_type("FILE_COPY");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_file_copy_syscall("syscall", evt->syscall);
+    out_comma();
+
+    out_uint("bytes", evt->bytes);
+    out_comma();
+
+    out_file_copy_endpoint("source", &evt->source, evt->source_path, evt->hdr.type);
+    out_comma();
+
+    out_file_copy_endpoint("destination", &evt->destination, evt->destination_path,
+                           evt->hdr.type);
+    out_comma();
+
+    out_string("file_category", file_category_names[category]);
+    out_comma();
+
+    out_int("mount_namespace", evt->mntns);
+    out_comma();
+
+    out_string("comm", (const char *)&evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_security_tamper(struct ebpf_security_tamper_event *evt)
+{
+    out_object_start();
+    out_event_type("SECURITY_TAMPER");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_string("comm", evt->comm);
+    out_comma();
+
+    switch (evt->op) {
+    case EBPF_SECURITY_TAMPER_OP_WRITE:
+        out_string("op", "WRITE");
+        out_comma();
+        out_string("path", evt->path);
+        out_comma();
+        out_uint("dev", evt->dev);
+        out_comma();
+        out_uint("inode", evt->inode);
+        break;
+    case EBPF_SECURITY_TAMPER_OP_SELF_WRITE:
+        out_string("op", "SELF_WRITE");
+        out_comma();
+        out_string("path", evt->path);
+        out_comma();
+        out_uint("dev", evt->dev);
+        out_comma();
+        out_uint("inode", evt->inode);
+        break;
+    case EBPF_SECURITY_TAMPER_OP_SELF_UNLINK:
+        out_string("op", "SELF_UNLINK");
+        out_comma();
+        out_string("path", evt->path);
+        out_comma();
+        out_uint("dev", evt->dev);
+        out_comma();
+        out_uint("inode", evt->inode);
+        break;
+    case EBPF_SECURITY_TAMPER_OP_SELF_RENAME:
+        out_string("op", "SELF_RENAME");
+        out_comma();
+        out_string("path", evt->path);
+        out_comma();
+        out_uint("dev", evt->dev);
+        out_comma();
+        out_uint("inode", evt->inode);
+        break;
+    case EBPF_SECURITY_TAMPER_OP_SIGNAL:
+        out_string("op", "SIGNAL");
+        out_comma();
+        out_uint("target_pid", evt->target_pid);
+        out_comma();
+        out_string("target_comm", evt->target_comm);
+        out_comma();
+        out_int("signal", evt->signal);
+        break;
+    default:
+        out_string("op", "UNKNOWN");
+        break;
+    }
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_kernel_module_load_syscall(const char *name,
+                                           enum ebpf_kernel_module_load_syscall syscall)
+{
+    switch (syscall) {
+    case EBPF_KERNEL_MODULE_LOAD_SYSCALL_INIT_MODULE:
+        out_string(name, "init_module");
+        break;
+    case EBPF_KERNEL_MODULE_LOAD_SYSCALL_FINIT_MODULE:
+        out_string(name, "finit_module");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+static void out_kernel_module_load(struct ebpf_kernel_module_load_event *evt)
+{
+    out_object_start();
+    out_event_type("KERNEL_MODULE_LOAD");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_kernel_module_load_syscall("syscall", evt->syscall);
+    out_comma();
+
+    out_string("name", evt->name);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_fs_mount(const char *name, struct ebpf_fs_mount_event *evt)
+{
+    out_object_start();
+    out_event_type(name);
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_string("source", evt->source);
+    out_comma();
+
+    out_string("destination", evt->destination);
+    out_comma();
+
+    out_string("fs_type", evt->fs_type);
+    out_comma();
+
+    out_uint("flags", evt->flags);
+    out_comma();
+
+    out_int("mount_namespace", evt->mntns);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_filesystem_view_change(struct ebpf_filesystem_view_change_event *evt)
+{
+    out_object_start();
+    out_event_type("FILESYSTEM_VIEW_CHANGE");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_uint("old_mount_namespace", evt->old_mntns);
+    out_comma();
+
+    out_uint("new_mount_namespace", evt->new_mntns);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_device_class(const char *name, enum ebpf_device_class device_class)
+{
+    switch (device_class) {
+    case EBPF_DEVICE_CLASS_ACCELERATOR:
+        out_string(name, "accelerator");
+        break;
+    default:
+        out_string(name, "unknown");
+        break;
+    }
+}
+
+static void out_open_access_mode(const char *name, uint32_t flags)
+{
+    switch (flags & O_ACCMODE) {
+    case O_RDONLY:
+        out_string(name, "RDONLY");
+        break;
+    case O_WRONLY:
+        out_string(name, "WRONLY");
+        break;
+    case O_RDWR:
+        out_string(name, "RDWR");
+        break;
+    default:
+        out_string(name, "UNKNOWN");
+        break;
+    }
+}
+
+// Flags covering others (O_SYNC includes O_DSYNC, O_TMPFILE includes
+// O_DIRECTORY) come first, kernel-internal ones (e.g. O_LARGEFILE, which it
+// sets itself on 64-bit) are left out
+static const struct {
+    const char *name;
+    uint32_t flag;
+} open_flag_names[] = {
+    {"O_CREAT", O_CREAT},
+    {"O_EXCL", O_EXCL},
+    {"O_NOCTTY", O_NOCTTY},
+    {"O_TRUNC", O_TRUNC},
+    {"O_APPEND", O_APPEND},
+    {"O_NONBLOCK", O_NONBLOCK},
+    {"O_SYNC", O_SYNC},
+    {"O_DSYNC", O_DSYNC},
+    {"O_NOFOLLOW", O_NOFOLLOW},
+    {"O_CLOEXEC", O_CLOEXEC},
+#ifdef O_TMPFILE
+    {"O_TMPFILE", O_TMPFILE},
+#endif
+    {"O_DIRECTORY", O_DIRECTORY},
+#ifdef O_DIRECT
+    {"O_DIRECT", O_DIRECT},
+#endif
+#ifdef O_NOATIME
+    {"O_NOATIME", O_NOATIME},
+#endif
+#ifdef O_PATH
+    {"O_PATH", O_PATH},
+#endif
+};
+
+static void out_open_flags(const char *name, uint32_t flags)
+{
+    switch (flags & O_ACCMODE) {
+    case O_RDONLY:
+        printf("\"%s\":[\"O_RDONLY\"", name);
+        break;
+    case O_WRONLY:
+        printf("\"%s\":[\"O_WRONLY\"", name);
+        break;
+    default:
+        printf("\"%s\":[\"O_RDWR\"", name);
+        break;
+    }
+
+    uint32_t rest = flags & ~O_ACCMODE;
+    for (size_t i = 0; i < sizeof(open_flag_names) / sizeof(open_flag_names[0]); i++) {
+        if ((rest & open_flag_names[i].flag) != open_flag_names[i].flag)
+            continue;
+
+        out_comma();
+        printf("\"%s\"", open_flag_names[i].name);
+        rest &= ~open_flag_names[i].flag;
+    }
+    printf("]");
+}
+
+static void out_file_open(struct ebpf_file_open_event *evt)
+{
+    out_object_start();
+    out_event_type("FILE_OPEN");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_string("path", evt->path);
+    out_comma();
+
+    out_open_flags("flags", evt->flags);
+    out_comma();
+
+    out_uint("mode", evt->mode);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_file_truncate(struct ebpf_file_truncate_event *evt)
+{
+    out_object_start();
+    out_event_type("FILE_TRUNCATE");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    switch (evt->syscall) {
+    case EBPF_FILE_TRUNCATE_SYSCALL_TRUNCATE:
+        out_string("syscall", "truncate");
+        break;
+    case EBPF_FILE_TRUNCATE_SYSCALL_FTRUNCATE:
+        out_string("syscall", "ftruncate");
+        break;
+    default:
+        out_string("syscall", "UNKNOWN");
+        break;
+    }
+    out_comma();
+
+    out_string("path", evt->path);
+    out_comma();
+
+    out_uint("old_size", evt->old_size);
+    out_comma();
+
+    out_uint("new_size", evt->new_size);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static void out_device_access(struct ebpf_device_access_event *evt)
+{
+    out_object_start();
+    out_event_type("DEVICE_ACCESS");
+    out_comma();
+
+    out_event_hdr(&evt->hdr);
+    out_comma();
+
+    out_pid_info("pids", &evt->pids);
+    out_comma();
+
+    out_device_class("device_class", evt->device_class);
+    out_comma();
+
+    out_string("path", evt->path);
+    out_comma();
+
+    out_uint("flags", evt->flags);
+    out_comma();
+
+    out_open_access_mode("access_mode", evt->flags);
+    out_comma();
+
+    // Kernel dev_t encoding, 12 bits of major and 20 bits of minor
+    out_uint("device_major", evt->rdev >> 20);
+    out_comma();
+
+    out_uint("device_minor", evt->rdev & 0xfffff);
+    out_comma();
+
+    out_string("comm", evt->comm);
+
+    out_object_end();
+    out_newline();
+}
+
+static uint64_t monotonic_secs()
+{
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return ts.tv_sec;
+}
+
+// Per-process network activity, aggregated from NETWORK_CONNECTION_CLOSED
+// events (so connections only count once they're closed) and printed every
+// g_net_summary_interval seconds. The table is emptied every time it's
+// printed, so it only ever holds processes that were active during the
+// current interval. If it fills up before that, it's printed early.
+#define NET_SUMMARY_MAX 1024
+
+struct net_summary {
+    struct ebpf_pid_info pids;
+    char comm[TASK_COMM_LEN];
+    uint64_t connections;
+    uint64_t bytes_sent;
+    uint64_t bytes_received;
+};
+
+static struct net_summary net_summaries[NET_SUMMARY_MAX];
+static int net_summaries_len        = 0;
+static uint64_t net_summaries_since = 0;
+
+static void out_net_summaries()
+{
+    uint64_t now = monotonic_secs();
+
+    for (int i = 0; i < net_summaries_len; i++) {
+        struct net_summary *ns = &net_summaries[i];
+
+        out_object_start();
+        out_event_type("NETWORK_PROCESS_SUMMARY");
+        out_comma();
+
+        out_pid_info("pids", &ns->pids);
+        out_comma();
+
+        out_uint("period_secs", now - net_summaries_since);
+        out_comma();
+
+        out_uint("connections", ns->connections);
+        out_comma();
+
+        out_uint("bytes_sent", ns->bytes_sent);
+        out_comma();
+
+        out_uint("bytes_received", ns->bytes_received);
+        out_comma();
+
+        out_string("comm", ns->comm);
+
+        out_object_end();
+        out_newline();
+    }
+
+    net_summaries_len   = 0;
+    net_summaries_since = now;
+}
+
+static void net_summary_add(struct ebpf_net_event *evt)
+{
+    struct net_summary *ns = NULL;
+
+    for (int i = 0; i < net_summaries_len; i++) {
+        if (net_summaries[i].pids.tgid == evt->pids.tgid &&
+            net_summaries[i].pids.start_time_ns == evt->pids.start_time_ns) {
+            ns = &net_summaries[i];
+            break;
+        }
+    }
+
+    if (!ns) {
+        if (net_summaries_len == NET_SUMMARY_MAX)
+            out_net_summaries();
+
+        ns = &net_summaries[net_summaries_len++];
+        memset(ns, 0, sizeof(*ns));
+        ns->pids = evt->pids;
+    }
+
+    memcpy(ns->comm, evt->comm, sizeof(ns->comm));
+    ns->connections++;
+    ns->bytes_sent += evt->net.tcp.close.bytes_sent;
+    ns->bytes_received += evt->net.tcp.close.bytes_received;
+}
+
+// Files created in the last g_drop_and_run_window seconds, to be matched
+// against execs by dev/inode/generation. Kept in a ring so the oldest creates are dropped
+// when it's full, whether or not they're still within the window.
+#define DROP_AND_RUN_MAX 4096
+
+struct drop {
+    uint64_t ts;
+    uint32_t dev;
+    uint64_t inode;
+    uint32_t inode_generation;
+    struct ebpf_pid_info pids;
+    char *path;
+};
+
+static struct drop drops[DROP_AND_RUN_MAX];
+static int drops_next = 0;
+
+static void drop_and_run__create(struct ebpf_file_create_event *evt)
+{
+    struct drop *d = &drops[drops_next];
+    drops_next     = (drops_next + 1) % DROP_AND_RUN_MAX;
+
+    free(d->path);
+    d->ts               = evt->hdr.ts;
+    d->dev              = evt->dev;
+    d->inode            = evt->inode;
+    d->inode_generation = evt->inode_generation;
+    d->pids             = evt->pids;
+    d->path             = strdup(evt->path);
+}
+
+static void drop_and_run__exec(struct ebpf_process_exec_event *evt)
+{
+    uint64_t window_ns = g_drop_and_run_window * 1000000000ULL;
+
+    for (int i = 0; i < DROP_AND_RUN_MAX; i++) {
+        struct drop *d = &drops[i];
+
+        if (!d->path || d->dev != evt->exe_dev || d->inode != evt->exe_inode ||
+            d->inode_generation != evt->exe_inode_generation)
+            continue;
+
+        // Both timestamps are CLOCK_MONOTONIC, taken in the probes. Anything
+        // outside of the window is stale, possibly a reused inode on a
+        // filesystem without inode generations.
+        if (evt->hdr.ts < d->ts || evt->hdr.ts - d->ts > window_ns)
+            continue;
+
+        out_object_start();
+        out_event_type("DROP_AND_RUN");
+        out_comma();
+
+        out_pid_info("writer_pids", &d->pids);
+        out_comma();
+
+        out_pid_info("executor_pids", &evt->pids);
+        out_comma();
+
+        out_string("path", d->path);
+        out_comma();
+
+        out_string("filename", evt->filename);
+        out_comma();
+
+        out_uint("dev", d->dev);
+        out_comma();
+
+        out_uint("inode", d->inode);
+        out_comma();
+
+        out_uint("inode_generation", d->inode_generation);
+        out_comma();
+
+        out_uint("gap_ns", evt->hdr.ts - d->ts);
+
+        out_object_end();
+        out_newline();
+
+        // Only the first exec of a dropped file is reported
+        free(d->path);
+        d->path = NULL;
+        break;
+    }
+}
+
+static int event_ctx_callback(struct ebpf_event_header *evt_hdr)
+{
+    g_events_processed++;
+
+    switch (evt_hdr->type) {
+    case EBPF_EVENT_PROCESS_FORK:
+        out_process_fork((struct ebpf_process_fork_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_EXEC:
+        // May only have been turned on for drop and run detection, as is the
+        // case for FILE_CREATE
+        if (g_events_env & EBPF_EVENT_PROCESS_EXEC)
+            out_process_exec((struct ebpf_process_exec_event *)evt_hdr);
+
+        if (g_drop_and_run_window)
+            drop_and_run__exec((struct ebpf_process_exec_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_EXIT:
+        out_process_exit((struct ebpf_process_exit_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SETSID:
+        out_process_setsid((struct ebpf_process_setsid_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_CHDIR:
+        out_process_chdir((struct ebpf_process_chdir_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_UNSHARE:
+        out_process_namespace("PROCESS_UNSHARE", (struct ebpf_process_namespace_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SETNS:
+        out_process_namespace("PROCESS_SETNS", (struct ebpf_process_namespace_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SETUID:
+        out_process_setuid((struct ebpf_process_setuid_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SETGID:
+        out_process_setgid((struct ebpf_process_setgid_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SETSCHED:
+        out_process_setsched((struct ebpf_process_setsched_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_TTY_WRITE:
+        out_process_tty_write((struct ebpf_process_tty_write_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_BPF_LINK:
+        out_process_bpf_link((struct ebpf_process_bpf_link_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_BPF_SYSCALL:
+        out_process_bpf_syscall((struct ebpf_process_bpf_syscall_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_MM_SPOOF:
+        out_process_mm_spoof((struct ebpf_process_mm_spoof_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_PTRACE:
+        out_process_ptrace((struct ebpf_process_ptrace_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SIGNAL:
+        out_process_signal((struct ebpf_process_signal_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_SETCAP:
+        out_process_setcap((struct ebpf_process_setcap_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_MMAP_EXEC:
+        out_process_mmap_exec((struct ebpf_process_mmap_exec_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_PROCESS_MPROTECT:
+        out_process_mprotect((struct ebpf_process_mprotect_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_DELETE:
+        out_file_delete((struct ebpf_file_delete_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_CREATE:
+        if (g_events_env & EBPF_EVENT_FILE_CREATE)
+            out_file_create((struct ebpf_file_create_event *)evt_hdr);
+
+        if (g_drop_and_run_window)
+            drop_and_run__create((struct ebpf_file_create_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_RENAME:
+        out_file_rename((struct ebpf_file_rename_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_COPY:
+        out_file_copy((struct ebpf_file_copy_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_MODIFY_ATTR:
+        out_file_modify_attr((struct ebpf_file_modify_attr_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_SYMLINK:
+        out_file_link("FILE_SYMLINK", (struct ebpf_file_link_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_HARDLINK:
+        out_file_link("FILE_HARDLINK", (struct ebpf_file_link_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_TRUNCATE:
+        out_file_truncate((struct ebpf_file_truncate_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_SECURITY_TAMPER:
+        out_security_tamper((struct ebpf_security_tamper_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILESYSTEM_VIEW_CHANGE:
+        out_filesystem_view_change((struct ebpf_filesystem_view_change_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FS_MOUNT:
+        out_fs_mount("FS_MOUNT", (struct ebpf_fs_mount_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FS_UMOUNT:
+        out_fs_mount("FS_UMOUNT", (struct ebpf_fs_mount_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_DEVICE_ACCESS:
+        out_device_access((struct ebpf_device_access_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_FILE_OPEN:
+        out_file_open((struct ebpf_file_open_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_KERNEL_MODULE_LOAD:
+        out_kernel_module_load((struct ebpf_kernel_module_load_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED:
+        out_network_connection_accepted_event((struct ebpf_net_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_CONNECTION_ATTEMPTED:
+        out_network_connection_attempted_event((struct ebpf_net_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_CONNECTION_CLOSED:
+        if (g_net_summary_interval)
+            net_summary_add((struct ebpf_net_event *)evt_hdr);
+
+        // May only have been turned on for the summaries
+        if (g_events_env & EBPF_EVENT_NETWORK_CONNECTION_CLOSED)
+            out_network_connection_closed_event((struct ebpf_net_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_UDP_SEND:
+        out_network_udp_send_event((struct ebpf_net_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_UDP_RECV:
+        out_network_udp_recv_event((struct ebpf_net_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_DNS_QUERY:
+        out_network_dns_query_event((struct ebpf_dns_query_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_DNS_RESPONSE:
+        if (g_resolved_via)
+            resolved_via__add((struct ebpf_dns_response_event *)evt_hdr);
+
+        // May only have been turned on for --resolved-via
+        if (g_events_env & EBPF_EVENT_NETWORK_DNS_RESPONSE)
+            out_network_dns_response_event((struct ebpf_dns_response_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_LISTEN:
+        out_network_listen_event((struct ebpf_net_listen_event *)evt_hdr);
+        break;
+    case EBPF_EVENT_NETWORK_BIND:
+        out_network_bind_event((struct ebpf_net_event *)evt_hdr);
+        break;
+    }
+
+    return 0;
+}
+
+static uint64_t timeval_to_us(struct timeval *tv)
+{
+    return tv->tv_sec * 1000000 + tv->tv_usec;
+}
+
+// Deliberately cheap (one syscall and one map lookup) so it doesn't distort
+// the very numbers it's reporting
+static void out_stats(struct ebpf_event_ctx *ctx)
+{
+    struct ebpf_event_stats ees;
+    struct rusage ru;
+
+    if (ebpf_event_ctx__read_stats(ctx, &ees) < 0) {
+        fprintf(stderr, "Could not read event stats\n");
+        return;
+    }
+
+    if (getrusage(RUSAGE_SELF, &ru) < 0) {
+        fprintf(stderr, "Could not get resource usage: %s\n", strerror(errno));
+        return;
+    }
+
+    out_object_start();
+    out_event_type("STATS");
+    out_comma();
+
+    out_uint("user_time_us", timeval_to_us(&ru.ru_utime));
+    out_comma();
+    out_uint("system_time_us", timeval_to_us(&ru.ru_stime));
+    out_comma();
+    out_uint("max_rss_kb", ru.ru_maxrss);
+    out_comma();
+    out_uint("events_processed", g_events_processed);
+    out_comma();
+    out_uint("events_emitted", ees.emitted);
+    out_comma();
+    out_uint("events_dropped", ees.dropped);
+    out_comma();
+    out_uint("ringbuf_backlog_bytes", ees.ringbuf_backlog);
+
+    out_object_end();
+    out_newline();
+}
+
+static void print_init_msg(uint64_t features, const char *object_sha256)
+{
+    printf("{\"probes_initialized\": true, \"features\": {");
+    printf("\"bpf_tramp\": %s", (features & EBPF_FEATURE_BPF_TRAMP) ? "true" : "false");
+    printf(", \"ringbuf\": %s", (features & EBPF_FEATURE_RINGBUF) ? "true" : "false");
+    printf("}, \"object_sha256\": \"%s\"}\n", object_sha256);
+}
+
+// Describes the effective configuration so a recorded stream is
+// self-describing, printed after the init message and again whenever the
+// configuration changes at runtime (i.e. on pause/resume)
+static void out_config(struct ebpf_event_ctx *ctx, bool paused)
+{
+    bool first;
+
+    out_object_start();
+    out_event_type("CONFIG");
+    out_comma();
+
+    first = true;
+    printf("\"events\":[");
+    for (int i = FILE_DELETE; i < CMDLINE_MAX; i++) {
+        if (!(g_events_env & cmdline_to_lib[i]))
+            continue;
+
+        if (!first)
+            out_comma();
+        first = false;
+
+        printf("\"%s\"", cmdline_names[i]);
+    }
+    printf("]");
+    out_comma();
+
+    first = true;
+    printf("\"file_categories\":[");
+    for (int i = 0; i < FILE_CATEGORY_MAX; i++) {
+        if (!(g_file_categories & (1 << i)))
+            continue;
+
+        if (!first)
+            out_comma();
+        first = false;
+
+        printf("\"%s\"", file_category_names[i]);
     }
+    printf("]");
+    out_comma();
+
+    out_bool("file_category_magic", g_file_category_magic);
+    out_comma();
+
+    out_string("lolbin_list", g_lolbin_list_path ? g_lolbin_list_path : "");
+    out_comma();
 
-    switch (net->family) {
-    case EBPF_NETWORK_EVENT_AF_INET:
-        out_string("family", "AF_INET");
-        out_comma();
+    out_string("expected_object_sha256", g_expected_object_sha256 ? g_expected_object_sha256 : "");
+    out_comma();
 
-        out_ip_addr("source_address", &net->saddr);
-        out_comma();
+    out_int("stats_interval", g_stats_interval);
+    out_comma();
 
-        out_int("source_port", net->sport);
-        out_comma();
+    out_int("net_summary_interval", g_net_summary_interval);
+    out_comma();
 
-        out_ip_addr("destination_address", &net->daddr);
-        out_comma();
+    out_int("drop_and_run_window", g_drop_and_run_window);
+    out_comma();
 
-        out_int("destination_port", net->dport);
-        break;
-    case EBPF_NETWORK_EVENT_AF_INET6:
-        out_string("family", "AF_INET6");
-        out_comma();
+    out_string("tamper_paths", g_tamper_paths);
+    out_comma();
 
-        out_ip6_addr("source_address", &net->saddr6);
-        out_comma();
+    out_string("tamper_comms", g_tamper_comms);
+    out_comma();
 
-        out_int("source_port", net->sport);
-        out_comma();
+    out_string("self_paths", g_self_paths);
+    out_comma();
 
-        out_ip6_addr("destination_address", &net->daddr6);
-        out_comma();
+    out_string("device_paths", g_device_paths);
+    out_comma();
 
-        out_int("destination_port", net->dport);
-        break;
-    }
+    out_bool("proc_seq", g_proc_seq);
+    out_comma();
 
+    out_bool("ptrace_ignore_traceme", g_ptrace_ignore_traceme);
     out_comma();
-    out_int("network_namespace", net->netns);
 
-    switch (evt->hdr.type) {
-    case EBPF_EVENT_NETWORK_CONNECTION_CLOSED:
+    out_string("pid_filter", g_pid_filter);
+    out_comma();
+
+    out_bool("capture_env", g_capture_env);
+    out_comma();
+
+    out_int("capture_env_max", g_capture_env_max);
+    out_comma();
+
+    out_bool("hash_execs", g_hash_execs);
+    out_comma();
+
+    out_bool("mprotect_verbose", g_mprotect_verbose);
+    out_comma();
+
+    out_bool("trace_opens", g_trace_opens);
+    out_comma();
+
+    out_string("open_paths", g_open_paths);
+    out_comma();
+
+    out_bool("no_threads", g_no_threads);
+    out_comma();
+
+    out_uint("ringbuf_size_bytes", ebpf_event_ctx__get_ringbuf_size(ctx));
+    out_comma();
+
+    out_bool("unbuffer_stdout", g_unbuffer_stdout);
+    out_comma();
+
+    out_bool("libbpf_verbose", g_libbpf_verbose);
+    out_comma();
+
+    out_bool("paused", paused);
+
+    out_object_end();
+    out_newline();
+}
+
+// Entries printed per FILTER_MAP line, a dump prints one line per turn of the
+// main loop so a large map doesn't hold up reading events
+#define FILTER_MAP_DUMP_PAGE 64
+
+static const char *filter_map_names[EBPF_FILTER_MAP_MAX] = {
+    [EBPF_FILTER_MAP_PIDS]               = "pid_filter",
+    [EBPF_FILTER_MAP_OPEN_PATH_PREFIXES] = "open_path_prefixes",
+    [EBPF_FILTER_MAP_TAMPER_INODES]      = "tamper_inodes",
+    [EBPF_FILTER_MAP_TAMPER_COMMS]       = "tamper_comms",
+    [EBPF_FILTER_MAP_DEVICE_INODES]      = "device_inodes",
+};
+
+static struct {
+    bool active;
+    enum ebpf_filter_map map;
+    struct ebpf_filter_map_cursor cursor;
+} filter_map_dump;
+
+static void out_filter_map_entry(enum ebpf_filter_map map,
+                                 const void *key,
+                                 uint8_t value,
+                                 void *data)
+{
+    bool *first = data;
+
+    if (!*first)
         out_comma();
-        out_uint("bytes_sent", net->tcp.close.bytes_sent);
+    *first = false;
+
+    out_object_start();
+    switch (map) {
+    case EBPF_FILTER_MAP_PIDS: {
+        const uint32_t *pid = key;
+        out_uint("pid", *pid);
+        break;
+    }
+    case EBPF_FILTER_MAP_OPEN_PATH_PREFIXES: {
+        const struct ebpf_open_path_prefix *prefix = key;
+        char path[sizeof(prefix->path) + 1]        = {0};
+        size_t len                                 = prefix->prefixlen / 8;
 
+        memcpy(path, prefix->path, len < sizeof(prefix->path) ? len : sizeof(prefix->path));
+        out_string("prefix", path);
+        break;
+    }
+    case EBPF_FILTER_MAP_TAMPER_INODES: {
+        const struct ebpf_tamper_inode *inode = key;
+        out_uint("dev", inode->dev);
         out_comma();
-        out_uint("bytes_received", net->tcp.close.bytes_received);
+        out_uint("inode", inode->inode);
+        out_comma();
+        out_string("owner", value == EBPF_TAMPER_INODE_OWNER_SELF ? "SELF" : "SECURITY");
         break;
     }
+    case EBPF_FILTER_MAP_TAMPER_COMMS: {
+        char comm[TASK_COMM_LEN + 1] = {0};
 
+        memcpy(comm, key, TASK_COMM_LEN);
+        out_string("comm", comm);
+        break;
+    }
+    case EBPF_FILTER_MAP_DEVICE_INODES: {
+        const struct ebpf_device_inode *inode = key;
+        out_uint("dev", inode->dev);
+        out_comma();
+        out_uint("inode", inode->inode);
+        out_comma();
+        out_device_class("device_class", value);
+        break;
+    }
+    default:
+        break;
+    }
     out_object_end();
 }
 
-static void out_network_event(const char *name, struct ebpf_net_event *evt)
+// Prints the next page of the dump in progress as a FILTER_MAP line, moving on
+// to the next map once one is done. A map that can't be read is logged and
+// skipped, it doesn't stop tracing.
+static void out_filter_map_dump_page(struct ebpf_event_ctx *ctx)
 {
+    bool first = true;
+    bool last;
+
     out_object_start();
-    out_event_type(name);
+    out_event_type("FILTER_MAP");
     out_comma();
-
-    out_pid_info("pids", &evt->pids);
+    out_string("map", filter_map_names[filter_map_dump.map]);
     out_comma();
 
-    out_net_info("net", evt);
+    printf("\"entries\":[");
+    int n = ebpf_event_ctx__dump_filter_map(ctx, filter_map_dump.map, &filter_map_dump.cursor,
+                                            FILTER_MAP_DUMP_PAGE, out_filter_map_entry, &first);
+    printf("]");
     out_comma();
 
-    out_string("comm", (const char *)&evt->comm);
+    if (n < 0)
+        fprintf(stderr, "Could not dump filter map %s: %d %s\n",
+                filter_map_names[filter_map_dump.map], n, strerror(-n));
+
+    last = n < FILTER_MAP_DUMP_PAGE;
+    out_bool("last", last);
 
     out_object_end();
     out_newline();
+
+    if (!last)
+        return;
+
+    memset(&filter_map_dump.cursor, 0, sizeof(filter_map_dump.cursor));
+    if (++filter_map_dump.map == EBPF_FILTER_MAP_MAX)
+        filter_map_dump.active = false;
 }
 
-static void out_network_connection_accepted_event(struct ebpf_net_event *evt)
+static int setup_open_paths(struct ebpf_event_ctx *ctx)
 {
-    out_network_event("NETWORK_CONNECTION_ACCEPTED", evt);
+    int err = 0;
+    char *saveptr;
+
+    char *paths = strdup(g_open_paths);
+    if (!paths)
+        return -ENOMEM;
+
+    for (char *tok = strtok_r(paths, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        err = ebpf_event_ctx__add_open_path_prefix(ctx, tok);
+        if (err < 0) {
+            fprintf(stderr, "Could not add open path prefix %s: %d %s\n", tok, err,
+                    strerror(-err));
+            break;
+        }
+    }
+
+    free(paths);
+    return err;
 }
 
-static void out_network_connection_attempted_event(struct ebpf_net_event *evt)
+static int setup_pid_filter(struct ebpf_event_ctx *ctx)
 {
-    out_network_event("NETWORK_CONNECTION_ATTEMPTED", evt);
+    int err = 0;
+    char *saveptr;
+
+    char *pids = strdup(g_pid_filter);
+    if (!pids)
+        return -ENOMEM;
+
+    for (char *tok = strtok_r(pids, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        char *end;
+        errno    = 0;
+        long pid = strtol(tok, &end, 10);
+        if (errno != 0 || *end != '\0' || pid <= 0 || pid > UINT32_MAX) {
+            fprintf(stderr, "Invalid PID in --pid-filter: %s\n", tok);
+            err = -EINVAL;
+            break;
+        }
+
+        err = ebpf_event_ctx__add_filter_pid(ctx, pid);
+        if (err < 0) {
+            fprintf(stderr, "Could not filter on PID %ld: %d %s\n", pid, err, strerror(-err));
+            break;
+        }
+    }
+
+    free(pids);
+    return err;
 }
 
-static void out_network_connection_closed_event(struct ebpf_net_event *evt)
+// Paths that don't exist are skipped, most systems only have some of the
+// security modules the default list covers
+static int setup_tamper_watch(struct ebpf_event_ctx *ctx)
 {
-    out_network_event("NETWORK_CONNECTION_CLOSED", evt);
+    int err = 0;
+    char *saveptr;
+
+    char *paths = strdup(g_tamper_paths);
+    if (!paths)
+        return -ENOMEM;
+
+    for (char *tok = strtok_r(paths, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        err = ebpf_event_ctx__add_tamper_path(ctx, tok);
+        if (err == -ENOENT) {
+            err = 0;
+        } else if (err < 0) {
+            fprintf(stderr, "Could not watch %s for tampering: %d %s\n", tok, err, strerror(-err));
+            goto out;
+        }
+    }
+
+    free(paths);
+    paths = strdup(g_self_paths);
+    if (!paths)
+        return -ENOMEM;
+
+    for (char *tok = strtok_r(paths, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        err = ebpf_event_ctx__add_self_tamper_path(ctx, tok);
+        if (err == -ENOENT) {
+            err = 0;
+        } else if (err < 0) {
+            fprintf(stderr, "Could not watch %s for tampering: %d %s\n", tok, err, strerror(-err));
+            goto out;
+        }
+    }
+
+    if (g_lolbin_list_path) {
+        err = ebpf_event_ctx__add_self_tamper_path(ctx, g_lolbin_list_path);
+        if (err < 0) {
+            fprintf(stderr, "Could not watch %s for tampering: %d %s\n", g_lolbin_list_path, err,
+                    strerror(-err));
+            goto out;
+        }
+    }
+
+    char *comms = strdup(g_tamper_comms);
+    if (!comms) {
+        err = -ENOMEM;
+        goto out;
+    }
+
+    for (char *tok = strtok_r(comms, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        err = ebpf_event_ctx__add_tamper_comm(ctx, tok);
+        if (err < 0) {
+            fprintf(stderr, "Could not watch %s for tampering: %d %s\n", tok, err, strerror(-err));
+            break;
+        }
+    }
+
+    free(comms);
+out:
+    free(paths);
+    return err;
 }
 
-static int event_ctx_callback(struct ebpf_event_header *evt_hdr)
+// Globs matching nothing and paths that don't exist are skipped, machines
+// rarely have more than one vendor's devices
+static int setup_device_watch(struct ebpf_event_ctx *ctx)
 {
-    switch (evt_hdr->type) {
-    case EBPF_EVENT_PROCESS_FORK:
-        out_process_fork((struct ebpf_process_fork_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_PROCESS_EXEC:
-        out_process_exec((struct ebpf_process_exec_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_PROCESS_EXIT:
-        out_process_exit((struct ebpf_process_exit_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_PROCESS_SETSID:
-        out_process_setsid((struct ebpf_process_setsid_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_PROCESS_SETUID:
-        out_process_setuid((struct ebpf_process_setuid_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_PROCESS_SETGID:
-        out_process_setgid((struct ebpf_process_setgid_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_PROCESS_TTY_WRITE:
-        out_process_tty_write((struct ebpf_process_tty_write_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_FILE_DELETE:
-        out_file_delete((struct ebpf_file_delete_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_FILE_CREATE:
-        out_file_create((struct ebpf_file_create_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_FILE_RENAME:
-        out_file_rename((struct ebpf_file_rename_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_NETWORK_CONNECTION_ACCEPTED:
-        out_network_connection_accepted_event((struct ebpf_net_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_NETWORK_CONNECTION_ATTEMPTED:
-        out_network_connection_attempted_event((struct ebpf_net_event *)evt_hdr);
-        break;
-    case EBPF_EVENT_NETWORK_CONNECTION_CLOSED:
-        out_network_connection_closed_event((struct ebpf_net_event *)evt_hdr);
-        break;
+    int err = 0;
+    char *saveptr;
+
+    char *paths = strdup(g_device_paths);
+    if (!paths)
+        return -ENOMEM;
+
+    for (char *tok = strtok_r(paths, ",", &saveptr); tok; tok = strtok_r(NULL, ",", &saveptr)) {
+        glob_t g;
+        if (glob(tok, 0, NULL, &g) != 0)
+            continue;
+
+        for (size_t i = 0; i < g.gl_pathc; i++) {
+            err = ebpf_event_ctx__add_device_path(ctx, g.gl_pathv[i],
+                                                  EBPF_DEVICE_CLASS_ACCELERATOR);
+            if (err == -ENOENT) {
+                err = 0;
+            } else if (err < 0) {
+                fprintf(stderr, "Could not watch %s for device accesses: %d %s\n",
+                        g.gl_pathv[i], err, strerror(-err));
+                break;
+            }
+        }
+
+        globfree(&g);
+        if (err < 0)
+            break;
     }
 
-    return 0;
+    free(paths);
+    return err;
 }
 
-static void print_init_msg(uint64_t features)
+static int get_object_sha256(char hex[SHA256_HEX_LEN + 1])
 {
-    printf("{\"probes_initialized\": true, \"features\": {");
-    printf("\"bpf_tramp\": %s", (features & EBPF_FEATURE_BPF_TRAMP) ? "true" : "false");
-    printf("}}\n");
+    uint8_t hash[EBPF_OBJECT_SHA256_LEN];
+
+    int err = ebpf_object_sha256(hash);
+    if (err < 0)
+        return err;
+
+    for (int i = 0; i < EBPF_OBJECT_SHA256_LEN; i++)
+        sprintf(hex + i * 2, "%02x", hash[i]);
+
+    return 0;
 }
 
 int main(int argc, char **argv)
@@ -687,6 +4888,16 @@ int main(int argc, char **argv)
         goto out;
     }
 
+    if (signal(SIGUSR1, sig_usr) == SIG_ERR || signal(SIGUSR2, sig_usr) == SIG_ERR) {
+        fprintf(stderr, "Failed to register SIGUSR1/SIGUSR2 handlers\n");
+        goto out;
+    }
+
+    if (signal(SIGHUP, sig_hup) == SIG_ERR) {
+        fprintf(stderr, "Failed to register SIGHUP handler\n");
+        goto out;
+    }
+
     err = argp_parse(&argp, argc, argv, 0, NULL, NULL);
     if (err)
         goto out;
@@ -702,17 +4913,148 @@ int main(int argc, char **argv)
     if (g_libbpf_verbose)
         ebpf_set_verbose_logging();
 
-    err = ebpf_event_ctx__new(&ctx, event_ctx_callback, g_events_env);
+    if (g_lolbin_list_path) {
+        err = load_lolbin_list(g_lolbin_list_path);
+        if (err < 0)
+            goto out;
+    }
+
+    char object_sha256[SHA256_HEX_LEN + 1];
+    err = get_object_sha256(object_sha256);
+    if (err < 0) {
+        fprintf(stderr, "Could not compute BPF object SHA256: %d %s\n", err, strerror(-err));
+        goto out;
+    }
+
+    if (g_expected_object_sha256 && strcasecmp(g_expected_object_sha256, object_sha256) != 0) {
+        fprintf(stderr, "BPF object SHA256 mismatch: expected %s, got %s, refusing to load\n",
+                g_expected_object_sha256, object_sha256);
+        err = 1;
+        goto out;
+    }
+
+    uint64_t events = g_events_env;
+    if (g_net_summary_interval)
+        events |= EBPF_EVENT_NETWORK_CONNECTION_CLOSED;
+    if (g_drop_and_run_window)
+        events |= EBPF_EVENT_FILE_CREATE | EBPF_EVENT_PROCESS_EXEC;
+    if (g_events_env & EBPF_EVENT_NETWORK_DNS_RESPONSE)
+        events |= EBPF_EVENT_NETWORK_DNS_QUERY;
+    if (g_resolved_via)
+        events |= EBPF_EVENT_NETWORK_DNS_RESPONSE;
+
+    err = ebpf_event_ctx__new(&ctx, event_ctx_callback, events);
 
     if (err < 0) {
         fprintf(stderr, "Could not create event context: %d %s\n", err, strerror(-err));
         goto out;
     }
 
+    if (g_proc_seq) {
+        err = ebpf_event_ctx__set_proc_seq(ctx, true);
+        if (err < 0) {
+            fprintf(stderr, "Could not enable per-process sequence numbers\n");
+            goto out;
+        }
+    }
+
+    if (g_capture_env) {
+        err = ebpf_event_ctx__set_env_capture(ctx, g_capture_env_max);
+        if (err < 0) {
+            fprintf(stderr, "Could not enable environment capture\n");
+            goto out;
+        }
+    }
+
+    if (g_mprotect_verbose) {
+        err = ebpf_event_ctx__set_mprotect_verbose(ctx, true);
+        if (err < 0) {
+            fprintf(stderr, "Could not enable verbose mprotect events\n");
+            goto out;
+        }
+    }
+
+    if (!g_no_threads) {
+        err = ebpf_event_ctx__set_trace_threads(ctx, true);
+        if (err < 0) {
+            fprintf(stderr, "Could not enable thread creation events\n");
+            goto out;
+        }
+    }
+
+    // Prefixes first, so that no open outside of them slips through
+    if (*g_open_paths) {
+        err = setup_open_paths(ctx);
+        if (err < 0)
+            goto out;
+    }
+
+    if (g_trace_opens) {
+        err = ebpf_event_ctx__set_trace_opens(ctx, true);
+        if (err < 0) {
+            fprintf(stderr, "Could not enable open events\n");
+            goto out;
+        }
+    }
+
+    if (*g_pid_filter) {
+        err = setup_pid_filter(ctx);
+        if (err < 0)
+            goto out;
+    }
+
+    if (g_events_env & EBPF_EVENT_SECURITY_TAMPER) {
+        err = setup_tamper_watch(ctx);
+        if (err < 0)
+            goto out;
+    }
+
+    if (g_events_env & EBPF_EVENT_DEVICE_ACCESS) {
+        err = setup_device_watch(ctx);
+        if (err < 0)
+            goto out;
+    }
+
     if (g_print_features_init)
-        print_init_msg(ebpf_event_ctx__get_features(ctx));
+        print_init_msg(ebpf_event_ctx__get_features(ctx), object_sha256);
+
+    out_config(ctx, false);
 
+    if (g_dump_filter_maps)
+        dump_requested = 1;
+
+    uint64_t last_stats = monotonic_secs();
+    net_summaries_since = monotonic_secs();
     while (!exiting) {
+        if (g_stats_interval && monotonic_secs() - last_stats >= g_stats_interval) {
+            out_stats(ctx);
+            last_stats = monotonic_secs();
+        }
+
+        if (g_net_summary_interval &&
+            monotonic_secs() - net_summaries_since >= g_net_summary_interval)
+            out_net_summaries();
+
+        if (pause_changed) {
+            err = update_paused(ctx);
+            if (err < 0)
+                break;
+
+            out_config(ctx, pause_requested);
+        }
+
+        // A dump requested while one is in progress is covered by it
+        if (dump_requested) {
+            dump_requested = 0;
+            if (!filter_map_dump.active) {
+                memset(&filter_map_dump, 0, sizeof(filter_map_dump));
+                filter_map_dump.active = true;
+            }
+        }
+
+        if (filter_map_dump.active)
+            out_filter_map_dump_page(ctx);
+
         err = ebpf_event_ctx__next(ctx, 10);
         if (err < 0 && err != -EINTR) {
             fprintf(stderr, "Failed to poll event context %d: %s\n", err, strerror(-err));
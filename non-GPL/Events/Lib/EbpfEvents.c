@@ -15,11 +15,15 @@
 #include <errno.h>
 #include <stdbool.h>
 #include <stdio.h>
+#include <string.h>
 #include <sys/resource.h>
+#include <sys/stat.h>
+#include <sys/sysmacros.h>
 #include <sys/utsname.h>
 #include <unistd.h>
 
 #include "EventProbe.skel.h"
+#include "Sha256.h"
 
 #define KERNEL_VERSION(maj, min, patch)                                                            \
     (((maj) << 16) | ((min) << 8) | (patch > 255 ? 255 : (patch)))
@@ -198,6 +202,23 @@ static int probe_fill_relos(struct btf *btf, struct EventProbe_bpf *obj)
     }
     err = err ?: FILL_FUNC_RET_IDX(obj, btf, vfs_rename);
 
+    err = err ?: FILL_FUNC_ARG_IDX(obj, btf, vfs_symlink, dentry);
+    err = err ?: FILL_FUNC_ARG_IDX(obj, btf, vfs_symlink, oldname);
+    err = err ?: FILL_FUNC_RET_IDX(obj, btf, vfs_symlink);
+    err = err ?: FILL_FUNC_ARG_IDX(obj, btf, vfs_link, old_dentry);
+    err = err ?: FILL_FUNC_ARG_IDX(obj, btf, vfs_link, new_dentry);
+    err = err ?: FILL_FUNC_RET_IDX(obj, btf, vfs_link);
+
+    err = err ?: FILL_FUNC_RET_IDX(obj, btf, inet_accept);
+    err = err ?: FILL_FUNC_RET_IDX(obj, btf, udp_recvmsg);
+    // IPv6 may be a module, whose functions aren't in the vmlinux BTF. The
+    // kprobes are used then (see probe_set_autoload).
+    if (BTF_FUNC_EXISTS(btf, udpv6_recvmsg))
+        err = err ?: FILL_FUNC_RET_IDX(obj, btf, udpv6_recvmsg);
+    // Same for AF_UNIX
+    if (BTF_FUNC_EXISTS(btf, unix_accept))
+        err = err ?: FILL_FUNC_RET_IDX(obj, btf, unix_accept);
+
     return err;
 }
 
@@ -217,6 +238,18 @@ static inline int probe_set_autoload(struct btf *btf, struct EventProbe_bpf *obj
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__do_renameat2, false);
     }
 
+    // Same for do_symlinkat and do_linkat, which are static on older kernels
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, do_symlinkat)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__do_symlinkat, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__do_symlinkat, false);
+    }
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, do_linkat)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__do_linkat, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__do_linkat, false);
+    }
+
     // tcp_v6_connect kprobes and fexit probe are mutually exclusive.
     // disable auto-loading of kprobes if `tcp_v6_connect` exists in BTF and
     // if bpf trampolines are supported on the current arch, and vice-versa.
@@ -227,6 +260,44 @@ static inline int probe_set_autoload(struct btf *btf, struct EventProbe_bpf *obj
         err = err ?: bpf_program__set_autoload(obj->progs.fexit__tcp_v6_connect, false);
     }
 
+    // Same for inet6_bind
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, inet6_bind)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__inet6_bind, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__inet6_bind, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__inet6_bind, false);
+    }
+
+    // Same for the udpv6_sendmsg and udpv6_recvmsg probes
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, udpv6_sendmsg)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__udpv6_sendmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__udpv6_sendmsg, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__udpv6_sendmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__udpv6_sendmsg, false);
+    }
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, udpv6_recvmsg)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__udpv6_recvmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__udpv6_recvmsg, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__udpv6_recvmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__udpv6_recvmsg, false);
+    }
+
+    // And the AF_UNIX connect and accept probes
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, unix_stream_connect)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__unix_stream_connect, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__unix_stream_connect, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__unix_stream_connect, false);
+    }
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, unix_accept)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__unix_accept, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__unix_accept, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__unix_accept, false);
+    }
+
     // tty_write BTF information is not available on all supported kernels due
     // to a pahole bug, see:
     // https://rhysre.net/how-an-obscure-arm64-link-option-broke-our-bpf-probe.html
@@ -239,6 +310,37 @@ static inline int probe_set_autoload(struct btf *btf, struct EventProbe_bpf *obj
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__tty_write, false);
     }
 
+    // chmod_common and chown_common are static, and can be left out of BTF
+    // (or inlined) depending on the compiler
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, chmod_common)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__chmod_common, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__chmod_common, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__chmod_common, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__chmod_common, false);
+    }
+    if (has_bpf_tramp && BTF_FUNC_EXISTS(btf, chown_common)) {
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__chown_common, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__chown_common, false);
+    } else {
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__chown_common, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__chown_common, false);
+    }
+
+    // Without module support (CONFIG_MODULES) there's neither the module_load
+    // tracepoint nor the init_module/finit_module syscall tracepoints
+    if (btf__find_by_name_kind(btf, "btf_trace_module_load", BTF_KIND_TYPEDEF) < 0) {
+        err = err ?: bpf_program__set_autoload(obj->progs.module_load, false);
+        err = err ?: bpf_program__set_autoload(
+                          obj->progs.tracepoint_syscalls_sys_enter_init_module, false);
+        err = err ?: bpf_program__set_autoload(
+                          obj->progs.tracepoint_syscalls_sys_exit_init_module, false);
+        err = err ?: bpf_program__set_autoload(
+                          obj->progs.tracepoint_syscalls_sys_enter_finit_module, false);
+        err = err ?: bpf_program__set_autoload(
+                          obj->progs.tracepoint_syscalls_sys_exit_finit_module, false);
+    }
+
     // bpf trampolines are only implemented for x86. disable auto-loading of all
     // fentry/fexit progs if EBPF_FEATURE_BPF_TRAMP is not in `features` and
     // enable the k[ret]probe counterpart.
@@ -247,15 +349,39 @@ static inline int probe_set_autoload(struct btf *btf, struct EventProbe_bpf *obj
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__mnt_want_write, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__vfs_unlink, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__vfs_unlink, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__do_filp_open, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__do_filp_open, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__vfs_rename, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__vfs_rename, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__vfs_symlink, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__vfs_symlink, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__vfs_link, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__vfs_link, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__vfs_truncate, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__vfs_truncate, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__kernel_clone, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__kernel_clone, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__path_mount, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__path_mount, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__path_umount, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__path_umount, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__taskstats_exit, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__commit_creds, false);
-        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__inet_csk_accept, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__security_mmap_file, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__security_file_mprotect, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__inet_accept, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__inet_accept, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__tcp_v4_connect, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__tcp_v4_connect, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__inet_listen, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__inet_listen, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__inet_bind, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__inet_bind, false);
         err = err ?: bpf_program__set_autoload(obj->progs.kprobe__tcp_close, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__udp_sendmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__udp_sendmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kprobe__udp_recvmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.kretprobe__udp_recvmsg, false);
     } else {
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__do_unlinkat, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__mnt_want_write, false);
@@ -264,11 +390,31 @@ static inline int probe_set_autoload(struct btf *btf, struct EventProbe_bpf *obj
         err = err ?: bpf_program__set_autoload(obj->progs.fexit__do_filp_open, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__vfs_rename, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fexit__vfs_rename, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__vfs_symlink, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__vfs_symlink, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__vfs_link, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__vfs_link, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__vfs_truncate, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__vfs_truncate, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__kernel_clone, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__kernel_clone, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__path_mount, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__path_mount, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__path_umount, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__path_umount, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__taskstats_exit, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__commit_creds, false);
-        err = err ?: bpf_program__set_autoload(obj->progs.fexit__inet_csk_accept, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__security_mmap_file, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__security_file_mprotect, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__inet_accept, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fexit__tcp_v4_connect, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__inet_listen, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__inet_bind, false);
         err = err ?: bpf_program__set_autoload(obj->progs.fentry__tcp_close, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__udp_sendmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__udp_sendmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fentry__udp_recvmsg, false);
+        err = err ?: bpf_program__set_autoload(obj->progs.fexit__udp_recvmsg, false);
     }
 
     return err;
@@ -373,6 +519,11 @@ static uint64_t detect_system_features()
     if (system_has_bpf_tramp())
         features |= EBPF_FEATURE_BPF_TRAMP;
 
+    // Events are only ever sent up through the BPF ring buffer (5.8+), older
+    // kernels are turned away by kernel_version_is_supported anyway
+    if (libbpf_probe_bpf_map_type(BPF_MAP_TYPE_RINGBUF, NULL) == 1)
+        features |= EBPF_FEATURE_RINGBUF;
+
     return features;
 }
 
@@ -512,6 +663,11 @@ uint64_t ebpf_event_ctx__get_features(struct ebpf_event_ctx *ctx)
     return ctx->features;
 }
 
+uint32_t ebpf_event_ctx__get_ringbuf_size(struct ebpf_event_ctx *ctx)
+{
+    return bpf_map__max_entries(ctx->probe->maps.ringbuf);
+}
+
 int ebpf_event_ctx__new(struct ebpf_event_ctx **ctx, ebpf_event_handler_fn cb, uint64_t events)
 {
     struct EventProbe_bpf *probe = NULL;
@@ -572,6 +728,17 @@ int ebpf_event_ctx__new(struct ebpf_event_ctx **ctx, ebpf_event_handler_fn cb, u
 
     probe->rodata->consumer_pid = getpid();
 
+    // One event buffer per CPU, see EventProbe.bpf.c
+    int n_cpus = libbpf_num_possible_cpus();
+    if (n_cpus < 0) {
+        err = n_cpus;
+        goto out_destroy_probe;
+    }
+
+    err = bpf_map__set_max_entries(probe->maps.elastic_ebpf_events_event_buffer, n_cpus);
+    if (err != 0)
+        goto out_destroy_probe;
+
     err = probe_fill_relos(btf, probe);
     if (err != 0)
         goto out_destroy_probe;
@@ -642,6 +809,384 @@ int ebpf_event_ctx__next(struct ebpf_event_ctx *ctx, int timeout)
     return consumed > 0 ? 0 : consumed;
 }
 
+int ebpf_event_ctx__set_paused(struct ebpf_event_ctx *ctx, bool paused)
+{
+    if (!ctx)
+        return -1;
+
+    ctx->probe->bss->events_paused = paused;
+    return 0;
+}
+
+int ebpf_event_ctx__set_proc_seq(struct ebpf_event_ctx *ctx, bool enabled)
+{
+    if (!ctx)
+        return -1;
+
+    ctx->probe->bss->proc_seq_events = enabled ? ctx->cb_ctx->events_mask : 0;
+    return 0;
+}
+
+int ebpf_event_ctx__set_env_capture(struct ebpf_event_ctx *ctx, uint32_t max_bytes)
+{
+    if (!ctx)
+        return -1;
+
+    ctx->probe->bss->env_capture_max = max_bytes > ENV_MAX ? ENV_MAX : max_bytes;
+    return 0;
+}
+
+int ebpf_event_ctx__set_mprotect_verbose(struct ebpf_event_ctx *ctx, bool verbose)
+{
+    if (!ctx)
+        return -1;
+
+    ctx->probe->bss->mprotect_verbose = verbose;
+    return 0;
+}
+
+int ebpf_event_ctx__set_trace_threads(struct ebpf_event_ctx *ctx, bool enabled)
+{
+    if (!ctx)
+        return -1;
+
+    ctx->probe->bss->trace_threads = enabled;
+    return 0;
+}
+
+int ebpf_event_ctx__add_filter_pid(struct ebpf_event_ctx *ctx, uint32_t pid)
+{
+    uint8_t one = 1;
+
+    if (!ctx || pid == 0)
+        return -EINVAL;
+
+    if (bpf_map_update_elem(bpf_map__fd(ctx->probe->maps.elastic_ebpf_events_pid_filter), &pid,
+                            &one, BPF_ANY) < 0)
+        return -errno;
+
+    ctx->probe->bss->pid_filter_enabled = true;
+    return 0;
+}
+
+static int add_tamper_inode(struct ebpf_event_ctx *ctx,
+                            const char *path,
+                            enum ebpf_tamper_inode_owner owner)
+{
+    struct stat st;
+    uint8_t value = owner;
+
+    if (!ctx || !path)
+        return -EINVAL;
+
+    if (stat(path, &st) < 0)
+        return -errno;
+
+    // The probes see the kernel's internal dev_t encoding, which differs from
+    // the userspace one
+    struct ebpf_tamper_inode key = {
+        .dev   = (major(st.st_dev) << 20) | minor(st.st_dev),
+        .inode = st.st_ino,
+    };
+    if (bpf_map_update_elem(bpf_map__fd(ctx->probe->maps.elastic_ebpf_events_tamper_inodes),
+                            &key, &value, BPF_ANY) < 0)
+        return -errno;
+
+    ctx->probe->bss->tamper_inodes_watched = true;
+    return 0;
+}
+
+int ebpf_event_ctx__add_tamper_path(struct ebpf_event_ctx *ctx, const char *path)
+{
+    return add_tamper_inode(ctx, path, EBPF_TAMPER_INODE_OWNER_SECURITY);
+}
+
+int ebpf_event_ctx__add_self_tamper_path(struct ebpf_event_ctx *ctx, const char *path)
+{
+    return add_tamper_inode(ctx, path, EBPF_TAMPER_INODE_OWNER_SELF);
+}
+
+int ebpf_event_ctx__add_tamper_comm(struct ebpf_event_ctx *ctx, const char *comm)
+{
+    char key[TASK_COMM_LEN] = {0};
+    uint8_t one             = 1;
+
+    if (!ctx || !comm)
+        return -EINVAL;
+
+    // Matched against the kernel's NUL-padded comm, which is truncated to
+    // TASK_COMM_LEN - 1 characters
+    strncpy(key, comm, TASK_COMM_LEN - 1);
+    if (bpf_map_update_elem(bpf_map__fd(ctx->probe->maps.elastic_ebpf_events_tamper_comms), key,
+                            &one, BPF_ANY) < 0)
+        return -errno;
+
+    return 0;
+}
+
+int ebpf_event_ctx__add_device_path(struct ebpf_event_ctx *ctx,
+                                    const char *path,
+                                    enum ebpf_device_class device_class)
+{
+    struct stat st;
+    uint8_t value = device_class;
+
+    if (!ctx || !path)
+        return -EINVAL;
+
+    if (stat(path, &st) < 0)
+        return -errno;
+
+    // See ebpf_event_ctx__add_tamper_path
+    struct ebpf_device_inode key = {
+        .dev   = (major(st.st_dev) << 20) | minor(st.st_dev),
+        .inode = st.st_ino,
+    };
+    if (bpf_map_update_elem(bpf_map__fd(ctx->probe->maps.elastic_ebpf_events_device_inodes), &key,
+                            &value, BPF_ANY) < 0)
+        return -errno;
+
+    ctx->probe->bss->device_inodes_watched = true;
+    return 0;
+}
+
+int ebpf_event_ctx__set_trace_opens(struct ebpf_event_ctx *ctx, bool enabled)
+{
+    if (!ctx)
+        return -1;
+
+    ctx->probe->bss->trace_opens = enabled;
+    return 0;
+}
+
+int ebpf_event_ctx__add_open_path_prefix(struct ebpf_event_ctx *ctx, const char *prefix)
+{
+    struct ebpf_open_path_prefix key = {0};
+    uint8_t one                      = 1;
+
+    if (!ctx || !prefix)
+        return -EINVAL;
+
+    size_t len = strlen(prefix);
+    if (len >= sizeof(key.path))
+        return -ENAMETOOLONG;
+
+    key.prefixlen = len * 8;
+    memcpy(key.path, prefix, len);
+    if (bpf_map_update_elem(bpf_map__fd(ctx->probe->maps.elastic_ebpf_events_open_path_prefixes),
+                            &key, &one, BPF_ANY) < 0)
+        return -errno;
+
+    ctx->probe->bss->open_path_prefixes_set = true;
+    return 0;
+}
+
+static struct bpf_map *filter_map(struct ebpf_event_ctx *ctx, enum ebpf_filter_map map)
+{
+    switch (map) {
+    case EBPF_FILTER_MAP_PIDS:
+        return ctx->probe->maps.elastic_ebpf_events_pid_filter;
+    case EBPF_FILTER_MAP_OPEN_PATH_PREFIXES:
+        return ctx->probe->maps.elastic_ebpf_events_open_path_prefixes;
+    case EBPF_FILTER_MAP_TAMPER_INODES:
+        return ctx->probe->maps.elastic_ebpf_events_tamper_inodes;
+    case EBPF_FILTER_MAP_TAMPER_COMMS:
+        return ctx->probe->maps.elastic_ebpf_events_tamper_comms;
+    case EBPF_FILTER_MAP_DEVICE_INODES:
+        return ctx->probe->maps.elastic_ebpf_events_device_inodes;
+    default:
+        return NULL;
+    }
+}
+
+int ebpf_event_ctx__dump_filter_map(struct ebpf_event_ctx *ctx,
+                                    enum ebpf_filter_map map,
+                                    struct ebpf_filter_map_cursor *cursor,
+                                    uint32_t max_entries,
+                                    ebpf_filter_map_entry_fn cb,
+                                    void *data)
+{
+    uint8_t key[sizeof(cursor->key)];
+    uint8_t value;
+    uint32_t n = 0;
+
+    if (!ctx || !cursor || !cb)
+        return -EINVAL;
+
+    struct bpf_map *m = filter_map(ctx, map);
+    if (!m || bpf_map__key_size(m) > sizeof(key) || bpf_map__value_size(m) != sizeof(value))
+        return -EINVAL;
+
+    int fd            = bpf_map__fd(m);
+    uint32_t max_read = bpf_map__max_entries(m);
+
+    // bpf_map_get_next_key starts over from the first key if the one the
+    // cursor is at is gone, end the dump there rather than repeat entries
+    if (cursor->started && bpf_map_lookup_elem(fd, cursor->key, &value) < 0) {
+        if (errno != ENOENT)
+            return -errno;
+        cursor->read = max_read;
+    }
+
+    while (n < max_entries && cursor->read < max_read) {
+        if (bpf_map_get_next_key(fd, cursor->started ? cursor->key : NULL, key) < 0) {
+            if (errno == ENOENT)
+                break;
+            return -errno;
+        }
+
+        cursor->started = true;
+        cursor->read++;
+        memcpy(cursor->key, key, bpf_map__key_size(m));
+
+        if (bpf_map_lookup_elem(fd, key, &value) < 0) {
+            // Removed since its key was read, the cursor is lost
+            if (errno == ENOENT) {
+                cursor->read = max_read;
+                break;
+            }
+            return -errno;
+        }
+
+        cb(map, key, value, data);
+        n++;
+    }
+
+    return n;
+}
+
+int ebpf_event_ctx__read_stats(struct ebpf_event_ctx *ctx, struct ebpf_event_stats *ees)
+{
+    int err       = 0;
+    uint32_t zero = 0;
+
+    if (!ctx || !ees)
+        return -1;
+
+    int n_cpus = libbpf_num_possible_cpus();
+    if (n_cpus < 0)
+        return n_cpus;
+
+    struct ebpf_event_stats pcpu_ees[n_cpus];
+    err = bpf_map_lookup_elem(bpf_map__fd(ctx->probe->maps.elastic_ebpf_events_stats), &zero,
+                              pcpu_ees);
+    if (err < 0)
+        goto out;
+
+    memset(ees, 0, sizeof(*ees));
+    for (int i = 0; i < n_cpus; i++) {
+        ees->emitted += pcpu_ees[i].emitted;
+        ees->dropped += pcpu_ees[i].dropped;
+        if (pcpu_ees[i].ringbuf_backlog > ees->ringbuf_backlog)
+            ees->ringbuf_backlog = pcpu_ees[i].ringbuf_backlog;
+    }
+
+out:
+    return err;
+}
+
+#define BOOT_ID_LEN 36 // Hyphenated UUID, e.g. 0fc8d8fa-8f2e-4fa5-9ad3-8a36ae1cbbb5
+
+#define FNV1A_64_OFFSET_BASIS 0xcbf29ce484222325ULL
+#define FNV1A_64_PRIME 0x100000001b3ULL
+
+static uint64_t fnv1a_64(uint64_t hash, const uint8_t *buf, size_t len)
+{
+    for (size_t i = 0; i < len; i++) {
+        hash ^= buf[i];
+        hash *= FNV1A_64_PRIME;
+    }
+
+    return hash;
+}
+
+// Stable for the lifetime of the system, so only read it once
+static int get_boot_id(const char **boot_id)
+{
+    static char cached[BOOT_ID_LEN + 1];
+    static bool read = false;
+
+    int err = 0;
+    FILE *f = NULL;
+
+    if (read)
+        goto out;
+
+    f = fopen("/proc/sys/kernel/random/boot_id", "r");
+    if (!f) {
+        err = -errno;
+        goto out;
+    }
+
+    if (fread(cached, 1, BOOT_ID_LEN, f) != BOOT_ID_LEN) {
+        err = -EIO;
+        goto out;
+    }
+
+    cached[BOOT_ID_LEN] = '\0';
+    read                = true;
+
+out:
+    if (f)
+        fclose(f);
+    *boot_id = cached;
+    return err;
+}
+
+int ebpf_entity_id(uint32_t tgid, uint64_t start_time_ns, uint64_t *id)
+{
+    const char *boot_id;
+    uint8_t buf[sizeof(tgid) + sizeof(start_time_ns)];
+
+    int err = get_boot_id(&boot_id);
+    if (err < 0)
+        return err;
+
+    for (size_t i = 0; i < sizeof(tgid); i++)
+        buf[i] = (tgid >> (i * 8)) & 0xFF;
+    for (size_t i = 0; i < sizeof(start_time_ns); i++)
+        buf[sizeof(tgid) + i] = (start_time_ns >> (i * 8)) & 0xFF;
+
+    uint64_t hash = fnv1a_64(FNV1A_64_OFFSET_BASIS, (const uint8_t *)boot_id, BOOT_ID_LEN);
+    *id           = fnv1a_64(hash, buf, sizeof(buf));
+
+    return 0;
+}
+
+int ebpf_object_sha256(uint8_t hash[EBPF_OBJECT_SHA256_LEN])
+{
+    // Opening (but not loading) the skeleton is the only way to get at the
+    // embedded object
+    struct EventProbe_bpf *probe = EventProbe_bpf__open();
+    if (probe == NULL)
+        return -ENOENT;
+
+    sha256(probe->skeleton->data, probe->skeleton->data_sz, hash);
+
+    EventProbe_bpf__destroy(probe);
+    return 0;
+}
+
+int ebpf_fd_sha256(int fd, uint8_t hash[EBPF_OBJECT_SHA256_LEN])
+{
+    struct sha256_ctx sha;
+    uint8_t buf[16384];
+    ssize_t n;
+
+    sha256_init(&sha);
+    while ((n = read(fd, buf, sizeof(buf))) != 0) {
+        if (n < 0) {
+            if (errno == EINTR)
+                continue;
+            return -errno;
+        }
+        sha256_update(&sha, buf, n);
+    }
+    sha256_final(&sha, hash);
+
+    return 0;
+}
+
 void ebpf_event_ctx__destroy(struct ebpf_event_ctx **ctx)
 {
     if (!ctx)
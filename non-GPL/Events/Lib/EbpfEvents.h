@@ -17,6 +17,7 @@
 
 enum ebpf_kernel_feature {
     EBPF_FEATURE_BPF_TRAMP = (1 << 0),
+    EBPF_FEATURE_RINGBUF   = (1 << 1),
 };
 
 /* Opaque context */
@@ -24,6 +25,8 @@ struct ebpf_event_ctx;
 
 typedef int (*ebpf_event_handler_fn)(struct ebpf_event_header *);
 
+#define EBPF_OBJECT_SHA256_LEN 32
+
 /* Turn on logging of all libbpf debug logs to stderr */
 int ebpf_set_verbose_logging();
 
@@ -40,11 +43,198 @@ int ebpf_event_ctx__new(struct ebpf_event_ctx **ctx, ebpf_event_handler_fn cb, u
 
 uint64_t ebpf_event_ctx__get_features(struct ebpf_event_ctx *ctx);
 
+/* Size in bytes of the ringbuffer events are sent up through. */
+uint32_t ebpf_event_ctx__get_ringbuf_size(struct ebpf_event_ctx *ctx);
+
 /* Consumes as many events as possible from the event context and returns the
  * number consumed.
  */
 int ebpf_event_ctx__next(struct ebpf_event_ctx *ctx, int timeout);
 
+/* Pauses or resumes event emission without detaching the probes. While
+ * paused, the probes keep running but don't send any events up, so anything
+ * happening in the meantime (e.g. a fork) is never seen by the consumer.
+ */
+int ebpf_event_ctx__set_paused(struct ebpf_event_ctx *ctx, bool paused);
+
+/* Turns per-process sequence numbers (proc_seq in struct ebpf_event_header)
+ * on or off. They're off by default as they cost a map lookup per event. Only
+ * the event types ctx was created with are counted.
+ */
+int ebpf_event_ctx__set_proc_seq(struct ebpf_event_ctx *ctx, bool enabled);
+
+/* Captures up to max_bytes of the environment of exec'ing processes in
+ * EBPF_EVENT_PROCESS_EXEC events (as an EBPF_VL_FIELD_ENV field), capped at
+ * ENV_MAX. 0 (the default) turns capture off, copying the environment makes
+ * every exec more expensive.
+ */
+int ebpf_event_ctx__set_env_capture(struct ebpf_event_ctx *ctx, uint32_t max_bytes);
+
+/* By default, EBPF_EVENT_PROCESS_MPROTECT events are only sent for memory
+ * made executable that wasn't. If verbose, they're sent for every successful
+ * mprotect, including the many benign ones (e.g. RW to RO after relocation).
+ */
+int ebpf_event_ctx__set_mprotect_verbose(struct ebpf_event_ctx *ctx, bool verbose);
+
+/* Turns EBPF_EVENT_PROCESS_FORK events for new threads (is_thread set) on or
+ * off (the default). Threads share their process' pids and every other
+ * event's attribution, so most consumers only care about new processes.
+ */
+int ebpf_event_ctx__set_trace_threads(struct ebpf_event_ctx *ctx, bool enabled);
+
+/* Restricts events to those of process pid (a tgid) and of any process it
+ * forks from then on. May be called several times to allow more processes.
+ * Once called, events of every other process are dropped in the probes. A
+ * process is forgotten when it exits, so a later process reusing its pid isn't
+ * allowed.
+ *
+ * Returns 0 on success or a negative errno on failure.
+ */
+int ebpf_event_ctx__add_filter_pid(struct ebpf_event_ctx *ctx, uint32_t pid);
+
+/* Adds a file or directory to the set watched for EBPF_EVENT_SECURITY_TAMPER
+ * writes. Writes to the file itself, or to any file directly in the directory,
+ * are reported. The path is resolved to its inode when this is called, so a
+ * file that's recreated later isn't watched anymore.
+ *
+ * Returns 0 on success or a negative errno on failure (e.g. -ENOENT if path
+ * doesn't exist).
+ */
+int ebpf_event_ctx__add_tamper_path(struct ebpf_event_ctx *ctx, const char *path);
+
+/* Like ebpf_event_ctx__add_tamper_path, for the caller's own pinned BPF objects
+ * and config files (or directories of them). Writes, unlinks and renames are
+ * reported as EBPF_SECURITY_TAMPER_OP_SELF_WRITE, _SELF_UNLINK and
+ * _SELF_RENAME, except those made by the caller itself. The caller's writes to
+ * paths added with ebpf_event_ctx__add_tamper_path are still reported.
+ *
+ * Returns 0 on success or a negative errno on failure (e.g. -ENOENT if path
+ * doesn't exist).
+ */
+int ebpf_event_ctx__add_self_tamper_path(struct ebpf_event_ctx *ctx, const char *path);
+
+/* Adds a process name (as in /proc/<pid>/comm) to the set watched for
+ * EBPF_EVENT_SECURITY_TAMPER signals. SIGKILL, SIGTERM, SIGINT and SIGSTOP
+ * sent to a process with that name are reported.
+ *
+ * Returns 0 on success or a negative errno on failure.
+ */
+int ebpf_event_ctx__add_tamper_comm(struct ebpf_event_ctx *ctx, const char *comm);
+
+/* Adds a device file, or a directory of device files, to the set watched for
+ * EBPF_EVENT_DEVICE_ACCESS. Opens of the file itself, or of any file directly
+ * in the directory, are reported as device_class. As with
+ * ebpf_event_ctx__add_tamper_path, the path is resolved to its inode when this
+ * is called, device files created later in a watched directory are covered
+ * but a watched device file that's recreated isn't.
+ *
+ * Returns 0 on success or a negative errno on failure (e.g. -ENOENT if path
+ * doesn't exist).
+ */
+int ebpf_event_ctx__add_device_path(struct ebpf_event_ctx *ctx,
+                                    const char *path,
+                                    enum ebpf_device_class device_class);
+
+/* Turns EBPF_EVENT_FILE_OPEN events on or off (the default). Every successful
+ * open is reported, which on a busy system is many thousands a second, so
+ * they're off in the probes unless enabled here, regardless of the events the
+ * ctx was created with.
+ */
+int ebpf_event_ctx__set_trace_opens(struct ebpf_event_ctx *ctx, bool enabled);
+
+/* Restricts EBPF_EVENT_FILE_OPEN events to paths starting with prefix, up to
+ * OPEN_PATH_PREFIX_MAX - 1 characters long. May be called several times to
+ * allow more prefixes. The match is on the string, so e.g. "/etc" also
+ * matches "/etcd/...", end the prefix with a "/" to only match a directory.
+ *
+ * Returns 0 on success or a negative errno on failure (e.g. -ENAMETOOLONG if
+ * prefix is too long).
+ */
+int ebpf_event_ctx__add_open_path_prefix(struct ebpf_event_ctx *ctx, const char *prefix);
+
+/* Maps holding what the probes filter on, as filled in by the
+ * ebpf_event_ctx__add_* functions and, for the PID filter, the probes
+ * themselves on fork and exit.
+ */
+enum ebpf_filter_map {
+    EBPF_FILTER_MAP_PIDS               = 0, // Keys are uint32_t tgids
+    EBPF_FILTER_MAP_OPEN_PATH_PREFIXES = 1, // Keys are struct ebpf_open_path_prefix
+    // Keys are struct ebpf_tamper_inode, values their enum ebpf_tamper_inode_owner
+    EBPF_FILTER_MAP_TAMPER_INODES = 2,
+    EBPF_FILTER_MAP_TAMPER_COMMS  = 3, // Keys are char[TASK_COMM_LEN]
+    // Keys are struct ebpf_device_inode, values their enum ebpf_device_class
+    EBPF_FILTER_MAP_DEVICE_INODES = 4,
+    EBPF_FILTER_MAP_MAX           = 5,
+};
+
+/* Position in a dump of a filter map, zeroed to start one */
+struct ebpf_filter_map_cursor {
+    bool started;
+    uint32_t read; // Entries read so far
+    uint8_t key[sizeof(struct ebpf_open_path_prefix)];
+};
+
+/* Called with each entry of a filter map, value is the uint8_t stored with it */
+typedef void (*ebpf_filter_map_entry_fn)(enum ebpf_filter_map map,
+                                         const void *key,
+                                         uint8_t value,
+                                         void *data);
+
+/* Reads up to max_entries entries of a filter map, carrying on from where the
+ * last call with cursor stopped, and calls cb with each. Maps are only read,
+ * so dumping them doesn't affect the probes, and a large one can be dumped a
+ * page at a time in between reading events.
+ *
+ * The map isn't locked: entries added or removed during a dump may or may not
+ * be included, and if the entry the cursor is at is removed the dump ends
+ * there, without the entries it hadn't got to. An entry is never read twice,
+ * and a dump never reads more entries than the map can hold, so it ends even
+ * if the map keeps changing.
+ *
+ * Returns the number of entries read, fewer than max_entries once the dump is
+ * done, or a negative errno on failure.
+ */
+int ebpf_event_ctx__dump_filter_map(struct ebpf_event_ctx *ctx,
+                                    enum ebpf_filter_map map,
+                                    struct ebpf_filter_map_cursor *cursor,
+                                    uint32_t max_entries,
+                                    ebpf_filter_map_entry_fn cb,
+                                    void *data);
+
+/* Reads the event counters kept by the probes, summed across all CPUs.
+ * ringbuf_backlog is the largest backlog last seen by any CPU. Returns 0 on
+ * success or less than 0 on failure.
+ */
+int ebpf_event_ctx__read_stats(struct ebpf_event_ctx *ctx, struct ebpf_event_stats *ees);
+
+/* Computes an opaque ID for a process (thread group), identical for every
+ * event of that process and unique across pid reuse and reboots. tgid and
+ * start_time_ns are the fields of the same name in struct ebpf_pid_info.
+ *
+ * The ID is the 64-bit FNV-1a hash of the boot ID (as read from
+ * /proc/sys/kernel/random/boot_id, without the trailing newline), followed by
+ * tgid as 4 little-endian bytes and start_time_ns as 8 little-endian bytes.
+ *
+ * Returns 0 on success or less than 0 if the boot ID could not be read.
+ */
+int ebpf_entity_id(uint32_t tgid, uint64_t start_time_ns, uint64_t *id);
+
+/* Computes the SHA256 of the BPF object embedded in this library, i.e. exactly
+ * what ebpf_event_ctx__new loads. CO-RE relocations are applied at load time
+ * for the running kernel and so aren't covered, which keeps the hash stable
+ * across kernels.
+ *
+ * Returns 0 on success or less than 0 on failure.
+ */
+int ebpf_object_sha256(uint8_t hash[EBPF_OBJECT_SHA256_LEN]);
+
+/* Computes the SHA256 of everything readable from fd, starting at its current
+ * offset. Used to hash the files behind exec events.
+ *
+ * Returns 0 on success or a negative errno on read failure.
+ */
+int ebpf_fd_sha256(int fd, uint8_t hash[EBPF_OBJECT_SHA256_LEN]);
+
 void ebpf_event_ctx__destroy(struct ebpf_event_ctx **ctx);
 
 #endif // EBPF_EVENTS_H_
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2021 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+#include "Sha256.h"
+
+#include <string.h>
+
+#define ROTR(x, n) (((x) >> (n)) | ((x) << (32 - (n))))
+
+static const uint32_t k[64] = {
+    0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+    0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+    0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+    0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+    0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+    0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+    0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+    0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+};
+
+static void sha256_block(uint32_t state[8], const uint8_t block[64])
+{
+    uint32_t w[64];
+    uint32_t a, b, c, d, e, f, g, h;
+
+    for (int i = 0; i < 16; i++) {
+        w[i] = (uint32_t)block[i * 4] << 24 | (uint32_t)block[i * 4 + 1] << 16 |
+               (uint32_t)block[i * 4 + 2] << 8 | (uint32_t)block[i * 4 + 3];
+    }
+
+    for (int i = 16; i < 64; i++) {
+        uint32_t s0 = ROTR(w[i - 15], 7) ^ ROTR(w[i - 15], 18) ^ (w[i - 15] >> 3);
+        uint32_t s1 = ROTR(w[i - 2], 17) ^ ROTR(w[i - 2], 19) ^ (w[i - 2] >> 10);
+        w[i]        = w[i - 16] + s0 + w[i - 7] + s1;
+    }
+
+    a = state[0];
+    b = state[1];
+    c = state[2];
+    d = state[3];
+    e = state[4];
+    f = state[5];
+    g = state[6];
+    h = state[7];
+
+    for (int i = 0; i < 64; i++) {
+        uint32_t s1  = ROTR(e, 6) ^ ROTR(e, 11) ^ ROTR(e, 25);
+        uint32_t ch  = (e & f) ^ (~e & g);
+        uint32_t t1  = h + s1 + ch + k[i] + w[i];
+        uint32_t s0  = ROTR(a, 2) ^ ROTR(a, 13) ^ ROTR(a, 22);
+        uint32_t maj = (a & b) ^ (a & c) ^ (b & c);
+        uint32_t t2  = s0 + maj;
+
+        h = g;
+        g = f;
+        f = e;
+        e = d + t1;
+        d = c;
+        c = b;
+        b = a;
+        a = t1 + t2;
+    }
+
+    state[0] += a;
+    state[1] += b;
+    state[2] += c;
+    state[3] += d;
+    state[4] += e;
+    state[5] += f;
+    state[6] += g;
+    state[7] += h;
+}
+
+void sha256_init(struct sha256_ctx *ctx)
+{
+    static const uint32_t initial_state[8] = {
+        0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+        0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+    };
+
+    memcpy(ctx->state, initial_state, sizeof(ctx->state));
+    ctx->block_len = 0;
+    ctx->len       = 0;
+}
+
+void sha256_update(struct sha256_ctx *ctx, const void *data, size_t len)
+{
+    const uint8_t *p = data;
+
+    ctx->len += len;
+
+    // Top up a partial block left over from the last update first
+    if (ctx->block_len) {
+        size_t n = sizeof(ctx->block) - ctx->block_len;
+        n        = n > len ? len : n;
+        memcpy(ctx->block + ctx->block_len, p, n);
+        ctx->block_len += n;
+        p += n;
+        len -= n;
+
+        if (ctx->block_len < sizeof(ctx->block))
+            return;
+        sha256_block(ctx->state, ctx->block);
+        ctx->block_len = 0;
+    }
+
+    for (; len >= 64; len -= 64, p += 64)
+        sha256_block(ctx->state, p);
+
+    memcpy(ctx->block, p, len);
+    ctx->block_len = len;
+}
+
+void sha256_final(struct sha256_ctx *ctx, uint8_t digest[SHA256_DIGEST_LEN])
+{
+    uint8_t *block = ctx->block;
+    size_t rem     = ctx->block_len;
+
+    // Final block(s): the remaining bytes, a 1 bit, zero padding and the
+    // message length in bits as a big-endian 64 bit integer
+    memset(block + rem, 0, sizeof(ctx->block) - rem);
+    block[rem] = 0x80;
+
+    if (rem >= 56) {
+        sha256_block(ctx->state, block);
+        memset(block, 0, sizeof(ctx->block));
+    }
+
+    uint64_t bits = ctx->len * 8;
+    for (int i = 0; i < 8; i++)
+        block[63 - i] = (bits >> (i * 8)) & 0xFF;
+    sha256_block(ctx->state, block);
+
+    for (int i = 0; i < 8; i++) {
+        digest[i * 4]     = (ctx->state[i] >> 24) & 0xFF;
+        digest[i * 4 + 1] = (ctx->state[i] >> 16) & 0xFF;
+        digest[i * 4 + 2] = (ctx->state[i] >> 8) & 0xFF;
+        digest[i * 4 + 3] = ctx->state[i] & 0xFF;
+    }
+}
+
+void sha256(const void *data, size_t len, uint8_t digest[SHA256_DIGEST_LEN])
+{
+    struct sha256_ctx ctx;
+
+    sha256_init(&ctx);
+    sha256_update(&ctx, data, len);
+    sha256_final(&ctx, digest);
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2021 Elasticsearch B.V. and/or licensed to Elasticsearch B.V.
+ * under one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+#ifndef EBPF_EVENTS_SHA256_H_
+#define EBPF_EVENTS_SHA256_H_
+
+#include <stddef.h>
+#include <stdint.h>
+
+#define SHA256_DIGEST_LEN 32
+
+/* Minimal SHA256 (FIPS 180-4), used to fingerprint the BPF object and
+ * executables so we don't need to pull in a crypto library just for this.
+ */
+struct sha256_ctx {
+    uint32_t state[8];
+    uint8_t block[64];
+    size_t block_len;
+    uint64_t len;
+};
+
+void sha256_init(struct sha256_ctx *ctx);
+void sha256_update(struct sha256_ctx *ctx, const void *data, size_t len);
+void sha256_final(struct sha256_ctx *ctx, uint8_t digest[SHA256_DIGEST_LEN]);
+
+/* One-shot version of the above */
+void sha256(const void *data, size_t len, uint8_t digest[SHA256_DIGEST_LEN]);
+
+#endif // EBPF_EVENTS_SHA256_H_
@@ -87,6 +87,11 @@ invoke_bluebox() {
         cmd+=" -r $bin"
     done
 
+    # Optional kernel module for TestModuleLoad, built against the kernel under
+    # test and named ebpf_test_module.ko
+    is_empty $EBPF_TEST_MODULE \
+        || cmd+=" -r $EBPF_TEST_MODULE"
+
     $cmd \
         || exit_error "failed to generate initramfs (see above)"
 }
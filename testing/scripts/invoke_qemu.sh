@@ -98,6 +98,11 @@ main() {
         bootparams+=" console=ttyS0"
     fi
 
+    # Scratch directory shared with the guest over virtio-9p, which tests use
+    # as a stand-in for a network filesystem
+    local share=$(mktemp -d)
+    extra_args+=" -virtfs local,path=$share,mount_tag=testshare,security_model=none"
+
     qemu-system-${arch} \
         -nographic -m 1G \
         -kernel $kernel \
@@ -111,6 +116,7 @@ main() {
     trap "kill $qemu_pid && exit 1" SIGINT
     wait $qemu_pid
     trap - SIGINT
+    rm -rf $share
 
     return $ret
 }
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates an IPv4 TCP listening socket on the loopback interface, connects to
+// it twice and accepts the first connection with accept and the second with
+// accept4(SOCK_CLOEXEC), then exits. Used to test the accept_flags of
+// NETWORK_CONNECTION_ACCEPTED events.
+
+#define _GNU_SOURCE
+
+#include <arpa/inet.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2052
+
+int main()
+{
+    int listenfd;
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+
+    // Ensure loopback interface is up, see tcpv4_connect.c
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(listenfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(listenfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sin_family      = AF_INET;
+    addr.sin_addr.s_addr = inet_addr("127.0.0.1");
+    addr.sin_port        = htons(BOUND_PORT);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&addr, sizeof(addr)), -1);
+    CHECK(listen(listenfd, 2), -1);
+
+    int connectfd1, connectfd2;
+    CHECK(connectfd1 = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(connect(connectfd1, (struct sockaddr *)&addr, sizeof(addr)), -1);
+    CHECK(connectfd2 = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(connect(connectfd2, (struct sockaddr *)&addr, sizeof(addr)), -1);
+
+    int acceptfd1, acceptfd2;
+    CHECK(acceptfd1 = accept(listenfd, NULL, NULL), -1);
+    CHECK(acceptfd2 = accept4(listenfd, NULL, NULL, SOCK_CLOEXEC), -1);
+
+    close(acceptfd2);
+    close(acceptfd1);
+    close(connectfd2);
+    close(connectfd1);
+    close(listenfd);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s }\n", pid_info);
+
+    return 0;
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Connects to a private and a public address. Both are added to the loopback
+// interface first, so the connections never leave the machine (and are
+// refused, as nothing's listening, which doesn't matter for the test).
+#include <arpa/inet.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define PORT 2052
+
+static int add_lo_alias(int fd, const char *name, const char *addr)
+{
+    struct ifreq req;
+    memset(&req, 0, sizeof(req));
+    strcpy(req.ifr_name, name);
+
+    struct sockaddr_in *sin = (struct sockaddr_in *)&req.ifr_addr;
+    sin->sin_family         = AF_INET;
+    CHECK(inet_pton(AF_INET, addr, &sin->sin_addr), 0);
+    CHECK(ioctl(fd, SIOCSIFADDR, &req), -1);
+
+    return 0;
+}
+
+static int connect_to(const char *addr)
+{
+    struct sockaddr_in sin;
+    memset(&sin, 0, sizeof(sin));
+    sin.sin_family = AF_INET;
+    sin.sin_port   = htons(PORT);
+    CHECK(inet_pton(AF_INET, addr, &sin.sin_addr), 0);
+
+    int fd;
+    CHECK(fd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    connect(fd, (struct sockaddr *)&sin, sizeof(sin));
+    CHECK(close(fd), -1);
+
+    return 0;
+}
+
+int main()
+{
+    const char *private_addr = "10.1.2.3";
+    const char *public_addr  = "8.8.8.8";
+
+    int fd;
+    CHECK(fd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+
+    // See tcpv4_connect.c
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(fd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(fd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    CHECK(add_lo_alias(fd, "lo:1", private_addr), -1);
+    CHECK(add_lo_alias(fd, "lo:2", public_addr), -1);
+    CHECK(close(fd), -1);
+
+    CHECK(connect_to(private_addr), -1);
+    CHECK(connect_to(public_addr), -1);
+
+    printf("{ \"pid\": %d, \"private_address\": \"%s\", \"public_address\": \"%s\" }\n", getpid(),
+           private_addr, public_addr);
+
+    return 0;
+}
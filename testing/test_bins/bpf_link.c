@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Loads a do-nothing raw tracepoint program and attaches it to sched_switch
+// with BPF_RAW_TRACEPOINT_OPEN, using bpf(2) directly to not depend on libbpf.
+#include <linux/bpf.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define TRACEPOINT "sched_switch"
+
+static int sys_bpf(int cmd, union bpf_attr *attr)
+{
+    return syscall(SYS_bpf, cmd, attr, sizeof(*attr));
+}
+
+int main()
+{
+    // r0 = 0; exit
+    struct bpf_insn insns[] = {
+        {.code = BPF_ALU64 | BPF_MOV | BPF_K, .dst_reg = BPF_REG_0, .imm = 0},
+        {.code = BPF_JMP | BPF_EXIT},
+    };
+
+    union bpf_attr attr;
+    memset(&attr, 0, sizeof(attr));
+    attr.prog_type = BPF_PROG_TYPE_RAW_TRACEPOINT;
+    attr.insns     = (uint64_t)(uintptr_t)insns;
+    attr.insn_cnt  = sizeof(insns) / sizeof(insns[0]);
+    attr.license   = (uint64_t)(uintptr_t) "GPL";
+
+    int prog_fd;
+    CHECK(prog_fd = sys_bpf(BPF_PROG_LOAD, &attr), -1);
+
+    struct bpf_prog_info info;
+    memset(&info, 0, sizeof(info));
+    memset(&attr, 0, sizeof(attr));
+    attr.info.bpf_fd   = prog_fd;
+    attr.info.info_len = sizeof(info);
+    attr.info.info     = (uint64_t)(uintptr_t)&info;
+    CHECK(sys_bpf(BPF_OBJ_GET_INFO_BY_FD, &attr), -1);
+
+    memset(&attr, 0, sizeof(attr));
+    attr.raw_tracepoint.name    = (uint64_t)(uintptr_t)TRACEPOINT;
+    attr.raw_tracepoint.prog_fd = prog_fd;
+
+    int link_fd;
+    CHECK(link_fd = sys_bpf(BPF_RAW_TRACEPOINT_OPEN, &attr), -1);
+
+    printf("{ \"pid\": %d, \"prog_id\": %u, \"target\": \"%s\" }\n", getpid(), info.id, TRACEPOINT);
+
+    CHECK(close(link_fd), -1);
+    CHECK(close(prog_fd), -1);
+
+    return 0;
+}
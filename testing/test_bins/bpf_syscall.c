@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates an array map and loads a do-nothing socket filter program, using
+// bpf(2) directly to not depend on libbpf.
+#include <linux/bpf.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define MAP_NAME "ebpf_test_map"
+#define PROG_NAME "ebpf_test_prog"
+
+static int sys_bpf(int cmd, union bpf_attr *attr)
+{
+    return syscall(SYS_bpf, cmd, attr, sizeof(*attr));
+}
+
+static int obj_id(int fd, void *info, uint32_t info_len)
+{
+    union bpf_attr attr;
+    memset(&attr, 0, sizeof(attr));
+    attr.info.bpf_fd   = fd;
+    attr.info.info_len = info_len;
+    attr.info.info     = (uint64_t)(uintptr_t)info;
+    return sys_bpf(BPF_OBJ_GET_INFO_BY_FD, &attr);
+}
+
+int main()
+{
+    union bpf_attr attr;
+    memset(&attr, 0, sizeof(attr));
+    attr.map_type    = BPF_MAP_TYPE_ARRAY;
+    attr.key_size    = sizeof(uint32_t);
+    attr.value_size  = sizeof(uint64_t);
+    attr.max_entries = 1;
+    strncpy(attr.map_name, MAP_NAME, sizeof(attr.map_name) - 1);
+
+    int map_fd;
+    CHECK(map_fd = sys_bpf(BPF_MAP_CREATE, &attr), -1);
+
+    // r0 = 0; exit
+    struct bpf_insn insns[] = {
+        {.code = BPF_ALU64 | BPF_MOV | BPF_K, .dst_reg = BPF_REG_0, .imm = 0},
+        {.code = BPF_JMP | BPF_EXIT},
+    };
+
+    memset(&attr, 0, sizeof(attr));
+    attr.prog_type = BPF_PROG_TYPE_SOCKET_FILTER;
+    attr.insns     = (uint64_t)(uintptr_t)insns;
+    attr.insn_cnt  = sizeof(insns) / sizeof(insns[0]);
+    attr.license   = (uint64_t)(uintptr_t) "GPL";
+    strncpy(attr.prog_name, PROG_NAME, sizeof(attr.prog_name) - 1);
+
+    int prog_fd;
+    CHECK(prog_fd = sys_bpf(BPF_PROG_LOAD, &attr), -1);
+
+    struct bpf_map_info map_info;
+    memset(&map_info, 0, sizeof(map_info));
+    CHECK(obj_id(map_fd, &map_info, sizeof(map_info)), -1);
+
+    struct bpf_prog_info prog_info;
+    memset(&prog_info, 0, sizeof(prog_info));
+    CHECK(obj_id(prog_fd, &prog_info, sizeof(prog_info)), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"map_id\": %u, \"map_name\": \"%s\", \"prog_id\": %u, "
+           "\"prog_name\": \"%s\" }\n",
+           pid_info, map_info.id, MAP_NAME, prog_info.id, PROG_NAME);
+
+    CHECK(close(prog_fd), -1);
+    CHECK(close(map_fd), -1);
+
+    return 0;
+}
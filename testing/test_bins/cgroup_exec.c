@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a cgroup on the unified hierarchy and spawns a child that moves
+// itself into it, then execs ./do_nothing. No controllers are enabled, so the
+// child stays in the root of the pids controller's hierarchy.
+#include <errno.h>
+#include <fcntl.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *cgroup_root = "/cgroup_exec_cgroup";
+const char *cgroup_dir  = "/cgroup_exec_cgroup/cgroup_exec_test";
+
+int main()
+{
+    int err = 0;
+
+    if (mkdir(cgroup_root, 0700) < 0 && errno != EEXIST) {
+        perror("mkdir");
+        return 1;
+    }
+    CHECK(mount("none", cgroup_root, "cgroup2", 0, NULL), -1);
+    CHECK(mkdir(cgroup_dir, 0700), -1);
+
+    struct stat st;
+    CHECK(stat(cgroup_dir, &st), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        char procs[256];
+        snprintf(procs, sizeof(procs), "%s/cgroup.procs", cgroup_dir);
+
+        // Writing 0 moves the writing process
+        int fd;
+        CHECK(fd = open(procs, O_WRONLY), -1);
+        CHECK(write(fd, "0", 1), -1);
+        CHECK(close(fd), -1);
+        CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child %d did not exit cleanly\n", pid);
+        err = 1;
+        goto cleanup;
+    }
+
+    printf("{ \"child_pid\": %d, \"cgroup_id\": %lu, \"cgroup_path\": \"%s\" }\n", pid,
+           (unsigned long)st.st_ino, cgroup_dir + strlen(cgroup_root));
+
+cleanup:
+    CHECK(rmdir(cgroup_dir), -1);
+    CHECK(umount(cgroup_root), -1);
+    CHECK(rmdir(cgroup_root), -1);
+
+    return err;
+}
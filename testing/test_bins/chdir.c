@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// chdirs into TEST_DIR, then into its subdirectory with a relative path, then
+// back to TEST_DIR with fchdir on an fd opened beforehand.
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define TEST_DIR "/chdir_test"
+#define SUBDIR "sub"
+
+int main()
+{
+    CHECK(mkdir(TEST_DIR, 0755), -1);
+    CHECK(mkdir(TEST_DIR "/" SUBDIR, 0755), -1);
+
+    int dir_fd;
+    CHECK(dir_fd = open(TEST_DIR, O_RDONLY | O_DIRECTORY), -1);
+
+    CHECK(chdir(TEST_DIR), -1);
+    CHECK(chdir(SUBDIR), -1);
+    CHECK(fchdir(dir_fd), -1);
+    CHECK(close(dir_fd), -1);
+
+    CHECK(rmdir(TEST_DIR "/" SUBDIR), -1);
+    CHECK(chdir("/"), -1);
+    CHECK(rmdir(TEST_DIR), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"dir\": \"%s\", \"subdir\": \"%s\" }\n", pid_info, TEST_DIR,
+           TEST_DIR "/" SUBDIR);
+    return 0;
+}
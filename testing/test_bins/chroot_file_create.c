@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Chroots into a directory and creates a file in it. The file is left behind
+// so the test can check it's reachable from outside the chroot.
+#include <errno.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *root_path = "/chroot_file_create";
+    const char *path      = "/chrooted_file";
+
+    if (mkdir(root_path, 0700) < 0 && errno != EEXIST) {
+        perror("mkdir");
+        exit(1);
+    }
+
+    CHECK(chroot(root_path), -1);
+    CHECK(chdir("/"), -1);
+
+    FILE *f;
+    CHECK(f = fopen(path, "w"), NULL);
+    CHECK(fclose(f), EOF);
+
+    printf("{ \"pid\": %d, \"root_path\": \"%s\", \"path\": \"%s\" }\n", getpid(), root_path,
+           path);
+
+    return 0;
+}
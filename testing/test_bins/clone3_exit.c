@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a child sharing the parent's filesystem information and file
+// descriptor table with clone3, which exits immediately, then prints the
+// parent's pid info and the child's pid. Used to test the PROCESS_FORK event
+// of a clone3.
+
+#include <linux/sched.h>
+#include <signal.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    struct clone_args args;
+    memset(&args, 0, sizeof(args));
+    args.flags       = CLONE_FS | CLONE_FILES;
+    args.exit_signal = SIGCHLD;
+
+    // glibc has no clone3 wrapper
+    long pid;
+    CHECK(pid = syscall(SYS_clone3, &args, sizeof(args)), -1);
+
+    if (pid == 0)
+        _exit(0);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"parent_info\": %s, \"child_pid\": %ld }\n", pid_info, pid);
+
+    return 0;
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Does what a container runtime does on `docker exec`: starts a "container"
+// (a process in a cgroup named like a docker container's, in a mount
+// namespace of its own), then, named like a runtime shim, spawns a process
+// that joins the container's cgroup and mount namespace and execs
+// ./do_nothing. The same done before taking the shim's name (as nsenter
+// would), and the container's own process exec'ing ./do_nothing, must not be
+// container execs.
+#define _GNU_SOURCE
+#include <errno.h>
+#include <fcntl.h>
+#include <sched.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/prctl.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define CONTAINER_ID "4f66ad9a0b2e1c6f7b1f0d2e3a5c9b8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b"
+
+const char *cgroup_root = "/container_exec_cgroup";
+const char *cgroup_dir  = "/container_exec_cgroup/docker-" CONTAINER_ID ".scope";
+
+static int write_file(const char *dir, const char *file, const char *buf)
+{
+    char path[256];
+    snprintf(path, sizeof(path), "%s/%s", dir, file);
+
+    int fd;
+    CHECK(fd = open(path, O_WRONLY), -1);
+    CHECK(write(fd, buf, strlen(buf)), -1);
+    CHECK(close(fd), -1);
+
+    return 0;
+}
+
+// Joins the container's cgroup and mount namespace and execs ./do_nothing,
+// only returns on failure
+static int exec_in_container(const char *ns_path)
+{
+    int ns_fd;
+    CHECK(write_file(cgroup_dir, "cgroup.procs", "0"), -1);
+    CHECK(ns_fd = open(ns_path, O_RDONLY), -1);
+    CHECK(setns(ns_fd, CLONE_NEWNS), -1);
+    // Joining a mount namespace moves to its root, where the test binaries
+    // are
+    CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+    return -1;
+}
+
+// Runs exec_in_container in a child and waits for it, returns its pid
+static pid_t spawn_into_container(const char *ns_path, int *wstatus)
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        exec_in_container(ns_path);
+        _exit(1);
+    }
+
+    CHECK(waitpid(pid, wstatus, 0), -1);
+    return pid;
+}
+
+int main()
+{
+    int err = 0;
+
+    if (mkdir(cgroup_root, 0700) < 0 && errno != EEXIST) {
+        perror("mkdir");
+        return 1;
+    }
+    CHECK(mount("none", cgroup_root, "cgroup2", 0, NULL), -1);
+    // Exec events report the pids controller's cgroup
+    CHECK(write_file(cgroup_root, "cgroup.subtree_control", "+pids"), -1);
+    CHECK(mkdir(cgroup_dir, 0700), -1);
+
+    int ready[2], start[2];
+    CHECK(pipe(ready), -1);
+    CHECK(pipe(start), -1);
+
+    char c;
+    pid_t init_pid;
+    CHECK(init_pid = fork(), -1);
+    if (init_pid == 0) {
+        // Writing 0 moves the writing process
+        CHECK(write_file(cgroup_dir, "cgroup.procs", "0"), -1);
+        CHECK(unshare(CLONE_NEWNS), -1);
+        CHECK(write(ready[1], "x", 1), -1);
+        CHECK(read(start[0], &c, 1), -1);
+        CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+    }
+    CHECK(read(ready[0], &c, 1), -1);
+
+    char ns_path[64];
+    snprintf(ns_path, sizeof(ns_path), "/proc/%d/ns/mnt", init_pid);
+
+    int nsenter_wstatus;
+    pid_t nsenter_pid = spawn_into_container(ns_path, &nsenter_wstatus);
+
+    CHECK(prctl(PR_SET_NAME, "containerd-shim"), -1);
+    int wstatus;
+    pid_t pid = spawn_into_container(ns_path, &wstatus);
+    CHECK(write(start[1], "x", 1), -1);
+
+    int init_wstatus;
+    CHECK(waitpid(init_pid, &init_wstatus, 0), -1);
+    if (nsenter_pid < 0 || pid < 0 || !WIFEXITED(nsenter_wstatus) ||
+        WEXITSTATUS(nsenter_wstatus) != 0 || !WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0 ||
+        !WIFEXITED(init_wstatus) || WEXITSTATUS(init_wstatus) != 0) {
+        fprintf(stderr, "child %d, %d or %d did not exit cleanly\n", nsenter_pid, pid, init_pid);
+        err = 1;
+        goto cleanup;
+    }
+
+    printf("{ \"child_pid\": %d, \"nsenter_pid\": %d, \"init_pid\": %d, \"container_id\": "
+           "\"%s\" }\n",
+           pid, nsenter_pid, init_pid, CONTAINER_ID);
+
+cleanup:
+    CHECK(rmdir(cgroup_dir), -1);
+    CHECK(umount(cgroup_root), -1);
+    CHECK(rmdir(cgroup_root), -1);
+
+    return err;
+}
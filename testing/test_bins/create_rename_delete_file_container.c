@@ -17,9 +17,13 @@
 // kernel). This logic is the type of thing that's heavily subject to change
 // between kernel versions, so it's absolutely something we want to test across
 // multiple kernels.
+//
+// The child is also placed in a cgroup named like a containerd container's so
+// the events' container_id can be checked.
 #define _GNU_SOURCE
 
 #include <errno.h>
+#include <fcntl.h>
 #include <ftw.h>
 #include <sched.h>
 #include <stdio.h>
@@ -36,6 +40,11 @@
 
 #define STACK_SIZE (1024 * 1024)
 
+#define CONTAINER_ID "9c1e7d3b5a2f4e6d8c0b1a3f5e7d9c2b4a6f8e0d1c3b5a7f9e2d4c6b8a0f1e3d"
+
+const char *cgroup_root = "/file_container_cgroup";
+const char *cgroup_dir  = "/file_container_cgroup/cri-containerd-" CONTAINER_ID ".scope";
+
 const char *ovl_upperdir = "/ovl_upperdir";
 const char *ovl_lowerdir = "/ovl_lowerdir";
 const char *ovl_workdir  = "/ovl_workdir";
@@ -45,6 +54,19 @@ const char *ovl_mountpoint = "/ovl_mountpoint";
 const char *filename_orig = "foo.txt";
 const char *filename_new  = "bar.txt";
 
+static int write_file(const char *dir, const char *file, const char *buf)
+{
+    char path[256];
+    snprintf(path, sizeof(path), "%s/%s", dir, file);
+
+    int fd;
+    CHECK(fd = open(path, O_WRONLY), -1);
+    CHECK(write(fd, buf, strlen(buf)), -1);
+    CHECK(close(fd), -1);
+
+    return 0;
+}
+
 static int pivot_root(const char *new_root, const char *put_old)
 {
     return syscall(SYS_pivot_root, new_root, put_old);
@@ -119,10 +141,23 @@ int main()
                              MAP_PRIVATE | MAP_ANONYMOUS | MAP_STACK, -1, 0),
           MAP_FAILED);
 
+    if (mkdir(cgroup_root, 0700) < 0 && errno != EEXIST) {
+        perror("mkdir");
+        return 1;
+    }
+    CHECK(mount("none", cgroup_root, "cgroup2", 0, NULL), -1);
+    // File events report the pids controller's cgroup
+    CHECK(write_file(cgroup_root, "cgroup.subtree_control", "+pids"), -1);
+    CHECK(mkdir(cgroup_dir, 0700), -1);
+
+    // The child inherits our cgroup, move back out once it's done
+    CHECK(write_file(cgroup_dir, "cgroup.procs", "0"), -1);
+
     pid_t child_pid;
     CHECK(child_pid = clone(child, child_stack + STACK_SIZE, CLONE_NEWNS | SIGCHLD, NULL), -1);
 
     CHECK(wait(&wstatus), -1);
+    CHECK(write_file(cgroup_root, "cgroup.procs", "0"), -1);
 
     if (WEXITSTATUS(wstatus) != 0) {
         fprintf(stderr, "child exited with nonzero status %d, see errors\n", WEXITSTATUS(wstatus));
@@ -130,8 +165,9 @@ int main()
         goto cleanup;
     }
 
-    printf("{ \"child_pid\": %d, \"filename_orig\": \"/%s\", \"filename_new\": \"/%s\"}\n",
-           child_pid, filename_orig, filename_new);
+    printf("{ \"child_pid\": %d, \"filename_orig\": \"/%s\", \"filename_new\": \"/%s\", "
+           "\"container_id\": \"%s\"}\n",
+           child_pid, filename_orig, filename_new, CONTAINER_ID);
 
 cleanup:
     // Clean up directories created by child
@@ -139,6 +175,9 @@ cleanup:
     CHECK(rm_recursive(ovl_upperdir), -1);
     CHECK(rm_recursive(ovl_lowerdir), -1);
     CHECK(rm_recursive(ovl_workdir), -1);
+    CHECK(rmdir(cgroup_dir), -1);
+    CHECK(umount(cgroup_root), -1);
+    CHECK(rmdir(cgroup_root), -1);
 
     return err;
 }
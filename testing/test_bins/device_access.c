@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Opens a stand-in for an accelerator device in /tmp, which the test has
+// EventsTrace watch as a device directory
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define DEVICE_PATH "/tmp/fake_accel0"
+
+int main()
+{
+    int fd;
+    CHECK(fd = open(DEVICE_PATH, O_RDWR | O_CREAT, 0600), -1);
+    CHECK(close(fd), -1);
+    CHECK(unlink(DEVICE_PATH), -1);
+
+    printf("{ \"pid\": %d, \"path\": \"%s\" }\n", getpid(), DEVICE_PATH);
+
+    return 0;
+}
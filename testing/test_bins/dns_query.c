@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Runs a fake DNS server on 127.0.0.1:53 that answers everything with
+// NXDOMAIN, sends it a datagram too short to be a DNS message and a query cut
+// off in the middle of its name, then looks up example.com with res_query.
+#include <arpa/inet.h>
+#include <arpa/nameser.h>
+#include <net/if.h>
+#include <netdb.h>
+#include <netinet/in.h>
+#include <resolv.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *qname = "example.com";
+
+static int server(int serverfd)
+{
+    // The two bad datagrams, then res_query's query
+    for (int i = 0; i < 3; i++) {
+        unsigned char buf[512];
+        struct sockaddr_in peer;
+        socklen_t len = sizeof(peer);
+        ssize_t n;
+        CHECK(n = recvfrom(serverfd, buf, sizeof(buf), 0, (struct sockaddr *)&peer, &len), -1);
+        if (n < HFIXEDSZ)
+            continue;
+
+        HEADER *hdr = (HEADER *)buf;
+        hdr->qr     = 1;
+        hdr->rcode  = NXDOMAIN;
+        CHECK(sendto(serverfd, buf, n, 0, (struct sockaddr *)&peer, len), -1);
+    }
+
+    return 0;
+}
+
+int main()
+{
+    int serverfd;
+    CHECK(serverfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+
+    // The init in our minimal VM setup doesn't bring loopback up (see
+    // tcpv4_connect.c)
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(serverfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(serverfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr;
+    memset(&serveraddr, 0, sizeof(serveraddr));
+    serveraddr.sin_family      = AF_INET;
+    serveraddr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+    serveraddr.sin_port        = htons(NAMESERVER_PORT);
+    CHECK(bind(serverfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        return server(serverfd);
+
+    int clientfd;
+    CHECK(clientfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+
+    const unsigned char too_short[] = {0x12, 0x34, 0x01};
+    CHECK(sendto(clientfd, too_short, sizeof(too_short), 0, (struct sockaddr *)&serveraddr,
+                 sizeof(serveraddr)),
+          -1);
+
+    // One question, the label claims 7 bytes but only 3 follow
+    const unsigned char cut_off[] = {0x12, 0x34, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00,
+                                     0x00, 0x00, 0x00, 0x00, 0x07, 'e',  'x',  'a'};
+    CHECK(sendto(clientfd, cut_off, sizeof(cut_off), 0, (struct sockaddr *)&serveraddr,
+                 sizeof(serveraddr)),
+          -1);
+
+    // Don't depend on whatever /etc/resolv.conf says
+    CHECK(res_init(), -1);
+    _res.nscount        = 1;
+    _res.nsaddr_list[0] = serveraddr;
+    _res.retry          = 1;
+    _res.options &= ~RES_DEFNAMES & ~RES_DNSRCH;
+
+    unsigned char answer[512];
+    if (res_query(qname, C_IN, T_A, answer, sizeof(answer)) != -1 || h_errno != HOST_NOT_FOUND) {
+        fprintf(stderr, "res_query did not get an NXDOMAIN\n");
+        return 1;
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    printf("{ \"pid\": %d, \"qname\": \"%s\", \"qtype\": \"A\" }\n", getpid(), qname);
+
+    return 0;
+}
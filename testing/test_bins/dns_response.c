@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Runs a fake DNS server on 127.0.0.1:53 and looks up two names with
+// res_query. The first is answered with a CNAME to cdn.example.net and two A
+// and an AAAA record for it, the second with a single A record and the TC bit
+// set.
+#include <arpa/inet.h>
+#include <arpa/nameser.h>
+#include <net/if.h>
+#include <netdb.h>
+#include <netinet/in.h>
+#include <resolv.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *qname           = "example.com";
+const char *truncated_qname = "truncated.example.com";
+
+// cdn.example.net
+static const unsigned char cname[] = {3,   'c', 'd', 'n', 7,   'e', 'x', 'a', 'm',
+                                      'p', 'l', 'e', 3,   'n', 'e', 't', 0};
+
+// Appends a record of class IN, named by a compression pointer to name_off
+static size_t add_record(unsigned char *buf,
+                         size_t off,
+                         size_t name_off,
+                         uint16_t type,
+                         uint32_t ttl,
+                         const void *rdata,
+                         uint16_t rdlength)
+{
+    unsigned char *p = &buf[off];
+    NS_PUT16(0xC000 | name_off, p);
+    NS_PUT16(type, p);
+    NS_PUT16(C_IN, p);
+    NS_PUT32(ttl, p);
+    NS_PUT16(rdlength, p);
+    memcpy(p, rdata, rdlength);
+    return p + rdlength - buf;
+}
+
+static int server(int serverfd)
+{
+    for (int i = 0; i < 2; i++) {
+        unsigned char buf[512];
+        struct sockaddr_in peer;
+        socklen_t len = sizeof(peer);
+        ssize_t n;
+        CHECK(n = recvfrom(serverfd, buf, sizeof(buf), 0, (struct sockaddr *)&peer, &len), -1);
+
+        if (n < HFIXEDSZ)
+            continue;
+
+        // Answers go right after the question, dropping anything the query
+        // had after it (e.g. an EDNS record)
+        size_t off = HFIXEDSZ;
+        while (off < (size_t)n && buf[off] != 0)
+            off += buf[off] + 1;
+        off += 1 + QFIXEDSZ;
+
+        HEADER *hdr  = (HEADER *)buf;
+        hdr->qr      = 1;
+        hdr->ra      = 1;
+        hdr->rcode   = NOERROR;
+        hdr->arcount = 0;
+
+        struct in_addr addr;
+        if (i == 0) {
+            size_t cname_off = off + 12;
+            off              = add_record(buf, off, HFIXEDSZ, T_CNAME, 300, cname, sizeof(cname));
+
+            inet_pton(AF_INET, "192.0.2.1", &addr);
+            off = add_record(buf, off, cname_off, T_A, 60, &addr, sizeof(addr));
+            inet_pton(AF_INET, "192.0.2.2", &addr);
+            off = add_record(buf, off, cname_off, T_A, 60, &addr, sizeof(addr));
+
+            struct in6_addr addr6;
+            inet_pton(AF_INET6, "2001:db8::1", &addr6);
+            off          = add_record(buf, off, cname_off, T_AAAA, 60, &addr6, sizeof(addr6));
+            hdr->ancount = htons(4);
+        } else {
+            inet_pton(AF_INET, "192.0.2.3", &addr);
+            off          = add_record(buf, off, HFIXEDSZ, T_A, 60, &addr, sizeof(addr));
+            hdr->ancount = htons(1);
+            hdr->tc      = 1;
+        }
+
+        CHECK(sendto(serverfd, buf, off, 0, (struct sockaddr *)&peer, len), -1);
+    }
+
+    return 0;
+}
+
+int main()
+{
+    int serverfd;
+    CHECK(serverfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+
+    // The init in our minimal VM setup doesn't bring loopback up (see
+    // tcpv4_connect.c)
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(serverfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(serverfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr;
+    memset(&serveraddr, 0, sizeof(serveraddr));
+    serveraddr.sin_family      = AF_INET;
+    serveraddr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+    serveraddr.sin_port        = htons(NAMESERVER_PORT);
+    CHECK(bind(serverfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        return server(serverfd);
+
+    // Don't depend on whatever /etc/resolv.conf says. The truncated response
+    // is taken as is rather than retried over TCP.
+    CHECK(res_init(), -1);
+    _res.nscount        = 1;
+    _res.nsaddr_list[0] = serveraddr;
+    _res.retry          = 1;
+    _res.options &= ~RES_DEFNAMES & ~RES_DNSRCH;
+    _res.options |= RES_IGNTC;
+
+    unsigned char answer[512];
+    CHECK(res_query(qname, C_IN, T_A, answer, sizeof(answer)), -1);
+    CHECK(res_query(truncated_qname, C_IN, T_A, answer, sizeof(answer)), -1);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    printf("{ \"pid\": %d, \"qname\": \"%s\", \"cname\": \"cdn.example.net\", \"addresses\": "
+           "[\"192.0.2.1\", \"192.0.2.2\", \"2001:db8::1\"], \"truncated_qname\": \"%s\", "
+           "\"truncated_address\": \"192.0.2.3\" }\n",
+           getpid(), qname, truncated_qname);
+
+    return 0;
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Writes a copy of ./do_nothing to a new file and has a child execute it,
+// i.e. "drops" a binary and runs it.
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *path = "/tmp/dropped";
+    char buf[4096];
+
+    int in, out;
+    CHECK(in = open("./do_nothing", O_RDONLY), -1);
+    CHECK(out = open(path, O_WRONLY | O_CREAT | O_TRUNC, 0755), -1);
+
+    ssize_t n;
+    while ((n = read(in, buf, sizeof(buf))) > 0)
+        CHECK(write(out, buf, n), -1);
+    CHECK(n, -1);
+
+    // Must be closed before the exec, or it fails with ETXTBSY
+    CHECK(close(in), -1);
+    CHECK(close(out), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        CHECK(execl(path, path, NULL), -1);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    printf("{ \"writer_pid\": %d, \"executor_pid\": %d, \"path\": \"%s\" }\n", getpid(), pid,
+           path);
+
+    CHECK(unlink(path), -1);
+
+    return 0;
+}
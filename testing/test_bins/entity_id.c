@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks a child that re-execs this binary to create and delete a file, then
+// exits. Once the child has been reaped, forks another child that is forced
+// to reuse the first child's pid (via /proc/sys/kernel/ns_last_pid), so the
+// entity IDs of the two can be compared.
+#include <stdio.h>
+#include <string.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define PID_REUSE_ATTEMPTS 100
+
+const char *filename = "/entity_id_test.txt";
+
+static int child()
+{
+    FILE *f;
+    CHECK(f = fopen(filename, "w"), NULL);
+    CHECK(fclose(f), EOF);
+    CHECK(unlink(filename), -1);
+
+    return 0;
+}
+
+static int set_last_pid(pid_t pid)
+{
+    FILE *f;
+    CHECK(f = fopen("/proc/sys/kernel/ns_last_pid", "w"), NULL);
+    CHECK(fprintf(f, "%d", pid), -1);
+    CHECK(fclose(f), EOF);
+
+    return 0;
+}
+
+int main(int argc, char **argv)
+{
+    if (argc > 1 && strcmp(argv[1], "child") == 0)
+        return child();
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        CHECK(execl("./entity_id", "./entity_id", "child", NULL), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child exited abnormally, see errors\n");
+        return 1;
+    }
+
+    // Something else on the system may grab the pid between us setting
+    // ns_last_pid and forking, so try a few times
+    pid_t reused_pid = -1;
+    for (int i = 0; i < PID_REUSE_ATTEMPTS && reused_pid != pid; i++) {
+        CHECK(set_last_pid(pid - 1), -1);
+        CHECK(reused_pid = fork(), -1);
+        if (reused_pid == 0)
+            return 0;
+        CHECK(waitpid(reused_pid, &wstatus, 0), -1);
+    }
+
+    if (reused_pid != pid) {
+        fprintf(stderr, "could not reuse pid %d\n", pid);
+        return 1;
+    }
+
+    printf("{ \"child_pid\": %d, \"filename\": \"%s\" }\n", pid, filename);
+    return 0;
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Copies ./do_nothing onto a tmpfs and onto the 9p share set up by
+// invoke_qemu.sh (a stand-in for a network filesystem) and execs both copies.
+// The 9p part is reported as skipped if the share can't be mounted (e.g. the
+// kernel lacks 9p support).
+#include <fcntl.h>
+#include <stdbool.h>
+#include <stdio.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static int copy_file(const char *from, const char *to)
+{
+    int in, out;
+    CHECK(in = open(from, O_RDONLY), -1);
+    CHECK(out = open(to, O_WRONLY | O_CREAT | O_TRUNC, 0755), -1);
+
+    char buf[4096];
+    ssize_t n;
+    while ((n = read(in, buf, sizeof(buf))) > 0)
+        CHECK(write(out, buf, n), -1);
+    CHECK(n, -1);
+
+    CHECK(close(in), -1);
+    CHECK(close(out), -1);
+
+    return 0;
+}
+
+static pid_t run_from(const char *dir)
+{
+    char path[256];
+    snprintf(path, sizeof(path), "%s/do_nothing", dir);
+    CHECK(copy_file("./do_nothing", path), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        CHECK(execl(path, path, NULL), -1);
+        return -1;
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    CHECK(unlink(path), -1);
+
+    return pid;
+}
+
+int main()
+{
+    const char *tmpfs_dir = "/tmp/exe_fs_type_tmpfs";
+    const char *netfs_dir = "/tmp/exe_fs_type_netfs";
+
+    CHECK(mkdir(tmpfs_dir, 0755), -1);
+    CHECK(mount("tmpfs", tmpfs_dir, "tmpfs", 0, NULL), -1);
+
+    pid_t tmpfs_pid;
+    CHECK(tmpfs_pid = run_from(tmpfs_dir), -1);
+    CHECK(umount(tmpfs_dir), -1);
+
+    CHECK(mkdir(netfs_dir, 0755), -1);
+    bool netfs_skipped =
+        mount("testshare", netfs_dir, "9p", 0, "trans=virtio,version=9p2000.L") == -1;
+
+    pid_t netfs_pid = 0;
+    if (!netfs_skipped) {
+        CHECK(netfs_pid = run_from(netfs_dir), -1);
+        CHECK(umount(netfs_dir), -1);
+    }
+
+    printf("{ \"tmpfs_pid\": %d, \"netfs_pid\": %d, \"netfs_skipped\": %s }\n", tmpfs_pid,
+           netfs_pid, netfs_skipped ? "true" : "false");
+
+    return 0;
+}
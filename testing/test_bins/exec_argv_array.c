@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Execs ./do_nothing twice, once with arguments a flattened argv can't tell
+// apart (embedded spaces, an empty argument) and once with an argument longer
+// than the probes capture.
+#include <stdio.h>
+#include <string.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define LONG_ARG_LEN 10000
+
+static pid_t spawn(char *const argv[])
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        CHECK(execv("./do_nothing", argv), -1);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    return pid;
+}
+
+int main()
+{
+    char *spaced_argv[] = {"./do_nothing", "two words", "", " padded ", NULL};
+    pid_t spaced_pid    = spawn(spaced_argv);
+
+    static char long_arg[LONG_ARG_LEN + 1];
+    memset(long_arg, 'a', LONG_ARG_LEN);
+    char *long_argv[] = {"./do_nothing", long_arg, NULL};
+    pid_t long_pid    = spawn(long_argv);
+
+    printf("{ \"spaced_pid\": %d, \"long_pid\": %d }\n", spaced_pid, long_pid);
+    return 0;
+}
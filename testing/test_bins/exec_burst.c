@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Spawns a burst of processes that exec ./do_nothing and immediately exit,
+// i.e. that are long gone by the time their exec events are read in userspace.
+// Processes are spawned one after the other rather than all at once so the
+// test measures whether exec data is complete, not whether the ringbuffer can
+// absorb a few hundred exec events at once.
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define N_PROCS 250
+
+int main()
+{
+    pid_t pids[N_PROCS];
+
+    for (int i = 0; i < N_PROCS; i++) {
+        CHECK(pids[i] = fork(), -1);
+
+        if (pids[i] == 0) {
+            char arg[16];
+            snprintf(arg, sizeof(arg), "%d", i);
+            CHECK(execl("./do_nothing", "./do_nothing", "burst", arg, NULL), -1);
+        }
+
+        int wstatus;
+        CHECK(waitpid(pids[i], &wstatus, 0), -1);
+    }
+
+    printf("{ \"child_pids\": [");
+    for (int i = 0; i < N_PROCS; i++)
+        printf("%s%d", i == 0 ? "" : ", ", pids[i]);
+    printf("] }\n");
+
+    return 0;
+}
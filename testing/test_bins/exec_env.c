@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Execs ./do_nothing with a known environment
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        char *argv[] = {"./do_nothing", NULL};
+        char *envp[] = {"FOO=bar", "SPACED=a b", NULL};
+        CHECK(execve("./do_nothing", argv, envp), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    printf("{ \"child_pid\": %d }\n", pid);
+    return 0;
+}
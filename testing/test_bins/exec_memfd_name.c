@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Copies ./do_nothing to a regular file named like a memfd's dentry,
+// "memfd:<name>", and execs it from there with execveat(AT_EMPTY_PATH) in a
+// child, the same way execveat_memfd does with an actual memfd.
+#define _GNU_SOURCE
+
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *path = "./memfd:exec_memfd_name";
+
+int main()
+{
+    int src, dst;
+    CHECK(src = open("./do_nothing", O_RDONLY), -1);
+    CHECK(dst = open(path, O_WRONLY | O_CREAT | O_TRUNC, 0755), -1);
+
+    char buf[4096];
+    ssize_t n;
+    do {
+        CHECK(n = read(src, buf, sizeof(buf)), -1);
+        CHECK(write(dst, buf, n), -1);
+    } while (n > 0);
+    CHECK(close(src), -1);
+    CHECK(close(dst), -1);
+
+    int fd;
+    CHECK(fd = open(path, O_RDONLY | O_CLOEXEC), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        char *argv[] = {"do_nothing", NULL};
+        char *envp[] = {NULL};
+        CHECK(syscall(SYS_execveat, fd, "", argv, envp, AT_EMPTY_PATH), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    CHECK(unlink(path), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child %d did not exit cleanly\n", pid);
+        return 1;
+    }
+
+    printf("{ \"child_pid\": %d }\n", pid);
+    return 0;
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Execs three #! scripts, each in its own child, all eventually run by
+// /do_nothing (there's no shell in the test environment):
+//
+// - /shebang_script, a plain "#!/do_nothing" script
+// - /shebang_nested, whose interpreter is /shebang_script
+// - /shebang_env, a "#!/usr/bin/env /do_nothing" script. If there's no
+//   /usr/bin/env, it's symlinked to this binary, which acts like env when run
+//   as such.
+#define _GNU_SOURCE
+
+#include <errno.h>
+#include <fcntl.h>
+#include <libgen.h>
+#include <stdbool.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define SCRIPT "/shebang_script"
+#define NESTED "/shebang_nested"
+#define ENV_SCRIPT "/shebang_env"
+#define ENV "/usr/bin/env"
+
+static int write_script(const char *path, const char *contents)
+{
+    int fd;
+    CHECK(fd = open(path, O_WRONLY | O_CREAT | O_TRUNC, 0755), -1);
+    CHECK(write(fd, contents, strlen(contents)), -1);
+    CHECK(close(fd), -1);
+    return 0;
+}
+
+static pid_t run_script(const char *path)
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        CHECK(execl(path, path, NULL), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child %d running %s did not exit cleanly\n", pid, path);
+        return -1;
+    }
+
+    return pid;
+}
+
+int main(int argc, char **argv)
+{
+    // Run as the interpreter of /shebang_env: argv is env, the command and
+    // the script
+    if (strcmp(basename(argv[0]), "env") == 0) {
+        if (argc < 2)
+            return 1;
+        CHECK(execv(argv[1], argv + 1), -1);
+    }
+
+    CHECK(write_script(SCRIPT, "#!/do_nothing\n"), -1);
+    CHECK(write_script(NESTED, "#!" SCRIPT "\n"), -1);
+    CHECK(write_script(ENV_SCRIPT, "#!" ENV " /do_nothing\n"), -1);
+
+    bool created_env = false;
+    if (access(ENV, X_OK) != 0) {
+        char self[4096];
+        ssize_t n;
+        CHECK(n = readlink("/proc/self/exe", self, sizeof(self) - 1), -1);
+        self[n] = '\0';
+
+        if (mkdir("/usr", 0755) != 0 && errno != EEXIST) {
+            perror("mkdir /usr");
+            return -1;
+        }
+        if (mkdir("/usr/bin", 0755) != 0 && errno != EEXIST) {
+            perror("mkdir /usr/bin");
+            return -1;
+        }
+        CHECK(symlink(self, ENV), -1);
+        created_env = true;
+    }
+
+    pid_t script_pid, nested_pid, env_pid;
+    CHECK(script_pid = run_script(SCRIPT), -1);
+    CHECK(nested_pid = run_script(NESTED), -1);
+    CHECK(env_pid = run_script(ENV_SCRIPT), -1);
+
+    if (created_env)
+        CHECK(unlink(ENV), -1);
+    CHECK(unlink(SCRIPT), -1);
+    CHECK(unlink(NESTED), -1);
+    CHECK(unlink(ENV_SCRIPT), -1);
+
+    printf("{ \"script_pid\": %d, \"nested_pid\": %d, \"env_pid\": %d }\n", script_pid,
+           nested_pid, env_pid);
+    return 0;
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Copies ./do_nothing into a memfd and execs it from there with
+// execveat(AT_EMPTY_PATH) in a child, i.e. without the executed file ever
+// existing on a filesystem.
+#define _GNU_SOURCE
+
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/mman.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    int src, memfd;
+    CHECK(src = open("./do_nothing", O_RDONLY), -1);
+    CHECK(memfd = memfd_create("execveat_memfd", MFD_CLOEXEC), -1);
+
+    char buf[4096];
+    ssize_t n;
+    do {
+        CHECK(n = read(src, buf, sizeof(buf)), -1);
+        CHECK(write(memfd, buf, n), -1);
+    } while (n > 0);
+    CHECK(close(src), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        char *argv[] = {"do_nothing", NULL};
+        char *envp[] = {NULL};
+        CHECK(syscall(SYS_execveat, memfd, "", argv, envp, AT_EMPTY_PATH), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child %d did not exit cleanly\n", pid);
+        return 1;
+    }
+
+    printf("{ \"child_pid\": %d }\n", pid);
+    return 0;
+}
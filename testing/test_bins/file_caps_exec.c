@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Makes a copy of ./do_nothing with the file capabilities cap_net_raw+ep,
+// then, as an unprivileged user, execs the copy followed by ./do_nothing
+// itself. The first exec should start with CAP_NET_RAW, the second with no
+// capabilities at all.
+#include <errno.h>
+#include <fcntl.h>
+#include <linux/capability.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <sys/xattr.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *caps_path = "./do_nothing_net_raw";
+const uid_t unpriv_id = 1000;
+
+static int copy_file(const char *src, const char *dst)
+{
+    int src_fd, dst_fd;
+    char buf[4096];
+    ssize_t n;
+
+    CHECK(src_fd = open(src, O_RDONLY), -1);
+    CHECK(dst_fd = open(dst, O_WRONLY | O_CREAT | O_TRUNC, 0755), -1);
+
+    while ((n = read(src_fd, buf, sizeof(buf))) > 0)
+        CHECK(write(dst_fd, buf, n), -1);
+    CHECK(n, -1);
+
+    CHECK(close(src_fd), -1);
+    CHECK(close(dst_fd), -1);
+
+    return 0;
+}
+
+static pid_t fork_exec_unpriv(const char *path)
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+
+    if (pid == 0) {
+        // Dropping all root uids clears the permitted and effective sets
+        CHECK(setresgid(unpriv_id, unpriv_id, unpriv_id), -1);
+        CHECK(setresuid(unpriv_id, unpriv_id, unpriv_id), -1);
+        CHECK(execl(path, path, NULL), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    return pid;
+}
+
+int main()
+{
+    int err = 0;
+    pid_t caps_pid, nocaps_pid;
+
+    CHECK(copy_file("./do_nothing", caps_path), -1);
+
+    struct vfs_cap_data cap_data = {
+        .magic_etc = VFS_CAP_REVISION_2 | VFS_CAP_FLAGS_EFFECTIVE,
+        .data      = {{.permitted = 1 << CAP_NET_RAW}},
+    };
+    if (setxattr(caps_path, "security.capability", &cap_data, XATTR_CAPS_SZ_2, 0) < 0) {
+        if (errno != ENOTSUP) {
+            perror("setxattr");
+            err = 1;
+            goto out;
+        }
+
+        // e.g. the initramfs is on a ramfs, which has no xattr support
+        printf("{ \"xattr_supported\": false }\n");
+        goto out;
+    }
+
+    if ((caps_pid = fork_exec_unpriv(caps_path)) < 0 ||
+        (nocaps_pid = fork_exec_unpriv("./do_nothing")) < 0) {
+        err = 1;
+        goto out;
+    }
+
+    printf("{ \"xattr_supported\": true, \"caps_pid\": %d, \"nocaps_pid\": %d }\n", caps_pid,
+           nocaps_pid);
+
+out:
+    CHECK(unlink(caps_path), -1);
+    return err;
+}
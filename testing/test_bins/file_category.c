@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a text file and then a shell script, in that order. Used to test
+// filtering file events by category.
+#include <stdio.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *text_path   = "/tmp/file_category.txt";
+    const char *script_path = "/tmp/file_category.sh";
+
+    FILE *f;
+    CHECK(f = fopen(text_path, "w"), NULL);
+    CHECK(fputs("hello\n", f), EOF);
+    CHECK(fclose(f), EOF);
+
+    CHECK(f = fopen(script_path, "w"), NULL);
+    CHECK(fputs("#!/bin/sh\necho hello\n", f), EOF);
+    CHECK(fclose(f), EOF);
+
+    printf("{ \"pid\": %d, \"text_path\": \"%s\", \"script_path\": \"%s\" }\n", getpid(),
+           text_path, script_path);
+
+    CHECK(unlink(text_path), -1);
+    CHECK(unlink(script_path), -1);
+
+    return 0;
+}
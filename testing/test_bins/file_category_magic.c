@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Renames a FIFO and then a shell script, in that order, both to paths without
+// an extension so they can only be classified by their contents. The files
+// are left behind for the test to remove, they must still be there when
+// EventsTrace reads them.
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *fifo_tmp_path   = "/tmp/file_category_magic_fifo.tmp";
+    const char *fifo_path       = "/tmp/file_category_magic_fifo";
+    const char *script_tmp_path = "/tmp/file_category_magic_script.tmp";
+    const char *script_path     = "/tmp/file_category_magic_script";
+
+    CHECK(mkfifo(fifo_tmp_path, 0644), -1);
+    CHECK(rename(fifo_tmp_path, fifo_path), -1);
+
+    FILE *f;
+    CHECK(f = fopen(script_tmp_path, "w"), NULL);
+    CHECK(fputs("#!/bin/sh\necho hello\n", f), EOF);
+    CHECK(fclose(f), EOF);
+    CHECK(rename(script_tmp_path, script_path), -1);
+
+    printf("{ \"pid\": %d, \"fifo_path\": \"%s\", \"script_path\": \"%s\" }\n", getpid(),
+           fifo_path, script_path);
+
+    return 0;
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a file and chmods it through a path relative to the cwd, which
+// should be reported resolved.
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *dir      = "/tmp";
+    const char *filename = "chmod_target";
+    const mode_t mode    = 04750;
+
+    CHECK(chdir(dir), -1);
+
+    int fd;
+    CHECK(fd = open(filename, O_CREAT | O_WRONLY | O_TRUNC, 0600), -1);
+    CHECK(close(fd), -1);
+
+    struct stat st;
+    CHECK(stat(filename, &st), -1);
+    CHECK(chmod(filename, mode), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"path\": \"%s/%s\", \"old_mode\": %u, \"new_mode\": %u }\n",
+           pid_info, dir, filename, st.st_mode & 07777, mode);
+
+    CHECK(unlink(filename), -1);
+
+    return 0;
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a file and chowns it with fchownat through a path relative to the
+// cwd, which should be reported resolved. Needs CAP_CHOWN.
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *dir      = "/tmp";
+    const char *filename = "chown_target";
+    const uid_t uid      = 1234;
+    const gid_t gid      = 5678;
+
+    CHECK(chdir(dir), -1);
+
+    int fd;
+    CHECK(fd = open(filename, O_CREAT | O_WRONLY | O_TRUNC, 0644), -1);
+    CHECK(close(fd), -1);
+
+    struct stat st;
+    CHECK(stat(filename, &st), -1);
+    CHECK(fchownat(AT_FDCWD, filename, uid, gid, 0), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"path\": \"%s/%s\", \"old_uid\": %u, \"new_uid\": %u, "
+           "\"old_gid\": %u, \"new_gid\": %u }\n",
+           pid_info, dir, filename, st.st_uid, uid, st.st_gid, gid);
+
+    CHECK(unlink(filename), -1);
+
+    return 0;
+}
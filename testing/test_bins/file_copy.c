@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// sendfile()'s a file to a TCP socket connected over the loopback interface,
+// then splice()'s data from one pipe to another. Used to test file copy
+// events.
+#define _GNU_SOURCE
+#include <arpa/inet.h>
+#include <fcntl.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/sendfile.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2050
+#define SENDFILE_BYTES 1000
+#define SPLICE_BYTES 100
+
+int main()
+{
+    const char *src_path = "/tmp/file_copy_src";
+    char buf[SENDFILE_BYTES];
+    memset(buf, 'A', sizeof(buf));
+
+    int srcfd;
+    CHECK(srcfd = open(src_path, O_RDWR | O_CREAT | O_TRUNC, 0644), -1);
+    CHECK(write(srcfd, buf, SENDFILE_BYTES), -1);
+    CHECK(lseek(srcfd, 0, SEEK_SET), -1);
+
+    int connectfd;
+    CHECK(connectfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+
+    // Ensure loopback interface is up, see tcpv4_connect.c
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(connectfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(connectfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr;
+    memset(&serveraddr, 0, sizeof(serveraddr));
+    serveraddr.sin_family      = AF_INET;
+    serveraddr.sin_addr.s_addr = htonl(INADDR_ANY);
+    serveraddr.sin_port        = htons((unsigned short)BOUND_PORT);
+
+    int listenfd;
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+    CHECK(listen(listenfd, 1), -1);
+
+    struct sockaddr_in clientaddr;
+    memset(&clientaddr, 0, sizeof(clientaddr));
+    clientaddr.sin_family      = AF_INET;
+    clientaddr.sin_addr.s_addr = inet_addr("127.0.0.1");
+    clientaddr.sin_port        = htons(BOUND_PORT);
+    CHECK(connect(connectfd, (struct sockaddr *)&clientaddr, sizeof(clientaddr)), -1);
+
+    int acceptfd;
+    struct sockaddr_in acceptaddr;
+    socklen_t sz = sizeof(acceptaddr);
+    CHECK(acceptfd = accept(listenfd, (struct sockaddr *)&acceptaddr, &sz), -1);
+
+    ssize_t sent;
+    CHECK(sent = sendfile(connectfd, srcfd, NULL, SENDFILE_BYTES), -1);
+
+    int pipe_in[2], pipe_out[2];
+    CHECK(pipe(pipe_in), -1);
+    CHECK(pipe(pipe_out), -1);
+    CHECK(write(pipe_in[1], buf, SPLICE_BYTES), -1);
+
+    ssize_t spliced;
+    CHECK(spliced = splice(pipe_in[0], NULL, pipe_out[1], NULL, SPLICE_BYTES, 0), -1);
+
+    struct stat pipe_in_stat, pipe_out_stat;
+    CHECK(fstat(pipe_in[0], &pipe_in_stat), -1);
+    CHECK(fstat(pipe_out[1], &pipe_out_stat), -1);
+
+    printf("{ \"pid\": %d, \"src_path\": \"%s\", \"sendfile_bytes\": %zd, \"client_port\": %d, "
+           "\"server_port\": %d, \"splice_bytes\": %zd, \"pipe_in_inode\": %lu, "
+           "\"pipe_out_inode\": %lu }\n",
+           getpid(), src_path, sent, ntohs(acceptaddr.sin_port), BOUND_PORT, spliced,
+           (unsigned long)pipe_in_stat.st_ino, (unsigned long)pipe_out_stat.st_ino);
+
+    close(acceptfd);
+    close(connectfd);
+    close(listenfd);
+    close(srcfd);
+    CHECK(unlink(src_path), -1);
+
+    return 0;
+}
@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates and deletes N_FILES files as fast as it can, far more FILE_CREATE
+// events than fit in the ringbuffer if nothing is reading it.
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define N_FILES 2000
+
+int main()
+{
+    for (int i = 0; i < N_FILES; i++) {
+        char path[64];
+        snprintf(path, sizeof(path), "/file_flood_%d", i);
+
+        int fd;
+        CHECK(fd = open(path, O_RDWR | O_CREAT, 0644), -1);
+        CHECK(close(fd), -1);
+        CHECK(unlink(path), -1);
+    }
+
+    printf("{ \"pid\": %d, \"count\": %d }\n", getpid(), N_FILES);
+    return 0;
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a file and a hardlink to it, through paths relative to the cwd,
+// which should both be reported resolved.
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *dir      = "/tmp";
+    const char *target   = "hardlink_target";
+    const char *linkname = "hardlink_test";
+
+    CHECK(chdir(dir), -1);
+
+    int fd;
+    CHECK(fd = open(target, O_CREAT | O_WRONLY | O_TRUNC, 0644), -1);
+    CHECK(close(fd), -1);
+    CHECK(link(target, linkname), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"target_path\": \"%s/%s\", \"link_path\": \"%s/%s\" }\n",
+           pid_info, dir, target, dir, linkname);
+
+    CHECK(unlink(linkname), -1);
+    CHECK(unlink(target), -1);
+
+    return 0;
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a file of a known size, hardlinks it and deletes the original path,
+// leaving the link behind for the testrunner to stat and delete. Used to test
+// the inode information of FILE_CREATE and FILE_DELETE events.
+
+#include <fcntl.h>
+#include <string.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define PATH "/file_inode_test"
+#define LINK_PATH "/file_inode_test_link"
+#define SIZE 12345
+
+int main()
+{
+    char buf[SIZE];
+    memset(buf, 'x', sizeof(buf));
+
+    int fd;
+    CHECK(fd = open(PATH, O_WRONLY | O_CREAT | O_TRUNC, 0644), -1);
+    CHECK(write(fd, buf, sizeof(buf)), -1);
+    CHECK(close(fd), -1);
+
+    unlink(LINK_PATH);
+    CHECK(link(PATH, LINK_PATH), -1);
+    CHECK(unlink(PATH), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"path\": \"%s\", \"link_path\": \"%s\", \"size\": %d }\n",
+           pid_info, PATH, LINK_PATH, SIZE);
+
+    return 0;
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Opens / (outside of the prefix the test restricts opens to), then creates
+// TEST_FILE with O_RDWR | O_CREAT.
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define TEST_FILE "/file_open_test"
+#define MODE 0640
+
+int main()
+{
+    int fd;
+    CHECK(fd = open("/", O_RDONLY | O_DIRECTORY), -1);
+    CHECK(close(fd), -1);
+
+    CHECK(fd = open(TEST_FILE, O_RDWR | O_CREAT, MODE), -1);
+    CHECK(close(fd), -1);
+    CHECK(unlink(TEST_FILE), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"path\": \"%s\", \"mode\": %d }\n", pid_info, TEST_FILE, MODE);
+    return 0;
+}
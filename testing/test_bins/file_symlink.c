@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a dangling symlink through a path relative to the cwd. The target is
+// reported as given, the link path resolved.
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *dir      = "/tmp";
+    const char *target   = "symlink_target_does_not_exist";
+    const char *linkname = "symlink_test";
+
+    CHECK(chdir(dir), -1);
+    CHECK(symlinkat(target, AT_FDCWD, linkname), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"target_path\": \"%s\", \"link_path\": \"%s/%s\" }\n", pid_info,
+           target, dir, linkname);
+
+    CHECK(unlink(linkname), -1);
+
+    return 0;
+}
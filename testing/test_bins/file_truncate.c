@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Writes 100 bytes to a file, shrinks it to 10 with ftruncate, grows it to 50
+// with truncate, then deletes it. Used to test FILE_TRUNCATE events.
+
+#include <fcntl.h>
+#include <string.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define PATH "/file_truncate_test"
+
+int main()
+{
+    char buf[100];
+    memset(buf, 'x', sizeof(buf));
+
+    int fd;
+    CHECK(fd = open(PATH, O_RDWR | O_CREAT | O_TRUNC, 0644), -1);
+    CHECK(write(fd, buf, sizeof(buf)), -1);
+    CHECK(ftruncate(fd, 10), -1);
+    CHECK(close(fd), -1);
+
+    CHECK(truncate(PATH, 50), -1);
+    CHECK(unlink(PATH), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"path\": \"%s\" }\n", pid_info, PATH);
+
+    return 0;
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Does what a container runtime does to run a process in a container: joins
+// the container's mount namespace (here that of a child that unshared one)
+// with setns, then forks a process that execs ./do_nothing.
+#define _GNU_SOURCE
+#include <fcntl.h>
+#include <limits.h>
+#include <sched.h>
+#include <signal.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static ino_t mntns_inode()
+{
+    struct stat st;
+    if (stat("/proc/self/ns/mnt", &st) < 0)
+        return 0;
+    return st.st_ino;
+}
+
+int main()
+{
+    char cwd[PATH_MAX];
+    CHECK(getcwd(cwd, sizeof(cwd)), NULL);
+
+    int ready[2];
+    CHECK(pipe(ready), -1);
+
+    pid_t holder;
+    CHECK(holder = fork(), -1);
+    if (holder == 0) {
+        CHECK(unshare(CLONE_NEWNS), -1);
+        CHECK(write(ready[1], "x", 1), -1);
+        pause();
+        return 0;
+    }
+
+    char c;
+    CHECK(read(ready[0], &c, 1), -1);
+
+    char ns_path[64];
+    snprintf(ns_path, sizeof(ns_path), "/proc/%d/ns/mnt", holder);
+    int ns_fd;
+    CHECK(ns_fd = open(ns_path, O_RDONLY), -1);
+
+    ino_t old_mntns = mntns_inode();
+    CHECK(setns(ns_fd, CLONE_NEWNS), -1);
+    ino_t new_mntns = mntns_inode();
+    CHECK(close(ns_fd), -1);
+
+    // Joining a mount namespace moves to its root, the namespace being a copy
+    // of ours the directory we were in is still there
+    CHECK(chdir(cwd), -1);
+
+    pid_t child;
+    CHECK(child = fork(), -1);
+    if (child == 0)
+        CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+
+    CHECK(waitpid(child, NULL, 0), -1);
+    CHECK(kill(holder, SIGKILL), -1);
+    CHECK(waitpid(holder, NULL, 0), -1);
+
+    printf("{ \"pid\": %d, \"child_pid\": %d, \"old_mntns\": %lu, \"new_mntns\": %lu }\n", getpid(),
+           child, (unsigned long)old_mntns, (unsigned long)new_mntns);
+
+    return 0;
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Pins itself to CPU 0 and forks a burst of children that exit immediately,
+// generating many fork/exit events on the same CPU in quick succession, which
+// is where events with identical or near-identical timestamps show up.
+#define _GNU_SOURCE
+#include <sched.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define N_PROCS 100
+
+int main()
+{
+    cpu_set_t set;
+    CPU_ZERO(&set);
+    CPU_SET(0, &set);
+    CHECK(sched_setaffinity(0, sizeof(set), &set), -1);
+
+    for (int i = 0; i < N_PROCS; i++) {
+        pid_t pid;
+        CHECK(pid = fork(), -1);
+
+        if (pid == 0)
+            exit(0);
+
+        int wstatus;
+        CHECK(waitpid(pid, &wstatus, 0), -1);
+    }
+
+    printf("{ \"pid\": %d, \"cpu\": 0, \"n_procs\": %d }\n", getpid(), N_PROCS);
+
+    return 0;
+}
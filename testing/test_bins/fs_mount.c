@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Mounts a tmpfs on a temporary directory, through a path relative to the cwd,
+// then umounts it. Done in a new mount namespace so nothing leaks out.
+#define _GNU_SOURCE
+#include <limits.h>
+#include <sched.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/mount.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    CHECK(unshare(CLONE_NEWNS), -1);
+    CHECK(mount(NULL, "/", NULL, MS_REC | MS_PRIVATE, NULL), -1);
+
+    char dir[] = "/tmp/fs_mount_XXXXXX";
+    CHECK(mkdtemp(dir), NULL);
+    CHECK(chdir("/tmp"), -1);
+
+    const char *relative_dir  = dir + sizeof("/tmp/") - 1;
+    const unsigned long flags = MS_NOSUID | MS_NODEV;
+    CHECK(mount("fs_mount_source", relative_dir, "tmpfs", flags, NULL), -1);
+    CHECK(umount2(relative_dir, 0), -1);
+    CHECK(rmdir(dir), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"source\": \"fs_mount_source\", \"destination\": \"%s\", "
+           "\"flags\": %lu }\n",
+           pid_info, dir, flags);
+
+    return 0;
+}
@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Binds an IPv4 TCP socket to a fixed port on all addresses, then an IPv6 UDP
+// socket to port 0 on all addresses, which makes the kernel pick an ephemeral
+// port. Prints both ports and exits. Used to test NETWORK_BIND events.
+
+#include <arpa/inet.h>
+#include <netinet/in.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2051
+
+int main()
+{
+    struct sockaddr_in addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sin_family      = AF_INET;
+    addr.sin_addr.s_addr = htonl(INADDR_ANY);
+    addr.sin_port        = htons(BOUND_PORT);
+
+    int tcpfd;
+    CHECK(tcpfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(tcpfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(tcpfd, (struct sockaddr *)&addr, sizeof(addr)), -1);
+
+    struct sockaddr_in6 addr6;
+    memset(&addr6, 0, sizeof(addr6));
+    addr6.sin6_family = AF_INET6;
+    addr6.sin6_addr   = in6addr_any;
+    addr6.sin6_port   = 0;
+
+    int udpfd;
+    CHECK(udpfd = socket(AF_INET6, SOCK_DGRAM, 0), -1);
+    CHECK(bind(udpfd, (struct sockaddr *)&addr6, sizeof(addr6)), -1);
+
+    socklen_t len = sizeof(addr6);
+    CHECK(getsockname(udpfd, (struct sockaddr *)&addr6, &len), -1);
+
+    close(udpfd);
+    close(tcpfd);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+
+    char netns[128];
+    ssize_t nbytes;
+    CHECK(nbytes = readlink("/proc/self/ns/net", netns, sizeof(netns)), -1);
+    netns[nbytes] = '\0';
+
+    uint64_t netns_inode;
+    sscanf(netns, "net:[%lu]", &netns_inode);
+
+    printf("{ \"pid_info\": %s, \"tcp_port\": %d, \"udp_port\": %d, \"netns\": %lu }\n",
+           pid_info, BOUND_PORT, ntohs(addr6.sin6_port), netns_inode);
+
+    return 0;
+}
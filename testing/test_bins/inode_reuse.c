@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates and deletes a file, then creates files until one reuses its inode
+// number (or we give up). Inode generations are read with FS_IOC_GETVERSION,
+// which not every filesystem supports.
+#include <fcntl.h>
+#include <linux/fs.h>
+#include <stdbool.h>
+#include <stdio.h>
+#include <sys/ioctl.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define MAX_ATTEMPTS 64
+
+struct created {
+    char path[64];
+    ino_t inode;
+    unsigned int generation;
+};
+
+static bool create(struct created *c)
+{
+    int fd;
+    CHECK(fd = open(c->path, O_CREAT | O_EXCL | O_WRONLY, 0644), -1);
+
+    struct stat st;
+    CHECK(fstat(fd, &st), -1);
+    c->inode = st.st_ino;
+
+    int generation = 0;
+    bool ok        = ioctl(fd, FS_IOC_GETVERSION, &generation) == 0;
+    c->generation  = generation;
+
+    CHECK(close(fd), -1);
+    return ok;
+}
+
+int main()
+{
+    struct created first      = {.path = "/tmp/inode_reuse_first"};
+    bool generation_supported = create(&first);
+    CHECK(unlink(first.path), -1);
+
+    struct created second;
+    bool reused = false;
+    for (int i = 0; i < MAX_ATTEMPTS && !reused; i++) {
+        snprintf(second.path, sizeof(second.path), "/tmp/inode_reuse_second_%d", i);
+        create(&second);
+        CHECK(unlink(second.path), -1);
+        reused = second.inode == first.inode;
+    }
+
+    printf("{ \"pid\": %d, \"generation_supported\": %s, \"reused\": %s, "
+           "\"first\": { \"path\": \"%s\", \"inode\": %lu, \"generation\": %u }, "
+           "\"second\": { \"path\": \"%s\", \"inode\": %lu, \"generation\": %u } }\n",
+           getpid(), generation_supported ? "true" : "false", reused ? "true" : "false",
+           first.path, first.inode, first.generation, second.path, second.inode,
+           second.generation);
+
+    return 0;
+}
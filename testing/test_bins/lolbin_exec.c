@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Execs a stand-in "curl" (a copy of ./do_nothing) through a symlink with an
+// innocuous name, ./do_nothing through a symlink named "wget", and
+// ./do_nothing itself. LOLBins are matched on the file that was exec'd, so with
+// the default list only the first is flagged.
+#include <fcntl.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *lolbin_path  = "./curl";
+const char *lolbin_link  = "./update";
+const char *renamed_link = "./wget";
+
+static pid_t fork_exec(const char *path)
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+
+    if (pid == 0) {
+        CHECK(execl(path, path, "https://example.com", NULL), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    return pid;
+}
+
+int main()
+{
+    int err = 0;
+    pid_t lolbin_pid, renamed_pid, normal_pid;
+    char buf[4096];
+
+    int in, out;
+    CHECK(in = open("./do_nothing", O_RDONLY), -1);
+    CHECK(out = open(lolbin_path, O_WRONLY | O_CREAT | O_TRUNC, 0755), -1);
+
+    ssize_t n;
+    while ((n = read(in, buf, sizeof(buf))) > 0)
+        CHECK(write(out, buf, n), -1);
+    CHECK(n, -1);
+
+    // Must be closed before the exec, or it fails with ETXTBSY
+    CHECK(close(in), -1);
+    CHECK(close(out), -1);
+
+    CHECK(symlink("curl", lolbin_link), -1);
+    CHECK(symlink("do_nothing", renamed_link), -1);
+
+    if ((lolbin_pid = fork_exec(lolbin_link)) < 0 ||
+        (renamed_pid = fork_exec(renamed_link)) < 0 ||
+        (normal_pid = fork_exec("./do_nothing")) < 0) {
+        err = 1;
+        goto out;
+    }
+
+    printf("{ \"lolbin_pid\": %d, \"renamed_pid\": %d, \"normal_pid\": %d }\n", lolbin_pid,
+           renamed_pid, normal_pid);
+
+out:
+    CHECK(unlink(renamed_link), -1);
+    CHECK(unlink(lolbin_link), -1);
+    CHECK(unlink(lolbin_path), -1);
+    return err;
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Points its argv at a fake command line with prctl(PR_SET_MM), so
+// /proc/self/cmdline shows it. Needs CAP_SYS_RESOURCE, reports being skipped
+// without it.
+#include <errno.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <sys/prctl.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#ifndef PR_SET_MM
+#define PR_SET_MM 35
+#define PR_SET_MM_ARG_START 8
+#define PR_SET_MM_ARG_END 9
+#endif
+
+int main()
+{
+    const char fake_argv[] = "[kworker/0:1]";
+
+    char *buf;
+    CHECK(buf = mmap(NULL, getpagesize(), PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_ANONYMOUS,
+                     -1, 0),
+          MAP_FAILED);
+    memcpy(buf, fake_argv, sizeof(fake_argv));
+
+    // The mapping is below the stack, where the real argv is, so arg_start
+    // can be moved first without ending up past arg_end
+    unsigned long start = (unsigned long)buf;
+    unsigned long end   = start + sizeof(fake_argv);
+    if (prctl(PR_SET_MM, PR_SET_MM_ARG_START, start, 0, 0) < 0) {
+        if (errno != EPERM) {
+            perror("prctl(PR_SET_MM_ARG_START)");
+            return 1;
+        }
+        printf("{ \"pid\": %d, \"skipped\": true }\n", getpid());
+        return 0;
+    }
+    CHECK(prctl(PR_SET_MM, PR_SET_MM_ARG_END, end, 0, 0), -1);
+
+    printf("{ \"pid\": %d, \"skipped\": false, \"arg_start\": %lu, \"arg_end\": %lu }\n", getpid(),
+           start, end);
+
+    return 0;
+}
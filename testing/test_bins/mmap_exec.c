@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Maps an anonymous RWX region, then writes to an anonymous RW region and
+// makes it executable with mprotect (the W^X way of loading code).
+#include <stdio.h>
+#include <string.h>
+#include <sys/mman.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define LEN 4096
+
+int main()
+{
+    void *rwx, *wx;
+    CHECK(rwx = mmap(NULL, LEN, PROT_READ | PROT_WRITE | PROT_EXEC, MAP_PRIVATE | MAP_ANONYMOUS,
+                     -1, 0),
+          MAP_FAILED);
+
+    CHECK(wx = mmap(NULL, LEN, PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_ANONYMOUS, -1, 0),
+          MAP_FAILED);
+    memset(wx, 0xc3, LEN); // ret
+    CHECK(mprotect(wx, LEN, PROT_READ | PROT_EXEC), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"rwx_addr\": %lu, \"wx_addr\": %lu, \"len\": %d }\n", pid_info,
+           (unsigned long)rwx, (unsigned long)wx, LEN);
+
+    CHECK(munmap(rwx, LEN), -1);
+    CHECK(munmap(wx, LEN), -1);
+    return 0;
+}
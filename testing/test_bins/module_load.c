@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Loads MODULE_PATH with finit_module and unloads it again. A module has to be
+// built against the exact kernel under test, so it isn't shipped here: if
+// there's no module at MODULE_PATH, it can't be loaded or we don't have
+// CAP_SYS_MODULE, this just reports that it skipped.
+#include <errno.h>
+#include <fcntl.h>
+#include <linux/capability.h>
+#include <stdbool.h>
+#include <stdio.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define MODULE_PATH "/ebpf_test_module.ko"
+#define MODULE_NAME "ebpf_test_module"
+
+static bool have_cap_sys_module()
+{
+    struct __user_cap_header_struct hdr = {.version = _LINUX_CAPABILITY_VERSION_3, .pid = 0};
+    struct __user_cap_data_struct data[_LINUX_CAPABILITY_U32S_3];
+
+    if (syscall(SYS_capget, &hdr, data) != 0)
+        return false;
+    return data[CAP_TO_INDEX(CAP_SYS_MODULE)].effective & CAP_TO_MASK(CAP_SYS_MODULE);
+}
+
+static int skip(const char *reason)
+{
+    printf("{ \"pid\": %d, \"skipped\": true, \"reason\": \"%s\" }\n", getpid(), reason);
+    return 0;
+}
+
+int main()
+{
+    if (!have_cap_sys_module())
+        return skip("no CAP_SYS_MODULE");
+
+    int fd = open(MODULE_PATH, O_RDONLY | O_CLOEXEC);
+    if (fd < 0)
+        return skip("no test module");
+
+    if (syscall(SYS_finit_module, fd, "", 0) != 0) {
+        // Most likely built for a different kernel (ENOEXEC) or module loading
+        // is disabled (EPERM)
+        int err = errno;
+        CHECK(close(fd), -1);
+        if (err == ENOEXEC || err == EPERM || err == ENOSYS)
+            return skip("module load failed");
+        errno = err;
+        perror("finit_module");
+        return 1;
+    }
+    CHECK(close(fd), -1);
+    CHECK(syscall(SYS_delete_module, MODULE_NAME, O_NONBLOCK), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"skipped\": false, \"name\": \"%s\" }\n", pid_info, MODULE_NAME);
+    return 0;
+}
@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Makes an RW region read-only (benign) and then another RW region RWX, in
+// that order.
+#include <stdio.h>
+#include <sys/mman.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define LEN 4096
+
+int main()
+{
+    void *ro, *rwx;
+    CHECK(ro = mmap(NULL, LEN, PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_ANONYMOUS, -1, 0),
+          MAP_FAILED);
+    CHECK(rwx = mmap(NULL, LEN, PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_ANONYMOUS, -1, 0),
+          MAP_FAILED);
+
+    CHECK(mprotect(ro, LEN, PROT_READ), -1);
+    CHECK(mprotect(rwx, LEN, PROT_READ | PROT_WRITE | PROT_EXEC), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"ro_addr\": %lu, \"rwx_addr\": %lu, \"len\": %d }\n", pid_info,
+           (unsigned long)ro, (unsigned long)rwx, LEN);
+
+    CHECK(munmap(ro, LEN), -1);
+    CHECK(munmap(rwx, LEN), -1);
+    return 0;
+}
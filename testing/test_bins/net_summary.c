@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Makes N_CONNS TCP connections over the loopback interface to a server
+// running in a child process, sending SEND_BYTES and receiving RECV_BYTES over
+// each. Used to test per-process network summaries: the server lives in
+// another process so only the client side of each connection counts towards
+// this process.
+#include <arpa/inet.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2051
+#define N_CONNS 3
+#define SEND_BYTES 1000
+#define RECV_BYTES 500
+
+static int read_full(int fd, char *buf, size_t len)
+{
+    size_t off = 0;
+    while (off < len) {
+        ssize_t n;
+        CHECK(n = read(fd, buf + off, len - off), -1);
+        if (n == 0)
+            return -1;
+        off += n;
+    }
+
+    return 0;
+}
+
+static int server(int listenfd)
+{
+    char buf[SEND_BYTES];
+    memset(buf, 'B', sizeof(buf));
+
+    for (int i = 0; i < N_CONNS; i++) {
+        int acceptfd;
+        CHECK(acceptfd = accept(listenfd, NULL, NULL), -1);
+        CHECK(read_full(acceptfd, buf, SEND_BYTES), -1);
+        CHECK(write(acceptfd, buf, RECV_BYTES), -1);
+
+        // Wait for the client to close first
+        CHECK(read(acceptfd, buf, 1), -1);
+        close(acceptfd);
+    }
+
+    return 0;
+}
+
+int main()
+{
+    char buf[SEND_BYTES];
+    memset(buf, 'A', sizeof(buf));
+
+    // Ensure loopback interface is up, see tcpv4_connect.c
+    int fd;
+    CHECK(fd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(fd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(fd, SIOCSIFFLAGS, &lo_up_req), -1);
+    close(fd);
+
+    struct sockaddr_in addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sin_family      = AF_INET;
+    addr.sin_addr.s_addr = inet_addr("127.0.0.1");
+    addr.sin_port        = htons(BOUND_PORT);
+
+    int listenfd;
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&addr, sizeof(addr)), -1);
+    CHECK(listen(listenfd, N_CONNS), -1);
+
+    pid_t server_pid;
+    CHECK(server_pid = fork(), -1);
+    if (server_pid == 0)
+        return server(listenfd);
+    close(listenfd);
+
+    for (int i = 0; i < N_CONNS; i++) {
+        int connectfd;
+        CHECK(connectfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+        CHECK(connect(connectfd, (struct sockaddr *)&addr, sizeof(addr)), -1);
+        CHECK(write(connectfd, buf, SEND_BYTES), -1);
+        CHECK(read_full(connectfd, buf, RECV_BYTES), -1);
+        close(connectfd);
+    }
+
+    int wstatus;
+    CHECK(waitpid(server_pid, &wstatus, 0), -1);
+
+    printf("{ \"pid\": %d, \"connections\": %d, \"bytes_sent\": %d, \"bytes_received\": %d }\n",
+           getpid(), N_CONNS, N_CONNS * SEND_BYTES, N_CONNS * RECV_BYTES);
+
+    return 0;
+}
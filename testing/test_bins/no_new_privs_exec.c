@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks two children that exec ./do_nothing, the first one after setting
+// no_new_privs, the second one without.
+#include <stdbool.h>
+#include <stdio.h>
+#include <sys/prctl.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static pid_t fork_exec(bool no_new_privs)
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+
+    if (pid == 0) {
+        if (no_new_privs)
+            CHECK(prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0), -1);
+        CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+    }
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    return pid;
+}
+
+int main()
+{
+    pid_t nnp_pid, normal_pid;
+    CHECK(nnp_pid = fork_exec(true), -1);
+    CHECK(normal_pid = fork_exec(false), -1);
+
+    printf("{ \"nnp_pid\": %d, \"normal_pid\": %d }\n", nnp_pid, normal_pid);
+
+    return 0;
+}
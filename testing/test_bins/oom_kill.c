@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Runs a child in a memory-limited cgroup that allocates until the OOM killer
+// kills it, then runs another child that's just killed with a plain SIGKILL.
+//
+// Everything is done in a dedicated cgroup so the OOM killer can't pick any
+// other process on the system as a victim.
+#include <errno.h>
+#include <fcntl.h>
+#include <signal.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const char *cgroup_root = "/oom_kill_cgroup";
+const char *cgroup_dir  = "/oom_kill_cgroup/oom_kill";
+
+// Small enough to hit quickly, big enough for a static binary to start in
+#define MEMORY_MAX (16 * 1024 * 1024)
+#define ALLOC_SIZE (1024 * 1024)
+
+static int write_file(const char *dir, const char *file, const char *buf)
+{
+    char path[256];
+    snprintf(path, sizeof(path), "%s/%s", dir, file);
+
+    int fd;
+    CHECK(fd = open(path, O_WRONLY), -1);
+    CHECK(write(fd, buf, strlen(buf)), -1);
+    CHECK(close(fd), -1);
+
+    return 0;
+}
+
+static int oom_child()
+{
+    // Writing 0 moves the writing process
+    CHECK(write_file(cgroup_dir, "cgroup.procs", "0"), -1);
+
+    for (;;) {
+        char *buf;
+        CHECK(buf = malloc(ALLOC_SIZE), NULL);
+        memset(buf, 'A', ALLOC_SIZE);
+    }
+
+    return 0;
+}
+
+static int wait_killed(pid_t pid)
+{
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    if (!WIFSIGNALED(wstatus) || WTERMSIG(wstatus) != SIGKILL) {
+        fprintf(stderr, "child %d was not killed by SIGKILL\n", pid);
+        return -1;
+    }
+
+    return 0;
+}
+
+int main()
+{
+    int err = 0;
+    char buf[64];
+
+    if (mkdir(cgroup_root, 0700) < 0 && errno != EEXIST) {
+        perror("mkdir");
+        return 1;
+    }
+    CHECK(mount("none", cgroup_root, "cgroup2", 0, NULL), -1);
+    CHECK(write_file(cgroup_root, "cgroup.subtree_control", "+memory"), -1);
+    CHECK(mkdir(cgroup_dir, 0700), -1);
+
+    snprintf(buf, sizeof(buf), "%d", MEMORY_MAX);
+    CHECK(write_file(cgroup_dir, "memory.max", buf), -1);
+
+    // Doesn't exist if swap accounting is disabled, in which case there's
+    // nothing to turn off
+    write_file(cgroup_dir, "memory.swap.max", "0");
+
+    pid_t oom_pid;
+    CHECK(oom_pid = fork(), -1);
+    if (oom_pid == 0)
+        return oom_child();
+
+    if (wait_killed(oom_pid) < 0) {
+        err = 1;
+        goto cleanup;
+    }
+
+    pid_t kill_pid;
+    CHECK(kill_pid = fork(), -1);
+    if (kill_pid == 0) {
+        pause();
+        return 0;
+    }
+
+    CHECK(kill(kill_pid, SIGKILL), -1);
+    if (wait_killed(kill_pid) < 0) {
+        err = 1;
+        goto cleanup;
+    }
+
+    printf("{ \"oom_pid\": %d, \"kill_pid\": %d }\n", oom_pid, kill_pid);
+
+cleanup:
+    CHECK(rmdir(cgroup_dir), -1);
+    CHECK(umount(cgroup_root), -1);
+    CHECK(rmdir(cgroup_root), -1);
+
+    return err;
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Makes itself a child subreaper, then forks a parent which forks a child and
+// immediately exits. The orphaned child waits until it has been reparented to
+// us and then execs ./do_nothing.
+#include <stdio.h>
+#include <sys/prctl.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static int parent(int pipe_fd)
+{
+    pid_t child_pid;
+    CHECK(child_pid = fork(), -1);
+
+    if (child_pid == 0) {
+        pid_t orig_parent = getppid();
+        while (getppid() == orig_parent)
+            usleep(1000);
+
+        CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+    }
+
+    CHECK(write(pipe_fd, &child_pid, sizeof(child_pid)), -1);
+    return 0;
+}
+
+int main()
+{
+    // Orphans get reparented to us rather than init, so we can wait on them
+    CHECK(prctl(PR_SET_CHILD_SUBREAPER, 1), -1);
+
+    int fds[2];
+    CHECK(pipe(fds), -1);
+
+    pid_t parent_pid;
+    CHECK(parent_pid = fork(), -1);
+    if (parent_pid == 0)
+        return parent(fds[1]);
+
+    pid_t child_pid;
+    CHECK(read(fds[0], &child_pid, sizeof(child_pid)), -1);
+
+    int wstatus;
+    CHECK(waitpid(parent_pid, &wstatus, 0), -1);
+    CHECK(waitpid(child_pid, &wstatus, 0), -1);
+
+    printf("{ \"reaper_pid\": %d, \"parent_pid\": %d, \"child_pid\": %d }\n", getpid(), parent_pid,
+           child_pid);
+    return 0;
+}
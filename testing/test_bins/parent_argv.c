@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Stands in for `sh -c ./do_nothing`: re-execs itself with a "-c ./do_nothing"
+// argv and forks two children that exec ./do_nothing. The first does so right
+// away, the second only once the parent has exec'd again (into --wait mode,
+// which reaps the children), so the parent's argv it forked with is stale.
+#include <fcntl.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static const char wait_cmdline[] = "./parent_argv\0--wait";
+
+static int parent_execd(pid_t ppid)
+{
+    char path[64], cmdline[sizeof(wait_cmdline)] = {0};
+    snprintf(path, sizeof(path), "/proc/%d/cmdline", ppid);
+
+    int fd;
+    CHECK(fd = open(path, O_RDONLY), -1);
+    CHECK(read(fd, cmdline, sizeof(cmdline)), -1);
+    CHECK(close(fd), -1);
+
+    return memcmp(cmdline, wait_cmdline, sizeof(wait_cmdline)) == 0;
+}
+
+int main(int argc, char **argv)
+{
+    if (argc == 1)
+        CHECK(execl("./parent_argv", "./parent_argv", "-c", "./do_nothing", NULL), -1);
+
+    if (strcmp(argv[1], "--wait") == 0) {
+        while (wait(NULL) > 0)
+            ;
+        return 0;
+    }
+
+    pid_t fresh_pid;
+    CHECK(fresh_pid = fork(), -1);
+    if (fresh_pid == 0)
+        CHECK(execl(argv[2], argv[2], NULL), -1);
+    CHECK(waitpid(fresh_pid, NULL, 0), -1);
+
+    // The write end is closed when the parent execs, waking up the child. The
+    // parent's argv is replaced a bit later, so also wait for that.
+    int pipefd[2];
+    CHECK(pipe2(pipefd, O_CLOEXEC), -1);
+
+    pid_t stale_pid;
+    CHECK(stale_pid = fork(), -1);
+    if (stale_pid == 0) {
+        char c;
+        CHECK(close(pipefd[1]), -1);
+        CHECK(read(pipefd[0], &c, 1), -1);
+        while (!parent_execd(getppid()))
+            usleep(1000);
+        CHECK(execl(argv[2], argv[2], NULL), -1);
+    }
+
+    printf("{ \"fresh_pid\": %d, \"stale_pid\": %d, \"parent_argv\": \"%s %s %s\" }\n", fresh_pid,
+           stale_pid, argv[0], argv[1], argv[2]);
+    fflush(stdout);
+
+    CHECK(execl("./parent_argv", "./parent_argv", "--wait", NULL), -1);
+    return 0;
+}
@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Waits for stdin to be closed, then forks a child that execs ./do_nothing.
+// Its pid is known before it does anything, so EventsTrace can be started
+// filtering on it in the meantime.
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    char buf[64];
+    ssize_t n;
+    do {
+        CHECK(n = read(STDIN_FILENO, buf, sizeof(buf)), -1);
+    } while (n > 0);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    printf("{ \"child_pid\": %d }\n", pid);
+    return 0;
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Starts a "container" (a new pid namespace) whose init runs ./do_nothing in
+// a child a little after starting.
+#define _GNU_SOURCE
+#include <sched.h>
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    CHECK(unshare(CLONE_NEWPID), -1);
+
+    pid_t init;
+    CHECK(init = fork(), -1);
+    if (init == 0) {
+        usleep(10000);
+
+        pid_t child;
+        CHECK(child = fork(), -1);
+        if (child == 0)
+            CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+
+        CHECK(waitpid(child, NULL, 0), -1);
+        return 0;
+    }
+
+    CHECK(waitpid(init, NULL, 0), -1);
+
+    printf("{ \"pid\": %d, \"init_pid\": %d }\n", getpid(), init);
+
+    return 0;
+}
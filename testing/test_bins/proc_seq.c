@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks two children that each create and delete a few files, one after the
+// other, so each has a known number of file events.
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define N_FILES 5
+
+static pid_t fork_create_delete()
+{
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+
+    if (pid == 0) {
+        for (int i = 0; i < N_FILES; i++) {
+            char path[64];
+            snprintf(path, sizeof(path), "/tmp/proc_seq_%d_%d", getpid(), i);
+
+            FILE *f;
+            CHECK(f = fopen(path, "w"), NULL);
+            CHECK(fclose(f), EOF);
+            CHECK(unlink(path), -1);
+        }
+        _exit(0);
+    }
+
+    CHECK(waitpid(pid, NULL, 0), -1);
+    return pid;
+}
+
+int main()
+{
+    pid_t first_pid, second_pid;
+    CHECK(first_pid = fork_create_delete(), -1);
+    CHECK(second_pid = fork_create_delete(), -1);
+
+    printf("{ \"first_pid\": %d, \"second_pid\": %d, \"n_events\": %d }\n", first_pid, second_pid,
+           2 * N_FILES);
+
+    return 0;
+}
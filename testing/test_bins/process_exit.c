@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks children that exit in various ways:
+//
+// - exit(42)
+// - killed with SIGKILL
+// - a second thread exits first, then the thread group leader exits with 7
+// - the thread group leader exits first, then a second thread exits the
+//   process with 5
+// - exit(3), but is never reaped and stays a zombie until we exit
+//
+// Threads are created with a bare clone() so this doesn't need libpthread.
+#define _GNU_SOURCE
+
+#include <sched.h>
+#include <signal.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/syscall.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define THREAD_FLAGS                                                                               \
+    (CLONE_VM | CLONE_FS | CLONE_FILES | CLONE_SIGHAND | CLONE_THREAD | CLONE_SYSVSEM |            \
+     CLONE_PARENT_SETTID | CLONE_CHILD_CLEARTID)
+
+static char thread_stack[64 * 1024];
+
+// Returning from a clone()'d function only exits that thread
+static int thread_return(void *arg)
+{
+    return 0;
+}
+
+static int thread_exit_process(void *arg)
+{
+    usleep(100 * 1000);
+    exit(5);
+}
+
+static int start_thread(int (*fn)(void *), pid_t *tid)
+{
+    CHECK(clone(fn, thread_stack + sizeof(thread_stack), THREAD_FLAGS, NULL, tid, NULL, tid), -1);
+    return 0;
+}
+
+static int thread_exits_first()
+{
+    // The kernel zeroes tid once the thread has exited
+    pid_t tid;
+    CHECK(start_thread(thread_return, &tid), -1);
+    while (__atomic_load_n(&tid, __ATOMIC_SEQ_CST) != 0)
+        usleep(1000);
+
+    exit(7);
+}
+
+static int leader_exits_first()
+{
+    pid_t tid;
+    CHECK(start_thread(thread_exit_process, &tid), -1);
+
+    // Exits just this thread, unlike exit()
+    syscall(SYS_exit, 0);
+    return 0;
+}
+
+static int wait_exited(pid_t pid, int code)
+{
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != code) {
+        fprintf(stderr, "child %d did not exit with %d\n", pid, code);
+        return -1;
+    }
+
+    return 0;
+}
+
+int main()
+{
+    pid_t exit_pid;
+    CHECK(exit_pid = fork(), -1);
+    if (exit_pid == 0)
+        exit(42);
+    CHECK(wait_exited(exit_pid, 42), -1);
+
+    pid_t kill_pid;
+    CHECK(kill_pid = fork(), -1);
+    if (kill_pid == 0) {
+        pause();
+        return 0;
+    }
+    CHECK(kill(kill_pid, SIGKILL), -1);
+    CHECK(waitpid(kill_pid, NULL, 0), -1);
+
+    pid_t thread_exit_pid;
+    CHECK(thread_exit_pid = fork(), -1);
+    if (thread_exit_pid == 0)
+        return thread_exits_first();
+    CHECK(wait_exited(thread_exit_pid, 7), -1);
+
+    pid_t leader_exit_pid;
+    CHECK(leader_exit_pid = fork(), -1);
+    if (leader_exit_pid == 0)
+        return leader_exits_first();
+    CHECK(wait_exited(leader_exit_pid, 5), -1);
+
+    // Wait for it to exit without reaping it
+    pid_t zombie_pid;
+    CHECK(zombie_pid = fork(), -1);
+    if (zombie_pid == 0)
+        exit(3);
+    siginfo_t info;
+    CHECK(waitid(P_PID, zombie_pid, &info, WEXITED | WNOWAIT), -1);
+
+    printf("{ \"exit_pid\": %d, \"kill_pid\": %d, \"thread_exit_pid\": %d, "
+           "\"leader_exit_pid\": %d, \"zombie_pid\": %d }\n",
+           exit_pid, kill_pid, thread_exit_pid, leader_exit_pid, zombie_pid);
+
+    return 0;
+}
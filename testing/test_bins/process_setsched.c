@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks a child and renices it from the parent, then tries to switch the
+// parent to SCHED_FIFO. The latter requires CAP_SYS_NICE, so whether it
+// succeeded is part of the output.
+#include <sched.h>
+#include <signal.h>
+#include <stdio.h>
+#include <sys/resource.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    pid_t child_pid;
+    CHECK(child_pid = fork(), -1);
+
+    if (child_pid == 0) {
+        pause();
+        return 0;
+    }
+
+    const int nice = 10;
+    CHECK(setpriority(PRIO_PROCESS, child_pid, nice), -1);
+
+    const int fifo_priority  = 1;
+    struct sched_param param = {.sched_priority = fifo_priority};
+    int fifo_ok              = sched_setscheduler(0, SCHED_FIFO, &param) == 0;
+
+    CHECK(kill(child_pid, SIGKILL), -1);
+    CHECK(waitpid(child_pid, NULL, 0), -1);
+
+    printf("{ \"pid\": %d, \"child_pid\": %d, \"nice\": %d, \"fifo_ok\": %s, "
+           "\"fifo_priority\": %d }\n",
+           getpid(), child_pid, nice, fifo_ok ? "true" : "false", fifo_priority);
+
+    return 0;
+}
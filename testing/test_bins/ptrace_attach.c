@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks a sleeping child and a second child that PTRACE_ATTACHes to its
+// sibling, as a debugger (or injector) would, then detaches.
+#include <signal.h>
+#include <stdio.h>
+#include <sys/ptrace.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    pid_t target;
+    CHECK(target = fork(), -1);
+    if (target == 0) {
+        for (;;)
+            pause();
+    }
+
+    pid_t tracer;
+    CHECK(tracer = fork(), -1);
+    if (tracer == 0) {
+        CHECK(ptrace(PTRACE_ATTACH, target, NULL, NULL), -1);
+        CHECK(waitpid(target, NULL, 0), -1);
+        CHECK(ptrace(PTRACE_DETACH, target, NULL, NULL), -1);
+
+        char pid_info[8192];
+        gen_pid_info_json(pid_info, sizeof(pid_info));
+        printf("{ \"tracer_pid_info\": %s, \"target_pid\": %d }\n", pid_info, target);
+        return 0;
+    }
+
+    int wstatus;
+    CHECK(waitpid(tracer, &wstatus, 0), -1);
+    CHECK(kill(target, SIGKILL), -1);
+    CHECK(waitpid(target, NULL, 0), -1);
+
+    return WIFEXITED(wstatus) ? WEXITSTATUS(wstatus) : 1;
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Allocates a pty, sets its window size and writes a line to the slave.
+// devpts is mounted if it isn't already (it's not in the test environment).
+#define _GNU_SOURCE
+
+#include <errno.h>
+#include <fcntl.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/ioctl.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <sys/sysmacros.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define ROWS 42
+#define COLS 137
+#define LINE "--- OK\n"
+
+int main()
+{
+    if (access("/dev/pts/ptmx", F_OK) != 0) {
+        if (mkdir("/dev/pts", 0755) != 0 && errno != EEXIST) {
+            perror("mkdir /dev/pts");
+            return 1;
+        }
+        CHECK(mount("devpts", "/dev/pts", "devpts", 0, NULL), -1);
+    }
+
+    int master, slave;
+    CHECK(master = posix_openpt(O_RDWR | O_NOCTTY), -1);
+    CHECK(grantpt(master), -1);
+    CHECK(unlockpt(master), -1);
+
+    char *name;
+    CHECK(name = ptsname(master), NULL);
+    CHECK(slave = open(name, O_RDWR | O_NOCTTY), -1);
+
+    struct winsize ws = {.ws_row = ROWS, .ws_col = COLS};
+    CHECK(ioctl(slave, TIOCSWINSZ, &ws), -1);
+
+    CHECK(write(slave, LINE, sizeof(LINE) - 1), -1);
+
+    struct stat st;
+    CHECK(fstat(slave, &st), -1);
+
+    CHECK(close(slave), -1);
+    CHECK(close(master), -1);
+
+    printf("{ \"pid\": %d, \"major\": %u, \"minor\": %u, \"rows\": %d, \"cols\": %d }\n", getpid(),
+           major(st.st_rdev), minor(st.st_rdev), ROWS, COLS);
+    return 0;
+}
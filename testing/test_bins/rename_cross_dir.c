@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates a file in one directory, moves it to another, then cleans up. Used
+// to test the cross_directory flag of FILE_RENAME events.
+
+#include <fcntl.h>
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define DIR_A "/rename_cross_dir_a"
+#define DIR_B "/rename_cross_dir_b"
+#define OLD_PATH DIR_A "/file"
+#define NEW_PATH DIR_B "/file"
+
+int main()
+{
+    CHECK(mkdir(DIR_A, 0755), -1);
+    CHECK(mkdir(DIR_B, 0755), -1);
+
+    int fd;
+    CHECK(fd = open(OLD_PATH, O_WRONLY | O_CREAT, 0644), -1);
+    CHECK(close(fd), -1);
+    CHECK(rename(OLD_PATH, NEW_PATH), -1);
+
+    CHECK(unlink(NEW_PATH), -1);
+    CHECK(rmdir(DIR_B), -1);
+    CHECK(rmdir(DIR_A), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"old_path\": \"%s\", \"new_path\": \"%s\" }\n", pid_info,
+           OLD_PATH, NEW_PATH);
+
+    return 0;
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates two files, atomically swaps them with renameat2(RENAME_EXCHANGE),
+// then cleans up. Used to test the flags of FILE_RENAME events.
+
+#define _GNU_SOURCE
+
+#include <fcntl.h>
+#include <stdio.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define PATH_A "/rename_exchange_a"
+#define PATH_B "/rename_exchange_b"
+
+int main()
+{
+    int fd;
+    CHECK(fd = open(PATH_A, O_WRONLY | O_CREAT, 0644), -1);
+    CHECK(close(fd), -1);
+    CHECK(fd = open(PATH_B, O_WRONLY | O_CREAT, 0644), -1);
+    CHECK(close(fd), -1);
+
+    CHECK(renameat2(AT_FDCWD, PATH_A, AT_FDCWD, PATH_B, RENAME_EXCHANGE), -1);
+
+    CHECK(unlink(PATH_B), -1);
+    CHECK(unlink(PATH_A), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"path_a\": \"%s\", \"path_b\": \"%s\" }\n", pid_info, PATH_A,
+           PATH_B);
+
+    return 0;
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Runs a fake DNS server on 127.0.0.1:53 and looks up two names with
+// res_query, one resolving to 127.0.0.1 with a TTL of 60, the other to
+// 127.0.0.3 with a TTL of 0. Then connects to both addresses and to
+// 127.0.0.2, which wasn't looked up.
+#include <arpa/inet.h>
+#include <arpa/nameser.h>
+#include <net/if.h>
+#include <netdb.h>
+#include <netinet/in.h>
+#include <resolv.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2049
+
+const char *resolved_qname   = "resolved.example.com";
+const char *resolved_address = "127.0.0.1";
+const char *expired_qname    = "expired.example.com";
+const char *expired_address  = "127.0.0.3";
+const char *direct_address   = "127.0.0.2";
+
+static int server(int serverfd)
+{
+    for (int i = 0; i < 2; i++) {
+        unsigned char buf[512];
+        struct sockaddr_in peer;
+        socklen_t len = sizeof(peer);
+        ssize_t n;
+        CHECK(n = recvfrom(serverfd, buf, sizeof(buf), 0, (struct sockaddr *)&peer, &len), -1);
+
+        if (n < HFIXEDSZ)
+            continue;
+
+        // The answer goes right after the question, dropping anything the
+        // query had after it (e.g. an EDNS record)
+        size_t off = HFIXEDSZ;
+        while (off < (size_t)n && buf[off] != 0)
+            off += buf[off] + 1;
+        off += 1 + QFIXEDSZ;
+
+        HEADER *hdr  = (HEADER *)buf;
+        hdr->qr      = 1;
+        hdr->ra      = 1;
+        hdr->rcode   = NOERROR;
+        hdr->ancount = htons(1);
+        hdr->arcount = 0;
+
+        struct in_addr addr;
+        inet_pton(AF_INET, i == 0 ? resolved_address : expired_address, &addr);
+
+        unsigned char *p = &buf[off];
+        NS_PUT16(0xC000 | HFIXEDSZ, p);
+        NS_PUT16(T_A, p);
+        NS_PUT16(C_IN, p);
+        NS_PUT32(i == 0 ? 60 : 0, p);
+        NS_PUT16(sizeof(addr), p);
+        memcpy(p, &addr, sizeof(addr));
+        p += sizeof(addr);
+
+        CHECK(sendto(serverfd, buf, p - buf, 0, (struct sockaddr *)&peer, len), -1);
+    }
+
+    return 0;
+}
+
+static int connect_to(int listenfd, const char *address)
+{
+    int connectfd;
+    CHECK(connectfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+
+    struct sockaddr_in addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sin_family = AF_INET;
+    addr.sin_port   = htons(BOUND_PORT);
+    inet_pton(AF_INET, address, &addr.sin_addr);
+    CHECK(connect(connectfd, (struct sockaddr *)&addr, sizeof(addr)), -1);
+
+    int acceptfd;
+    CHECK(acceptfd = accept(listenfd, NULL, NULL), -1);
+
+    close(acceptfd);
+    close(connectfd);
+
+    return 0;
+}
+
+int main()
+{
+    int serverfd;
+    CHECK(serverfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+
+    // The init in our minimal VM setup doesn't bring loopback up (see
+    // tcpv4_connect.c)
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(serverfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(serverfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr;
+    memset(&serveraddr, 0, sizeof(serveraddr));
+    serveraddr.sin_family      = AF_INET;
+    serveraddr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+    serveraddr.sin_port        = htons(NAMESERVER_PORT);
+    CHECK(bind(serverfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        return server(serverfd);
+
+    // Don't depend on whatever /etc/resolv.conf says
+    CHECK(res_init(), -1);
+    _res.nscount        = 1;
+    _res.nsaddr_list[0] = serveraddr;
+    _res.retry          = 1;
+    _res.options &= ~RES_DEFNAMES & ~RES_DNSRCH;
+
+    unsigned char answer[512];
+    CHECK(res_query(resolved_qname, C_IN, T_A, answer, sizeof(answer)), -1);
+    CHECK(res_query(expired_qname, C_IN, T_A, answer, sizeof(answer)), -1);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    int listenfd;
+    struct sockaddr_in listenaddr;
+    memset(&listenaddr, 0, sizeof(listenaddr));
+    listenaddr.sin_family      = AF_INET;
+    listenaddr.sin_addr.s_addr = htonl(INADDR_ANY);
+    listenaddr.sin_port        = htons(BOUND_PORT);
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&listenaddr, sizeof(listenaddr)), -1);
+    CHECK(listen(listenfd, 1), -1);
+
+    CHECK(connect_to(listenfd, resolved_address), -1);
+    CHECK(connect_to(listenfd, direct_address), -1);
+    CHECK(connect_to(listenfd, expired_address), -1);
+
+    close(listenfd);
+
+    printf("{ \"pid\": %d, \"port\": %d, \"resolved_qname\": \"%s\", \"resolved_address\": \"%s\", "
+           "\"direct_address\": \"%s\", \"expired_qname\": \"%s\", \"expired_address\": \"%s\" }\n",
+           getpid(), BOUND_PORT, resolved_qname, resolved_address, direct_address, expired_qname,
+           expired_address);
+
+    return 0;
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Disables a stand-in for the SELinux enforce node (a file in a watched
+// directory) and stops a stand-in auditd (a child renamed to auditd).
+#include <signal.h>
+#include <stdio.h>
+#include <sys/prctl.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    const char *path   = "/tmp/enforce";
+    const char *daemon = "auditd";
+
+    int pipefd[2];
+    CHECK(pipe(pipefd), -1);
+
+    pid_t daemon_pid;
+    CHECK(daemon_pid = fork(), -1);
+
+    if (daemon_pid == 0) {
+        CHECK(prctl(PR_SET_NAME, daemon), -1);
+        CHECK(write(pipefd[1], "x", 1), -1);
+        pause();
+        return 0;
+    }
+
+    // Make sure the child renamed itself before signaling it
+    char c;
+    CHECK(read(pipefd[0], &c, 1), -1);
+
+    FILE *f;
+    CHECK(f = fopen(path, "w"), NULL);
+    CHECK(fputs("0", f), EOF);
+    CHECK(fclose(f), EOF);
+    CHECK(unlink(path), -1);
+
+    CHECK(kill(daemon_pid, SIGTERM), -1);
+    CHECK(waitpid(daemon_pid, NULL, 0), -1);
+
+    printf("{ \"pid\": %d, \"path\": \"%s\", \"daemon_pid\": %d, \"daemon\": \"%s\", "
+           "\"signal\": %d }\n",
+           getpid(), path, daemon_pid, daemon, SIGTERM);
+
+    return 0;
+}
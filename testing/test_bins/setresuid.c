@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Changes all of the real, effective and saved gids and then uids, then only
+// the effective one (-1 leaves the others as they are) and then the
+// filesystem one. The gids go first, while still root.
+#define _GNU_SOURCE
+
+#include <stdio.h>
+#include <sys/fsuid.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    CHECK(setresgid(1, 2, 3), -1);
+    CHECK(setresgid(-1, 3, -1), -1);
+    setfsgid(1);
+
+    CHECK(setresuid(1, 2, 3), -1);
+    CHECK(setresuid(-1, 3, -1), -1);
+    setfsuid(1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s }\n", pid_info);
+    return 0;
+}
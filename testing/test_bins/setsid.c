@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks a child that starts a new session, then calls setsid() again, which
+// fails as it's now a session leader. It then forks a grandchild that also
+// starts a new session, so its event directly follows the child's if the
+// failed call wasn't reported.
+#include <errno.h>
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static int child()
+{
+    CHECK(setsid(), -1);
+
+    if (setsid() != -1 || errno != EPERM) {
+        fprintf(stderr, "second setsid() didn't fail with EPERM\n");
+        return 1;
+    }
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        CHECK(setsid(), -1);
+        return 0;
+    }
+
+    CHECK(waitpid(pid, NULL, 0), -1);
+    printf("%d", pid);
+
+    return 0;
+}
+
+int main()
+{
+    int fds[2];
+    CHECK(pipe(fds), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0) {
+        CHECK(dup2(fds[1], STDOUT_FILENO), -1);
+        return child();
+    }
+    CHECK(close(fds[1]), -1);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child exited abnormally, see errors\n");
+        return 1;
+    }
+
+    char buf[32] = {};
+    CHECK(read(fds[0], buf, sizeof(buf) - 1), -1);
+
+    printf("{ \"child_pid\": %d, \"grandchild_pid\": %s, \"old_sid\": %d }\n", pid, buf, getsid(0));
+
+    return 0;
+}
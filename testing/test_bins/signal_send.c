@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Checks that a child exists with signal 0, then sends it SIGUSR1.
+#include <signal.h>
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    int ready[2];
+    CHECK(pipe(ready), -1);
+
+    pid_t child;
+    CHECK(child = fork(), -1);
+    if (child == 0) {
+        sigset_t set;
+        sigemptyset(&set);
+        sigaddset(&set, SIGUSR1);
+        CHECK(sigprocmask(SIG_BLOCK, &set, NULL), -1);
+        CHECK(write(ready[1], "x", 1), -1);
+
+        int sig;
+        return sigwait(&set, &sig) != 0;
+    }
+
+    char c;
+    CHECK(read(ready[0], &c, 1), -1);
+
+    CHECK(kill(child, 0), -1);
+    CHECK(kill(child, SIGUSR1), -1);
+    CHECK(waitpid(child, NULL, 0), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"child_pid\": %d, \"signal\": %d }\n", pid_info, child, SIGUSR1);
+
+    return 0;
+}
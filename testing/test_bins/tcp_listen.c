@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Binds an IPv4 TCP socket to a port on all addresses, listens on it with a
+// distinctive backlog, closes it and exits. Used to test NETWORK_LISTEN events.
+
+#include <arpa/inet.h>
+#include <netinet/in.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2050
+#define BACKLOG 17
+
+int main()
+{
+    struct sockaddr_in addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sin_family      = AF_INET;
+    addr.sin_addr.s_addr = htonl(INADDR_ANY);
+    addr.sin_port        = htons(BOUND_PORT);
+
+    int listenfd;
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&addr, sizeof(addr)), -1);
+    CHECK(listen(listenfd, BACKLOG), -1);
+    close(listenfd);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+
+    char netns[128];
+    ssize_t nbytes;
+    CHECK(nbytes = readlink("/proc/self/ns/net", netns, sizeof(netns)), -1);
+    netns[nbytes] = '\0';
+
+    uint64_t netns_inode;
+    sscanf(netns, "net:[%lu]", &netns_inode);
+
+    printf("{ \"pid_info\": %s, \"port\": %d, \"backlog\": %d, \"netns\": %lu }\n", pid_info,
+           BOUND_PORT, BACKLOG, netns_inode);
+
+    return 0;
+}
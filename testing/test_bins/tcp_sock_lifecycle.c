@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates an IPv4 TCP listening socket, connects to it on the loopback
+// interface, sends a message each way so both ends report their close, closes
+// all sockets and exits. Prints the inode numbers of the connecting and the
+// accepted sockets. Used to test correlating connection events by socket.
+
+#include <arpa/inet.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <netinet/ip.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2053
+
+int main()
+{
+    int connectfd;
+    CHECK(connectfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+
+    // Ensure loopback interface is up, see tcpv4_connect.c
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(connectfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(connectfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr = {0};
+    serveraddr.sin_family         = AF_INET;
+    serveraddr.sin_addr.s_addr    = htonl(INADDR_LOOPBACK);
+    serveraddr.sin_port           = htons(BOUND_PORT);
+
+    int listenfd;
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+    CHECK(listen(listenfd, 1), -1);
+
+    CHECK(connect(connectfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+
+    int acceptfd;
+    struct sockaddr_in acceptaddr;
+    socklen_t sz = sizeof(acceptaddr);
+    CHECK(acceptfd = accept(listenfd, (struct sockaddr *)&acceptaddr, &sz), -1);
+
+    // Sockets that never carried any data aren't reported on close
+    char buf[4];
+    CHECK(send(connectfd, "ping", 4, 0), -1);
+    CHECK(recv(acceptfd, buf, sizeof(buf), MSG_WAITALL), -1);
+    CHECK(send(acceptfd, "pong", 4, 0), -1);
+    CHECK(recv(connectfd, buf, sizeof(buf), MSG_WAITALL), -1);
+
+    struct stat connect_st, accept_st;
+    CHECK(fstat(connectfd, &connect_st), -1);
+    CHECK(fstat(acceptfd, &accept_st), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"client_port\": %d, \"server_port\": %d, "
+           "\"client_sock_inode\": %lu, \"accepted_sock_inode\": %lu }\n",
+           pid_info, ntohs(acceptaddr.sin_port), BOUND_PORT, (unsigned long)connect_st.st_ino,
+           (unsigned long)accept_st.st_ino);
+
+    close(acceptfd);
+    close(connectfd);
+    close(listenfd);
+
+    return 0;
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates an IPv4 TCP listening socket on the loopback interface and connects
+// to it from an IPv6 socket through the IPv4-mapped address ::ffff:127.0.0.1,
+// closes all sockets and exits. Used to test IPv4-mapped addresses in network
+// connection events.
+
+#include <arpa/inet.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <netinet/ip.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define BOUND_PORT 2049
+
+int main()
+{
+    int connectfd;
+    CHECK(connectfd = socket(AF_INET6, SOCK_STREAM, 0), -1);
+
+    // Ensure loopback interface is up, see tcpv6_connect.c
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(connectfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(connectfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr = {0};
+    serveraddr.sin_family         = AF_INET;
+    serveraddr.sin_addr.s_addr    = htonl(INADDR_LOOPBACK);
+    serveraddr.sin_port           = htons(BOUND_PORT);
+
+    int listenfd;
+    CHECK(listenfd = socket(AF_INET, SOCK_STREAM, 0), -1);
+    CHECK(setsockopt(listenfd, SOL_SOCKET, SO_REUSEADDR, &(int){1}, sizeof(int)), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+    CHECK(listen(listenfd, 1), -1);
+
+    struct sockaddr_in6 clientaddr = {0};
+    clientaddr.sin6_family         = AF_INET6;
+    clientaddr.sin6_port           = htons(BOUND_PORT);
+    CHECK(inet_pton(AF_INET6, "::ffff:127.0.0.1", &clientaddr.sin6_addr), 0);
+    CHECK(connect(connectfd, (struct sockaddr *)&clientaddr, sizeof(clientaddr)), -1);
+
+    int acceptfd;
+    struct sockaddr_in acceptaddr;
+    socklen_t sz = sizeof(acceptaddr);
+    CHECK(acceptfd = accept(listenfd, (struct sockaddr *)&acceptaddr, &sz), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+
+    char netns[128];
+    ssize_t nbytes;
+    CHECK(nbytes = readlink("/proc/self/ns/net", netns, sizeof(netns) - 1), -1);
+    netns[nbytes] = '\0';
+
+    uint64_t netns_inode;
+    sscanf(netns, "net:[%lu]", &netns_inode);
+
+    printf("{ \"pid_info\": %s, \"client_port\": %d, \"server_port\": %d, \"netns\": %lu }\n",
+           pid_info, ntohs(acceptaddr.sin_port), BOUND_PORT, netns_inode);
+
+    close(acceptfd);
+    close(connectfd);
+    close(listenfd);
+
+    return 0;
+}
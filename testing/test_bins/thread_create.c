@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Starts a thread that returns right away, waits for it to exit, then forks a
+// child that exits right away. Prints its pid info, the thread's tid and the
+// child's pid. Used to test PROCESS_FORK events of thread creations.
+//
+// The thread is created with a bare clone() and the flags pthread_create uses,
+// so this doesn't need libpthread.
+#define _GNU_SOURCE
+
+#include <sched.h>
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define THREAD_FLAGS                                                                               \
+    (CLONE_VM | CLONE_FS | CLONE_FILES | CLONE_SIGHAND | CLONE_THREAD | CLONE_SYSVSEM |            \
+     CLONE_PARENT_SETTID | CLONE_CHILD_CLEARTID)
+
+static char thread_stack[64 * 1024];
+
+// Returning from a clone()'d function only exits that thread
+static int thread_return(void *arg)
+{
+    return 0;
+}
+
+int main()
+{
+    // The kernel zeroes ctid once the thread has exited
+    pid_t tid, ctid;
+    CHECK(tid = clone(thread_return, thread_stack + sizeof(thread_stack), THREAD_FLAGS, NULL,
+                      &ctid, NULL, &ctid),
+          -1);
+    while (__atomic_load_n(&ctid, __ATOMIC_SEQ_CST) != 0)
+        usleep(1000);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        _exit(0);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"thread_tid\": %d, \"child_pid\": %d }\n", pid_info, tid, pid);
+
+    return 0;
+}
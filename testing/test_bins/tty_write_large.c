@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Writes LEN bytes of 'a' to 'z' repeated to a pty in a single write, then a
+// short line in a second one. devpts is mounted if it isn't already (it's not
+// in the test environment).
+#define _GNU_SOURCE
+
+#include <errno.h>
+#include <fcntl.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <sys/mount.h>
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define LEN 8192
+#define LINE "--- OK\n"
+
+int main()
+{
+    if (access("/dev/pts/ptmx", F_OK) != 0) {
+        if (mkdir("/dev/pts", 0755) != 0 && errno != EEXIST) {
+            perror("mkdir /dev/pts");
+            return 1;
+        }
+        CHECK(mount("devpts", "/dev/pts", "devpts", 0, NULL), -1);
+    }
+
+    int master, slave;
+    CHECK(master = open("/dev/pts/ptmx", O_RDWR | O_NOCTTY), -1);
+    CHECK(grantpt(master), -1);
+    CHECK(unlockpt(master), -1);
+
+    char *name;
+    CHECK(name = ptsname(master), NULL);
+    CHECK(slave = open(name, O_RDWR | O_NOCTTY), -1);
+
+    static char buf[LEN];
+    for (int i = 0; i < LEN; i++)
+        buf[i] = 'a' + i % 26;
+
+    ssize_t n;
+    CHECK(n = write(slave, buf, LEN), -1);
+    if (n != LEN) {
+        fprintf(stderr, "short write to %s: %zd\n", name, n);
+        return 1;
+    }
+    CHECK(write(slave, LINE, sizeof(LINE) - 1), -1);
+
+    CHECK(close(slave), -1);
+    CHECK(close(master), -1);
+
+    printf("{ \"pid\": %d, \"len\": %d, \"line\": \"--- OK\\n\" }\n", getpid(), LEN);
+    return 0;
+}
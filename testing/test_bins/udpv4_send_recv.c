@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Sends a datagram to a UDP echo server on the loopback interface from an
+// unconnected socket (sendto/recvfrom, the peer is passed with each datagram)
+// and reads the echo, then does the same from a connected socket
+// (send/recv, the peer is the socket's). Used to test UDP events.
+
+#include <arpa/inet.h>
+#include <net/if.h>
+#include <netinet/in.h>
+#include <string.h>
+#include <sys/ioctl.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <unistd.h>
+
+#include "common.h"
+
+static int port_of(int fd)
+{
+    struct sockaddr_in addr;
+    socklen_t len = sizeof(addr);
+    CHECK(getsockname(fd, (struct sockaddr *)&addr, &len), -1);
+    return ntohs(addr.sin_port);
+}
+
+static int echo(int serverfd)
+{
+    char buf[64];
+    struct sockaddr_in peer;
+    socklen_t len = sizeof(peer);
+    ssize_t n;
+    CHECK(n = recvfrom(serverfd, buf, sizeof(buf), 0, (struct sockaddr *)&peer, &len), -1);
+    CHECK(sendto(serverfd, buf, n, 0, (struct sockaddr *)&peer, len), -1);
+    return 0;
+}
+
+int main()
+{
+    int serverfd;
+    CHECK(serverfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+
+    // The init in our minimal VM setup doesn't bring loopback up (see
+    // tcpv4_connect.c)
+    struct ifreq lo_up_req;
+    strcpy(lo_up_req.ifr_name, "lo");
+    CHECK(ioctl(serverfd, SIOCGIFFLAGS, &lo_up_req), -1);
+    lo_up_req.ifr_flags |= IFF_UP;
+    CHECK(ioctl(serverfd, SIOCSIFFLAGS, &lo_up_req), -1);
+
+    struct sockaddr_in serveraddr;
+    memset(&serveraddr, 0, sizeof(serveraddr));
+    serveraddr.sin_family      = AF_INET;
+    serveraddr.sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+    serveraddr.sin_port        = 0;
+    CHECK(bind(serverfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+    int server_port;
+    CHECK(server_port = port_of(serverfd), -1);
+    serveraddr.sin_port = htons(server_port);
+
+    const char msg[] = "ping";
+    char buf[64];
+
+    int unconnectedfd;
+    CHECK(unconnectedfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+    CHECK(sendto(unconnectedfd, msg, sizeof(msg), 0, (struct sockaddr *)&serveraddr,
+                 sizeof(serveraddr)),
+          -1);
+    CHECK(echo(serverfd), -1);
+    CHECK(recvfrom(unconnectedfd, buf, sizeof(buf), 0, NULL, NULL), -1);
+    int unconnected_port;
+    CHECK(unconnected_port = port_of(unconnectedfd), -1);
+
+    int connectedfd;
+    CHECK(connectedfd = socket(AF_INET, SOCK_DGRAM, 0), -1);
+    CHECK(connect(connectedfd, (struct sockaddr *)&serveraddr, sizeof(serveraddr)), -1);
+    CHECK(send(connectedfd, msg, sizeof(msg), 0), -1);
+    CHECK(echo(serverfd), -1);
+    CHECK(recv(connectedfd, buf, sizeof(buf), 0), -1);
+    int connected_port;
+    CHECK(connected_port = port_of(connectedfd), -1);
+
+    CHECK(close(unconnectedfd), -1);
+    CHECK(close(connectedfd), -1);
+    CHECK(close(serverfd), -1);
+
+    printf("{ \"pid\": %d, \"server_port\": %d, \"unconnected_port\": %d, "
+           "\"connected_port\": %d, \"bytes\": %zu }\n",
+           getpid(), server_port, unconnected_port, connected_port, sizeof(msg));
+
+    return 0;
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Creates an AF_UNIX listening socket bound to a path and one bound to a name
+// in the abstract namespace, connects to and accepts on each, closes all
+// sockets and exits. Used to test AF_UNIX network connection events.
+
+#include <stddef.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <sys/un.h>
+#include <unistd.h>
+
+#include "common.h"
+
+#define SOCKET_PATH "/unix_connect_test.sock"
+#define ABSTRACT_NAME "unix_connect_test"
+
+// Binds a listening socket to addr, connects to it and accepts the connection
+static int connect_accept(struct sockaddr_un *addr, socklen_t len)
+{
+    int listenfd, connectfd, acceptfd;
+    CHECK(listenfd = socket(AF_UNIX, SOCK_STREAM, 0), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)addr, len), -1);
+    CHECK(listen(listenfd, 1), -1);
+
+    CHECK(connectfd = socket(AF_UNIX, SOCK_STREAM, 0), -1);
+    CHECK(connect(connectfd, (struct sockaddr *)addr, len), -1);
+    CHECK(acceptfd = accept(listenfd, NULL, NULL), -1);
+
+    close(acceptfd);
+    close(connectfd);
+    close(listenfd);
+
+    return 0;
+}
+
+int main()
+{
+    struct sockaddr_un addr;
+
+    memset(&addr, 0, sizeof(addr));
+    addr.sun_family = AF_UNIX;
+    strcpy(addr.sun_path, SOCKET_PATH);
+    unlink(SOCKET_PATH);
+    CHECK(connect_accept(&addr, sizeof(addr)), -1);
+    CHECK(unlink(SOCKET_PATH), -1);
+
+    // Abstract names aren't NUL-terminated, the address length says where
+    // they end
+    memset(&addr, 0, sizeof(addr));
+    addr.sun_family = AF_UNIX;
+    memcpy(addr.sun_path + 1, ABSTRACT_NAME, strlen(ABSTRACT_NAME));
+    socklen_t len = offsetof(struct sockaddr_un, sun_path) + 1 + strlen(ABSTRACT_NAME);
+    CHECK(connect_accept(&addr, len), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+
+    char netns[128];
+    ssize_t nbytes;
+    CHECK(nbytes = readlink("/proc/self/ns/net", netns, sizeof(netns)), -1);
+    netns[nbytes] = '\0';
+
+    uint64_t netns_inode;
+    sscanf(netns, "net:[%lu]", &netns_inode);
+
+    printf("{ \"pid_info\": %s, \"path\": \"%s\", \"abstract_name\": \"%s\", \"netns\": %lu }\n",
+           pid_info, SOCKET_PATH, ABSTRACT_NAME, netns_inode);
+
+    return 0;
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Listens on an AF_UNIX socket and forks a child that drops to another uid
+// and gid and connects to it, then another that connects and exits before
+// the connection is accepted. Used to test the peer credentials of AF_UNIX
+// network connection events.
+
+#include <stddef.h>
+#include <stdint.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <sys/types.h>
+#include <sys/un.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+// Abstract, so the child doesn't need permission to write to a socket file
+#define ABSTRACT_NAME "unix_peercred_test"
+#define CHILD_UID 1000
+#define CHILD_GID 1001
+
+static int connect_to(struct sockaddr_un *addr, socklen_t len, int wait_for_close)
+{
+    int connectfd;
+    CHECK(connectfd = socket(AF_UNIX, SOCK_STREAM, 0), -1);
+    CHECK(connect(connectfd, (struct sockaddr *)addr, len), -1);
+
+    // Keep the child around until the connection is accepted and closed
+    if (wait_for_close) {
+        char c;
+        CHECK(read(connectfd, &c, sizeof(c)), -1);
+    }
+
+    close(connectfd);
+    return 0;
+}
+
+static int accept_from(int listenfd, pid_t pid)
+{
+    int acceptfd, wstatus;
+    CHECK(acceptfd = accept(listenfd, NULL, NULL), -1);
+    close(acceptfd);
+
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child %d failed\n", pid);
+        return -1;
+    }
+
+    return 0;
+}
+
+int main()
+{
+    struct sockaddr_un addr;
+    memset(&addr, 0, sizeof(addr));
+    addr.sun_family = AF_UNIX;
+    memcpy(addr.sun_path + 1, ABSTRACT_NAME, strlen(ABSTRACT_NAME));
+    socklen_t len = offsetof(struct sockaddr_un, sun_path) + 1 + strlen(ABSTRACT_NAME);
+
+    int listenfd;
+    CHECK(listenfd = socket(AF_UNIX, SOCK_STREAM, 0), -1);
+    CHECK(bind(listenfd, (struct sockaddr *)&addr, len), -1);
+    CHECK(listen(listenfd, 2), -1);
+
+    pid_t child_pid;
+    CHECK(child_pid = fork(), -1);
+    if (child_pid == 0) {
+        if (setgid(CHILD_GID) < 0 || setuid(CHILD_UID) < 0) {
+            perror("setgid/setuid");
+            _exit(1);
+        }
+        _exit(connect_to(&addr, len, 1) < 0);
+    }
+    CHECK(accept_from(listenfd, child_pid), -1);
+
+    // Connects and is reaped before the connection is accepted
+    pid_t exited_pid;
+    CHECK(exited_pid = fork(), -1);
+    if (exited_pid == 0)
+        _exit(connect_to(&addr, len, 0) < 0);
+    CHECK(waitpid(exited_pid, NULL, 0), -1);
+
+    int acceptfd;
+    CHECK(acceptfd = accept(listenfd, NULL, NULL), -1);
+    close(acceptfd);
+    close(listenfd);
+
+    printf("{ \"pid\": %d, \"uid\": %d, \"gid\": %d, \"child_pid\": %d, \"child_uid\": %d, "
+           "\"child_gid\": %d, \"exited_pid\": %d, \"abstract_name\": \"%s\" }\n",
+           getpid(), geteuid(), getegid(), child_pid, CHILD_UID, CHILD_GID, exited_pid,
+           ABSTRACT_NAME);
+
+    return 0;
+}
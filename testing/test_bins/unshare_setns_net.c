@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Moves itself to a new network namespace with unshare, then back to the
+// original one with setns on an fd opened beforehand. Prints its pid info and
+// the inode number of the original network namespace. Used to test the
+// PROCESS_UNSHARE and PROCESS_SETNS events.
+#define _GNU_SOURCE
+
+#include <fcntl.h>
+#include <sched.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <sys/stat.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    int fd;
+    CHECK(fd = open("/proc/self/ns/net", O_RDONLY), -1);
+
+    struct stat st;
+    CHECK(fstat(fd, &st), -1);
+
+    CHECK(unshare(CLONE_NEWNET), -1);
+    CHECK(setns(fd, CLONE_NEWNET), -1);
+    CHECK(close(fd), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"net_ns\": %lu }\n", pid_info, (unsigned long)st.st_ino);
+
+    return 0;
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Moves itself to new UTS and network namespaces with unshare, then forks a
+// child that exits right away. Prints its pid info, the child's pid and the
+// inode numbers of the namespaces it was in before the unshare. Used to test
+// the namespaces of process events.
+#define _GNU_SOURCE
+
+#include <sched.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+// Reads the inode number of /proc/self/ns/<name>, a link to "<name>:[<inode>]"
+static uint32_t ns_inode(const char *name)
+{
+    char path[64], link[64];
+    snprintf(path, sizeof(path), "/proc/self/ns/%s", name);
+
+    ssize_t nbytes;
+    CHECK(nbytes = readlink(path, link, sizeof(link) - 1), -1);
+    link[nbytes] = '\0';
+
+    uint32_t inode = 0;
+    sscanf(link, "%*[^[][%u]", &inode);
+    return inode;
+}
+
+int main()
+{
+    char namespaces[512];
+    snprintf(namespaces, sizeof(namespaces),
+             "{\"mnt\": %u, \"net\": %u, \"pid\": %u, \"user\": %u, \"uts\": %u, \"ipc\": %u, "
+             "\"cgroup\": %u}",
+             ns_inode("mnt"), ns_inode("net"), ns_inode("pid"), ns_inode("user"),
+             ns_inode("uts"), ns_inode("ipc"), ns_inode("cgroup"));
+
+    CHECK(unshare(CLONE_NEWUTS | CLONE_NEWNET), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+    if (pid == 0)
+        _exit(0);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"pid_info\": %s, \"child_pid\": %d, \"namespaces\": %s }\n", pid_info, pid,
+           namespaces);
+
+    return 0;
+}
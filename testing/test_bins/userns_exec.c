@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// Forks a child that moves into a new user namespace in which uid/gid 0 maps to
+// an unprivileged host uid/gid (as is done for a rootless container), becomes
+// root within it, then nests yet another user namespace inside that one and
+// execs ./do_nothing.
+//
+// Maps are as follows:
+//
+// host uid/gid 1000 -> uid/gid 0 in the first namespace -> uid/gid 5 in the
+// nested namespace
+#define _GNU_SOURCE
+
+#include <fcntl.h>
+#include <sched.h>
+#include <stdio.h>
+#include <string.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+const int host_id   = 1000;
+const int userns_id = 0;
+const int nested_id = 5;
+
+static int write_file(const char *path, const char *buf)
+{
+    int fd;
+    CHECK(fd = open(path, O_WRONLY), -1);
+    CHECK(write(fd, buf, strlen(buf)), -1);
+    CHECK(close(fd), -1);
+
+    return 0;
+}
+
+static int write_maps(const char *proc_dir, int id, int lower_id)
+{
+    char path[256], map[256];
+    snprintf(map, sizeof(map), "%d %d 1\n", id, lower_id);
+
+    snprintf(path, sizeof(path), "%s/uid_map", proc_dir);
+    CHECK(write_file(path, map), -1);
+
+    // gid_map can't be written by an unprivileged process unless setgroups is
+    // denied
+    snprintf(path, sizeof(path), "%s/setgroups", proc_dir);
+    CHECK(write_file(path, "deny"), -1);
+
+    snprintf(path, sizeof(path), "%s/gid_map", proc_dir);
+    CHECK(write_file(path, map), -1);
+
+    return 0;
+}
+
+static int child(int ready_fd, int mapped_fd)
+{
+    char c;
+
+    CHECK(unshare(CLONE_NEWUSER), -1);
+    CHECK(write(ready_fd, "x", 1), -1);
+    CHECK(read(mapped_fd, &c, 1), -1);
+
+    // Become root in the first namespace, i.e. host_id on the host
+    CHECK(setresgid(userns_id, userns_id, userns_id), -1);
+    CHECK(setresuid(userns_id, userns_id, userns_id), -1);
+
+    // Nested namespace, which we're allowed to map ourselves into without any
+    // help from a more privileged process as it's a single id mapping of our
+    // own ids
+    CHECK(unshare(CLONE_NEWUSER), -1);
+    CHECK(write_maps("/proc/self", nested_id, userns_id), -1);
+
+    CHECK(execl("./do_nothing", "./do_nothing", NULL), -1);
+
+    return 0;
+}
+
+int main()
+{
+    int ready[2], mapped[2];
+    CHECK(pipe(ready), -1);
+    CHECK(pipe(mapped), -1);
+
+    pid_t pid;
+    CHECK(pid = fork(), -1);
+
+    if (pid == 0)
+        return child(ready[1], mapped[0]);
+
+    char c;
+    CHECK(read(ready[0], &c, 1), -1);
+
+    char proc_dir[256];
+    snprintf(proc_dir, sizeof(proc_dir), "/proc/%d", pid);
+    CHECK(write_maps(proc_dir, userns_id, host_id), -1);
+
+    CHECK(write(mapped[1], "x", 1), -1);
+
+    int wstatus;
+    CHECK(wait(&wstatus), -1);
+    if (!WIFEXITED(wstatus) || WEXITSTATUS(wstatus) != 0) {
+        fprintf(stderr, "child exited abnormally, see errors\n");
+        return 1;
+    }
+
+    printf("{ \"child_pid\": %d, \"host_id\": %d, \"userns_id\": %d, \"nested_id\": %d }\n", pid,
+           host_id, userns_id, nested_id);
+
+    return 0;
+}
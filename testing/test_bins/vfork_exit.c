@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+// vforks a child that exits immediately, then prints the parent's pid info and
+// the child's pid. Used to test the PROCESS_FORK event of a vfork.
+
+#include <stdio.h>
+#include <sys/types.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "common.h"
+
+int main()
+{
+    pid_t pid;
+    CHECK(pid = vfork(), -1);
+
+    // The child borrows the parent's address space and stack, all it may do
+    // is exit or exec
+    if (pid == 0)
+        _exit(0);
+
+    int wstatus;
+    CHECK(waitpid(pid, &wstatus, 0), -1);
+
+    char pid_info[8192];
+    gen_pid_info_json(pid_info, sizeof(pid_info));
+    printf("{ \"parent_info\": %s, \"child_pid\": %d }\n", pid_info, pid);
+
+    return 0;
+}
@@ -15,7 +15,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -26,18 +34,64 @@ type EventsTraceInstance struct {
 	StdoutChan chan string
 	StderrChan chan string
 	InitMsg    InitMsg
+
+	// Only set on the per-test views of an instance shared by
+	// RunTestsParallel, in which case StdoutChan only carries the events
+	// routed to that test
+	demux *eventDemux
+
+	// Shared with those views, see LostEventCount
+	lost *lostEvents
+
+	// Shared with those views too, see Subscribe
+	subs *subscriptions
+}
+
+// Accessed atomically
+type lostEvents struct {
+	// events_dropped of the last STATS message read
+	bpfDropped int64
+	// Stdout lines dropped for lack of room in StdoutChan, in a
+	// subscription's channel or in a demux's backlog
+	linesDropped int64
+}
+
+// Keeps track of the drops reported by a STATS line
+func (l *lostEvents) recordStats(line string) {
+	var stats StatsMsg
+	if err := json.Unmarshal([]byte(line), &stats); err != nil {
+		TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+	}
+	atomic.StoreInt64(&l.bpfDropped, stats.EventsDropped)
+}
+
+// Returns how many events were lost so far, either in BPF because the
+// ringbuffer was full or by the testrunner because StdoutChan was. The BPF
+// count is only as recent as the last STATS message read, EventsTrace prints
+// one every second.
+func (et *EventsTraceInstance) LostEventCount() int64 {
+	return atomic.LoadInt64(&et.lost.bpfDropped) + atomic.LoadInt64(&et.lost.linesDropped)
 }
 
 const streamChanSize = 200000
+
+// Events a subscription's handler can fall behind by before further events are
+// dropped for it, see Subscribe
+const subscriptionChanSize = 4096
 const eventsTraceBinPath = "/EventsTrace"
 
+// How long GetNextEventJson waits for a matching event. Shorter than the
+// lifetime of an EventsTrace instance started by RunEventsTest, so a missing
+// event fails with a timeout rather than EventsTrace being killed under it.
+const defaultEventTimeout = 20 * time.Second
+
 func (et *EventsTraceInstance) Start(ctx context.Context) {
 	if err := et.Cmd.Start(); err != nil {
-		fmt.Println("failed to start EventsTrace: ", err)
-		TestFail()
+		TestFail("failed to start EventsTrace: ", err)
 	}
 
-	readStreamFunc := func(streamCtx context.Context, c chan string, stream io.ReadCloser) {
+	readStreamFunc := func(streamCtx context.Context, c chan string, stream io.ReadCloser,
+		dropped *int64, tee func(string)) {
 		defer close(c)
 
 		for {
@@ -47,6 +101,10 @@ func (et *EventsTraceInstance) Start(ctx context.Context) {
 			default:
 				scanner := bufio.NewScanner(stream)
 				for scanner.Scan() {
+					if tee != nil {
+						tee(scanner.Text())
+					}
+
 					select {
 					case c <- scanner.Text():
 						break
@@ -56,6 +114,9 @@ func (et *EventsTraceInstance) Start(ctx context.Context) {
 						// forever trying to write to stdout/stderr and the
 						// test will time out
 						fmt.Println("dropped EventsTrace stdout/stderr due to full channel")
+						if dropped != nil {
+							atomic.AddInt64(dropped, 1)
+						}
 					}
 				}
 
@@ -70,8 +131,11 @@ func (et *EventsTraceInstance) Start(ctx context.Context) {
 	et.StdoutChan = make(chan string, streamChanSize)
 	et.StderrChan = make(chan string, streamChanSize)
 
-	go readStreamFunc(ctx, et.StdoutChan, et.Stdout)
-	go readStreamFunc(ctx, et.StderrChan, et.Stderr)
+	go func() {
+		defer et.subs.close()
+		readStreamFunc(ctx, et.StdoutChan, et.Stdout, &et.lost.linesDropped, et.subs.publish)
+	}()
+	go readStreamFunc(ctx, et.StderrChan, et.Stderr, nil, nil)
 
 	// Block until EventsTrace logs its "probes ready" line, indicating it's
 	// done loading
@@ -96,29 +160,511 @@ func (et *EventsTraceInstance) DumpStderr() {
 }
 
 func (et *EventsTraceInstance) GetNextEventJson(types ...string) string {
-	var line string
-loop:
+	line, ok := et.GetNextEventJsonWithTimeout(defaultEventTimeout, types...)
+	if !ok {
+		et.failWait(fmt.Sprintf("a %s event", strings.Join(types, " or ")))
+	}
+
+	return line
+}
+
+// Fails the test after waiting for what in vain. Lost events are the likelier
+// explanation if there were any, so that's what's reported then.
+func (et *EventsTraceInstance) failWait(what string) {
+	et.DumpStderr()
+	if lost := et.LostEventCount(); lost > 0 {
+		TestFail(fmt.Sprintf("%d events lost, test unreliable (timed out waiting for %s), "+
+			"dumped stderr above", lost, what))
+	}
+
+	TestFail(fmt.Sprintf("timed out after %s waiting for %s, dumped stderr above",
+		defaultEventTimeout, what))
+}
+
+// Returns the first eventType event for which match returns true, failing the
+// test if none arrives within defaultEventTimeout. Non-matching events are
+// discarded.
+func WaitForEvent[T any](et *EventsTraceInstance, eventType string, match func(T) bool) T {
+	deadline := time.Now().Add(defaultEventTimeout)
+	for {
+		line, ok := et.GetNextEventJsonWithTimeout(time.Until(deadline), eventType)
+		if !ok {
+			et.failWait(fmt.Sprintf("a matching %s event", eventType))
+		}
+
+		var ev T
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if match(ev) {
+			return ev
+		}
+	}
+}
+
+// Event types to wait for, parsed once per wait. A type ending in "*" matches
+// every type starting with what precedes it ("FILE_*", or "*" for any event),
+// other types containing glob metacharacters are matched with path.Match and
+// the rest exactly. Patterns never match STATS lines, only "STATS" itself does.
+type typeMatcher struct {
+	exact    map[string]bool
+	prefixes []string
+	globs    []string
+}
+
+func newTypeMatcher(types []string) typeMatcher {
+	m := typeMatcher{exact: make(map[string]bool)}
+	for _, t := range types {
+		switch {
+		case !strings.ContainsAny(t, "*?[\\"):
+			m.exact[t] = true
+		case strings.IndexAny(t, "*?[\\") == len(t)-1 && t[len(t)-1] == '*':
+			m.prefixes = append(m.prefixes, t[:len(t)-1])
+		default:
+			if _, err := path.Match(t, ""); err != nil {
+				TestFail(fmt.Sprintf("bad event type pattern %q", t), err)
+			}
+			m.globs = append(m.globs, t)
+		}
+	}
+
+	return m
+}
+
+func (m typeMatcher) match(eventType string) bool {
+	if m.exact[eventType] {
+		return true
+	}
+	if eventType == "STATS" {
+		return false
+	}
+
+	for _, p := range m.prefixes {
+		if strings.HasPrefix(eventType, p) {
+			return true
+		}
+	}
+	for _, g := range m.globs {
+		if ok, _ := path.Match(g, eventType); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the next event of one of types, or false if none arrived within
+// timeout. Events of other types read in the meantime are discarded. Types
+// may be patterns, see typeMatcher.
+//
+// Lines are only ever sent to StdoutChan whole, a line EventsTrace is still
+// writing when the timeout fires is left to the next call rather than lost.
+func (et *EventsTraceInstance) GetNextEventJsonWithTimeout(timeout time.Duration,
+	types ...string) (string, bool) {
+	m := newTypeMatcher(types)
+	deadline := time.After(timeout)
 	for {
+		line, eventType, ok := et.nextLine(deadline)
+		if !ok {
+			return "", false
+		}
+
+		if m.match(eventType) {
+			return line, true
+		}
+	}
+}
+
+// Returns the next line of any type along with its type, or false once
+// deadline fires. Keeps track of the drops reported by STATS lines.
+func (et *EventsTraceInstance) nextLine(deadline <-chan time.Time) (string, string, bool) {
+	select {
+	case line, ok := <-et.StdoutChan:
+		if !ok {
+			et.DumpStderr()
+			TestFail("EventsTrace stdout closed while waiting for events, dumped stderr above")
+		}
+
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			et.DumpStderr()
+			TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+		}
+
+		if eventType == "STATS" {
+			et.lost.recordStats(line)
+		}
+
+		return line, eventType, true
+	case <-deadline:
+		return "", "", false
+	}
+}
+
+type subscription struct {
+	types typeMatcher
+	c     chan json.RawMessage
+}
+
+type subscriptions struct {
+	mu     sync.Mutex
+	subs   []subscription
+	closed bool
+	lost   *lostEvents
+}
+
+// Calls handler, from a goroutine of its own, with every eventType event
+// EventsTrace prints from now on until it exits. eventType may be a pattern,
+// see typeMatcher. Events are delivered whether or not they are also read
+// with GetNextEventJson, and on the views of RunTestsParallel a subscription
+// sees every event of the shared instance, not just those routed to the view.
+//
+// Handlers are called one event at a time, in order. Up to
+// subscriptionChanSize events are queued for a handler that's still busy,
+// further events are dropped for it (reading events must never block, see
+// Start) and counted by LostEventCount.
+func (et *EventsTraceInstance) Subscribe(eventType string, handler func(json.RawMessage)) {
+	sub := subscription{
+		types: newTypeMatcher([]string{eventType}),
+		c:     make(chan json.RawMessage, subscriptionChanSize),
+	}
+
+	et.subs.mu.Lock()
+	defer et.subs.mu.Unlock()
+	if et.subs.closed {
+		return
+	}
+	et.subs.subs = append(et.subs.subs, sub)
+
+	go func() {
+		for ev := range sub.c {
+			handler(ev)
+		}
+	}()
+}
+
+func (s *subscriptions) publish(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.subs) == 0 {
+		return
+	}
+
+	eventType, err := getJsonEventType(line)
+	if err != nil {
+		// nextLine fails the test on these
+		return
+	}
+
+	for _, sub := range s.subs {
+		if !sub.types.match(eventType) {
+			continue
+		}
+
 		select {
-		case line = <-et.StdoutChan:
-			eventType, err := getJsonEventType(line)
-			if err != nil {
-				et.DumpStderr()
-				TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+		case sub.c <- json.RawMessage(line):
+		default:
+			fmt.Println("dropped EventsTrace stdout due to full subscription channel")
+			atomic.AddInt64(&s.lost.linesDropped, 1)
+		}
+	}
+}
+
+// Stops the handler goroutines once they've caught up, EventsTrace exited
+func (s *subscriptions) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for _, sub := range s.subs {
+		close(sub.c)
+	}
+	s.subs = nil
+}
+
+// Discards events of any type until one for which match returns true, which
+// is returned, failing the test if none arrives within defaultEventTimeout.
+// Lets a test skip whatever earlier test binaries left behind.
+func (et *EventsTraceInstance) DrainUntil(match func(line string) bool) string {
+	deadline := time.After(defaultEventTimeout)
+	for {
+		line, _, ok := et.nextLine(deadline)
+		if !ok {
+			et.failWait("a matching event")
+		}
+
+		if match(line) {
+			return line
+		}
+	}
+}
+
+// DrainUntil the first event generated by process tgid, which is returned.
+// Like eventDemux.route, forks are matched on their parent.
+func (et *EventsTraceInstance) DrainForPid(tgid int64) string {
+	return et.DrainUntil(func(line string) bool {
+		var ev struct {
+			Pids       PidInfo `json:"pids"`
+			ParentPids PidInfo `json:"parent_pids"`
+		}
+		if json.Unmarshal([]byte(line), &ev) != nil {
+			return false
+		}
+		return ev.Pids.Tgid == tgid || ev.ParentPids.Tgid == tgid
+	})
+}
+
+// Matches a single event for ExpectEventsInOrder. Name is only used to make
+// failures readable.
+type EventMatcher struct {
+	Name  string
+	Type  string
+	Match func(line string) bool
+}
+
+type matchedEvent struct {
+	matcher *EventMatcher
+	hdr     EventHeader
+}
+
+// Events on the same CPU are ordered by their sub-sequence number, which is
+// exact. Events on different CPUs can only be ordered by their timestamp.
+func eventHeaderBefore(a, b EventHeader) bool {
+	if a.Cpu == b.Cpu {
+		return a.Subseq < b.Subseq
+	}
+	return a.KtimeNs < b.KtimeNs
+}
+
+// Reads events until every matcher has matched one of them (the first
+// matching event is used for each), then asserts the matched events were
+// generated in the order the matchers were given in.
+func (et *EventsTraceInstance) ExpectEventsInOrder(matchers ...EventMatcher) {
+	var types []string
+	for _, m := range matchers {
+		types = append(types, m.Type)
+	}
+
+	matched := make([]*matchedEvent, len(matchers))
+	for remaining := len(matchers); remaining > 0; {
+		line := et.GetNextEventJson(types...)
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+		}
+
+		for i := range matchers {
+			if matched[i] != nil || matchers[i].Type != eventType || !matchers[i].Match(line) {
+				continue
 			}
 
-			for _, a := range types {
-				if a == eventType {
-					break loop
-				}
+			var hdr EventHeader
+			if err := json.Unmarshal([]byte(line), &hdr); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			matched[i] = &matchedEvent{&matchers[i], hdr}
+			remaining--
+			break
+		}
+	}
+
+	inOrder := true
+	for i := 1; i < len(matched); i++ {
+		if !eventHeaderBefore(matched[i-1].hdr, matched[i].hdr) {
+			inOrder = false
+		}
+	}
+	if inOrder {
+		return
+	}
+
+	observed := make([]*matchedEvent, len(matched))
+	copy(observed, matched)
+	sort.SliceStable(observed, func(i, j int) bool {
+		return eventHeaderBefore(observed[i].hdr, observed[j].hdr)
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "events out of order\n%-4s %-32s %s\n", "", "expected", "observed")
+	for i := range matched {
+		marker := "   "
+		if matched[i] != observed[i] {
+			marker = "!= "
+		}
+		o := observed[i]
+		fmt.Fprintf(&b, "%-4s %-32s %s (%s ktime_ns=%d cpu=%d subseq=%d)\n", marker,
+			matched[i].matcher.Name, o.matcher.Name, o.matcher.Type, o.hdr.KtimeNs, o.hdr.Cpu,
+			o.hdr.Subseq)
+	}
+	TestFail(b.String())
+}
+
+// Pauses event emission in EventsTrace, blocking until it has acknowledged the
+// pause on stderr
+func (et *EventsTraceInstance) Pause() {
+	et.signalAndWait(syscall.SIGUSR1, "Events paused")
+}
+
+// Resumes event emission in EventsTrace, blocking until it has acknowledged
+// the resume on stderr
+func (et *EventsTraceInstance) Resume() {
+	et.signalAndWait(syscall.SIGUSR2, "Events resumed")
+}
+
+func (et *EventsTraceInstance) signalAndWait(sig os.Signal, ack string) {
+	if err := et.Cmd.Process.Signal(sig); err != nil {
+		TestFail(fmt.Sprintf("Could not send %s to EventsTrace: %s", sig, err))
+	}
+
+	deadline := time.After(defaultEventTimeout)
+	for {
+		select {
+		case line := <-et.StderrChan:
+			if line == ack {
+				return
 			}
-		case <-time.After(60 * time.Second):
+		case <-deadline:
 			et.DumpStderr()
-			TestFail("timed out waiting for EventsTrace output, dumped stderr above")
+			TestFail(fmt.Sprintf("timed out waiting for EventsTrace to log \"%s\", dumped stderr above", ack))
 		}
 	}
+}
 
-	return line
+// Only has EventsTrace print events of pids and of processes they fork from
+// then on. Must be called before Start, the filter is set up before any event
+// is read.
+func (et *EventsTraceInstance) SetPidFilter(pids ...int) {
+	if et.Cmd.Process != nil {
+		TestFail("SetPidFilter called after EventsTrace was started")
+	}
+
+	var strs []string
+	for _, pid := range pids {
+		strs = append(strs, strconv.Itoa(pid))
+	}
+	et.Cmd.Args = append(et.Cmd.Args, "--pid-filter="+strings.Join(strs, ","))
+}
+
+// Runs a test binary like runTestBin. On an instance shared by
+// RunTestsParallel, the events of the binary (and of the processes it forks)
+// are routed to the calling test.
+func (et *EventsTraceInstance) RunTestBin(binName string) []byte {
+	if et.demux == nil {
+		return runTestBin(binName)
+	}
+
+	return runTestBinWith(binName, func(pid int) {
+		et.demux.register(int64(pid), et.StdoutChan)
+	})
+}
+
+// Routes the events of an EventsTrace instance shared by several tests to the
+// test that spawned the process they were generated in, keyed by tgid.
+// Processes forked by a routed process are routed to the same test, which
+// relies on PROCESS_FORK events being enabled.
+//
+// A single goroutine routes every line in the order EventsTrace printed them,
+// so the events each test sees are in the same order as in serial mode.
+type eventDemux struct {
+	mu     sync.Mutex
+	routes map[int64]chan string
+	lost   *lostEvents
+
+	// Events nobody was waiting for yet. A test can only register a process
+	// after starting it, by which time some of its events may already have
+	// been read, those are picked up from here on registration.
+	backlog []string
+}
+
+func newEventDemux(in chan string, lost *lostEvents) *eventDemux {
+	d := &eventDemux{routes: make(map[int64]chan string), lost: lost}
+	go d.run(in)
+	return d
+}
+
+func (d *eventDemux) run(in chan string) {
+	for line := range in {
+		// Not generated by any process, so never routed, but the drops they
+		// report have to be kept track of as in serial mode
+		if eventType, err := getJsonEventType(line); err == nil && eventType == "STATS" {
+			d.lost.recordStats(line)
+			continue
+		}
+
+		d.mu.Lock()
+		if !d.route(line) {
+			d.backlog = append(d.backlog, line)
+			if len(d.backlog) > streamChanSize {
+				d.backlog = d.backlog[1:]
+				atomic.AddInt64(&d.lost.linesDropped, 1)
+			}
+		}
+		d.mu.Unlock()
+	}
+
+	// EventsTrace exited, wake up every test still waiting for events
+	d.mu.Lock()
+	closed := make(map[chan string]bool)
+	for _, c := range d.routes {
+		if !closed[c] {
+			close(c)
+			closed[c] = true
+		}
+	}
+	d.mu.Unlock()
+}
+
+// Must be called with mu held. Returns false if nobody's waiting for line.
+func (d *eventDemux) route(line string) bool {
+	var event struct {
+		Pids       PidInfo `json:"pids"`
+		ParentPids PidInfo `json:"parent_pids"`
+		ChildPids  PidInfo `json:"child_pids"`
+	}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return false
+	}
+
+	// Forks are generated in the parent
+	tgid := event.Pids.Tgid
+	if event.ParentPids.Tgid != 0 {
+		tgid = event.ParentPids.Tgid
+	}
+
+	c, ok := d.routes[tgid]
+	if !ok {
+		return false
+	}
+
+	if event.ChildPids.Tgid != 0 {
+		d.routes[event.ChildPids.Tgid] = c
+	}
+
+	select {
+	case c <- line:
+	default:
+		fmt.Println("dropped EventsTrace stdout due to full channel")
+		atomic.AddInt64(&d.lost.linesDropped, 1)
+	}
+	return true
+}
+
+func (d *eventDemux) register(tgid int64, c chan string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.routes[tgid] = c
+
+	// In order, so forks in the backlog register children before their
+	// events are looked at
+	var unrouted []string
+	for _, line := range d.backlog {
+		if !d.route(line) {
+			unrouted = append(unrouted, line)
+		}
+	}
+	d.backlog = unrouted
 }
 
 func (et *EventsTraceInstance) Stop() error {
@@ -131,21 +677,23 @@ func (et *EventsTraceInstance) Stop() error {
 }
 
 func NewEventsTrace(ctx context.Context, args ...string) *EventsTraceInstance {
-	var et EventsTraceInstance
+	lost := &lostEvents{}
+	et := EventsTraceInstance{lost: lost, subs: &subscriptions{lost: lost}}
+	// Keeps LostEventCount up to date, tests' own --stats-interval come after
+	// it and take precedence
+	args = append([]string{"--stats-interval=1"}, args...)
 	args = append(args, "--print-features-on-init", "--unbuffer-stdout", "--libbpf-verbose")
 	et.Cmd = exec.CommandContext(ctx, eventsTraceBinPath, args...)
 
 	stdout, err := et.Cmd.StdoutPipe()
 	if err != nil {
-		fmt.Println("failed to redirect stdout: ", err)
-		TestFail()
+		TestFail("failed to redirect stdout: ", err)
 	}
 	et.Stdout = stdout
 
 	stderr, err := et.Cmd.StderrPipe()
 	if err != nil {
-		fmt.Println("failed to redirect stderr: ", err)
-		TestFail()
+		TestFail("failed to redirect stderr: ", err)
 	}
 	et.Stderr = stderr
 
@@ -1,3 +1,3 @@
 module github.com/elastic/ebpf/testrunner
 
-go 1.17
+go 1.18
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Elastic-2.0
+
+/*
+ * Copyright 2022 Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under
+ * one or more contributor license agreements. Licensed under the Elastic
+ * License 2.0; you may not use this file except in compliance with the Elastic
+ * License 2.0.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// How to run the BPFTcFilterTests gtest binary
+type TcFilterTestsConfig struct {
+	BinPath string
+
+	// TcFilter.bpf.o to test, passed to the binary in
+	// ELASTIC_EBPF_TC_FILTER_OBJ_PATH
+	ObjectPath string
+
+	// Where gtest writes its JSON report (--gtest_output=json:PATH)
+	ReportPath string
+}
+
+func (c TcFilterTestsConfig) Command() *exec.Cmd {
+	cmd := exec.Command(c.BinPath, "--gtest_output=json:"+c.ReportPath)
+	cmd.Env = append(os.Environ(), "ELASTIC_EBPF_TC_FILTER_OBJ_PATH="+c.ObjectPath)
+	return cmd
+}
+
+// Subset of the JSON report written by gtest binaries with --gtest_output=json
+type GTestReport struct {
+	Tests      int64            `json:"tests"`
+	Failures   int64            `json:"failures"`
+	TestSuites []GTestTestSuite `json:"testsuites"`
+}
+
+type GTestTestSuite struct {
+	Name     string            `json:"name"`
+	Tests    int64             `json:"tests"`
+	Failures int64             `json:"failures"`
+	Cases    []GTestTestResult `json:"testsuite"`
+}
+
+type GTestTestResult struct {
+	Name      string         `json:"name"`
+	ClassName string         `json:"classname"`
+	Status    string         `json:"status"`
+	Result    string         `json:"result"`
+	Failures  []GTestFailure `json:"failures"`
+}
+
+type GTestFailure struct {
+	// "file:line\nmessage" of the failed EXPECT_* or ASSERT_*
+	Failure string `json:"failure"`
+}
+
+func (r GTestTestResult) String() string {
+	s := fmt.Sprintf("%s.%s: %s %s", r.ClassName, r.Name, r.Status, r.Result)
+	for _, f := range r.Failures {
+		s += "\n  " + strings.ReplaceAll(f.Failure, "\n", "\n  ")
+	}
+	return s
+}
+
+// Results of all the test cases of all the suites in the report
+func (r GTestReport) Results() []GTestTestResult {
+	var results []GTestTestResult
+	for _, suite := range r.TestSuites {
+		results = append(results, suite.Cases...)
+	}
+	return results
+}
+
+func ReadGTestReport(path string) (GTestReport, error) {
+	var report GTestReport
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+
+	if err := json.Unmarshal(b, &report); err != nil {
+		return report, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+
+	return report, nil
+}
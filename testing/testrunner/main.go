@@ -10,29 +10,160 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 )
 
+// Tests that only look at the processes they spawn, so can share an
+// EventsTrace instance with -parallel
+var independentTests = []TestCase{
+	{Func: TestForkExit, Args: []string{"--process-fork"}},
+	{Func: TestForkExec, Args: []string{"--process-fork", "--process-exec"}},
+	{Func: TestVfork, Args: []string{"--process-fork"}},
+	{Func: TestClone3, Args: []string{"--process-fork"}},
+	{Func: TestThreadCreate, Args: []string{"--process-fork"}},
+	{Func: TestNamespaceIds, Args: []string{"--process-fork", "--process-exec"}},
+	{Func: TestUnshareSetns, Args: []string{"--process-unshare", "--process-setns"}},
+	{Func: TestSetsid, Args: []string{"--process-setsid"}},
+	{Func: TestSetuid, Args: []string{"--process-setuid"}},
+	{Func: TestSetgid, Args: []string{"--process-setgid"}},
+	{Func: TestSetresuid, Args: []string{"--process-setuid", "--process-setgid"}},
+	{Func: TestSetcap, Args: []string{"--process-setcap"}},
+	{Func: TestProcessSetSched, Args: []string{"--process-setsched"}},
+	{Func: TestChdir, Args: []string{"--process-chdir"}},
+	{Func: TestFileCreate, Args: []string{"--file-create"}},
+	{Func: TestFileChmod, Args: []string{"--file-modify-attr"}},
+	{Func: TestFileChown, Args: []string{"--file-modify-attr"}},
+	{Func: TestFileSymlink, Args: []string{"--file-symlink"}},
+	{Func: TestFileHardlink, Args: []string{"--file-hardlink"}},
+	{Func: TestFileTruncate, Args: []string{"--file-truncate"}},
+}
+
 func main() {
+	parallel := flag.Bool("parallel", false,
+		"Run independent tests concurrently against a single EventsTrace instance")
+	flag.StringVar(&reportPath, "report", "",
+		"Write a JSON report of every test's name, status, duration and failure message to this file")
+	flag.BoolVar(&failFast, "failfast", false,
+		"Stop at the first failed test instead of carrying on with the rest")
+	flag.Parse()
+
+	defer func() {
+		// A TestFail outside of any test, e.g. while setting up the
+		// parallel tests, ends the run but still makes it into the report
+		if r := recover(); r != nil {
+			failure, ok := r.(testFailure)
+			if !ok {
+				panic(r)
+			}
+			recordResult(TestResult{Name: "main", Status: "failed", Message: failure.message})
+		}
+
+		FinishTests()
+	}()
+
 	RunEventsTest(TestFeaturesCorrect)
-	RunEventsTest(TestForkExit, "--process-fork")
-	RunEventsTest(TestForkExec, "--process-fork", "--process-exec")
-	RunEventsTest(TestSetuid, "--process-setuid")
-	RunEventsTest(TestSetgid, "--process-setgid")
+
+	if *parallel {
+		RunTestsParallel(independentTests)
+	} else {
+		for _, tc := range independentTests {
+			RunEventsTestCase(tc)
+		}
+	}
+
+	RunEventsTest(TestProcessExit, "--process-exit")
+	RunEventsTest(TestParentArgv, "--process-exec")
+	RunEventsTest(TestForkExecOrdering, "--process-fork", "--process-exec")
+	RunEventsTest(TestFilesystemViewChange, "--filesystem-view-change", "--process-exec")
+	RunEventsTest(TestMount, "--fs-mount", "--fs-umount")
+	RunEventsTest(TestContainerStartTime, "--process-fork", "--process-exec")
+	RunEventsTest(TestSameCpuOrdering, "--process-fork", "--process-exit")
+	RunEventsTest(TestSubscribe, "--process-fork", "--process-exit")
+	RunEventsTest(TestNoThreads, "--process-fork", "--no-threads")
+	RunEventsTest(TestProcSeq, "--file-create", "--file-delete", "--proc-seq")
+	RunEventsTest(TestExecBurst, "--process-exec")
+	RunEventsTest(TestExecveatMemfd, "--process-exec")
+	RunEventsTest(TestExecMemfdName, "--process-exec")
+	RunEventsTest(TestExecArgvArray, "--process-exec")
+	RunEventsTest(TestExecEnvCapture, "--process-exec", "--capture-env")
+	RunEventsTest(TestExecHash, "--process-exec", "--hash-execs")
+	RunEventsTest(TestExecShebang, "--process-exec")
+	RunEventsTest(TestLolBin, "--process-exec")
+	RunEventsTest(TestLolBinCustomList, "--process-exec",
+		"--lolbin-list="+writeCustomLolBinList())
+	RunEventsTest(TestContainerExec, "--process-exec")
+	RunEventsTest(TestCgroupInfo, "--process-exec", "--process-exit")
+	RunEventsTest(TestDropAndRun, "--drop-and-run-window=60")
+	RunEventsTest(TestExecCapabilities, "--process-exec")
+	RunEventsTest(TestExecNoNewPrivs, "--process-exec")
+	RunEventsTest(TestExeFilesystemType, "--process-exec")
+	RunEventsTest(TestPauseResume, "--process-fork")
+	RunEventsTest(TestConfig, "--process-fork", "--file-create", "--stats-interval=30",
+		"--file-category=script,document")
+	RunEventsTest(TestStats, "--process-fork", "--file-create", "--stats-interval=1")
+	RunEventsTest(TestEventLoss, "--file-create")
+	RunEventsTest(TestEntityId, "--process-fork", "--process-exec", "--file-create", "--process-exit")
+	RunEventsTest(TestParentEntityId, "--process-fork", "--process-exec")
+	RunEventsTest(TestProcessBpfLink, "--process-bpf-link")
+	RunEventsTest(TestBpfSyscall, "--process-bpf-syscall")
+	RunEventsTest(TestProcessMmSpoof, "--process-mm-spoof")
+	RunEventsTest(TestPtraceAttach, "--process-ptrace")
+	RunEventsTest(TestSignalSend, "--process-signal")
+	RunEventsTest(TestMmapExec, "--process-mmap-exec")
+	RunEventsTest(TestMprotectRWX, "--process-mprotect")
+	RunEventsTest(TestMprotectVerbose, "--process-mprotect", "--mprotect-verbose")
+	RunEventsTest(TestModuleLoad, "--kernel-module-load")
+	RunEventsTest(TestUserNamespaceIds, "--process-setuid", "--process-exec")
 	RunEventsTest(TestTtyWrite, "--process-tty-write")
+	RunEventsTest(TestTtyWriteLarge, "--process-tty-write")
+	RunEventsTest(TestPtyWrite, "--process-tty-write")
 
-	RunEventsTest(TestFileCreate, "--file-create")
+	RunEventsTest(TestFileCreateChroot, "--file-create")
+	RunEventsTest(TestInodeGeneration, "--file-create")
 	RunEventsTest(TestFileDelete, "--file-delete")
+	RunEventsTest(TestFileCreateInode, "--file-create", "--file-delete")
+	RunEventsTest(TestFileOpen, "--trace-opens", "--open-paths=/file_open_test")
 	RunEventsTest(TestFileRename, "--file-rename")
+	RunEventsTest(TestFileRenameCrossDir, "--file-rename")
+	RunEventsTest(TestRenameExchange, "--file-rename")
+	RunEventsTest(TestFileCopy, "--file-copy")
+	RunEventsTest(TestFileCategory, "--file-create", "--file-category=script")
+	RunEventsTest(TestFileCategoryMagic, "--file-rename", "--file-category=script",
+		"--file-category-magic")
+	RunEventsTest(TestSecurityTamper, "--security-tamper", "--tamper-paths=/tmp",
+		"--tamper-comms=auditd")
+	RunEventsTest(TestDeviceAccess, "--device-access", "--device-paths=/tmp")
 
 	RunEventsTest(TestTcpv4ConnectionAttempt, "--net-conn-attempt")
 	RunEventsTest(TestTcpv4ConnectionAccept, "--net-conn-accept")
+	RunEventsTest(TestAccept4Flags, "--net-conn-accept")
 	RunEventsTest(TestTcpv4ConnectionClose, "--net-conn-close")
+	RunEventsTest(TestSocketLifecycleCorrelation, "--net-conn-attempt", "--net-conn-accept",
+		"--net-conn-close")
+	RunEventsTest(TestAddressScope, "--net-conn-attempt")
+	RunEventsTest(TestUdpv4SendRecv, "--net-udp-send", "--net-udp-recv")
+	RunEventsTest(TestDnsQuery, "--net-dns-query")
+	RunEventsTest(TestDnsResponse, "--net-dns-query", "--net-dns-response")
+	RunEventsTest(TestResolvedVia, "--net-conn-attempt", "--resolved-via")
+	RunEventsTest(TestListen, "--net-listen")
+	RunEventsTest(TestDrainForPid, "--net-listen")
+	RunEventsTest(TestBind, "--net-bind")
+	RunEventsTest(TestEventTypeWildcard, "--process-exec", "--net-bind", "--net-listen")
+	RunEventsTest(TestNetProcessSummary, "--net-summary-interval=1")
 	RunEventsTest(TestTcpv6ConnectionAttempt, "--net-conn-attempt")
+	RunEventsTest(TestMappedV4Connect, "--net-conn-attempt")
 	RunEventsTest(TestTcpv6ConnectionAccept, "--net-conn-accept")
 	RunEventsTest(TestTcpv6ConnectionClose, "--net-conn-close")
+	RunEventsTest(TestUnixSocketConnect, "--net-conn-attempt", "--net-conn-accept")
+	RunEventsTest(TestUnixSocketPeerCred, "--net-conn-attempt", "--net-conn-accept")
 
+	RunTest(TestAssertionHelpers)
 	RunTest(TestTcFilter)
+	RunTest(TestObjectSha256)
+	RunTest(TestPidFilter)
+	RunTest(TestFilterMapDump)
+	RunTest(TestSelfTamper)
 
 	// These tests rely on overlayfs support. Distro kernels commonly compile
 	// overlayfs as a module, thus it's not available to us in our
@@ -48,5 +179,11 @@ func main() {
 		fmt.Println("Overlayfs kernel module not loaded, not running ovl tests")
 	}
 
-	AllTestsPassed()
+	// Distro kernels generally have the memory controller, but it can still
+	// be disabled on the command line (cgroup_disable=memory)
+	if IsMemoryCgroupSupported() {
+		RunEventsTest(TestOomKill, "--process-exit")
+	} else {
+		fmt.Println("Memory cgroup controller not enabled, not running OOM kill test")
+	}
 }
@@ -10,11 +10,16 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"strings"
 	"syscall"
+	"time"
 )
 
 func TestFeaturesCorrect(et *EventsTraceInstance) {
@@ -22,16 +27,7 @@ func TestFeaturesCorrect(et *EventsTraceInstance) {
 	if err := syscall.Uname(&buf); err != nil {
 		TestFail(fmt.Sprintf("Failed to run uname: %s", err))
 	}
-
-	archBytes := []byte{}
-	for _, b := range buf.Machine {
-		if b == 0 {
-			break
-		}
-
-		archBytes = append(archBytes, byte(b))
-	}
-	arch := string(archBytes)
+	arch := utsnameString(buf.Machine[:])
 
 	// BPF trampolines are only supported on x86 at present.
 	//
@@ -55,8 +51,308 @@ func TestFeaturesCorrect(et *EventsTraceInstance) {
 	}
 }
 
+// Exercises the relationship assertion helpers on made up pids, both with
+// relationships they should accept and ones they should reject, checking the
+// failure messages name what's wrong
+func TestAssertionHelpers() {
+	parent := PidInfo{Tgid: 100, Ppid: 1, EntityId: "aaaa", ParentEntityId: "init"}
+	child := PidInfo{Tgid: 200, Ppid: 100, EntityId: "bbbb", ParentEntityId: "aaaa"}
+
+	expectOk := func(err error) {
+		if err != nil {
+			TestFail("unexpected assertion failure:", err)
+		}
+	}
+	expectErr := func(err error, substr string) {
+		if err == nil {
+			TestFail(fmt.Sprintf("expected an assertion failure mentioning %q", substr))
+		}
+		if !strings.Contains(err.Error(), substr) {
+			TestFail(fmt.Sprintf("assertion failure %q doesn't mention %q", err, substr))
+		}
+	}
+
+	expectOk(checkEntityRelationship(parent, child))
+	expectOk(checkAncestryContains(child, parent.Tgid))
+
+	reusedPid := child
+	reusedPid.ParentEntityId = "cccc"
+	expectErr(checkEntityRelationship(parent, reusedPid), `parent entity ID "cccc"`)
+
+	wrongPpid := child
+	wrongPpid.Ppid = 300
+	expectErr(checkEntityRelationship(parent, wrongPpid), "has ppid 300, expected 100")
+
+	noEntityId := child
+	noEntityId.EntityId = ""
+	expectErr(checkEntityRelationship(parent, noEntityId), "missing entity ID")
+
+	sameEntityId := child
+	sameEntityId.EntityId = parent.EntityId
+	expectErr(checkEntityRelationship(parent, sameEntityId), "have the same entity ID")
+
+	expectErr(checkAncestryContains(child, 300), "300 is not an ancestor of process 200")
+	expectErr(checkEntityRelationship(child, parent), "has ppid 1, expected 200")
+
+	// However the kernel happens to format an address, it's the same one
+	loopback := NetInfo{Transport: "TCP", Family: "AF_INET6", SourceAddr: "::1", DestAddr: "::1"}
+	expanded := loopback
+	expanded.SourceAddr = "0:0:0:0:0:0:0:1"
+	AssertStringsEqual(netInfoMismatch(loopback, expanded), "")
+
+	other := loopback
+	other.DestAddr = "::2"
+	AssertStringsEqual(netInfoMismatch(loopback, other), "destination address ::2 != ::1")
+}
+
+func TestObjectSha256() {
+	getObjectSha256 := func(args ...string) string {
+		ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+		defer cancel()
+
+		et := NewEventsTrace(ctx, args...)
+		et.Start(ctx)
+		if err := et.Stop(); err != nil {
+			TestFail(fmt.Sprintf("Could not stop EventsTrace binary: %s", err))
+		}
+
+		return et.InitMsg.ObjectSha256
+	}
+
+	hash := getObjectSha256()
+	AssertInt64Equal(int64(len(hash)), 64)
+	AssertStringsEqual(getObjectSha256(), hash)
+
+	// Loads fine if the hash is what's expected
+	AssertStringsEqual(getObjectSha256("--expected-object-sha256="+hash), hash)
+
+	// Refuses to load otherwise. Bounded by a timeout so a broken check that
+	// lets EventsTrace run forever fails the test rather than hanging it.
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+	defer cancel()
+
+	wrongHash := strings.Repeat("0", 64)
+	cmd := exec.CommandContext(ctx, eventsTraceBinPath, "--expected-object-sha256="+wrongHash)
+	output, err := cmd.CombinedOutput()
+	if _, ok := err.(*exec.ExitError); !ok {
+		TestFail(fmt.Sprintf("EventsTrace did not fail with a mismatched object hash: %s", err))
+	}
+	AssertTrue(strings.Contains(string(output), "BPF object SHA256 mismatch"))
+}
+
+// Reads FILTER_MAP lines until the dump of the last map is done, returning the
+// entries of each map and the number of lines each was printed in
+func readFilterMapDump(et *EventsTraceInstance) (map[string][]FilterMapEntry, map[string]int) {
+	entries := make(map[string][]FilterMapEntry)
+	pages := make(map[string]int)
+	for {
+		var msg FilterMapMsg
+		line := et.GetNextEventJson("FILTER_MAP")
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		entries[msg.Map] = append(entries[msg.Map], msg.Entries...)
+		pages[msg.Map]++
+		if msg.Map == "device_inodes" && msg.Last == "TRUE" {
+			return entries, pages
+		}
+	}
+}
+
+func TestFilterMapDump() {
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+	defer cancel()
+
+	et := NewEventsTrace(ctx, "--security-tamper", "--tamper-paths=/tmp",
+		"--tamper-comms=auditd", "--self-paths=", "--open-paths=/etc/", "--dump-filter-maps")
+
+	// Enough pids that the map takes more than one page, they needn't exist
+	pids := []int{os.Getpid()}
+	for pid := 1000001; pid <= 1000100; pid++ {
+		pids = append(pids, pid)
+	}
+	et.SetPidFilter(pids...)
+	et.Start(ctx)
+	defer et.Stop()
+
+	var st syscall.Stat_t
+	if err := syscall.Stat("/tmp", &st); err != nil {
+		TestFail("failed to stat /tmp: ", err)
+	}
+
+	check := func(entries map[string][]FilterMapEntry, pages map[string]int) {
+		seen := make(map[int64]bool)
+		for _, e := range entries["pid_filter"] {
+			seen[e.Pid] = true
+		}
+		for _, pid := range pids {
+			AssertTrue(seen[int64(pid)])
+		}
+		AssertTrue(pages["pid_filter"] > 1)
+
+		AssertInt64Equal(int64(len(entries["open_path_prefixes"])), 1)
+		AssertStringsEqual(entries["open_path_prefixes"][0].Prefix, "/etc/")
+
+		AssertInt64Equal(int64(len(entries["tamper_inodes"])), 1)
+		AssertInt64Equal(entries["tamper_inodes"][0].Dev, kernelDev(st.Dev))
+		AssertInt64Equal(entries["tamper_inodes"][0].Inode, int64(st.Ino))
+		AssertStringsEqual(entries["tamper_inodes"][0].Owner, "SECURITY")
+
+		AssertInt64Equal(int64(len(entries["tamper_comms"])), 1)
+		AssertStringsEqual(entries["tamper_comms"][0].Comm, "auditd")
+
+		// Only set up with --device-access
+		AssertInt64Equal(int64(len(entries["device_inodes"])), 0)
+	}
+
+	check(readFilterMapDump(et))
+
+	// And again on demand, dumping doesn't change the maps
+	if err := et.Cmd.Process.Signal(syscall.SIGHUP); err != nil {
+		TestFail("failed to send SIGHUP to EventsTrace: ", err)
+	}
+	check(readFilterMapDump(et))
+}
+
+func TestPidFilter() {
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+	defer cancel()
+
+	// Blocks until its stdin is closed, so the filter is in place before it
+	// does anything
+	var targetOutput strings.Builder
+	target := exec.Command("/pid_filter")
+	target.Stdout = &targetOutput
+	stdin, err := target.StdinPipe()
+	if err != nil {
+		TestFail("failed to redirect stdin: ", err)
+	}
+	if err := target.Start(); err != nil {
+		TestFail("failed to start pid_filter: ", err)
+	}
+
+	et := NewEventsTrace(ctx, "--process-fork", "--process-exec", "--process-exit")
+	et.SetPidFilter(target.Process.Pid)
+	et.Start(ctx)
+	defer et.Stop()
+
+	// Unrelated and busy, none of its events should make it through
+	runTestBin("exec_burst")
+
+	stdin.Close()
+	if err := target.Wait(); err != nil {
+		TestFail("pid_filter failed: ", err)
+	}
+
+	var binOutput struct {
+		ChildPid int64 `json:"child_pid"`
+	}
+	if err := json.Unmarshal([]byte(targetOutput.String()), &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Events are read until the exec of the target's child, so all of
+	// exec_burst's, which happened before, have been read by then
+	for {
+		line := et.GetNextEventJson("PROCESS_FORK", "PROCESS_EXEC", "PROCESS_EXIT")
+		var event struct {
+			EventType  string  `json:"event_type"`
+			Pids       PidInfo `json:"pids"`
+			ParentPids PidInfo `json:"parent_pids"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		tgid := event.Pids.Tgid
+		if event.EventType == "PROCESS_FORK" {
+			tgid = event.ParentPids.Tgid
+		}
+		if tgid != int64(target.Process.Pid) && tgid != binOutput.ChildPid {
+			TestFail(fmt.Sprintf("%s of unfiltered process %d emitted", event.EventType, tgid))
+		}
+
+		if event.EventType == "PROCESS_EXEC" && tgid == binOutput.ChildPid {
+			break
+		}
+	}
+}
+
+func TestStats(et *EventsTraceInstance) {
+	readStats := func() StatsMsg {
+		var stats StatsMsg
+		line := et.GetNextEventJson("STATS")
+		if err := json.Unmarshal([]byte(line), &stats); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+		return stats
+	}
+
+	first := readStats()
+
+	// Enough events that formatting and printing them costs EventsTrace
+	// measurable CPU time between the two samples
+	const nForks = 50
+	for i := 0; i < nForks; i++ {
+		runTestBin("fork_exit")
+	}
+	var floodOutput struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.Unmarshal(runTestBin("file_flood"), &floodOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+	nEvents := nForks + floodOutput.Count
+
+	// A stats message may have been printed partway through the above, keep
+	// reading until we get one that accounts for all the events, whether
+	// they were read or dropped
+	second := readStats()
+	for second.EventsProcessed+second.EventsDropped < first.EventsProcessed+first.EventsDropped+nEvents {
+		second = readStats()
+	}
+
+	AssertTrue(second.EventsProcessed > first.EventsProcessed)
+	AssertTrue(second.EventsEmitted+second.EventsDropped >= first.EventsEmitted+first.EventsDropped+nEvents)
+	AssertTrue(second.EventsEmitted >= second.EventsProcessed)
+	AssertTrue(second.UserTimeUs+second.SystemTimeUs > first.UserTimeUs+first.SystemTimeUs)
+
+	// Anything over a gigabyte for a tracer this simple is not plausible
+	AssertTrue(second.MaxRssKb > 0)
+	AssertTrue(second.MaxRssKb < 1024*1024)
+}
+
+func TestEventLoss(et *EventsTraceInstance) {
+	AssertInt64Equal(et.LostEventCount(), 0)
+
+	// With EventsTrace stopped nothing drains the ringbuffer, so most of the
+	// flood is dropped
+	if err := et.Cmd.Process.Signal(syscall.SIGSTOP); err != nil {
+		TestFail("failed to stop EventsTrace: ", err)
+	}
+	outputStr := runTestBin("file_flood")
+	if err := et.Cmd.Process.Signal(syscall.SIGCONT); err != nil {
+		TestFail("failed to continue EventsTrace: ", err)
+	}
+
+	var binOutput struct {
+		Pid   int64 `json:"pid"`
+		Count int64 `json:"count"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The drops show up with the next STATS message
+	for et.LostEventCount() == 0 {
+		et.GetNextEventJson("STATS")
+	}
+	AssertTrue(et.LostEventCount() <= binOutput.Count)
+}
+
 func TestForkExit(et *EventsTraceInstance) {
-	outputStr := runTestBin("fork_exit")
+	outputStr := et.RunTestBin("fork_exit")
 	var binOutput TestPidInfo
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json: ", err)
@@ -86,10 +382,159 @@ func TestForkExit(et *EventsTraceInstance) {
 	AssertInt64Equal(forkEvent.ChildPids.Sid, forkEvent.ParentPids.Sid)
 	AssertInt64Equal(forkEvent.ChildPids.Pgid, forkEvent.ParentPids.Pgid)
 	AssertInt64NotEqual(forkEvent.ChildPids.Tgid, forkEvent.ParentPids.Tgid)
+	AssertStringsEqual(forkEvent.IsThread, "FALSE")
+}
+
+// Runs binName, which creates a child that exits right away and prints the
+// parent's pid info and the child's pid, and checks the PROCESS_FORK event of
+// the child was generated with cloneFlags
+func testForkFlavor(et *EventsTraceInstance, binName string, cloneFlags string) {
+	outputStr := et.RunTestBin(binName)
+	var binOutput struct {
+		ParentPidInfo TestPidInfo `json:"parent_info"`
+		ChildPid      int64       `json:"child_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	forkEvent := WaitForEvent(et, "PROCESS_FORK", func(ev ProcessForkEvent) bool {
+		return ev.ParentPids.Tid == binOutput.ParentPidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.ParentPidInfo, forkEvent.ParentPids)
+	AssertInt64Equal(forkEvent.ChildPids.Tgid, binOutput.ChildPid)
+	AssertInt64Equal(forkEvent.ChildPids.Tid, binOutput.ChildPid)
+	AssertInt64Equal(forkEvent.ChildPids.Ppid, binOutput.ParentPidInfo.Tgid)
+	AssertInt64Equal(forkEvent.ChildPids.Sid, binOutput.ParentPidInfo.Sid)
+	AssertInt64Equal(forkEvent.ChildPids.Pgid, binOutput.ParentPidInfo.Pgid)
+	AssertStringsEqual(strings.Join(forkEvent.CloneFlags, "|"), cloneFlags)
+}
+
+func TestVfork(et *EventsTraceInstance) {
+	// The child runs in the parent's address space until it exits
+	testForkFlavor(et, "vfork_exit", "CLONE_VM|CLONE_VFORK")
+}
+
+func TestClone3(et *EventsTraceInstance) {
+	testForkFlavor(et, "clone3_exit", "CLONE_FS|CLONE_FILES")
+}
+
+type threadCreateOutput struct {
+	PidInfo   TestPidInfo `json:"pid_info"`
+	ThreadTid int64       `json:"thread_tid"`
+	ChildPid  int64       `json:"child_pid"`
+}
+
+func TestThreadCreate(et *EventsTraceInstance) {
+	var binOutput threadCreateOutput
+	if err := json.Unmarshal(et.RunTestBin("thread_create"), &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	fromBin := func(ev ProcessForkEvent) bool {
+		return ev.ParentPids.Tid == binOutput.PidInfo.Tid
+	}
+
+	thread := WaitForEvent(et, "PROCESS_FORK", fromBin)
+	AssertPidInfoEqual(binOutput.PidInfo, thread.ParentPids)
+	AssertStringsEqual(thread.IsThread, "TRUE")
+	AssertInt64Equal(thread.ChildPids.Tgid, binOutput.PidInfo.Tgid)
+	AssertInt64Equal(thread.ChildPids.Tid, binOutput.ThreadTid)
+	AssertStringsEqual(strings.Join(thread.CloneFlags, "|"),
+		"CLONE_VM|CLONE_FS|CLONE_FILES|CLONE_SIGHAND|CLONE_THREAD|CLONE_SYSVSEM|"+
+			"CLONE_PARENT_SETTID|CLONE_CHILD_CLEARTID")
+
+	child := WaitForEvent(et, "PROCESS_FORK", fromBin)
+	AssertStringsEqual(child.IsThread, "FALSE")
+	AssertInt64Equal(child.ChildPids.Tgid, binOutput.ChildPid)
+}
+
+func TestNoThreads(et *EventsTraceInstance) {
+	var binOutput threadCreateOutput
+	if err := json.Unmarshal(runTestBin("thread_create"), &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The thread was created before the child, its event would come first
+	child := WaitForEvent(et, "PROCESS_FORK", func(ev ProcessForkEvent) bool {
+		return ev.ParentPids.Tid == binOutput.PidInfo.Tid
+	})
+	AssertStringsEqual(child.IsThread, "FALSE")
+	AssertInt64Equal(child.ChildPids.Tgid, binOutput.ChildPid)
+}
+
+func TestNamespaceIds(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("unshare_uts_net")
+	var binOutput struct {
+		PidInfo    TestPidInfo `json:"pid_info"`
+		ChildPid   int64       `json:"child_pid"`
+		Namespaces Namespaces  `json:"namespaces"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+	before := binOutput.Namespaces
+
+	// Exec'd before the unshare, in the namespaces the bin read from /proc
+	exec := WaitForEvent(et, "PROCESS_EXEC", func(ev ProcessExecEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
+	})
+	if exec.Namespaces != before {
+		TestFail(fmt.Sprintf("PROCESS_EXEC namespaces %+v, expected %+v", exec.Namespaces, before))
+	}
+
+	// Forked after it, only the UTS and network namespaces are new
+	fork := WaitForEvent(et, "PROCESS_FORK", func(ev ProcessForkEvent) bool {
+		return ev.ChildPids.Tgid == binOutput.ChildPid
+	})
+	after := fork.Namespaces
+	AssertInt64NotEqual(int64(after.Uts), int64(before.Uts))
+	AssertInt64NotEqual(int64(after.Net), int64(before.Net))
+	after.Uts, after.Net = before.Uts, before.Net
+	if after != before {
+		TestFail(fmt.Sprintf("PROCESS_FORK namespaces %+v, expected %+v apart from uts and net",
+			fork.Namespaces, before))
+	}
+}
+
+func TestUnshareSetns(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("unshare_setns_net")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		NetNs   uint32      `json:"net_ns"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+	fromBin := func(ev ProcessNamespaceEvent) bool { return ev.Pids.Tid == binOutput.PidInfo.Tid }
+
+	// unshare only created a new network namespace
+	unshare := WaitForEvent(et, "PROCESS_UNSHARE", fromBin)
+	AssertPidInfoEqual(binOutput.PidInfo, unshare.Pids)
+	AssertStringsEqual(strings.Join(unshare.NsFlags, "|"), "CLONE_NEWNET")
+	AssertInt64Equal(int64(unshare.OldNamespaces.Net), int64(binOutput.NetNs))
+	AssertInt64NotEqual(int64(unshare.NewNamespaces.Net), int64(binOutput.NetNs))
+	after := unshare.NewNamespaces
+	after.Net = unshare.OldNamespaces.Net
+	if after != unshare.OldNamespaces {
+		TestFail(fmt.Sprintf("PROCESS_UNSHARE namespaces %+v, expected %+v apart from net",
+			unshare.NewNamespaces, unshare.OldNamespaces))
+	}
+
+	// setns moved it back to the original one
+	setns := WaitForEvent(et, "PROCESS_SETNS", fromBin)
+	AssertPidInfoEqual(binOutput.PidInfo, setns.Pids)
+	AssertStringsEqual(strings.Join(setns.NsFlags, "|"), "CLONE_NEWNET")
+	if setns.OldNamespaces != unshare.NewNamespaces || setns.NewNamespaces != unshare.OldNamespaces {
+		TestFail(fmt.Sprintf("PROCESS_SETNS namespaces %+v -> %+v, expected %+v -> %+v",
+			setns.OldNamespaces, setns.NewNamespaces, unshare.NewNamespaces,
+			unshare.OldNamespaces))
+	}
 }
 
 func TestForkExec(et *EventsTraceInstance) {
-	outputStr := runTestBin("fork_exec")
+	outputStr := et.RunTestBin("fork_exec")
 	var binOutput struct {
 		ParentPidInfo TestPidInfo `json:"parent_info"`
 		ChildPid      int64       `json:"child_pid"`
@@ -132,291 +577,3095 @@ func TestForkExec(et *EventsTraceInstance) {
 		}
 	}
 
+	AssertEntityRelationship(forkEvent.ParentPids, forkEvent.ChildPids)
+	AssertInt64Equal(forkEvent.ParentPids.Tgid, binOutput.ParentPidInfo.Tgid)
+	AssertAncestryContains(execEvent.Pids, binOutput.ParentPidInfo.Tgid)
+	AssertStringsEqual(execEvent.Pids.EntityId, forkEvent.ChildPids.EntityId)
+
 	AssertStringsEqual(execEvent.FileName, "./do_nothing")
+	AssertStringsEqual(execEvent.ExecSource, "execve")
 	AssertStringsEqual(execEvent.Argv, "./do_nothing")
 	AssertStringsEqual(execEvent.Cwd, "/")
 }
 
-func TestFileCreate(et *EventsTraceInstance) {
-	outputStr := runTestBin("create_rename_delete_file")
+func TestExecArgvArray(et *EventsTraceInstance) {
+	outputStr := runTestBin("exec_argv_array")
 	var binOutput struct {
-		PidInfo      TestPidInfo `json:"pid_info"`
-		FileNameOrig string      `json:"filename_orig"`
-		FileNameNew  string      `json:"filename_new"`
+		SpacedPid int64 `json:"spaced_pid"`
+		LongPid   int64 `json:"long_pid"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var fileCreateEvent FileCreateEvent
+	var spacedEvent, longEvent *ProcessExecEvent
+	for spacedEvent == nil || longEvent == nil {
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		var execEvent ProcessExecEvent
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.SpacedPid:
+			spacedEvent = &execEvent
+		case binOutput.LongPid:
+			longEvent = &execEvent
+		}
+	}
+
+	expected := []string{"./do_nothing", "two words", "", " padded "}
+	AssertInt64Equal(int64(len(spacedEvent.ArgvArray)), int64(len(expected)))
+	for i := range expected {
+		AssertStringsEqual(spacedEvent.ArgvArray[i], expected[i])
+	}
+	AssertStringsEqual(spacedEvent.ArgvTruncated, "FALSE")
+
+	// Cut short, but what's there is still split correctly
+	AssertStringsEqual(longEvent.ArgvTruncated, "TRUE")
+	AssertInt64Equal(int64(len(longEvent.ArgvArray)), 2)
+	AssertStringsEqual(longEvent.ArgvArray[0], "./do_nothing")
+	AssertTrue(strings.Trim(longEvent.ArgvArray[1], "a") == "")
+	AssertTrue(len(longEvent.ArgvArray[1]) < 10000)
+}
+
+func TestExecEnvCapture(et *EventsTraceInstance) {
+	outputStr := runTestBin("exec_env")
+	var binOutput struct {
+		ChildPid int64 `json:"child_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var execEvent ProcessExecEvent
 	for {
-		line := et.GetNextEventJson("FILE_CREATE")
-		if err := json.Unmarshal([]byte(line), &fileCreateEvent); err != nil {
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
 
-		if fileCreateEvent.Pids.Tid == binOutput.PidInfo.Tid {
+		if execEvent.Pids.Tgid == binOutput.ChildPid {
 			break
 		}
 	}
 
-	AssertPidInfoEqual(binOutput.PidInfo, fileCreateEvent.Pids)
-	AssertStringsEqual(fileCreateEvent.Path, binOutput.FileNameOrig)
+	AssertInt64Equal(int64(len(execEvent.Env)), 2)
+	AssertStringsEqual(execEvent.Env[0], "FOO=bar")
+	AssertStringsEqual(execEvent.Env[1], "SPACED=a b")
+	AssertStringsEqual(execEvent.EnvTruncated, "FALSE")
 }
 
-func TestFileDelete(et *EventsTraceInstance) {
-	outputStr := runTestBin("create_rename_delete_file")
+func TestExecShebang(et *EventsTraceInstance) {
+	outputStr := runTestBin("exec_shebang")
 	var binOutput struct {
-		PidInfo      TestPidInfo `json:"pid_info"`
-		FileNameOrig string      `json:"filename_orig"`
-		FileNameNew  string      `json:"filename_new"`
+		ScriptPid int64 `json:"script_pid"`
+		NestedPid int64 `json:"nested_pid"`
+		EnvPid    int64 `json:"env_pid"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var fileDeleteEvent FileDeleteEvent
+	// The env script's process execs twice, first the script (run by env)
+	// and then the interpreter env looked up
+	var scriptEvent, nestedEvent *ProcessExecEvent
+	var envEvents []ProcessExecEvent
+	for scriptEvent == nil || nestedEvent == nil || len(envEvents) < 2 {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.ScriptPid:
+			scriptEvent = &execEvent
+		case binOutput.NestedPid:
+			nestedEvent = &execEvent
+		case binOutput.EnvPid:
+			envEvents = append(envEvents, execEvent)
+		}
+	}
+
+	AssertStringsEqual(scriptEvent.FileName, "/shebang_script")
+	AssertTrue(strings.HasSuffix(scriptEvent.Interpreter, "/do_nothing"))
+	AssertStringsEqual(scriptEvent.ScriptPath, "/shebang_script")
+	AssertStringsEqual(scriptEvent.InterpreterViaEnv, "FALSE")
+
+	// The interpreter is the last one in the chain, the others are in argv
+	AssertStringsEqual(nestedEvent.FileName, "/shebang_nested")
+	AssertTrue(strings.HasSuffix(nestedEvent.Interpreter, "/do_nothing"))
+	AssertStringsEqual(nestedEvent.ScriptPath, "/shebang_nested")
+	AssertStringsEqual(nestedEvent.Argv, "/do_nothing /shebang_script /shebang_nested")
+
+	AssertStringsEqual(envEvents[0].FileName, "/shebang_env")
+	AssertTrue(strings.HasSuffix(envEvents[0].Interpreter, "/env"))
+	AssertStringsEqual(envEvents[0].ScriptPath, "/shebang_env")
+	AssertStringsEqual(envEvents[0].InterpreterViaEnv, "FALSE")
+
+	AssertTrue(strings.HasSuffix(envEvents[1].Interpreter, "/do_nothing"))
+	AssertStringsEqual(envEvents[1].ScriptPath, "/shebang_env")
+	AssertStringsEqual(envEvents[1].InterpreterViaEnv, "TRUE")
+}
+
+func TestExecHash(et *EventsTraceInstance) {
+	execEventOf := func(binName string) ProcessExecEvent {
+		outputStr := runTestBin(binName)
+		var binOutput struct {
+			ChildPid int64 `json:"child_pid"`
+		}
+		if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+			TestFail("failed to unmarshal json", err)
+		}
+
+		var execEvent ProcessExecEvent
+		for {
+			line := et.GetNextEventJson("PROCESS_EXEC")
+			if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+
+			if execEvent.Pids.Tgid == binOutput.ChildPid {
+				return execEvent
+			}
+		}
+	}
+
+	contents, err := os.ReadFile("/do_nothing")
+	if err != nil {
+		TestFail("failed to read /do_nothing", err)
+	}
+	expected := fmt.Sprintf("%x", sha256.Sum256(contents))
+
+	// The second exec of the same file is served from the cache
+	for i := 0; i < 2; i++ {
+		execEvent := execEventOf("fork_exec")
+		AssertStringsEqual(execEvent.Sha256, expected)
+		AssertStringsEqual(execEvent.Sha256Error, "FALSE")
+	}
+
+	// A memfd has no path to open
+	execEvent := execEventOf("execveat_memfd")
+	AssertStringsEqual(execEvent.Sha256, "")
+	AssertStringsEqual(execEvent.Sha256Error, "TRUE")
+}
+
+func TestExecveatMemfd(et *EventsTraceInstance) {
+	outputStr := runTestBin("execveat_memfd")
+	var binOutput struct {
+		ChildPid int64 `json:"child_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var execEvent ProcessExecEvent
 	for {
-		line := et.GetNextEventJson("FILE_DELETE")
-		if err := json.Unmarshal([]byte(line), &fileDeleteEvent); err != nil {
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
 
-		if fileDeleteEvent.Pids.Tid == binOutput.PidInfo.Tid {
+		if execEvent.Pids.Tgid == binOutput.ChildPid {
 			break
 		}
 	}
 
-	AssertPidInfoEqual(binOutput.PidInfo, fileDeleteEvent.Pids)
-	AssertStringsEqual(fileDeleteEvent.Path, binOutput.FileNameNew)
+	AssertStringsEqual(execEvent.ExecSource, "memfd")
+	AssertStringsEqual(execEvent.Argv, "do_nothing")
+}
+
+func TestExecMemfdName(et *EventsTraceInstance) {
+	outputStr := runTestBin("exec_memfd_name")
+	var binOutput struct {
+		ChildPid int64 `json:"child_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var execEvent ProcessExecEvent
+	for {
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if execEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	// Named like a memfd but it's a regular, linked file
+	AssertStringsEqual(execEvent.ExecSource, "execveat")
+}
+
+func TestForkExecOrdering(et *EventsTraceInstance) {
+	outputStr := runTestBin("fork_exec")
+	var binOutput struct {
+		ChildPid int64 `json:"child_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	et.ExpectEventsInOrder(
+		EventMatcher{"child fork", "PROCESS_FORK", func(line string) bool {
+			var forkEvent ProcessForkEvent
+			if err := json.Unmarshal([]byte(line), &forkEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return forkEvent.ChildPids.Tgid == binOutput.ChildPid
+		}},
+		EventMatcher{"child exec", "PROCESS_EXEC", func(line string) bool {
+			var execEvent ProcessExecEvent
+			if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return execEvent.Pids.Tgid == binOutput.ChildPid
+		}},
+	)
+}
+
+func TestFilesystemViewChange(et *EventsTraceInstance) {
+	outputStr := runTestBin("filesystem_view_change")
+	var binOutput struct {
+		Pid      int64 `json:"pid"`
+		ChildPid int64 `json:"child_pid"`
+		OldMntNs int64 `json:"old_mntns"`
+		NewMntNs int64 `json:"new_mntns"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	if binOutput.OldMntNs == binOutput.NewMntNs {
+		TestFail("test bin did not change mount namespace")
+	}
+
+	var viewChange FilesystemViewChangeEvent
+	var execEvent ProcessExecEvent
+	et.ExpectEventsInOrder(
+		EventMatcher{"setns", "FILESYSTEM_VIEW_CHANGE", func(line string) bool {
+			if err := json.Unmarshal([]byte(line), &viewChange); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return viewChange.Pids.Tgid == binOutput.Pid
+		}},
+		EventMatcher{"child exec", "PROCESS_EXEC", func(line string) bool {
+			if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return execEvent.Pids.Tgid == binOutput.ChildPid
+		}},
+	)
+
+	AssertInt64Equal(viewChange.OldMntNs, binOutput.OldMntNs)
+	AssertInt64Equal(viewChange.NewMntNs, binOutput.NewMntNs)
+	AssertStringsEqual(viewChange.Comm, "filesystem_view")
+	AssertInt64Equal(execEvent.MntNsSwitchedFrom, binOutput.OldMntNs)
+}
+
+func TestMount(et *EventsTraceInstance) {
+	outputStr := runTestBin("fs_mount")
+	var binOutput struct {
+		PidInfo     TestPidInfo `json:"pid_info"`
+		Source      string      `json:"source"`
+		Destination string      `json:"destination"`
+		Flags       int64       `json:"flags"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Skips the remount of / making it private
+	var mount MountEvent
+	for {
+		line := et.GetNextEventJson("FS_MOUNT")
+		if err := json.Unmarshal([]byte(line), &mount); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if mount.Pids.Tid == binOutput.PidInfo.Tid && mount.FsType != "" {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, mount.Pids)
+	AssertStringsEqual(mount.FsType, "tmpfs")
+	AssertStringsEqual(mount.Source, binOutput.Source)
+	AssertStringsEqual(mount.Destination, binOutput.Destination)
+	AssertInt64Equal(mount.Flags, binOutput.Flags)
+
+	var umount MountEvent
+	line := et.GetNextEventJson("FS_UMOUNT")
+	if err := json.Unmarshal([]byte(line), &umount); err != nil {
+		TestFail("failed to unmarshal JSON: ", err)
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, umount.Pids)
+	AssertStringsEqual(umount.FsType, "tmpfs")
+	AssertStringsEqual(umount.Source, binOutput.Source)
+	AssertStringsEqual(umount.Destination, binOutput.Destination)
+	AssertInt64Equal(umount.Mntns, mount.Mntns)
+}
+
+func TestContainerStartTime(et *EventsTraceInstance) {
+	outputStr := runTestBin("pidns_start_time")
+	var binOutput struct {
+		Pid     int64 `json:"pid"`
+		InitPid int64 `json:"init_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var initFork ProcessForkEvent
+	var childExec ProcessExecEvent
+	et.ExpectEventsInOrder(
+		EventMatcher{"container init fork", "PROCESS_FORK", func(line string) bool {
+			initFork = ProcessForkEvent{}
+			if err := json.Unmarshal([]byte(line), &initFork); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return initFork.ChildPids.Tgid == binOutput.InitPid
+		}},
+		EventMatcher{"container child exec", "PROCESS_EXEC", func(line string) bool {
+			childExec = ProcessExecEvent{}
+			if err := json.Unmarshal([]byte(line), &childExec); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return childExec.Pids.Ppid == binOutput.InitPid
+		}},
+	)
+
+	// The test bin itself isn't in a container, the container's init started
+	// it
+	if initFork.ParentPids.ContainerStartTimeNs != nil {
+		TestFail("container_start_time_ns present outside of a container")
+	}
+	if initFork.ChildPids.ContainerStartTimeNs == nil ||
+		childExec.Pids.ContainerStartTimeNs == nil {
+		TestFail("container_start_time_ns missing in a container")
+	}
+	AssertInt64Equal(*initFork.ChildPids.ContainerStartTimeNs, 0)
+
+	// The child started after the container did, at its host start time
+	// minus its container-relative one
+	initStart := initFork.ChildPids.StartBoottimeNs
+	childStart := childExec.Pids.StartBoottimeNs
+	AssertTrue(*childExec.Pids.ContainerStartTimeNs > 0)
+	AssertTrue(childStart > initStart)
+	AssertInt64Equal(childStart-*childExec.Pids.ContainerStartTimeNs, initStart)
+}
+
+func TestParentArgv(et *EventsTraceInstance) {
+	outputStr := runTestBin("parent_argv")
+	var binOutput struct {
+		FreshPid   int64  `json:"fresh_pid"`
+		StalePid   int64  `json:"stale_pid"`
+		ParentArgv string `json:"parent_argv"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var freshExec, staleExec *ProcessExecEvent
+	for freshExec == nil || staleExec == nil {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.FreshPid:
+			freshExec = &execEvent
+		case binOutput.StalePid:
+			staleExec = &execEvent
+		}
+	}
+
+	AssertStringsEqual(freshExec.ParentArgv, binOutput.ParentArgv)
+	AssertTrue(strings.Contains(freshExec.ParentArgv, "-c ./do_nothing"))
+	AssertStringsEqual(freshExec.ParentArgvTruncated, "FALSE")
+	AssertStringsEqual(freshExec.ParentArgvStale, "FALSE")
+
+	// The parent re-exec'd before this one exec'd, the snapshot is still the
+	// argv it was forked with
+	AssertStringsEqual(staleExec.ParentArgv, binOutput.ParentArgv)
+	AssertStringsEqual(staleExec.ParentArgvStale, "TRUE")
+}
+
+func TestProcessExit(et *EventsTraceInstance) {
+	outputStr := runTestBin("process_exit")
+	var binOutput struct {
+		ExitPid       int64 `json:"exit_pid"`
+		KillPid       int64 `json:"kill_pid"`
+		ThreadExitPid int64 `json:"thread_exit_pid"`
+		LeaderExitPid int64 `json:"leader_exit_pid"`
+		ZombiePid     int64 `json:"zombie_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Only the first event of each process is kept, an event for a thread
+	// that wasn't the last one alive would be caught by its exit code
+	events := make(map[int64]*ProcessExitEvent)
+	pids := []int64{binOutput.ExitPid, binOutput.KillPid, binOutput.ThreadExitPid,
+		binOutput.LeaderExitPid, binOutput.ZombiePid}
+	for len(events) < len(pids) {
+		line := et.GetNextEventJson("PROCESS_EXIT")
+
+		var exitEvent ProcessExitEvent
+		if err := json.Unmarshal([]byte(line), &exitEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		for _, pid := range pids {
+			if exitEvent.Pids.Tgid == pid && events[pid] == nil {
+				events[pid] = &exitEvent
+			}
+		}
+	}
+
+	AssertInt64Equal(events[binOutput.ExitPid].ExitCode, 42)
+	AssertInt64Equal(events[binOutput.ExitPid].Signal, 0)
+
+	AssertInt64Equal(events[binOutput.KillPid].Signal, int64(syscall.SIGKILL))
+
+	AssertInt64Equal(events[binOutput.ThreadExitPid].ExitCode, 7)
+	AssertInt64Equal(events[binOutput.LeaderExitPid].ExitCode, 5)
+
+	// Emitted at exit, not once the parent reaps it
+	AssertInt64Equal(events[binOutput.ZombiePid].ExitCode, 3)
+}
+
+func TestOomKill(et *EventsTraceInstance) {
+	outputStr := runTestBin("oom_kill")
+	var binOutput struct {
+		OomPid  int64 `json:"oom_pid"`
+		KillPid int64 `json:"kill_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var oomEvent, killEvent *ProcessExitEvent
+	for oomEvent == nil || killEvent == nil {
+		line := et.GetNextEventJson("PROCESS_EXIT")
+
+		var exitEvent ProcessExitEvent
+		if err := json.Unmarshal([]byte(line), &exitEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch exitEvent.Pids.Tgid {
+		case binOutput.OomPid:
+			oomEvent = &exitEvent
+		case binOutput.KillPid:
+			killEvent = &exitEvent
+		}
+	}
+
+	AssertInt64Equal(oomEvent.Signal, int64(syscall.SIGKILL))
+	AssertStringsEqual(oomEvent.OomKilled, "TRUE")
+
+	// An ordinary SIGKILL must not be mistaken for an OOM kill
+	AssertInt64Equal(killEvent.Signal, int64(syscall.SIGKILL))
+	AssertStringsEqual(killEvent.OomKilled, "FALSE")
+}
+
+func TestEntityId(et *EventsTraceInstance) {
+	outputStr := runTestBin("entity_id")
+	var binOutput struct {
+		ChildPid int64  `json:"child_pid"`
+		FileName string `json:"filename"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Every event type we're interested in has either pids or child_pids
+	var event struct {
+		EventType string  `json:"event_type"`
+		Pids      PidInfo `json:"pids"`
+		ChildPids PidInfo `json:"child_pids"`
+		Path      string  `json:"path"`
+	}
+
+	// The first child is seen forking, exec'ing, creating a file and
+	// exiting, then the second child (with the same pid) is seen forking
+	var entityId string
+	seen := map[string]bool{}
+	for {
+		line := et.GetNextEventJson("PROCESS_FORK", "PROCESS_EXEC", "FILE_CREATE", "PROCESS_EXIT")
+		event.Pids, event.ChildPids = PidInfo{}, PidInfo{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if event.EventType == "PROCESS_FORK" {
+			if event.ChildPids.Tgid != binOutput.ChildPid {
+				continue
+			}
+
+			if entityId == "" {
+				entityId = event.ChildPids.EntityId
+				AssertStringNotEmpty(entityId)
+				seen[event.EventType] = true
+				continue
+			}
+
+			// Second child, reusing the pid
+			AssertTrue(seen["PROCESS_EXIT"])
+			AssertTrue(event.ChildPids.EntityId != entityId)
+			break
+		}
+
+		if event.Pids.Tgid != binOutput.ChildPid || entityId == "" {
+			continue
+		}
+		if event.EventType == "FILE_CREATE" && event.Path != binOutput.FileName {
+			continue
+		}
+
+		AssertStringsEqual(event.Pids.EntityId, entityId)
+		seen[event.EventType] = true
+	}
+
+	AssertTrue(seen["PROCESS_EXEC"])
+	AssertTrue(seen["FILE_CREATE"])
+}
+
+func TestParentEntityId(et *EventsTraceInstance) {
+	outputStr := runTestBin("orphan_reparent")
+	var binOutput struct {
+		ReaperPid int64 `json:"reaper_pid"`
+		ParentPid int64 `json:"parent_pid"`
+		ChildPid  int64 `json:"child_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var parentFork, childFork *ProcessForkEvent
+	var childExec *ProcessExecEvent
+	for parentFork == nil || childFork == nil || childExec == nil {
+		line := et.GetNextEventJson("PROCESS_FORK", "PROCESS_EXEC")
+
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			et.DumpStderr()
+			TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+		}
+
+		switch eventType {
+		case "PROCESS_FORK":
+			var forkEvent ProcessForkEvent
+			if err := json.Unmarshal([]byte(line), &forkEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+
+			switch forkEvent.ChildPids.Tgid {
+			case binOutput.ParentPid:
+				parentFork = &forkEvent
+			case binOutput.ChildPid:
+				childFork = &forkEvent
+			}
+		case "PROCESS_EXEC":
+			var execEvent ProcessExecEvent
+			if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+
+			if execEvent.Pids.Tgid == binOutput.ChildPid {
+				childExec = &execEvent
+			}
+		}
+	}
+
+	reaper := parentFork.ParentPids
+	AssertInt64Equal(reaper.Tgid, binOutput.ReaperPid)
+	AssertEntityRelationship(reaper, parentFork.ChildPids)
+
+	// At fork time, the child's parent is the original parent
+	AssertStringsEqual(childFork.ParentPids.EntityId, parentFork.ChildPids.EntityId)
+	AssertEntityRelationship(childFork.ParentPids, childFork.ChildPids)
+
+	// By exec time it has been reparented to the subreaper
+	AssertEntityRelationship(reaper, childExec.Pids)
+}
+
+func TestConfig(et *EventsTraceInstance) {
+	nextConfig := func() ConfigMsg {
+		var config ConfigMsg
+		line := et.GetNextEventJson("CONFIG")
+		if err := json.Unmarshal([]byte(line), &config); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+		return config
+	}
+
+	// Must match the args this test is run with in main.go
+	config := nextConfig()
+	AssertStringsEqual(strings.Join(config.Events, ","), "FILE_CREATE,PROCESS_FORK")
+	AssertStringsEqual(strings.Join(config.FileCategories, ","), "script,document")
+	AssertStringsEqual(config.FileCategoryMagic, "FALSE")
+	AssertInt64Equal(config.StatsInterval, 30)
+	AssertInt64Equal(config.RingbufSizeBytes, 256*1024)
+	AssertStringsEqual(config.UnbufferStdout, "TRUE")
+	AssertStringsEqual(config.Paused, "FALSE")
+
+	// Pausing and resuming changes the configuration, so each must be
+	// followed by an updated CONFIG
+	et.Pause()
+	AssertStringsEqual(nextConfig().Paused, "TRUE")
+
+	et.Resume()
+	AssertStringsEqual(nextConfig().Paused, "FALSE")
+}
+
+func TestPauseResume(et *EventsTraceInstance) {
+	et.Pause()
+
+	outputStr := runTestBin("fork_exit")
+	var pausedOutput TestPidInfo
+	if err := json.Unmarshal(outputStr, &pausedOutput); err != nil {
+		TestFail("failed to unmarshal json: ", err)
+	}
+
+	// Nothing that happened while paused should ever be emitted, give
+	// EventsTrace a bit of time to (incorrectly) send the fork up before
+	// resuming.
+	//
+	// Note that there's no way to learn about the fork after resuming either,
+	// the probes don't buffer events while paused.
+	var forkEvent ProcessForkEvent
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		line, ok := et.GetNextEventJsonWithTimeout(time.Until(deadline), "PROCESS_FORK")
+		if !ok {
+			break
+		}
+
+		if err := json.Unmarshal([]byte(line), &forkEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if forkEvent.ParentPids.Tid == pausedOutput.Tid {
+			TestFail("PROCESS_FORK emitted while events were paused")
+		}
+	}
+
+	et.Resume()
+
+	outputStr = runTestBin("fork_exit")
+	var binOutput TestPidInfo
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json: ", err)
+	}
+
+	for {
+		line := et.GetNextEventJson("PROCESS_FORK")
+		if err := json.Unmarshal([]byte(line), &forkEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if forkEvent.ParentPids.Tid == binOutput.Tid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput, forkEvent.ParentPids)
+}
+
+func TestFileCreate(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("create_rename_delete_file")
+	var binOutput struct {
+		PidInfo      TestPidInfo `json:"pid_info"`
+		FileNameOrig string      `json:"filename_orig"`
+		FileNameNew  string      `json:"filename_new"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileCreateEvent FileCreateEvent
+	for {
+		line := et.GetNextEventJson("FILE_CREATE")
+		if err := json.Unmarshal([]byte(line), &fileCreateEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileCreateEvent.Pids.Tid == binOutput.PidInfo.Tid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, fileCreateEvent.Pids)
+	AssertStringsEqual(fileCreateEvent.Path, binOutput.FileNameOrig)
+	AssertStringsEqual(fileCreateEvent.RootPath, "/")
+}
+
+func TestInodeGeneration(et *EventsTraceInstance) {
+	outputStr := runTestBin("inode_reuse")
+	type created struct {
+		Path       string `json:"path"`
+		Inode      int64  `json:"inode"`
+		Generation int64  `json:"generation"`
+	}
+	var binOutput struct {
+		Pid                 int64   `json:"pid"`
+		GenerationSupported bool    `json:"generation_supported"`
+		Reused              bool    `json:"reused"`
+		First               created `json:"first"`
+		Second              created `json:"second"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var firstEvent, secondEvent *FileCreateEvent
+	for firstEvent == nil || secondEvent == nil {
+		var event FileCreateEvent
+		line := et.GetNextEventJson("FILE_CREATE")
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if event.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		switch event.Path {
+		case binOutput.First.Path:
+			firstEvent = &event
+		case binOutput.Second.Path:
+			secondEvent = &event
+		}
+	}
+
+	AssertInt64Equal(firstEvent.Inode, binOutput.First.Inode)
+	AssertInt64Equal(secondEvent.Inode, binOutput.Second.Inode)
+
+	// Filesystems without FS_IOC_GETVERSION can't be checked against, and may
+	// not have generations at all
+	if !binOutput.GenerationSupported {
+		return
+	}
+
+	AssertInt64Equal(firstEvent.InodeGeneration, binOutput.First.Generation)
+	AssertInt64Equal(secondEvent.InodeGeneration, binOutput.Second.Generation)
+
+	if binOutput.Reused {
+		AssertInt64NotEqual(firstEvent.InodeGeneration, secondEvent.InodeGeneration)
+	}
+}
+
+func TestFileCreateChroot(et *EventsTraceInstance) {
+	outputStr := runTestBin("chroot_file_create")
+	var binOutput struct {
+		Pid      int64  `json:"pid"`
+		RootPath string `json:"root_path"`
+		Path     string `json:"path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileCreateEvent FileCreateEvent
+	for {
+		line := et.GetNextEventJson("FILE_CREATE")
+		if err := json.Unmarshal([]byte(line), &fileCreateEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileCreateEvent.Pids.Tgid == binOutput.Pid {
+			break
+		}
+	}
+
+	AssertStringsEqual(fileCreateEvent.RootPath, binOutput.RootPath)
+	AssertStringsEqual(fileCreateEvent.Path, binOutput.Path)
+
+	// The path as seen from outside the chroot must be the very file created
+	hostPath := fileCreateEvent.RootPath + fileCreateEvent.Path
+	var st syscall.Stat_t
+	if err := syscall.Stat(hostPath, &st); err != nil {
+		TestFail(fmt.Sprintf("could not stat %s: %s", hostPath, err))
+	}
+	AssertInt64Equal(int64(st.Ino), fileCreateEvent.Inode)
+
+	os.Remove(hostPath)
+}
+
+func TestFileChmod(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("file_chmod")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		Path    string      `json:"path"`
+		OldMode int64       `json:"old_mode"`
+		NewMode int64       `json:"new_mode"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var ev FileModifyEvent
+	for {
+		line := et.GetNextEventJson("FILE_MODIFY_ATTR")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tid == binOutput.PidInfo.Tid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.Change, "MODE")
+	AssertStringsEqual(ev.Path, binOutput.Path)
+	AssertInt64Equal(ev.OldMode, binOutput.OldMode)
+	AssertInt64Equal(ev.NewMode, binOutput.NewMode)
+	AssertInt64Equal(ev.NewUid, ev.OldUid)
+	AssertInt64Equal(ev.NewGid, ev.OldGid)
+}
+
+func TestFileChown(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("file_chown")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		Path    string      `json:"path"`
+		OldUid  int64       `json:"old_uid"`
+		NewUid  int64       `json:"new_uid"`
+		OldGid  int64       `json:"old_gid"`
+		NewGid  int64       `json:"new_gid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var ev FileModifyEvent
+	for {
+		line := et.GetNextEventJson("FILE_MODIFY_ATTR")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tid == binOutput.PidInfo.Tid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.Change, "OWNER")
+	AssertStringsEqual(ev.Path, binOutput.Path)
+	AssertInt64Equal(ev.OldUid, binOutput.OldUid)
+	AssertInt64Equal(ev.NewUid, binOutput.NewUid)
+	AssertInt64Equal(ev.OldGid, binOutput.OldGid)
+	AssertInt64Equal(ev.NewGid, binOutput.NewGid)
+}
+
+func TestFileSymlink(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("file_symlink")
+	var binOutput struct {
+		PidInfo    TestPidInfo `json:"pid_info"`
+		TargetPath string      `json:"target_path"`
+		LinkPath   string      `json:"link_path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "FILE_SYMLINK", func(ev FileLinkEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.TargetPath, binOutput.TargetPath)
+	AssertStringsEqual(ev.LinkPath, binOutput.LinkPath)
+	AssertStringsEqual(ev.RootPath, "/")
+}
+
+func TestFileHardlink(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("file_hardlink")
+	var binOutput struct {
+		PidInfo    TestPidInfo `json:"pid_info"`
+		TargetPath string      `json:"target_path"`
+		LinkPath   string      `json:"link_path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "FILE_HARDLINK", func(ev FileLinkEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.TargetPath, binOutput.TargetPath)
+	AssertStringsEqual(ev.LinkPath, binOutput.LinkPath)
+	AssertStringsEqual(ev.RootPath, "/")
+}
+
+func TestFileDelete(et *EventsTraceInstance) {
+	outputStr := runTestBin("create_rename_delete_file")
+	var binOutput struct {
+		PidInfo      TestPidInfo `json:"pid_info"`
+		FileNameOrig string      `json:"filename_orig"`
+		FileNameNew  string      `json:"filename_new"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileDeleteEvent FileDeleteEvent
+	for {
+		line := et.GetNextEventJson("FILE_DELETE")
+		if err := json.Unmarshal([]byte(line), &fileDeleteEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileDeleteEvent.Pids.Tid == binOutput.PidInfo.Tid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, fileDeleteEvent.Pids)
+	AssertStringsEqual(fileDeleteEvent.Path, binOutput.FileNameNew)
+}
+
+func TestFileCreateInode(et *EventsTraceInstance) {
+	outputStr := runTestBin("file_inode")
+	var binOutput struct {
+		PidInfo  TestPidInfo `json:"pid_info"`
+		Path     string      `json:"path"`
+		LinkPath string      `json:"link_path"`
+		Size     int64       `json:"size"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(binOutput.LinkPath, &st); err != nil {
+		TestFail(fmt.Sprintf("could not stat %s: %s", binOutput.LinkPath, err))
+	}
+	AssertTrue(st.Ino != 0 && st.Dev != 0)
+
+	create := WaitForEvent(et, "FILE_CREATE", func(ev FileCreateEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
+	})
+	AssertStringsEqual(create.Path, binOutput.Path)
+	AssertInt64Equal(create.Inode, int64(st.Ino))
+	AssertInt64Equal(create.Dev, kernelDev(st.Dev))
+
+	// The link keeps the inode alive
+	del := WaitForEvent(et, "FILE_DELETE", func(ev FileDeleteEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
+	})
+	AssertStringsEqual(del.Path, binOutput.Path)
+	AssertInt64Equal(del.Inode, int64(st.Ino))
+	AssertInt64Equal(del.Dev, kernelDev(st.Dev))
+	AssertInt64Equal(del.Size, binOutput.Size)
+	AssertInt64Equal(del.Size, st.Size)
+	AssertStringsEqual(del.IsLastLink, "FALSE")
+
+	if err := os.Remove(binOutput.LinkPath); err != nil {
+		TestFail(fmt.Sprintf("could not remove %s: %s", binOutput.LinkPath, err))
+	}
+	lastDel := WaitForEvent(et, "FILE_DELETE", func(ev FileDeleteEvent) bool {
+		return ev.Path == binOutput.LinkPath
+	})
+	AssertInt64Equal(lastDel.Pids.Tgid, int64(os.Getpid()))
+	AssertInt64Equal(lastDel.Inode, int64(st.Ino))
+	AssertStringsEqual(lastDel.IsLastLink, "TRUE")
+}
+
+func TestFileRename(et *EventsTraceInstance) {
+	outputStr := runTestBin("create_rename_delete_file")
+	var binOutput struct {
+		PidInfo      TestPidInfo `json:"pid_info"`
+		FileNameOrig string      `json:"filename_orig"`
+		FileNameNew  string      `json:"filename_new"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileRenameEvent FileRenameEvent
+	for {
+		line := et.GetNextEventJson("FILE_RENAME")
+		if err := json.Unmarshal([]byte(line), &fileRenameEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileRenameEvent.Pids.Tid == binOutput.PidInfo.Tid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, fileRenameEvent.Pids)
+	AssertStringsEqual(fileRenameEvent.OldPath, binOutput.FileNameOrig)
+	AssertStringsEqual(fileRenameEvent.NewPath, binOutput.FileNameNew)
+	AssertStringsEqual(fileRenameEvent.CrossDirectory, "FALSE")
+	AssertStringsEqual(strings.Join(fileRenameEvent.Flags, "|"), "")
+}
+
+func TestRenameExchange(et *EventsTraceInstance) {
+	outputStr := runTestBin("rename_exchange")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		PathA   string      `json:"path_a"`
+		PathB   string      `json:"path_b"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "FILE_RENAME", func(ev FileRenameEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.OldPath, binOutput.PathA)
+	AssertStringsEqual(ev.NewPath, binOutput.PathB)
+	AssertStringsEqual(strings.Join(ev.Flags, "|"), "RENAME_EXCHANGE")
+}
+
+func TestFileRenameCrossDir(et *EventsTraceInstance) {
+	outputStr := runTestBin("rename_cross_dir")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		OldPath string      `json:"old_path"`
+		NewPath string      `json:"new_path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "FILE_RENAME", func(ev FileRenameEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.OldPath, binOutput.OldPath)
+	AssertStringsEqual(ev.NewPath, binOutput.NewPath)
+	AssertStringsEqual(ev.CrossDirectory, "TRUE")
+}
+
+func TestExecBurst(et *EventsTraceInstance) {
+	outputStr := runTestBin("exec_burst")
+	var binOutput struct {
+		ChildPids []int64 `json:"child_pids"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Every one of these processes has exited by now, so all exec data must
+	// have been captured in the kernel at exec time
+	remaining := map[int64]int{}
+	for i, pid := range binOutput.ChildPids {
+		remaining[pid] = i
+	}
+
+	for len(remaining) > 0 {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		i, ok := remaining[execEvent.Pids.Tgid]
+		if !ok {
+			continue
+		}
+		delete(remaining, execEvent.Pids.Tgid)
+
+		AssertStringsEqual(execEvent.FileName, "./do_nothing")
+		AssertStringsEqual(execEvent.Argv, fmt.Sprintf("./do_nothing burst %d", i))
+		AssertStringsEqual(execEvent.Cwd, "/")
+	}
+}
+
+func TestSubscribe(et *EventsTraceInstance) {
+	// Handlers run on a goroutine of their own, the checks are done here. The
+	// subscription outlives the test, once it's over the handler discards
+	// events rather than blocking forever on a channel nobody reads.
+	forks := make(chan json.RawMessage, subscriptionChanSize)
+	done := make(chan struct{})
+	defer close(done)
+	et.Subscribe("PROCESS_FORK", func(raw json.RawMessage) {
+		select {
+		case forks <- raw:
+		case <-done:
+		}
+	})
+
+	outputStr := runTestBin("fork_burst_same_cpu")
+	var binOutput struct {
+		Pid    int64 `json:"pid"`
+		NProcs int   `json:"n_procs"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Keep going for a while after the expected count is reached, to catch
+	// events delivered more than once
+	const grace = 2 * time.Second
+	seen := 0
+	deadline := time.After(defaultEventTimeout)
+	var graceDeadline <-chan time.Time
+	for waiting := true; waiting; {
+		if seen >= binOutput.NProcs && graceDeadline == nil {
+			graceDeadline = time.After(grace)
+		}
+
+		select {
+		case raw := <-forks:
+			// PROCESS_EXIT events are enabled too and must not reach the
+			// handler
+			eventType, err := getJsonEventType(string(raw))
+			if err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			AssertStringsEqual(eventType, "PROCESS_FORK")
+
+			var ev ProcessForkEvent
+			if err := json.Unmarshal(raw, &ev); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if ev.ParentPids.Tgid == binOutput.Pid {
+				seen++
+			}
+		case <-graceDeadline:
+			waiting = false
+		case <-deadline:
+			et.failWait(fmt.Sprintf("%d PROCESS_FORK events from fork_burst_same_cpu, got %d",
+				binOutput.NProcs, seen))
+		}
+	}
+
+	AssertInt64Equal(int64(seen), int64(binOutput.NProcs))
+}
+
+func TestSameCpuOrdering(et *EventsTraceInstance) {
+	outputStr := runTestBin("fork_burst_same_cpu")
+	var binOutput struct {
+		Pid    int64  `json:"pid"`
+		Cpu    uint32 `json:"cpu"`
+		NProcs int    `json:"n_procs"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Every fork and exit of the bin's children happened on the same CPU in
+	// a tight loop, so they must come out of the ringbuffer with strictly
+	// increasing sub-sequence numbers and non-decreasing timestamps
+	var prev *EventHeader
+	for seen := 0; seen < 2*binOutput.NProcs; {
+		var event struct {
+			EventHeader
+			ParentPids PidInfo `json:"parent_pids"`
+			Pids       PidInfo `json:"pids"`
+		}
+		line := et.GetNextEventJson("PROCESS_FORK", "PROCESS_EXIT")
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if event.ParentPids.Tgid != binOutput.Pid && event.Pids.Ppid != binOutput.Pid {
+			continue
+		}
+		seen++
+
+		if event.Cpu != binOutput.Cpu {
+			TestFail(fmt.Sprintf("event generated on CPU %d, test bin was pinned to CPU %d",
+				event.Cpu, binOutput.Cpu))
+		}
+
+		if prev != nil {
+			if event.Subseq <= prev.Subseq {
+				TestFail(fmt.Sprintf("subseq did not increase: %d followed %d", event.Subseq, prev.Subseq))
+			}
+			if event.KtimeNs < prev.KtimeNs {
+				TestFail(fmt.Sprintf("ktime_ns went backwards: %d followed %d", event.KtimeNs, prev.KtimeNs))
+			}
+		}
+		prev = &event.EventHeader
+	}
+}
+
+func TestProcSeq(et *EventsTraceInstance) {
+	outputStr := runTestBin("proc_seq")
+	var binOutput struct {
+		FirstPid  int64 `json:"first_pid"`
+		SecondPid int64 `json:"second_pid"`
+		NEvents   int   `json:"n_events"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Each child's sequence must count up from 1 without gaps, independently
+	// of the other child's
+	seqs := map[int64][]uint64{binOutput.FirstPid: nil, binOutput.SecondPid: nil}
+	for len(seqs[binOutput.FirstPid]) < binOutput.NEvents ||
+		len(seqs[binOutput.SecondPid]) < binOutput.NEvents {
+		var event struct {
+			EventHeader
+			Pids PidInfo `json:"pids"`
+		}
+		line := et.GetNextEventJson("FILE_CREATE", "FILE_DELETE")
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if seq, ok := seqs[event.Pids.Tgid]; ok {
+			seqs[event.Pids.Tgid] = append(seq, event.ProcSeq)
+		}
+	}
+
+	for pid, seq := range seqs {
+		for i, procSeq := range seq {
+			if procSeq != uint64(i+1) {
+				TestFail(fmt.Sprintf("proc_seq of pid %d: expected %d, got %d (%v)", pid, i+1,
+					procSeq, seq))
+			}
+		}
+	}
+}
+
+func TestContainerExec(et *EventsTraceInstance) {
+	outputStr := runTestBin("container_exec")
+	var binOutput struct {
+		ChildPid    int64  `json:"child_pid"`
+		NsenterPid  int64  `json:"nsenter_pid"`
+		InitPid     int64  `json:"init_pid"`
+		ContainerId string `json:"container_id"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var childExec, nsenterExec, initExec *ProcessExecEvent
+	for childExec == nil || nsenterExec == nil || initExec == nil {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.ChildPid:
+			childExec = &execEvent
+		case binOutput.NsenterPid:
+			nsenterExec = &execEvent
+		case binOutput.InitPid:
+			initExec = &execEvent
+		}
+	}
+
+	AssertContainerIdEqual(childExec.ContainerId, binOutput.ContainerId)
+	AssertStringsEqual(childExec.ContainerExec, "TRUE")
+
+	// Joined the container's namespace too, but not spawned by a runtime
+	AssertContainerIdEqual(nsenterExec.ContainerId, binOutput.ContainerId)
+	AssertStringsEqual(nsenterExec.ContainerExec, "FALSE")
+
+	// In the container too, but it created its namespace rather than joined it
+	AssertContainerIdEqual(initExec.ContainerId, binOutput.ContainerId)
+	AssertStringsEqual(initExec.ContainerExec, "FALSE")
+}
+
+func TestCgroupInfo(et *EventsTraceInstance) {
+	outputStr := runTestBin("cgroup_exec")
+	var binOutput struct {
+		ChildPid   int64  `json:"child_pid"`
+		CgroupId   uint64 `json:"cgroup_id"`
+		CgroupPath string `json:"cgroup_path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var execEvent ProcessExecEvent
+	for {
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if execEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	AssertStringsEqual(execEvent.Cgroup.Path, binOutput.CgroupPath)
+	if execEvent.Cgroup.Id != binOutput.CgroupId {
+		TestFail(fmt.Sprintf("cgroup id mismatch: %d != %d", execEvent.Cgroup.Id, binOutput.CgroupId))
+	}
+
+	var exitEvent ProcessExitEvent
+	for {
+		line := et.GetNextEventJson("PROCESS_EXIT")
+		if err := json.Unmarshal([]byte(line), &exitEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if exitEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	AssertStringsEqual(exitEvent.Cgroup.Path, binOutput.CgroupPath)
+}
+
+func TestDropAndRun(et *EventsTraceInstance) {
+	outputStr := runTestBin("drop_and_run")
+	var binOutput struct {
+		WriterPid   int64  `json:"writer_pid"`
+		ExecutorPid int64  `json:"executor_pid"`
+		Path        string `json:"path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var msg DropAndRunMsg
+	for {
+		line := et.GetNextEventJson("DROP_AND_RUN")
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if msg.WriterPids.Tgid == binOutput.WriterPid {
+			break
+		}
+	}
+
+	AssertInt64Equal(msg.ExecutorPids.Tgid, binOutput.ExecutorPid)
+	AssertStringsEqual(msg.Path, binOutput.Path)
+	AssertStringsEqual(msg.FileName, binOutput.Path)
+	AssertInt64NotEqual(msg.Inode, 0)
+	AssertTrue(msg.GapNs > 0)
+}
+
+// Runs lolbin_exec and returns the exec events of the stand-in curl (exec'd
+// through a symlink named "update"), of do_nothing exec'd through a symlink
+// named "wget", and of do_nothing itself
+func lolBinExecs(et *EventsTraceInstance) (lolBinExec, renamedExec, normalExec *ProcessExecEvent) {
+	outputStr := runTestBin("lolbin_exec")
+	var binOutput struct {
+		LolBinPid  int64 `json:"lolbin_pid"`
+		RenamedPid int64 `json:"renamed_pid"`
+		NormalPid  int64 `json:"normal_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	for lolBinExec == nil || renamedExec == nil || normalExec == nil {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.LolBinPid:
+			lolBinExec = &execEvent
+		case binOutput.RenamedPid:
+			renamedExec = &execEvent
+		case binOutput.NormalPid:
+			normalExec = &execEvent
+		}
+	}
+
+	return lolBinExec, renamedExec, normalExec
+}
+
+func TestLolBin(et *EventsTraceInstance) {
+	lolBinExec, renamedExec, normalExec := lolBinExecs(et)
+
+	// Matched on the exec'd file, not the name it was exec'd by
+	AssertStringsEqual(lolBinExec.FileName, "./update")
+	AssertStringsEqual(lolBinExec.ExePath, path.Join(lolBinExec.Cwd, "curl"))
+	AssertStringsEqual(lolBinExec.LolBin, "TRUE")
+	AssertStringsEqual(lolBinExec.LolBinCategory, "download")
+
+	AssertStringsEqual(renamedExec.FileName, "./wget")
+	AssertStringsEqual(renamedExec.ExePath, path.Join(renamedExec.Cwd, "do_nothing"))
+	AssertStringsEqual(renamedExec.LolBin, "FALSE")
+	AssertStringsEqual(renamedExec.LolBinCategory, "")
+
+	AssertStringsEqual(normalExec.LolBin, "FALSE")
+	AssertStringsEqual(normalExec.LolBinCategory, "")
+}
+
+// Replaces the default list, see TestLolBinCustomList
+const customLolBinList = "# Test entries\nrecon do_nothing\n"
+
+// Written before EventsTrace is started with --lolbin-list, returns its path
+func writeCustomLolBinList() string {
+	listPath := "/tmp/lolbin_list"
+	if err := os.WriteFile(listPath, []byte(customLolBinList), 0644); err != nil {
+		TestFail("could not write LOLBin list", err)
+	}
+	return listPath
+}
+
+func TestLolBinCustomList(et *EventsTraceInstance) {
+	lolBinExec, renamedExec, normalExec := lolBinExecs(et)
+
+	// curl isn't on the list any more
+	AssertStringsEqual(lolBinExec.LolBin, "FALSE")
+	AssertStringsEqual(lolBinExec.LolBinCategory, "")
+
+	AssertStringsEqual(renamedExec.LolBin, "TRUE")
+	AssertStringsEqual(renamedExec.LolBinCategory, "recon")
+
+	AssertStringsEqual(normalExec.LolBin, "TRUE")
+	AssertStringsEqual(normalExec.LolBinCategory, "recon")
+}
+
+func TestExecCapabilities(et *EventsTraceInstance) {
+	outputStr := runTestBin("file_caps_exec")
+	var binOutput struct {
+		XattrSupported bool  `json:"xattr_supported"`
+		CapsPid        int64 `json:"caps_pid"`
+		NoCapsPid      int64 `json:"nocaps_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	if !binOutput.XattrSupported {
+		fmt.Println("Root filesystem has no xattr support, not checking file capabilities")
+		return
+	}
+
+	var capsExec, noCapsExec *ProcessExecEvent
+	for capsExec == nil || noCapsExec == nil {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.CapsPid:
+			capsExec = &execEvent
+		case binOutput.NoCapsPid:
+			noCapsExec = &execEvent
+		}
+	}
+
+	AssertInt64Equal(int64(len(capsExec.Creds.CapEffective)), 1)
+	AssertStringsEqual(capsExec.Creds.CapEffective[0], "CAP_NET_RAW")
+	AssertInt64Equal(int64(len(capsExec.Creds.CapPermitted)), 1)
+	AssertStringsEqual(capsExec.Creds.CapPermitted[0], "CAP_NET_RAW")
+
+	AssertInt64Equal(int64(len(noCapsExec.Creds.CapEffective)), 0)
+	AssertInt64Equal(int64(len(noCapsExec.Creds.CapPermitted)), 0)
+}
+
+func TestExecNoNewPrivs(et *EventsTraceInstance) {
+	outputStr := runTestBin("no_new_privs_exec")
+	var binOutput struct {
+		NnpPid    int64 `json:"nnp_pid"`
+		NormalPid int64 `json:"normal_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var nnpExec, normalExec *ProcessExecEvent
+	for nnpExec == nil || normalExec == nil {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.NnpPid:
+			nnpExec = &execEvent
+		case binOutput.NormalPid:
+			normalExec = &execEvent
+		}
+	}
+
+	AssertStringsEqual(nnpExec.NoNewPrivs, "TRUE")
+	AssertStringsEqual(normalExec.NoNewPrivs, "FALSE")
+}
+
+func TestExeFilesystemType(et *EventsTraceInstance) {
+	outputStr := runTestBin("exe_fs_type")
+	var binOutput struct {
+		TmpfsPid     int64 `json:"tmpfs_pid"`
+		NetfsPid     int64 `json:"netfs_pid"`
+		NetfsSkipped bool  `json:"netfs_skipped"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var tmpfsExec, netfsExec *ProcessExecEvent
+	for tmpfsExec == nil || (netfsExec == nil && !binOutput.NetfsSkipped) {
+		var execEvent ProcessExecEvent
+		line := et.GetNextEventJson("PROCESS_EXEC")
+		if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch execEvent.Pids.Tgid {
+		case binOutput.TmpfsPid:
+			tmpfsExec = &execEvent
+		case binOutput.NetfsPid:
+			netfsExec = &execEvent
+		}
+	}
+
+	AssertStringsEqual(tmpfsExec.ExeFilesystemType, "tmpfs")
+	AssertStringsEqual(tmpfsExec.ExeOnNetworkFs, "FALSE")
+	AssertStringsEqual(tmpfsExec.ExeOnRemovableFs, "FALSE")
+
+	if binOutput.NetfsSkipped {
+		return
+	}
+
+	AssertStringsEqual(netfsExec.ExeFilesystemType, "9p")
+	AssertStringsEqual(netfsExec.ExeOnNetworkFs, "TRUE")
+	AssertStringsEqual(netfsExec.ExeOnRemovableFs, "FALSE")
+}
+
+func TestSetsid(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("setsid")
+	var binOutput struct {
+		ChildPid      int64 `json:"child_pid"`
+		GrandchildPid int64 `json:"grandchild_pid"`
+		OldSid        int64 `json:"old_sid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var childEvent ProcessSetsidEvent
+	for {
+		line := et.GetNextEventJson("PROCESS_SETSID")
+		if err := json.Unmarshal([]byte(line), &childEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if childEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	AssertInt64Equal(childEvent.Pids.Sid, binOutput.ChildPid)
+	AssertInt64Equal(childEvent.OldPids.Sid, binOutput.OldSid)
+	AssertInt64NotEqual(childEvent.OldPids.Sid, childEvent.Pids.Sid)
+
+	// The child's second, failed, setsid must not show up in between
+	var grandchildEvent ProcessSetsidEvent
+	line := et.GetNextEventJson("PROCESS_SETSID")
+	if err := json.Unmarshal([]byte(line), &grandchildEvent); err != nil {
+		TestFail("failed to unmarshal JSON: ", err)
+	}
+
+	AssertInt64Equal(grandchildEvent.Pids.Tgid, binOutput.GrandchildPid)
+	AssertInt64Equal(grandchildEvent.Pids.Sid, binOutput.GrandchildPid)
+	AssertInt64Equal(grandchildEvent.OldPids.Sid, binOutput.ChildPid)
+}
+
+func TestSetuid(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("setreuid")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		NewRuid int64       `json:"new_ruid"`
+		NewEuid int64       `json:"new_euid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var setUidEvent SetUidEvent
+	for {
+		line := et.GetNextEventJson("PROCESS_SETUID")
+		if err := json.Unmarshal([]byte(line), &setUidEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if setUidEvent.Pids.Tid == binOutput.PidInfo.Tid {
+			break
+		}
+	}
+
+	AssertInt64Equal(binOutput.NewRuid, setUidEvent.NewRuid)
+	AssertInt64Equal(binOutput.NewEuid, setUidEvent.NewEuid)
+	AssertPidInfoEqual(binOutput.PidInfo, setUidEvent.Pids)
+}
+
+func TestSetresuid(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("setresuid")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var setGidEvents []SetGidEvent
+	var setUidEvents []SetUidEvent
+	for len(setGidEvents) < 3 || len(setUidEvents) < 3 {
+		line := et.GetNextEventJson("PROCESS_SETUID", "PROCESS_SETGID")
+
+		var event struct {
+			EventType string `json:"event_type"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		switch event.EventType {
+		case "PROCESS_SETGID":
+			var setGidEvent SetGidEvent
+			if err := json.Unmarshal([]byte(line), &setGidEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if setGidEvent.Pids.Tid == binOutput.PidInfo.Tid {
+				setGidEvents = append(setGidEvents, setGidEvent)
+			}
+		case "PROCESS_SETUID":
+			var setUidEvent SetUidEvent
+			if err := json.Unmarshal([]byte(line), &setUidEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if setUidEvent.Pids.Tid == binOutput.PidInfo.Tid {
+				setUidEvents = append(setUidEvents, setUidEvent)
+			}
+		}
+	}
+
+	// {real, effective, saved, filesystem} after each change, the fs id
+	// follows the effective one unless set itself
+	expected := [][4]int64{{1, 2, 3, 2}, {1, 3, 3, 3}, {1, 3, 3, 1}}
+	for i, ids := range expected {
+		AssertInt64Equal(setGidEvents[i].NewRgid, ids[0])
+		AssertInt64Equal(setGidEvents[i].NewEgid, ids[1])
+		AssertInt64Equal(setGidEvents[i].NewSgid, ids[2])
+		AssertInt64Equal(setGidEvents[i].NewFsgid, ids[3])
+
+		AssertInt64Equal(setUidEvents[i].NewRuid, ids[0])
+		AssertInt64Equal(setUidEvents[i].NewEuid, ids[1])
+		AssertInt64Equal(setUidEvents[i].NewSuid, ids[2])
+		AssertInt64Equal(setUidEvents[i].NewFsuid, ids[3])
+	}
+	AssertPidInfoEqual(binOutput.PidInfo, setUidEvents[0].Pids)
+}
+
+func TestUserNamespaceIds(et *EventsTraceInstance) {
+	outputStr := runTestBin("userns_exec")
+	var binOutput struct {
+		ChildPid int64 `json:"child_pid"`
+		HostId   int64 `json:"host_id"`
+		UsernsId int64 `json:"userns_id"`
+		NestedId int64 `json:"nested_id"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var setUidEvent *SetUidEvent
+	var execEvent *ProcessExecEvent
+	for setUidEvent == nil || execEvent == nil {
+		line := et.GetNextEventJson("PROCESS_SETUID", "PROCESS_EXEC")
+
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			et.DumpStderr()
+			TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+		}
+
+		switch eventType {
+		case "PROCESS_SETUID":
+			setUidEvent = new(SetUidEvent)
+			if err := json.Unmarshal([]byte(line), &setUidEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if setUidEvent.Pids.Tgid != binOutput.ChildPid {
+				setUidEvent = nil
+			}
+		case "PROCESS_EXEC":
+			execEvent = new(ProcessExecEvent)
+			if err := json.Unmarshal([]byte(line), &execEvent); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if execEvent.Pids.Tgid != binOutput.ChildPid {
+				execEvent = nil
+			}
+		}
+	}
+
+	// Becoming root in the first user namespace
+	AssertInt64Equal(setUidEvent.NewRuid, binOutput.HostId)
+	AssertInt64Equal(setUidEvent.NewEuid, binOutput.HostId)
+	AssertInt64Equal(setUidEvent.NewContainerRuid, binOutput.UsernsId)
+	AssertInt64Equal(setUidEvent.NewContainerEuid, binOutput.UsernsId)
+
+	// Exec from the nested user namespace, host IDs should be unchanged
+	AssertInt64Equal(execEvent.Creds.Ruid, binOutput.HostId)
+	AssertInt64Equal(execEvent.Creds.Euid, binOutput.HostId)
+	AssertInt64Equal(execEvent.Creds.Rgid, binOutput.HostId)
+	AssertInt64Equal(execEvent.Creds.Egid, binOutput.HostId)
+	AssertInt64Equal(execEvent.Creds.ContainerRuid, binOutput.NestedId)
+	AssertInt64Equal(execEvent.Creds.ContainerEuid, binOutput.NestedId)
+	AssertInt64Equal(execEvent.Creds.ContainerRgid, binOutput.NestedId)
+	AssertInt64Equal(execEvent.Creds.ContainerEgid, binOutput.NestedId)
+}
+
+func TestProcessSetSched(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("process_setsched")
+	var binOutput struct {
+		Pid          int64 `json:"pid"`
+		ChildPid     int64 `json:"child_pid"`
+		Nice         int64 `json:"nice"`
+		FifoOk       bool  `json:"fifo_ok"`
+		FifoPriority int64 `json:"fifo_priority"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var reniceEvent, fifoEvent *ProcessSetSchedEvent
+	for reniceEvent == nil || (binOutput.FifoOk && fifoEvent == nil) {
+		var event ProcessSetSchedEvent
+		line := et.GetNextEventJson("PROCESS_SETSCHED")
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if event.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		switch event.Syscall {
+		case "setpriority":
+			reniceEvent = &event
+		case "sched_setscheduler":
+			fifoEvent = &event
+		}
+	}
+
+	AssertStringsEqual(reniceEvent.TargetType, "PROCESS")
+	AssertInt64Equal(reniceEvent.TargetId, binOutput.ChildPid)
+	AssertInt64Equal(reniceEvent.Nice, binOutput.Nice)
+
+	// Switching to SCHED_FIFO needs CAP_SYS_NICE, skip it if we don't have it
+	if !binOutput.FifoOk {
+		return
+	}
+
+	AssertStringsEqual(fifoEvent.TargetType, "PROCESS")
+	AssertInt64Equal(fifoEvent.TargetId, binOutput.Pid)
+	AssertStringsEqual(fifoEvent.Policy, "SCHED_FIFO")
+	AssertInt64Equal(fifoEvent.SchedPriority, binOutput.FifoPriority)
+}
+
+func TestProcessBpfLink(et *EventsTraceInstance) {
+	outputStr := runTestBin("bpf_link")
+	var binOutput struct {
+		Pid    int64  `json:"pid"`
+		ProgId int64  `json:"prog_id"`
+		Target string `json:"target"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "PROCESS_BPF_LINK", func(ev ProcessBpfLinkEvent) bool {
+		return ev.Pids.Tgid == binOutput.Pid
+	})
+
+	AssertStringsEqual(ev.Cmd, "BPF_RAW_TRACEPOINT_OPEN")
+	AssertStringsEqual(ev.AttachType, "TRACE_RAW_TP")
+	AssertStringsEqual(ev.Target, binOutput.Target)
+	AssertInt64Equal(ev.ProgId, binOutput.ProgId)
+	AssertStringsEqual(ev.Comm, "bpf_link")
+}
+
+func TestFileOpen(et *EventsTraceInstance) {
+	outputStr := runTestBin("file_open")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		Path    string      `json:"path"`
+		Mode    int64       `json:"mode"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The exec's open of /file_open itself and the open of / are outside of
+	// --open-paths, so this must be the first one reported
+	ev := WaitForEvent(et, "FILE_OPEN", func(ev FileOpenEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.Path, binOutput.Path)
+	AssertStringsEqual(strings.Join(ev.Flags, "|"), "O_RDWR|O_CREAT")
+	AssertInt64Equal(ev.Mode, binOutput.Mode)
+	AssertStringsEqual(ev.Comm, "file_open")
+}
+
+func TestFileTruncate(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("file_truncate")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		Path    string      `json:"path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The open with O_TRUNC before them isn't reported
+	fromBin := func(ev FileTruncateEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	}
+
+	ftruncate := WaitForEvent(et, "FILE_TRUNCATE", fromBin)
+	AssertPidInfoEqual(binOutput.PidInfo, ftruncate.Pids)
+	AssertStringsEqual(ftruncate.Syscall, "ftruncate")
+	AssertStringsEqual(ftruncate.Path, binOutput.Path)
+	AssertInt64Equal(ftruncate.OldSize, 100)
+	AssertInt64Equal(ftruncate.NewSize, 10)
+	AssertStringsEqual(ftruncate.Comm, "file_truncate")
+
+	truncate := WaitForEvent(et, "FILE_TRUNCATE", fromBin)
+	AssertStringsEqual(truncate.Syscall, "truncate")
+	AssertStringsEqual(truncate.Path, binOutput.Path)
+	AssertInt64Equal(truncate.OldSize, 10)
+	AssertInt64Equal(truncate.NewSize, 50)
+}
+
+func TestChdir(et *EventsTraceInstance) {
+	outputStr := runTestBin("chdir")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		Dir     string      `json:"dir"`
+		Subdir  string      `json:"subdir"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	fromBin := func(ev ChdirEvent) bool { return ev.Pids.Tid == binOutput.PidInfo.Tid }
+
+	ev := WaitForEvent(et, "PROCESS_CHDIR", fromBin)
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.Syscall, "chdir")
+	AssertStringsEqual(ev.Cwd, binOutput.Dir)
+	AssertStringsEqual(ev.Comm, "chdir")
+
+	// Relative to the previous cwd, but reported in full
+	ev = WaitForEvent(et, "PROCESS_CHDIR", fromBin)
+	AssertStringsEqual(ev.Syscall, "chdir")
+	AssertStringsEqual(ev.Cwd, binOutput.Subdir)
+
+	ev = WaitForEvent(et, "PROCESS_CHDIR", fromBin)
+	AssertStringsEqual(ev.Syscall, "fchdir")
+	AssertStringsEqual(ev.Cwd, binOutput.Dir)
+}
+
+func TestBpfSyscall(et *EventsTraceInstance) {
+	outputStr := runTestBin("bpf_syscall")
+	var binOutput struct {
+		PidInfo  TestPidInfo `json:"pid_info"`
+		MapId    int64       `json:"map_id"`
+		MapName  string      `json:"map_name"`
+		ProgId   int64       `json:"prog_id"`
+		ProgName string      `json:"prog_name"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var mapCreate, progLoad *ProcessBpfSyscallEvent
+	for mapCreate == nil || progLoad == nil {
+		var ev ProcessBpfSyscallEvent
+		line := et.GetNextEventJson("PROCESS_BPF_SYSCALL")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tid != binOutput.PidInfo.Tid {
+			continue
+		}
+
+		switch ev.Cmd {
+		case "BPF_MAP_CREATE":
+			mapCreate = &ev
+		case "BPF_PROG_LOAD":
+			progLoad = &ev
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, mapCreate.Pids)
+	AssertStringsEqual(mapCreate.MapType, "ARRAY")
+	AssertInt64Equal(mapCreate.MapId, binOutput.MapId)
+	AssertStringsEqual(mapCreate.Name, binOutput.MapName)
+
+	AssertPidInfoEqual(binOutput.PidInfo, progLoad.Pids)
+	AssertStringsEqual(progLoad.ProgType, "SOCKET_FILTER")
+	AssertInt64Equal(progLoad.ProgId, binOutput.ProgId)
+	AssertStringsEqual(progLoad.Name, binOutput.ProgName)
+	AssertStringsEqual(progLoad.Comm, "bpf_syscall")
+}
+
+func TestDeviceAccess(et *EventsTraceInstance) {
+	outputStr := runTestBin("device_access")
+	var binOutput struct {
+		Pid  int64  `json:"pid"`
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "DEVICE_ACCESS", func(ev DeviceAccessEvent) bool {
+		return ev.Pids.Tgid == binOutput.Pid
+	})
+
+	AssertStringsEqual(ev.DeviceClass, "accelerator")
+	AssertStringsEqual(ev.Path, binOutput.Path)
+	AssertStringsEqual(ev.AccessMode, "RDWR")
+	AssertStringsEqual(ev.Comm, "device_access")
+}
+
+func TestProcessMmSpoof(et *EventsTraceInstance) {
+	outputStr := runTestBin("mm_spoof")
+	var binOutput struct {
+		Pid      int64 `json:"pid"`
+		Skipped  bool  `json:"skipped"`
+		ArgStart int64 `json:"arg_start"`
+		ArgEnd   int64 `json:"arg_end"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	if binOutput.Skipped {
+		TestSkip("PR_SET_MM needs CAP_SYS_RESOURCE")
+	}
+
+	var argStart, argEnd *ProcessMmSpoofEvent
+	for argStart == nil || argEnd == nil {
+		var ev ProcessMmSpoofEvent
+		line := et.GetNextEventJson("PROCESS_MM_SPOOF")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		switch ev.Field {
+		case "ARG_START":
+			argStart = &ev
+		case "ARG_END":
+			argEnd = &ev
+		}
+	}
+
+	AssertStringsEqual(argStart.ArgvSpoofed, "TRUE")
+	AssertInt64Equal(argStart.Value, binOutput.ArgStart)
+	AssertStringsEqual(argEnd.ArgvSpoofed, "TRUE")
+	AssertInt64Equal(argEnd.Value, binOutput.ArgEnd)
+	AssertStringsEqual(argStart.Comm, "mm_spoof")
+}
+
+func TestPtraceAttach(et *EventsTraceInstance) {
+	outputStr := runTestBin("ptrace_attach")
+	var binOutput struct {
+		TracerPidInfo TestPidInfo `json:"tracer_pid_info"`
+		TargetPid     int64       `json:"target_pid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "PROCESS_PTRACE", func(ev ProcessPtraceEvent) bool {
+		return ev.Pids.Tid == binOutput.TracerPidInfo.Tid
+	})
+
+	AssertStringsEqual(ev.Request, "ATTACH")
+	AssertInt64Equal(ev.RequestNumber, 16)
+	AssertInt64Equal(ev.TargetPid, binOutput.TargetPid)
+	AssertPidInfoEqual(binOutput.TracerPidInfo, ev.Pids)
+	AssertStringsEqual(ev.Comm, "ptrace_attach")
+}
+
+func TestSignalSend(et *EventsTraceInstance) {
+	outputStr := runTestBin("signal_send")
+	var binOutput struct {
+		PidInfo  TestPidInfo `json:"pid_info"`
+		ChildPid int64       `json:"child_pid"`
+		Signal   int64       `json:"signal"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var events []ProcessSignalEvent
+	for len(events) < 2 {
+		var ev ProcessSignalEvent
+		line := et.GetNextEventJson("PROCESS_SIGNAL")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tid == binOutput.PidInfo.Tid {
+			events = append(events, ev)
+		}
+	}
+
+	// The existence check comes first
+	for i, sig := range []int64{0, binOutput.Signal} {
+		AssertPidInfoEqual(binOutput.PidInfo, events[i].Pids)
+		AssertStringsEqual(events[i].Syscall, "kill")
+		AssertInt64Equal(events[i].TargetPid, binOutput.ChildPid)
+		AssertInt64Equal(events[i].TargetTgid, binOutput.ChildPid)
+		AssertInt64Equal(events[i].Signal, sig)
+		AssertStringsEqual(events[i].Broadcast, "FALSE")
+	}
+}
+
+func TestSetcap(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("setcap_drop")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "PROCESS_SETCAP", func(ev ProcessSetCapEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	hasNetRaw := func(caps []string) bool {
+		for _, c := range caps {
+			if c == "CAP_NET_RAW" {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Only CAP_NET_RAW went away, the inheritable set wasn't touched
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertTrue(hasNetRaw(ev.OldCapEffective))
+	AssertFalse(hasNetRaw(ev.NewCapEffective))
+	AssertInt64Equal(int64(len(ev.NewCapEffective)), int64(len(ev.OldCapEffective)-1))
+	AssertTrue(hasNetRaw(ev.OldCapPermitted))
+	AssertFalse(hasNetRaw(ev.NewCapPermitted))
+	AssertInt64Equal(int64(len(ev.NewCapPermitted)), int64(len(ev.OldCapPermitted)-1))
+	AssertInt64Equal(int64(len(ev.NewCapInheritable)), int64(len(ev.OldCapInheritable)))
+}
+
+func TestMmapExec(et *EventsTraceInstance) {
+	outputStr := runTestBin("mmap_exec")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		RwxAddr uint64      `json:"rwx_addr"`
+		WxAddr  uint64      `json:"wx_addr"`
+		Len     uint64      `json:"len"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var rwxEvent, wxEvent *ProcessMmapExecEvent
+	for rwxEvent == nil || wxEvent == nil {
+		var ev ProcessMmapExecEvent
+		line := et.GetNextEventJson("PROCESS_MMAP_EXEC")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tid != binOutput.PidInfo.Tid {
+			continue
+		}
+		switch ev.Addr {
+		case binOutput.RwxAddr:
+			rwxEvent = &ev
+		case binOutput.WxAddr:
+			wxEvent = &ev
+		}
+	}
+
+	const protWrite, protExec = 0x2, 0x4
+
+	AssertPidInfoEqual(binOutput.PidInfo, rwxEvent.Pids)
+	AssertStringsEqual(rwxEvent.Syscall, "mmap")
+	AssertInt64Equal(int64(rwxEvent.Len), int64(binOutput.Len))
+	AssertTrue(rwxEvent.Prot&protExec != 0)
+	AssertTrue(rwxEvent.Prot&protWrite != 0)
+	AssertStringsEqual(rwxEvent.Path, "")
+	AssertStringsEqual(rwxEvent.Anonymous, "TRUE")
+	AssertStringsEqual(rwxEvent.WritableExecutable, "TRUE")
+	AssertStringsEqual(rwxEvent.WriteToExec, "FALSE")
+
+	AssertStringsEqual(wxEvent.Syscall, "mprotect")
+	AssertTrue(wxEvent.Prot&protExec != 0)
+	AssertStringsEqual(wxEvent.Path, "")
+	AssertStringsEqual(wxEvent.WritableExecutable, "FALSE")
+	AssertStringsEqual(wxEvent.WriteToExec, "TRUE")
+}
+
+type mprotectRwxOutput struct {
+	PidInfo TestPidInfo `json:"pid_info"`
+	RoAddr  uint64      `json:"ro_addr"`
+	RwxAddr uint64      `json:"rwx_addr"`
+	Len     uint64      `json:"len"`
+}
+
+func TestMprotectRWX(et *EventsTraceInstance) {
+	outputStr := runTestBin("mprotect_rwx")
+	var binOutput mprotectRwxOutput
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	const protExec = 0x4
+
+	// The RW to RO mprotect came first, but isn't reported
+	ev := WaitForEvent(et, "PROCESS_MPROTECT", func(ev ProcessMprotectEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertInt64Equal(int64(ev.Addr), int64(binOutput.RwxAddr))
+	AssertInt64Equal(int64(ev.Len), int64(binOutput.Len))
+	AssertInt64Equal(ev.OldProt, 0x3)
+	AssertInt64Equal(ev.NewProt, 0x7)
+	AssertTrue(ev.OldProt&protExec == 0)
+	AssertTrue(ev.NewProt&protExec != 0)
+	AssertStringsEqual(ev.MadeExecutable, "TRUE")
+}
+
+func TestMprotectVerbose(et *EventsTraceInstance) {
+	outputStr := runTestBin("mprotect_rwx")
+	var binOutput mprotectRwxOutput
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	fromBin := func(ev ProcessMprotectEvent) bool { return ev.Pids.Tid == binOutput.PidInfo.Tid }
+
+	// Startup code may have used mprotect before
+	ev := WaitForEvent(et, "PROCESS_MPROTECT", func(ev ProcessMprotectEvent) bool {
+		return fromBin(ev) && ev.Addr == binOutput.RoAddr
+	})
+	AssertInt64Equal(ev.OldProt, 0x3)
+	AssertInt64Equal(ev.NewProt, 0x1)
+	AssertStringsEqual(ev.MadeExecutable, "FALSE")
+
+	ev = WaitForEvent(et, "PROCESS_MPROTECT", fromBin)
+	AssertInt64Equal(int64(ev.Addr), int64(binOutput.RwxAddr))
+	AssertStringsEqual(ev.MadeExecutable, "TRUE")
+}
+
+func TestModuleLoad(et *EventsTraceInstance) {
+	outputStr := runTestBin("module_load")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		Skipped bool        `json:"skipped"`
+		Reason  string      `json:"reason"`
+		Name    string      `json:"name"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// Loading needs CAP_SYS_MODULE and a module built for the running kernel
+	if binOutput.Skipped {
+		TestSkip(binOutput.Reason)
+	}
+
+	ev := WaitForEvent(et, "KERNEL_MODULE_LOAD", func(ev ModuleLoadEvent) bool {
+		return ev.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertStringsEqual(ev.Syscall, "finit_module")
+	AssertStringsEqual(ev.Name, binOutput.Name)
+	AssertStringsEqual(ev.Comm, "module_load")
+}
+
+func TestSecurityTamper(et *EventsTraceInstance) {
+	outputStr := runTestBin("security_tamper")
+	var binOutput struct {
+		Pid       int64  `json:"pid"`
+		Path      string `json:"path"`
+		DaemonPid int64  `json:"daemon_pid"`
+		Daemon    string `json:"daemon"`
+		Signal    int64  `json:"signal"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var writeEvent, signalEvent *SecurityTamperEvent
+	for writeEvent == nil || signalEvent == nil {
+		var event SecurityTamperEvent
+		line := et.GetNextEventJson("SECURITY_TAMPER")
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if event.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		switch event.Op {
+		case "WRITE":
+			writeEvent = &event
+		case "SIGNAL":
+			signalEvent = &event
+		}
+	}
+
+	AssertStringsEqual(writeEvent.Path, binOutput.Path)
+	AssertInt64Equal(signalEvent.TargetPid, binOutput.DaemonPid)
+	AssertStringsEqual(signalEvent.TargetComm, binOutput.Daemon)
+	AssertInt64Equal(signalEvent.Signal, binOutput.Signal)
+}
+
+func TestSelfTamper() {
+	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+	defer cancel()
+
+	// Stands in for the directory the tracer's maps are pinned in, which has
+	// to exist before EventsTrace starts to be watched
+	pinDir, err := os.MkdirTemp("", "pins")
+	if err != nil {
+		TestFail("failed to create pin directory: ", err)
+	}
+	defer os.RemoveAll(pinDir)
+	pinPath := path.Join(pinDir, "allowed_pids")
+
+	et := NewEventsTrace(ctx, "--security-tamper", "--tamper-paths=", "--self-paths="+pinDir)
+	et.Start(ctx)
+	defer et.Stop()
+
+	if err := os.WriteFile(pinPath, []byte("0"), 0600); err != nil {
+		TestFail("failed to write pin: ", err)
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(pinPath, &st); err != nil {
+		TestFail("failed to stat pin: ", err)
+	}
+
+	ev := WaitForEvent(et, "SECURITY_TAMPER", func(ev SecurityTamperEvent) bool {
+		return ev.Pids.Tgid == int64(os.Getpid())
+	})
+
+	AssertStringsEqual(ev.Op, "SELF_WRITE")
+	AssertStringsEqual(ev.Path, pinPath)
+	AssertInt64Equal(ev.Dev, kernelDev(st.Dev))
+	AssertInt64Equal(ev.Inode, int64(st.Ino))
+
+	// Replacing a pin: move it aside, then remove it
+	renamedPath := pinPath + ".old"
+	if err := os.Rename(pinPath, renamedPath); err != nil {
+		TestFail("failed to rename pin: ", err)
+	}
+	if err := os.Remove(renamedPath); err != nil {
+		TestFail("failed to remove pin: ", err)
+	}
+
+	for _, want := range []struct{ op, path string }{
+		{"SELF_RENAME", pinPath},
+		{"SELF_UNLINK", renamedPath},
+	} {
+		ev := WaitForEvent(et, "SECURITY_TAMPER", func(ev SecurityTamperEvent) bool {
+			return ev.Pids.Tgid == int64(os.Getpid()) && ev.Op == want.op
+		})
+
+		AssertStringsEqual(ev.Path, want.path)
+		AssertInt64Equal(ev.Dev, kernelDev(st.Dev))
+		AssertInt64Equal(ev.Inode, int64(st.Ino))
+	}
+}
+
+func TestSetgid(et *EventsTraceInstance) {
+	outputStr := et.RunTestBin("setregid")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		NewRgid int64       `json:"new_rgid"`
+		NewEgid int64       `json:"new_egid"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	setGidEvent := WaitForEvent(et, "PROCESS_SETGID", func(setGidEvent SetGidEvent) bool {
+		return setGidEvent.Pids.Tid == binOutput.PidInfo.Tid
+	})
+
+	AssertInt64Equal(binOutput.NewRgid, setGidEvent.NewRgid)
+	AssertInt64Equal(binOutput.NewEgid, setGidEvent.NewEgid)
+	AssertPidInfoEqual(binOutput.PidInfo, setGidEvent.Pids)
+}
+
+func TestFileCreateContainer(et *EventsTraceInstance) {
+	outputStr := runTestBin("create_rename_delete_file_container")
+	var binOutput struct {
+		ChildPid     int64  `json:"child_pid"`
+		FileNameOrig string `json:"filename_orig"`
+		FileNameNew  string `json:"filename_new"`
+		ContainerId  string `json:"container_id"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileCreateEvent FileCreateEvent
+	for {
+		line := et.GetNextEventJson("FILE_CREATE")
+		if err := json.Unmarshal([]byte(line), &fileCreateEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileCreateEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	AssertStringsEqual(fileCreateEvent.Path, binOutput.FileNameOrig)
+	AssertContainerIdEqual(fileCreateEvent.ContainerId, binOutput.ContainerId)
+}
+
+func TestFileRenameContainer(et *EventsTraceInstance) {
+	outputStr := runTestBin("create_rename_delete_file_container")
+	var binOutput struct {
+		ChildPid     int64  `json:"child_pid"`
+		FileNameOrig string `json:"filename_orig"`
+		FileNameNew  string `json:"filename_new"`
+		ContainerId  string `json:"container_id"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileRenameEvent FileRenameEvent
+	for {
+		line := et.GetNextEventJson("FILE_RENAME")
+		if err := json.Unmarshal([]byte(line), &fileRenameEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileRenameEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	AssertStringsEqual(fileRenameEvent.OldPath, binOutput.FileNameOrig)
+	AssertStringsEqual(fileRenameEvent.NewPath, binOutput.FileNameNew)
+	AssertContainerIdEqual(fileRenameEvent.ContainerId, binOutput.ContainerId)
+}
+
+func TestFileDeleteContainer(et *EventsTraceInstance) {
+	outputStr := runTestBin("create_rename_delete_file_container")
+	var binOutput struct {
+		ChildPid     int64  `json:"child_pid"`
+		FileNameOrig string `json:"filename_orig"`
+		FileNameNew  string `json:"filename_new"`
+		ContainerId  string `json:"container_id"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var fileDeleteEvent FileDeleteEvent
+	for {
+		line := et.GetNextEventJson("FILE_DELETE")
+		if err := json.Unmarshal([]byte(line), &fileDeleteEvent); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if fileDeleteEvent.Pids.Tgid == binOutput.ChildPid {
+			break
+		}
+	}
+
+	AssertStringsEqual(fileDeleteEvent.Path, binOutput.FileNameNew)
+	AssertContainerIdEqual(fileDeleteEvent.ContainerId, binOutput.ContainerId)
+}
+
+func TestTtyWrite(et *EventsTraceInstance) {
+	out := runTestBin("tty_write")
+	var output struct {
+		Pid int64 `json:"pid"`
+	}
+	if err := json.Unmarshal(out, &output); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var ev TtyWriteEvent
+	for {
+		line := et.GetNextEventJson("PROCESS_TTY_WRITE")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+		if ev.Pids.Tgid == output.Pid {
+			break
+		}
+	}
+
+	AssertInt64Equal(ev.Len, 7)
+	AssertInt64Equal(ev.Truncated, 0)
+	AssertStringsEqual(ev.Out, "--- OK\n")
+	// This is a virtual console, not a pseudo terminal.
+	AssertInt64Equal(ev.TtyDev.Major, 4)
+	AssertInt64Equal(ev.TtyDev.WinsizeRows, 0)
+	AssertInt64Equal(ev.TtyDev.WinsizeCols, 0)
+}
+
+func TestTtyWriteLarge(et *EventsTraceInstance) {
+	out := runTestBin("tty_write_large")
+	var output struct {
+		Pid  int64  `json:"pid"`
+		Len  int64  `json:"len"`
+		Line string `json:"line"`
+	}
+	if err := json.Unmarshal(out, &output); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var expected strings.Builder
+	for i := int64(0); i < output.Len; i++ {
+		expected.WriteByte(byte('a' + i%26))
+	}
+
+	// The first write is split over events of at most 4096 bytes, each
+	// marked truncated but the last
+	fromBin := func(ev TtyWriteEvent) bool { return ev.Pids.Tgid == output.Pid }
+
+	var got strings.Builder
+	first := WaitForEvent(et, "PROCESS_TTY_WRITE", fromBin)
+	ev := first
+	for {
+		AssertInt64Equal(ev.Seq, first.Seq)
+		AssertInt64Equal(ev.TotalLen, output.Len)
+		AssertInt64Equal(ev.Offset, int64(got.Len()))
+		AssertInt64Equal(ev.Truncated, output.Len-ev.Offset-ev.Len)
+		got.WriteString(ev.Out)
+
+		if ev.Truncated == 0 {
+			break
+		}
+		AssertInt64Equal(ev.Len, 4096)
+		ev = WaitForEvent(et, "PROCESS_TTY_WRITE", fromBin)
+	}
+	AssertStringsEqual(got.String(), expected.String())
+
+	// The next write to the same tty comes right after
+	ev = WaitForEvent(et, "PROCESS_TTY_WRITE", fromBin)
+	AssertInt64Equal(ev.Seq, first.Seq+1)
+	AssertInt64Equal(ev.Offset, 0)
+	AssertInt64Equal(ev.Truncated, 0)
+	AssertInt64Equal(ev.TotalLen, int64(len(output.Line)))
+	AssertStringsEqual(ev.Out, output.Line)
+	AssertInt64Equal(ev.TtyDev.Major, first.TtyDev.Major)
+	AssertInt64Equal(ev.TtyDev.Minor, first.TtyDev.Minor)
+}
+
+func TestPtyWrite(et *EventsTraceInstance) {
+	out := runTestBin("pty_write")
+	var output struct {
+		Pid   int64 `json:"pid"`
+		Major int64 `json:"major"`
+		Minor int64 `json:"minor"`
+		Rows  int64 `json:"rows"`
+		Cols  int64 `json:"cols"`
+	}
+	if err := json.Unmarshal(out, &output); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "PROCESS_TTY_WRITE", func(ev TtyWriteEvent) bool {
+		return ev.Pids.Tgid == output.Pid
+	})
+	AssertStringsEqual(ev.Out, "--- OK\n")
+	// Unix98 pty slaves, unlike the virtual console in TestTtyWrite
+	AssertInt64Equal(ev.TtyDev.Major, 136)
+	AssertInt64Equal(ev.TtyDev.Major, output.Major)
+	AssertInt64Equal(ev.TtyDev.Minor, output.Minor)
+	AssertInt64Equal(ev.TtyDev.WinsizeRows, output.Rows)
+	AssertInt64Equal(ev.TtyDev.WinsizeCols, output.Cols)
+}
+
+func TestFileCategory(et *EventsTraceInstance) {
+	outputStr := runTestBin("file_category")
+	var binOutput struct {
+		Pid        int64  `json:"pid"`
+		TextPath   string `json:"text_path"`
+		ScriptPath string `json:"script_path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The text file is created first, so if it got through the filter it
+	// would show up before the script
+	for {
+		var ev FileCreateEvent
+		line := et.GetNextEventJson("FILE_CREATE")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		if ev.Path == binOutput.TextPath {
+			TestFail("text file was not filtered out: ", line)
+		}
+
+		AssertStringsEqual(ev.Path, binOutput.ScriptPath)
+		AssertStringsEqual(ev.FileCategory, "script")
+		break
+	}
+}
+
+func TestFileCategoryMagic(et *EventsTraceInstance) {
+	outputStr := runTestBin("file_category_magic")
+	var binOutput struct {
+		Pid        int64  `json:"pid"`
+		FifoPath   string `json:"fifo_path"`
+		ScriptPath string `json:"script_path"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+	defer os.Remove(binOutput.FifoPath)
+	defer os.Remove(binOutput.ScriptPath)
+
+	// The FIFO is renamed first. EventsTrace must neither block opening it
+	// (nobody ever writes to it) nor classify it, so the script shows up next.
+	ev := WaitForEvent(et, "FILE_RENAME", func(ev FileRenameEvent) bool {
+		return ev.Pids.Tgid == binOutput.Pid
+	})
+	AssertStringsEqual(ev.NewPath, binOutput.ScriptPath)
+	AssertStringsEqual(ev.FileCategory, "script")
+}
+
+func TestFileCopy(et *EventsTraceInstance) {
+	outputStr := runTestBin("file_copy")
+	var binOutput struct {
+		Pid           int64  `json:"pid"`
+		SrcPath       string `json:"src_path"`
+		SendfileBytes int64  `json:"sendfile_bytes"`
+		ClientPort    int64  `json:"client_port"`
+		ServerPort    int64  `json:"server_port"`
+		SpliceBytes   int64  `json:"splice_bytes"`
+		PipeInInode   int64  `json:"pipe_in_inode"`
+		PipeOutInode  int64  `json:"pipe_out_inode"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var sendfileEvent, spliceEvent *FileCopyEvent
+	for sendfileEvent == nil || spliceEvent == nil {
+		var ev FileCopyEvent
+		line := et.GetNextEventJson("FILE_COPY")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		switch ev.Syscall {
+		case "sendfile":
+			sendfileEvent = &ev
+		case "splice":
+			spliceEvent = &ev
+		}
+	}
+
+	AssertInt64Equal(sendfileEvent.Bytes, binOutput.SendfileBytes)
+	AssertStringsEqual(sendfileEvent.Source.Type, "FILE")
+	AssertStringsEqual(sendfileEvent.Source.Path, binOutput.SrcPath)
+	AssertStringsEqual(sendfileEvent.Destination.Type, "SOCKET")
+	if sendfileEvent.Destination.Net == nil {
+		TestFail("sendfile destination socket has no network info")
+	}
+	AssertStringsEqual(sendfileEvent.Destination.Net.Transport, "TCP")
+	AssertIPEqual("127.0.0.1", sendfileEvent.Destination.Net.SourceAddr)
+	AssertInt64Equal(sendfileEvent.Destination.Net.SourcePort, binOutput.ClientPort)
+	AssertIPEqual("127.0.0.1", sendfileEvent.Destination.Net.DestAddr)
+	AssertInt64Equal(sendfileEvent.Destination.Net.DestPort, binOutput.ServerPort)
+
+	AssertInt64Equal(spliceEvent.Bytes, binOutput.SpliceBytes)
+	AssertStringsEqual(spliceEvent.Source.Type, "PIPE")
+	AssertInt64Equal(spliceEvent.Source.Inode, binOutput.PipeInInode)
+	AssertStringsEqual(spliceEvent.Destination.Type, "PIPE")
+	AssertInt64Equal(spliceEvent.Destination.Inode, binOutput.PipeOutInode)
+}
+
+func TestNetProcessSummary(et *EventsTraceInstance) {
+	outputStr := runTestBin("net_summary")
+	var binOutput struct {
+		Pid           int64 `json:"pid"`
+		Connections   int64 `json:"connections"`
+		BytesSent     int64 `json:"bytes_sent"`
+		BytesReceived int64 `json:"bytes_received"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The connections may straddle an interval boundary, in which case
+	// they're split across two summaries
+	var total NetProcessSummaryMsg
+	for total.Connections < binOutput.Connections {
+		var summary NetProcessSummaryMsg
+		line := et.GetNextEventJson("NETWORK_PROCESS_SUMMARY")
+		if err := json.Unmarshal([]byte(line), &summary); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if summary.Pids.Tgid != binOutput.Pid {
+			continue
+		}
+
+		AssertStringsEqual(summary.Comm, "net_summary")
+		total.Connections += summary.Connections
+		total.BytesSent += summary.BytesSent
+		total.BytesReceived += summary.BytesReceived
+	}
+
+	AssertInt64Equal(total.Connections, binOutput.Connections)
+	AssertInt64Equal(total.BytesSent, binOutput.BytesSent)
+	AssertInt64Equal(total.BytesReceived, binOutput.BytesReceived)
+}
+
+func TestTcpv4ConnectionAttempt(et *EventsTraceInstance) {
+	outputStr := runTestBin("tcpv4_connect")
+	var binOutput struct {
+		PidInfo    TestPidInfo `json:"pid_info"`
+		ClientPort int64       `json:"client_port"`
+		ServerPort int64       `json:"server_port"`
+		NetNs      int64       `json:"netns"`
+	}
+
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var ev NetConnAttemptEvent
+	for {
+		line := et.GetNextEventJson("NETWORK_CONNECTION_ATTEMPTED")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if ev.Pids.Tgid == binOutput.PidInfo.Tgid {
+			break
+		}
+	}
+
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET",
+		SourceAddr: "127.0.0.1",
+		SourcePort: binOutput.ClientPort,
+		DestAddr:   "127.0.0.1",
+		DestPort:   binOutput.ServerPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
+	AssertStringsEqual(ev.Net.DestAddrScope, "LOOPBACK")
+	AssertStringsEqual(ev.Comm, "tcpv4_connect")
 }
 
-func TestFileRename(et *EventsTraceInstance) {
-	outputStr := runTestBin("create_rename_delete_file")
+func TestUdpv4SendRecv(et *EventsTraceInstance) {
+	outputStr := runTestBin("udpv4_send_recv")
 	var binOutput struct {
-		PidInfo      TestPidInfo `json:"pid_info"`
-		FileNameOrig string      `json:"filename_orig"`
-		FileNameNew  string      `json:"filename_new"`
+		Pid             int64 `json:"pid"`
+		ServerPort      int64 `json:"server_port"`
+		UnconnectedPort int64 `json:"unconnected_port"`
+		ConnectedPort   int64 `json:"connected_port"`
+		Bytes           int64 `json:"bytes"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var fileRenameEvent FileRenameEvent
-	for {
-		line := et.GetNextEventJson("FILE_RENAME")
-		if err := json.Unmarshal([]byte(line), &fileRenameEvent); err != nil {
-			TestFail("failed to unmarshal JSON: ", err)
-		}
-
-		if fileRenameEvent.Pids.Tid == binOutput.PidInfo.Tid {
-			break
-		}
+	// Matches a datagram of the test bin sent or received on the socket
+	// bound to port
+	udpMatcher := func(name, eventType string, port int64, ev *NetUdpEvent) EventMatcher {
+		return EventMatcher{name, eventType, func(line string) bool {
+			*ev = NetUdpEvent{}
+			if err := json.Unmarshal([]byte(line), ev); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			return ev.Pids.Tgid == binOutput.Pid && ev.Net.SourcePort == port
+		}}
 	}
 
-	AssertPidInfoEqual(binOutput.PidInfo, fileRenameEvent.Pids)
-	AssertStringsEqual(fileRenameEvent.OldPath, binOutput.FileNameOrig)
-	AssertStringsEqual(fileRenameEvent.NewPath, binOutput.FileNameNew)
+	var unconnectedSend, unconnectedEchoRecv, unconnectedEchoSend NetUdpEvent
+	var connectedSend, connectedRecv NetUdpEvent
+	et.ExpectEventsInOrder(
+		udpMatcher("unconnected send", "NETWORK_UDP_SEND", binOutput.UnconnectedPort,
+			&unconnectedSend),
+		udpMatcher("unconnected echo recv", "NETWORK_UDP_RECV", binOutput.ServerPort,
+			&unconnectedEchoRecv),
+		udpMatcher("unconnected echo send", "NETWORK_UDP_SEND", binOutput.ServerPort,
+			&unconnectedEchoSend),
+		udpMatcher("connected send", "NETWORK_UDP_SEND", binOutput.ConnectedPort,
+			&connectedSend),
+		udpMatcher("connected recv", "NETWORK_UDP_RECV", binOutput.ConnectedPort,
+			&connectedRecv),
+	)
+
+	// The peer of an unconnected socket is taken from each datagram. Its
+	// source address is unset as it was never bound to one.
+	AssertStringsEqual(unconnectedSend.Net.Transport, "UDP")
+	AssertStringsEqual(unconnectedSend.Net.Family, "AF_INET")
+	AssertIPEqual("0.0.0.0", unconnectedSend.Net.SourceAddr)
+	AssertIPEqual("127.0.0.1", unconnectedSend.Net.DestAddr)
+	AssertInt64Equal(unconnectedSend.Net.DestPort, binOutput.ServerPort)
+	AssertInt64Equal(unconnectedSend.Net.Bytes, binOutput.Bytes)
+	AssertStringsEqual(unconnectedSend.Comm, "udpv4_send_recv")
+
+	AssertIPEqual("127.0.0.1", unconnectedEchoRecv.Net.SourceAddr)
+	AssertIPEqual("127.0.0.1", unconnectedEchoRecv.Net.DestAddr)
+	AssertInt64Equal(unconnectedEchoRecv.Net.DestPort, binOutput.UnconnectedPort)
+	AssertInt64Equal(unconnectedEchoRecv.Net.Bytes, binOutput.Bytes)
+
+	AssertInt64Equal(unconnectedEchoSend.Net.DestPort, binOutput.UnconnectedPort)
+
+	// The peer of a connected socket is the socket's
+	AssertIPEqual("127.0.0.1", connectedSend.Net.SourceAddr)
+	AssertIPEqual("127.0.0.1", connectedSend.Net.DestAddr)
+	AssertInt64Equal(connectedSend.Net.DestPort, binOutput.ServerPort)
+
+	AssertIPEqual("127.0.0.1", connectedRecv.Net.DestAddr)
+	AssertInt64Equal(connectedRecv.Net.DestPort, binOutput.ServerPort)
+	AssertInt64Equal(connectedRecv.Net.Bytes, binOutput.Bytes)
 }
 
-func TestSetuid(et *EventsTraceInstance) {
-	outputStr := runTestBin("setreuid")
+func TestDnsQuery(et *EventsTraceInstance) {
+	outputStr := runTestBin("dns_query")
 	var binOutput struct {
-		PidInfo TestPidInfo `json:"pid_info"`
-		NewRuid int64       `json:"new_ruid"`
-		NewEuid int64       `json:"new_euid"`
+		Pid   int64  `json:"pid"`
+		Qname string `json:"qname"`
+		Qtype string `json:"qtype"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var setUidEvent SetUidEvent
+	// The bin sends two malformed queries first, which must be skipped
+	var ev NetDnsEvent
 	for {
-		line := et.GetNextEventJson("PROCESS_SETUID")
-		if err := json.Unmarshal([]byte(line), &setUidEvent); err != nil {
+		line := et.GetNextEventJson("NETWORK_DNS_QUERY")
+		ev = NetDnsEvent{}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
 
-		if setUidEvent.Pids.Tid == binOutput.PidInfo.Tid {
+		if ev.Pids.Tgid == binOutput.Pid {
 			break
 		}
 	}
 
-	AssertInt64Equal(binOutput.NewRuid, setUidEvent.NewRuid)
-	AssertInt64Equal(binOutput.NewEuid, setUidEvent.NewEuid)
-	AssertPidInfoEqual(binOutput.PidInfo, setUidEvent.Pids)
+	AssertStringsEqual(ev.Qname, binOutput.Qname)
+	AssertStringsEqual(ev.Qtype, binOutput.Qtype)
+	AssertStringsEqual(ev.Net.Transport, "UDP")
+	AssertIPEqual("127.0.0.1", ev.Net.DestAddr)
+	AssertInt64Equal(ev.Net.DestPort, 53)
+	AssertStringsEqual(ev.Comm, "dns_query")
 }
 
-func TestSetgid(et *EventsTraceInstance) {
-	outputStr := runTestBin("setregid")
+func TestDnsResponse(et *EventsTraceInstance) {
+	outputStr := runTestBin("dns_response")
 	var binOutput struct {
-		PidInfo TestPidInfo `json:"pid_info"`
-		NewRgid int64       `json:"new_rgid"`
-		NewEgid int64       `json:"new_egid"`
+		Pid              int64    `json:"pid"`
+		Qname            string   `json:"qname"`
+		Cname            string   `json:"cname"`
+		Addresses        []string `json:"addresses"`
+		TruncatedQname   string   `json:"truncated_qname"`
+		TruncatedAddress string   `json:"truncated_address"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var setGidEvent SetGidEvent
-	for {
-		line := et.GetNextEventJson("PROCESS_SETGID")
-		if err := json.Unmarshal([]byte(line), &setGidEvent); err != nil {
+	queries := map[string]NetDnsEvent{}
+	responses := map[string]NetDnsResponseEvent{}
+	for len(queries) < 2 || len(responses) < 2 {
+		line := et.GetNextEventJson("NETWORK_DNS_QUERY", "NETWORK_DNS_RESPONSE")
+		eventType, err := getJsonEventType(line)
+		if err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
 
-		if setGidEvent.Pids.Tid == binOutput.PidInfo.Tid {
-			break
+		if eventType == "NETWORK_DNS_QUERY" {
+			var ev NetDnsEvent
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if ev.Pids.Tgid == binOutput.Pid {
+				queries[ev.Qname] = ev
+			}
+		} else {
+			var ev NetDnsResponseEvent
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if ev.Pids.Tgid == binOutput.Pid {
+				responses[ev.Qname] = ev
+			}
 		}
 	}
 
-	AssertInt64Equal(binOutput.NewRgid, setGidEvent.NewRgid)
-	AssertInt64Equal(binOutput.NewEgid, setGidEvent.NewEgid)
-	AssertPidInfoEqual(binOutput.PidInfo, setGidEvent.Pids)
+	for qname, response := range responses {
+		query, ok := queries[qname]
+		if !ok {
+			TestFail(fmt.Sprintf("no query for the response for %s", qname))
+		}
+		AssertInt64Equal(response.TransactionId, query.TransactionId)
+		AssertTrue(response.QueryKtimeNs == query.KtimeNs)
+		AssertIPEqual("127.0.0.1", response.Net.DestAddr)
+		AssertInt64Equal(response.Net.DestPort, 53)
+		AssertStringsEqual(response.Rcode, "NOERROR")
+		AssertStringsEqual(response.AnswersTruncated, "FALSE")
+	}
+
+	response := responses[binOutput.Qname]
+	AssertStringsEqual(response.Qtype, "A")
+	AssertStringsEqual(response.Truncated, "FALSE")
+	AssertInt64Equal(int64(len(response.Answers)), int64(1+len(binOutput.Addresses)))
+	AssertStringsEqual(response.Answers[0].Type, "CNAME")
+	AssertStringsEqual(response.Answers[0].Name, binOutput.Qname)
+	AssertStringsEqual(response.Answers[0].Cname, binOutput.Cname)
+	for i, addr := range binOutput.Addresses {
+		AssertStringsEqual(response.Answers[i+1].Name, binOutput.Cname)
+		AssertIPEqual(addr, response.Answers[i+1].Address)
+	}
+
+	truncated := responses[binOutput.TruncatedQname]
+	AssertStringsEqual(truncated.Truncated, "TRUE")
+	AssertInt64Equal(int64(len(truncated.Answers)), 1)
+	AssertIPEqual(binOutput.TruncatedAddress, truncated.Answers[0].Address)
 }
 
-func TestFileCreateContainer(et *EventsTraceInstance) {
-	outputStr := runTestBin("create_rename_delete_file_container")
+func TestResolvedVia(et *EventsTraceInstance) {
+	outputStr := runTestBin("resolved_via")
 	var binOutput struct {
-		ChildPid     int64  `json:"child_pid"`
-		FileNameOrig string `json:"filename_orig"`
-		FileNameNew  string `json:"filename_new"`
+		Pid             int64  `json:"pid"`
+		Port            int64  `json:"port"`
+		ResolvedQname   string `json:"resolved_qname"`
+		ResolvedAddress string `json:"resolved_address"`
+		DirectAddress   string `json:"direct_address"`
+		ExpiredQname    string `json:"expired_qname"`
+		ExpiredAddress  string `json:"expired_address"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var fileCreateEvent FileCreateEvent
-	for {
-		line := et.GetNextEventJson("FILE_CREATE")
-		if err := json.Unmarshal([]byte(line), &fileCreateEvent); err != nil {
+	resolvedVia := map[string]string{}
+	for len(resolvedVia) < 3 {
+		var ev NetConnAttemptEvent
+		line := et.GetNextEventJson("NETWORK_CONNECTION_ATTEMPTED")
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
 
-		if fileCreateEvent.Pids.Tgid == binOutput.ChildPid {
-			break
+		if ev.Pids.Tgid == binOutput.Pid && ev.Net.DestPort == binOutput.Port {
+			resolvedVia[ev.Net.DestAddr] = ev.ResolvedVia
 		}
 	}
 
-	AssertStringsEqual(fileCreateEvent.Path, binOutput.FileNameOrig)
+	AssertStringsEqual(resolvedVia[binOutput.ResolvedAddress], binOutput.ResolvedQname)
+	// Never looked up
+	AssertStringsEqual(resolvedVia[binOutput.DirectAddress], "")
+	// Resolved with a TTL of 0
+	AssertStringsEqual(resolvedVia[binOutput.ExpiredAddress], "")
 }
 
-func TestFileRenameContainer(et *EventsTraceInstance) {
-	outputStr := runTestBin("create_rename_delete_file_container")
+func TestListen(et *EventsTraceInstance) {
+	outputStr := runTestBin("tcp_listen")
 	var binOutput struct {
-		ChildPid     int64  `json:"child_pid"`
-		FileNameOrig string `json:"filename_orig"`
-		FileNameNew  string `json:"filename_new"`
+		PidInfo TestPidInfo `json:"pid_info"`
+		Port    int64       `json:"port"`
+		Backlog int64       `json:"backlog"`
+		NetNs   int64       `json:"netns"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var fileRenameEvent FileRenameEvent
-	for {
-		line := et.GetNextEventJson("FILE_RENAME")
-		if err := json.Unmarshal([]byte(line), &fileRenameEvent); err != nil {
-			TestFail("failed to unmarshal JSON: ", err)
-		}
+	ev := WaitForEvent(et, "NETWORK_LISTEN", func(ev NetListenEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
+	})
 
-		if fileRenameEvent.Pids.Tgid == binOutput.ChildPid {
-			break
-		}
+	// A listening socket has no peer
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET",
+		SourceAddr: "0.0.0.0",
+		SourcePort: binOutput.Port,
+		DestAddr:   "0.0.0.0",
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
+	AssertInt64Equal(ev.Backlog, binOutput.Backlog)
+	AssertStringsEqual(ev.Comm, "tcp_listen")
+}
+
+func TestDrainForPid(et *EventsTraceInstance) {
+	var first, second struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+	}
+	// The first run's NETWORK_LISTEN event is still unread when the second
+	// run starts, DrainForPid must skip it
+	if err := json.Unmarshal(runTestBin("tcp_listen"), &first); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+	if err := json.Unmarshal(runTestBin("tcp_listen"), &second); err != nil {
+		TestFail("failed to unmarshal json", err)
 	}
 
-	AssertStringsEqual(fileRenameEvent.OldPath, binOutput.FileNameOrig)
-	AssertStringsEqual(fileRenameEvent.NewPath, binOutput.FileNameNew)
+	var ev NetListenEvent
+	if err := json.Unmarshal([]byte(et.DrainForPid(second.PidInfo.Tgid)), &ev); err != nil {
+		TestFail("failed to unmarshal JSON: ", err)
+	}
+	AssertInt64NotEqual(ev.Pids.Tgid, first.PidInfo.Tgid)
+	AssertPidInfoEqual(second.PidInfo, ev.Pids)
 }
 
-func TestFileDeleteContainer(et *EventsTraceInstance) {
-	outputStr := runTestBin("create_rename_delete_file_container")
+func TestEventTypeWildcard(et *EventsTraceInstance) {
+	outputStr := runTestBin("tcp_listen")
 	var binOutput struct {
-		ChildPid     int64  `json:"child_pid"`
-		FileNameOrig string `json:"filename_orig"`
-		FileNameNew  string `json:"filename_new"`
+		PidInfo TestPidInfo `json:"pid_info"`
 	}
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var fileDeleteEvent FileDeleteEvent
-	for {
-		line := et.GetNextEventJson("FILE_DELETE")
-		if err := json.Unmarshal([]byte(line), &fileDeleteEvent); err != nil {
+	// The bin's PROCESS_EXEC event comes first and must be skipped, then its
+	// bind is the first network event, whatever the subtype
+	var types []string
+	for len(types) < 2 {
+		line := et.GetNextEventJson("NETWORK_*")
+		var ev struct {
+			Pids PidInfo `json:"pids"`
+		}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
+		if ev.Pids.Tgid != binOutput.PidInfo.Tgid {
+			continue
+		}
 
-		if fileDeleteEvent.Pids.Tgid == binOutput.ChildPid {
-			break
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
 		}
+		types = append(types, eventType)
 	}
 
-	AssertStringsEqual(fileDeleteEvent.Path, binOutput.FileNameNew)
+	AssertStringsEqual(strings.Join(types, ","), "NETWORK_BIND,NETWORK_LISTEN")
 }
 
-func TestTtyWrite(et *EventsTraceInstance) {
-	out := runTestBin("tty_write")
-	var output struct {
-		Pid int64 `json:"pid"`
+func TestBind(et *EventsTraceInstance) {
+	outputStr := runTestBin("inet_bind")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+		TcpPort int64       `json:"tcp_port"`
+		UdpPort int64       `json:"udp_port"`
+		NetNs   int64       `json:"netns"`
 	}
-	if err := json.Unmarshal(out, &output); err != nil {
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var ev TtyWriteEvent
-	for {
-		line := et.GetNextEventJson("PROCESS_TTY_WRITE")
-		if err := json.Unmarshal([]byte(line), &ev); err != nil {
-			TestFail("failed to unmarshal JSON: ", err)
-		}
-		if ev.Pids.Tgid == output.Pid {
-			break
-		}
+	fromBin := func(ev NetBindEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
 	}
 
-	AssertInt64Equal(ev.Len, 7)
-	AssertInt64Equal(ev.Truncated, 0)
-	AssertStringsEqual(ev.Out, "--- OK\n")
-	// This is a virtual console, not a pseudo terminal.
-	AssertInt64Equal(ev.TtyDev.Major, 4)
-	AssertInt64Equal(ev.TtyDev.WinsizeRows, 0)
-	AssertInt64Equal(ev.TtyDev.WinsizeCols, 0)
+	tcp := WaitForEvent(et, "NETWORK_BIND", fromBin)
+	AssertPidInfoEqual(binOutput.PidInfo, tcp.Pids)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET",
+		SourceAddr: "0.0.0.0",
+		SourcePort: binOutput.TcpPort,
+		DestAddr:   "0.0.0.0",
+		NetNs:      binOutput.NetNs,
+	}, tcp.Net)
+	AssertStringsEqual(tcp.Comm, "inet_bind")
+
+	// Bound to port 0, the event must have the port the kernel picked
+	udp := WaitForEvent(et, "NETWORK_BIND", fromBin)
+	if udp.Net.SourcePort == 0 {
+		TestFail("ephemeral port not reported, got port 0")
+	}
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "UDP",
+		Family:     "AF_INET6",
+		SourceAddr: "::",
+		SourcePort: binOutput.UdpPort,
+		DestAddr:   "::",
+		NetNs:      binOutput.NetNs,
+	}, udp.Net)
 }
 
-func TestTcpv4ConnectionAttempt(et *EventsTraceInstance) {
-	outputStr := runTestBin("tcpv4_connect")
+func TestAddressScope(et *EventsTraceInstance) {
+	outputStr := runTestBin("address_scope")
 	var binOutput struct {
-		PidInfo    TestPidInfo `json:"pid_info"`
-		ClientPort int64       `json:"client_port"`
-		ServerPort int64       `json:"server_port"`
-		NetNs      int64       `json:"netns"`
+		Pid            int64  `json:"pid"`
+		PrivateAddress string `json:"private_address"`
+		PublicAddress  string `json:"public_address"`
 	}
-
 	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
 		TestFail("failed to unmarshal json", err)
 	}
 
-	var ev NetConnAttemptEvent
-	for {
+	scopes := map[string]string{}
+	for len(scopes) < 2 {
+		var ev NetConnAttemptEvent
 		line := et.GetNextEventJson("NETWORK_CONNECTION_ATTEMPTED")
 		if err := json.Unmarshal([]byte(line), &ev); err != nil {
 			TestFail("failed to unmarshal JSON: ", err)
 		}
 
-		if ev.Pids.Tgid == binOutput.PidInfo.Tgid {
-			break
+		if ev.Pids.Tgid == binOutput.Pid {
+			scopes[ev.Net.DestAddr] = ev.Net.DestAddrScope
 		}
 	}
 
-	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
-	AssertStringsEqual(ev.Net.Transport, "TCP")
-	AssertStringsEqual(ev.Net.Family, "AF_INET")
-	AssertStringsEqual(ev.Net.SourceAddr, "127.0.0.1")
-	AssertInt64Equal(ev.Net.SourcePort, binOutput.ClientPort)
-	AssertStringsEqual(ev.Net.DestAddr, "127.0.0.1")
-	AssertInt64Equal(ev.Net.DestPort, binOutput.ServerPort)
-	AssertInt64Equal(ev.Net.NetNs, binOutput.NetNs)
-	AssertStringsEqual(ev.Comm, "tcpv4_connect")
+	AssertStringsEqual(scopes[binOutput.PrivateAddress], "PRIVATE")
+	AssertStringsEqual(scopes[binOutput.PublicAddress], "PUBLIC")
 }
 
 func TestTcpv4ConnectionAccept(et *EventsTraceInstance) {
@@ -445,16 +3694,41 @@ func TestTcpv4ConnectionAccept(et *EventsTraceInstance) {
 	}
 
 	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
-	AssertStringsEqual(ev.Net.Transport, "TCP")
-	AssertStringsEqual(ev.Net.Family, "AF_INET")
-	AssertStringsEqual(ev.Net.SourceAddr, "127.0.0.1")
-	AssertInt64Equal(ev.Net.SourcePort, binOutput.ServerPort)
-	AssertStringsEqual(ev.Net.DestAddr, "127.0.0.1")
-	AssertInt64Equal(ev.Net.DestPort, binOutput.ClientPort)
-	AssertInt64Equal(ev.Net.NetNs, binOutput.NetNs)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET",
+		SourceAddr: "127.0.0.1",
+		SourcePort: binOutput.ServerPort,
+		DestAddr:   "127.0.0.1",
+		DestPort:   binOutput.ClientPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
 	AssertStringsEqual(ev.Comm, "tcpv4_connect")
 }
 
+func TestAccept4Flags(et *EventsTraceInstance) {
+	outputStr := runTestBin("accept4_flags")
+	var binOutput struct {
+		PidInfo TestPidInfo `json:"pid_info"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	fromBin := func(ev NetConnAcceptEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
+	}
+
+	// The first connection is accepted with plain accept, which must not
+	// pick up the flags of the accept4 after it
+	accept := WaitForEvent(et, "NETWORK_CONNECTION_ACCEPTED", fromBin)
+	AssertStringsEqual(strings.Join(accept.AcceptFlags, "|"), "")
+
+	accept4 := WaitForEvent(et, "NETWORK_CONNECTION_ACCEPTED", fromBin)
+	AssertStringsEqual(strings.Join(accept4.AcceptFlags, "|"), "SOCK_CLOEXEC")
+	AssertStringsEqual(accept4.Comm, "accept4_flags")
+}
+
 func TestTcpv4ConnectionClose(et *EventsTraceInstance) {
 	outputStr := runTestBin("tcpv4_connect")
 	var binOutput struct {
@@ -498,19 +3772,83 @@ func TestTcpv4ConnectionClose(et *EventsTraceInstance) {
 	// results in the _client_ socket being torn down first in the kernel.
 	// Thus, our BPF probes report the source/dest ports from the client
 	// socket's point of view for the close event. The SourcePort and DestPort
-	// assertions below verify this is correct.
+	// assertions below verify this is correct. Tests that don't control the
+	// close order should use AssertNetInfoEqualAnyDirection instead.
 
 	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
-	AssertStringsEqual(ev.Net.Transport, "TCP")
-	AssertStringsEqual(ev.Net.Family, "AF_INET")
-	AssertStringsEqual(ev.Net.SourceAddr, "127.0.0.1")
-	AssertInt64Equal(ev.Net.SourcePort, binOutput.ClientPort)
-	AssertStringsEqual(ev.Net.DestAddr, "127.0.0.1")
-	AssertInt64Equal(ev.Net.DestPort, binOutput.ServerPort)
-	AssertInt64Equal(ev.Net.NetNs, binOutput.NetNs)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET",
+		SourceAddr: "127.0.0.1",
+		SourcePort: binOutput.ClientPort,
+		DestAddr:   "127.0.0.1",
+		DestPort:   binOutput.ServerPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
 	AssertStringsEqual(ev.Comm, "tcpv4_connect")
 }
 
+// Unlike ports, which flip depending on the end a close is reported from, the
+// socket inode tells which socket an event is about
+func TestSocketLifecycleCorrelation(et *EventsTraceInstance) {
+	outputStr := runTestBin("tcp_sock_lifecycle")
+	var binOutput struct {
+		PidInfo           TestPidInfo `json:"pid_info"`
+		ClientPort        int64       `json:"client_port"`
+		ServerPort        int64       `json:"server_port"`
+		ClientSockInode   uint64      `json:"client_sock_inode"`
+		AcceptedSockInode uint64      `json:"accepted_sock_inode"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	var attempt, accept *NetInfo
+	closes := map[uint64]NetConnCloseEvent{}
+	for attempt == nil || accept == nil || len(closes) < 2 {
+		line := et.GetNextEventJson("NETWORK_CONNECTION_*")
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			TestFail(fmt.Sprintf("Failed to unmarshal the following JSON: \"%s\": %s", line, err))
+		}
+
+		// The three events have the same fields
+		var ev NetConnCloseEvent
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+		if ev.Pids.Tgid != binOutput.PidInfo.Tgid {
+			continue
+		}
+
+		switch eventType {
+		case "NETWORK_CONNECTION_ATTEMPTED":
+			attempt = &ev.Net
+		case "NETWORK_CONNECTION_ACCEPTED":
+			accept = &ev.Net
+		case "NETWORK_CONNECTION_CLOSED":
+			closes[ev.Net.SockInode] = ev
+		}
+	}
+
+	AssertTrue(binOutput.ClientSockInode != 0)
+	AssertTrue(binOutput.ClientSockInode != binOutput.AcceptedSockInode)
+	AssertTrue(attempt.SockInode == binOutput.ClientSockInode)
+	AssertTrue(accept.SockInode == binOutput.AcceptedSockInode)
+
+	// Each end's close is told apart by its inode, with its own ports as
+	// source, whichever one was torn down first
+	clientClose, ok := closes[binOutput.ClientSockInode]
+	AssertTrue(ok)
+	AssertInt64Equal(clientClose.Net.SourcePort, binOutput.ClientPort)
+	AssertInt64Equal(clientClose.Net.DestPort, binOutput.ServerPort)
+
+	acceptedClose, ok := closes[binOutput.AcceptedSockInode]
+	AssertTrue(ok)
+	AssertInt64Equal(acceptedClose.Net.SourcePort, binOutput.ServerPort)
+	AssertInt64Equal(acceptedClose.Net.DestPort, binOutput.ClientPort)
+}
+
 func TestTcpv6ConnectionAttempt(et *EventsTraceInstance) {
 	outputStr := runTestBin("tcpv6_connect")
 	var binOutput struct {
@@ -537,16 +3875,55 @@ func TestTcpv6ConnectionAttempt(et *EventsTraceInstance) {
 	}
 
 	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
-	AssertStringsEqual(ev.Net.Transport, "TCP")
-	AssertStringsEqual(ev.Net.Family, "AF_INET6")
-	AssertStringsEqual(ev.Net.SourceAddr, "::1")
-	AssertInt64Equal(ev.Net.SourcePort, binOutput.ClientPort)
-	AssertStringsEqual(ev.Net.DestAddr, "::1")
-	AssertInt64Equal(ev.Net.DestPort, binOutput.ServerPort)
-	AssertInt64Equal(ev.Net.NetNs, binOutput.NetNs)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET6",
+		SourceAddr: "::1",
+		SourcePort: binOutput.ClientPort,
+		DestAddr:   "::1",
+		DestPort:   binOutput.ServerPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
+	AssertStringsEqual(ev.Net.MappedV4, "FALSE")
 	AssertStringsEqual(ev.Comm, "tcpv6_connect")
 }
 
+func TestMappedV4Connect(et *EventsTraceInstance) {
+	outputStr := runTestBin("tcpv6_connect_mapped_v4")
+	var binOutput struct {
+		PidInfo    TestPidInfo `json:"pid_info"`
+		ClientPort int64       `json:"client_port"`
+		ServerPort int64       `json:"server_port"`
+		NetNs      int64       `json:"netns"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	ev := WaitForEvent(et, "NETWORK_CONNECTION_ATTEMPTED", func(ev NetConnAttemptEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid
+	})
+	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET6",
+		SourceAddr: "::ffff:127.0.0.1",
+		SourcePort: binOutput.ClientPort,
+		DestAddr:   "::ffff:127.0.0.1",
+		DestPort:   binOutput.ServerPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
+
+	// Both forms are there, AssertNetInfoEqual compares addresses normalized
+	AssertStringsEqual(ev.Net.SourceAddr, "::ffff:127.0.0.1")
+	AssertStringsEqual(ev.Net.DestAddr, "::ffff:127.0.0.1")
+	AssertStringsEqual(ev.Net.MappedV4, "TRUE")
+	AssertStringsEqual(ev.Net.SourceAddrV4, "127.0.0.1")
+	AssertStringsEqual(ev.Net.DestAddrV4, "127.0.0.1")
+	AssertStringsEqual(ev.Net.DestAddrScope, "LOOPBACK")
+	AssertStringsEqual(ev.Comm, "tcpv6_connect_m")
+}
+
 func TestTcpv6ConnectionAccept(et *EventsTraceInstance) {
 	outputStr := runTestBin("tcpv6_connect")
 	var binOutput struct {
@@ -573,13 +3950,15 @@ func TestTcpv6ConnectionAccept(et *EventsTraceInstance) {
 	}
 
 	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
-	AssertStringsEqual(ev.Net.Transport, "TCP")
-	AssertStringsEqual(ev.Net.Family, "AF_INET6")
-	AssertStringsEqual(ev.Net.SourceAddr, "::1")
-	AssertInt64Equal(ev.Net.SourcePort, binOutput.ServerPort)
-	AssertStringsEqual(ev.Net.DestAddr, "::1")
-	AssertInt64Equal(ev.Net.DestPort, binOutput.ClientPort)
-	AssertInt64Equal(ev.Net.NetNs, binOutput.NetNs)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET6",
+		SourceAddr: "::1",
+		SourcePort: binOutput.ServerPort,
+		DestAddr:   "::1",
+		DestPort:   binOutput.ClientPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
 	AssertStringsEqual(ev.Comm, "tcpv6_connect")
 }
 
@@ -609,22 +3988,162 @@ func TestTcpv6ConnectionClose(et *EventsTraceInstance) {
 	}
 
 	AssertPidInfoEqual(binOutput.PidInfo, ev.Pids)
-	AssertStringsEqual(ev.Net.Transport, "TCP")
-	AssertStringsEqual(ev.Net.Family, "AF_INET6")
-	AssertStringsEqual(ev.Net.SourceAddr, "::1")
-	AssertInt64Equal(ev.Net.SourcePort, binOutput.ClientPort)
-	AssertStringsEqual(ev.Net.DestAddr, "::1")
-	AssertInt64Equal(ev.Net.DestPort, binOutput.ServerPort)
-	AssertInt64Equal(ev.Net.NetNs, binOutput.NetNs)
+	AssertNetInfoEqual(NetInfo{
+		Transport:  "TCP",
+		Family:     "AF_INET6",
+		SourceAddr: "::1",
+		SourcePort: binOutput.ClientPort,
+		DestAddr:   "::1",
+		DestPort:   binOutput.ServerPort,
+		NetNs:      binOutput.NetNs,
+	}, ev.Net)
 	AssertStringsEqual(ev.Comm, "tcpv6_connect")
 }
 
+func TestUnixSocketConnect(et *EventsTraceInstance) {
+	outputStr := runTestBin("unix_connect")
+	var binOutput struct {
+		PidInfo      TestPidInfo `json:"pid_info"`
+		Path         string      `json:"path"`
+		AbstractName string      `json:"abstract_name"`
+		NetNs        int64       `json:"netns"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	fromBin := func(ev NetConnAttemptEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid && ev.Net.Family == "AF_UNIX"
+	}
+	acceptedFromBin := func(ev NetConnAcceptEvent) bool {
+		return ev.Pids.Tgid == binOutput.PidInfo.Tgid && ev.Net.Family == "AF_UNIX"
+	}
+
+	// The bin connects and accepts on the path first, then on the abstract
+	// name, which is rendered with a leading @ in place of its NUL
+	for _, path := range []string{binOutput.Path, "@" + binOutput.AbstractName} {
+		attempt := WaitForEvent(et, "NETWORK_CONNECTION_ATTEMPTED", fromBin)
+		AssertPidInfoEqual(binOutput.PidInfo, attempt.Pids)
+		AssertNetInfoEqual(NetInfo{
+			Family:   "AF_UNIX",
+			NetNs:    binOutput.NetNs,
+			UnixPath: path,
+		}, attempt.Net)
+		// Both ends are the bin's
+		AssertInt64Equal(attempt.Net.PeerPid, binOutput.PidInfo.Tgid)
+		AssertStringsEqual(attempt.Comm, "unix_connect")
+
+		accept := WaitForEvent(et, "NETWORK_CONNECTION_ACCEPTED", acceptedFromBin)
+		AssertPidInfoEqual(binOutput.PidInfo, accept.Pids)
+		AssertNetInfoEqual(NetInfo{
+			Family:   "AF_UNIX",
+			NetNs:    binOutput.NetNs,
+			UnixPath: path,
+		}, accept.Net)
+		// Both ends are the bin's
+		AssertInt64Equal(accept.Net.PeerPid, binOutput.PidInfo.Tgid)
+		AssertStringsEqual(accept.Comm, "unix_connect")
+	}
+}
+
+func TestUnixSocketPeerCred(et *EventsTraceInstance) {
+	outputStr := runTestBin("unix_peercred")
+	var binOutput struct {
+		Pid          int64  `json:"pid"`
+		Uid          int64  `json:"uid"`
+		Gid          int64  `json:"gid"`
+		ChildPid     int64  `json:"child_pid"`
+		ChildUid     int64  `json:"child_uid"`
+		ChildGid     int64  `json:"child_gid"`
+		ExitedPid    int64  `json:"exited_pid"`
+		AbstractName string `json:"abstract_name"`
+	}
+	if err := json.Unmarshal(outputStr, &binOutput); err != nil {
+		TestFail("failed to unmarshal json", err)
+	}
+
+	// The child connects, then the bin accepts its connection and that of the
+	// exited child, in that order. Events of different processes may be
+	// printed in either order.
+	var attempt *NetConnAttemptEvent
+	var accepts []NetConnAcceptEvent
+	for attempt == nil || len(accepts) < 2 {
+		line := et.GetNextEventJson("NETWORK_CONNECTION_ATTEMPTED", "NETWORK_CONNECTION_ACCEPTED")
+		eventType, err := getJsonEventType(line)
+		if err != nil {
+			TestFail("failed to unmarshal JSON: ", err)
+		}
+
+		if eventType == "NETWORK_CONNECTION_ATTEMPTED" {
+			var ev NetConnAttemptEvent
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if ev.Pids.Tgid == binOutput.ChildPid && ev.Net.Family == "AF_UNIX" {
+				attempt = &ev
+			}
+		} else {
+			var ev NetConnAcceptEvent
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				TestFail("failed to unmarshal JSON: ", err)
+			}
+			if ev.Pids.Tgid == binOutput.Pid && ev.Net.Family == "AF_UNIX" {
+				accepts = append(accepts, ev)
+			}
+		}
+	}
+
+	// The connecting end reports the process that listened
+	AssertStringsEqual(attempt.Net.UnixPath, "@"+binOutput.AbstractName)
+	AssertInt64Equal(attempt.Net.PeerPid, binOutput.Pid)
+	AssertInt64Equal(attempt.Net.PeerUid, binOutput.Uid)
+	AssertInt64Equal(attempt.Net.PeerGid, binOutput.Gid)
+	AssertStringsEqual(attempt.Net.PeerExited, "FALSE")
+
+	// The accepting end reports the process that connected
+	AssertStringsEqual(accepts[0].Net.UnixPath, "@"+binOutput.AbstractName)
+	AssertInt64Equal(accepts[0].Net.PeerPid, binOutput.ChildPid)
+	AssertInt64Equal(accepts[0].Net.PeerUid, binOutput.ChildUid)
+	AssertInt64Equal(accepts[0].Net.PeerGid, binOutput.ChildGid)
+	AssertStringsEqual(accepts[0].Net.PeerExited, "FALSE")
+
+	// Credentials captured at connect time, the peer has been reaped since
+	AssertInt64Equal(accepts[1].Net.PeerPid, binOutput.ExitedPid)
+	AssertInt64Equal(accepts[1].Net.PeerUid, binOutput.Uid)
+	AssertInt64Equal(accepts[1].Net.PeerGid, binOutput.Gid)
+	AssertStringsEqual(accepts[1].Net.PeerExited, "TRUE")
+}
+
 func TestTcFilter() {
-	cmd := exec.Command("/BPFTcFilterTests")
-	cmd.Env = os.Environ()
-	cmd.Env = append(cmd.Env, "ELASTIC_EBPF_TC_FILTER_OBJ_PATH=/TcFilter.bpf.o")
-	output, err := cmd.Output()
+	cfg := TcFilterTestsConfig{
+		BinPath:    "/BPFTcFilterTests",
+		ObjectPath: "/TcFilter.bpf.o",
+		ReportPath: "/tmp/BPFTcFilterTests.json",
+	}
+	defer os.Remove(cfg.ReportPath)
+
+	output, err := cfg.Command().Output()
+	report, reportErr := ReadGTestReport(cfg.ReportPath)
+	if reportErr != nil {
+		// Crashed before gtest could write its report
+		fmt.Println(string(output))
+		TestFail(fmt.Sprintf("BPFTcFilterTests failed: %s, could not read its report: %s",
+			err, reportErr))
+	}
+
+	var failed []string
+	for _, result := range report.Results() {
+		if result.Status != "RUN" || result.Result != "COMPLETED" || len(result.Failures) > 0 {
+			failed = append(failed, result.String())
+		}
+	}
+	if len(failed) > 0 {
+		TestFail(fmt.Sprintf("BPFTcFilterTests failed:\n%s", strings.Join(failed, "\n")))
+	}
 
+	AssertTrue(report.Tests > 0)
+	AssertInt64Equal(report.Failures, 0)
+	AssertInt64Equal(int64(len(report.Results())), report.Tests)
 	if err != nil {
 		fmt.Println(string(output))
 		TestFail(fmt.Sprintf("BPFTcFilterTests failed: %s", err))
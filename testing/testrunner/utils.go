@@ -11,15 +11,18 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -38,16 +41,90 @@ type InitMsg struct {
 	InitSuccess bool `json:"probes_initialized"`
 	Features    struct {
 		BpfTramp bool `json:"bpf_tramp"`
+		RingBuf  bool `json:"ringbuf"`
 	} `json:"features"`
+	ObjectSha256 string `json:"object_sha256"`
+}
+
+type StatsMsg struct {
+	UserTimeUs          int64 `json:"user_time_us"`
+	SystemTimeUs        int64 `json:"system_time_us"`
+	MaxRssKb            int64 `json:"max_rss_kb"`
+	EventsProcessed     int64 `json:"events_processed"`
+	EventsEmitted       int64 `json:"events_emitted"`
+	EventsDropped       int64 `json:"events_dropped"`
+	RingbufBacklogBytes int64 `json:"ringbuf_backlog_bytes"`
+}
+
+type ConfigMsg struct {
+	Events               []string `json:"events"`
+	FileCategories       []string `json:"file_categories"`
+	FileCategoryMagic    string   `json:"file_category_magic"`
+	LolBinList           string   `json:"lolbin_list"`
+	ExpectedObjectSha256 string   `json:"expected_object_sha256"`
+	StatsInterval        int64    `json:"stats_interval"`
+	NetSummaryInterval   int64    `json:"net_summary_interval"`
+	DropAndRunWindow     int64    `json:"drop_and_run_window"`
+	TamperPaths          string   `json:"tamper_paths"`
+	TamperComms          string   `json:"tamper_comms"`
+	SelfPaths            string   `json:"self_paths"`
+	PidFilter            string   `json:"pid_filter"`
+	RingbufSizeBytes     int64    `json:"ringbuf_size_bytes"`
+	UnbufferStdout       string   `json:"unbuffer_stdout"`
+	LibbpfVerbose        string   `json:"libbpf_verbose"`
+	Paused               string   `json:"paused"`
+}
+
+type FilterMapEntry struct {
+	Pid         int64  `json:"pid"`
+	Prefix      string `json:"prefix"`
+	Dev         int64  `json:"dev"`
+	Inode       int64  `json:"inode"`
+	Comm        string `json:"comm"`
+	Owner       string `json:"owner"`
+	DeviceClass string `json:"device_class"`
+}
+
+type FilterMapMsg struct {
+	Map     string           `json:"map"`
+	Entries []FilterMapEntry `json:"entries"`
+	Last    string           `json:"last"`
+}
+
+type NetProcessSummaryMsg struct {
+	Pids          PidInfo `json:"pids"`
+	PeriodSecs    int64   `json:"period_secs"`
+	Connections   int64   `json:"connections"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+	Comm          string  `json:"comm"`
+}
+
+type DropAndRunMsg struct {
+	WriterPids      PidInfo `json:"writer_pids"`
+	ExecutorPids    PidInfo `json:"executor_pids"`
+	Path            string  `json:"path"`
+	FileName        string  `json:"filename"`
+	Dev             int64   `json:"dev"`
+	Inode           int64   `json:"inode"`
+	InodeGeneration int64   `json:"inode_generation"`
+	GapNs           int64   `json:"gap_ns"`
 }
 
 type PidInfo struct {
-	Tid         int64 `json:"tid"`
-	Tgid        int64 `json:"tgid"`
-	Ppid        int64 `json:"ppid"`
-	Pgid        int64 `json:"pgid"`
-	Sid         int64 `json:"sid"`
-	StartTimeNs int64 `json:"start_time_ns"`
+	Tid         int64  `json:"tid"`
+	Tgid        int64  `json:"tgid"`
+	Ppid        int64  `json:"ppid"`
+	Pgid        int64  `json:"pgid"`
+	Sid         int64  `json:"sid"`
+	StartTimeNs int64  `json:"start_time_ns"`
+	EntityId    string `json:"entity_id"`
+
+	StartBoottimeNs int64 `json:"start_boottime_ns"`
+	// Only present for processes in a non-initial pid namespace
+	ContainerStartTimeNs *int64 `json:"container_start_time_ns"`
+
+	ParentEntityId string `json:"parent_entity_id"`
 }
 
 type CredInfo struct {
@@ -57,6 +134,18 @@ type CredInfo struct {
 	Egid int64 `json:"egid"`
 	Suid int64 `json:"suid"`
 	Sgid int64 `json:"sgid"`
+
+	// As seen from within the process' user namespace, the above are always
+	// as seen from the host
+	ContainerRuid int64 `json:"container_ruid"`
+	ContainerRgid int64 `json:"container_rgid"`
+	ContainerEuid int64 `json:"container_euid"`
+	ContainerEgid int64 `json:"container_egid"`
+	ContainerSuid int64 `json:"container_suid"`
+	ContainerSgid int64 `json:"container_sgid"`
+
+	CapPermitted []string `json:"cap_permitted"`
+	CapEffective []string `json:"cap_effective"`
 }
 
 type TtyInfo struct {
@@ -65,55 +154,456 @@ type TtyInfo struct {
 }
 
 type NetInfo struct {
-	Transport  string `json:"transport"`
-	Family     string `json:"family"`
-	SourceAddr string `json:"source_address"`
-	SourcePort int64  `json:"source_port"`
-	DestAddr   string `json:"destination_address"`
-	DestPort   int64  `json:"destination_port"`
-	NetNs      int64  `json:"network_namespace"`
+	Transport     string `json:"transport"`
+	Family        string `json:"family"`
+	SourceAddr    string `json:"source_address"`
+	SourcePort    int64  `json:"source_port"`
+	DestAddr      string `json:"destination_address"`
+	DestAddrScope string `json:"destination_address_scope"`
+	DestPort      int64  `json:"destination_port"`
+	MappedV4      string `json:"mapped_v4"`
+	SourceAddrV4  string `json:"source_address_v4"`
+	DestAddrV4    string `json:"destination_address_v4"`
+	NetNs         int64  `json:"network_namespace"`
+	SockInode     uint64 `json:"sock_inode"`
+	Bytes         int64  `json:"bytes"`
+	UnixPath      string `json:"unix_path"`
+	PeerPid       int64  `json:"peer_pid"`
+	PeerUid       int64  `json:"peer_uid"`
+	PeerGid       int64  `json:"peer_gid"`
+	PeerExited    string `json:"peer_exited"`
+}
+
+// Common to all events, see docs/events.md for how to order events with these
+type EventHeader struct {
+	KtimeNs uint64 `json:"ktime_ns"`
+	Cpu     uint32 `json:"cpu"`
+	Subseq  uint64 `json:"subseq"`
+	ProcSeq uint64 `json:"proc_seq"`
+}
+
+type Cgroup struct {
+	Id   uint64 `json:"id"`
+	Path string `json:"path"`
+}
+
+type Namespaces struct {
+	Mnt    uint32 `json:"mnt"`
+	Net    uint32 `json:"net"`
+	Pid    uint32 `json:"pid"`
+	User   uint32 `json:"user"`
+	Uts    uint32 `json:"uts"`
+	Ipc    uint32 `json:"ipc"`
+	Cgroup uint32 `json:"cgroup"`
 }
 
 type ProcessForkEvent struct {
-	ParentPids PidInfo `json:"parent_pids"`
-	ChildPids  PidInfo `json:"child_pids"`
+	EventHeader
+
+	ParentPids  PidInfo    `json:"parent_pids"`
+	ChildPids   PidInfo    `json:"child_pids"`
+	Cgroup      Cgroup     `json:"cgroup"`
+	Namespaces  Namespaces `json:"namespaces"`
+	ContainerId string     `json:"container_id"`
+	CloneFlags  []string   `json:"clone_flags"`
+	IsThread    string     `json:"is_thread"`
 }
 
 type ProcessExecEvent struct {
-	Pids     PidInfo  `json:"pids"`
-	Creds    CredInfo `json:"creds"`
-	Ctty     TtyInfo  `json:"ctty"`
-	FileName string   `json:"filename"`
-	Cwd      string   `json:"cwd"`
-	Argv     string   `json:"argv"`
+	EventHeader
+
+	Pids                PidInfo    `json:"pids"`
+	Creds               CredInfo   `json:"creds"`
+	Ctty                TtyInfo    `json:"ctty"`
+	FileName            string     `json:"filename"`
+	ExecSource          string     `json:"exec_source"`
+	ExePath             string     `json:"exe_path"`
+	ExeDev              int64      `json:"exe_dev"`
+	ExeInode            int64      `json:"exe_inode"`
+	ExeInodeGeneration  int64      `json:"exe_inode_generation"`
+	ExeFilesystemType   string     `json:"exe_fs_type"`
+	ExeOnNetworkFs      string     `json:"exe_on_network_fs"`
+	ExeOnRemovableFs    string     `json:"exe_on_removable_fs"`
+	NoNewPrivs          string     `json:"no_new_privs"`
+	MntNsSwitchedFrom   int64      `json:"mntns_switched_from"`
+	Cwd                 string     `json:"cwd"`
+	RootPath            string     `json:"root_path"`
+	Argv                string     `json:"argv"`
+	ArgvArray           []string   `json:"argv_array"`
+	ArgvTruncated       string     `json:"argv_truncated"`
+	ParentArgv          string     `json:"parent_argv"`
+	ParentArgvTruncated string     `json:"parent_argv_truncated"`
+	ParentArgvStale     string     `json:"parent_argv_stale"`
+	Cgroup              Cgroup     `json:"cgroup"`
+	Namespaces          Namespaces `json:"namespaces"`
+
+	LolBin         string `json:"lolbin"`
+	LolBinCategory string `json:"lolbin_category"`
+
+	ContainerId   string `json:"container_id"`
+	ContainerExec string `json:"container_exec"`
+
+	// Only set for #! script execs
+	Interpreter       string `json:"interpreter"`
+	ScriptPath        string `json:"script_path"`
+	InterpreterViaEnv string `json:"interpreter_via_env"`
+
+	// Only present with --capture-env
+	Env          []string `json:"env"`
+	EnvTruncated string   `json:"env_truncated"`
+
+	// Only present with --hash-execs
+	Sha256      string `json:"sha256"`
+	Sha256Error string `json:"sha256_error"`
+}
+
+type ProcessExitEvent struct {
+	EventHeader
+
+	Pids        PidInfo    `json:"pids"`
+	ExitCode    int64      `json:"exit_code"`
+	Signal      int64      `json:"signal"`
+	OomKilled   string     `json:"oom_killed"`
+	Cgroup      Cgroup     `json:"cgroup"`
+	Namespaces  Namespaces `json:"namespaces"`
+	ContainerId string     `json:"container_id"`
 }
 
 type FileCreateEvent struct {
-	Pids PidInfo `json:"pids"`
-	Path string  `json:"path"`
+	EventHeader
+
+	Pids            PidInfo `json:"pids"`
+	Path            string  `json:"path"`
+	RootPath        string  `json:"root_path"`
+	FileCategory    string  `json:"file_category"`
+	Dev             int64   `json:"dev"`
+	Inode           int64   `json:"inode"`
+	InodeGeneration int64   `json:"inode_generation"`
+	ContainerId     string  `json:"container_id"`
+}
+
+type FileLinkEvent struct {
+	EventHeader
+
+	Pids         PidInfo `json:"pids"`
+	TargetPath   string  `json:"target_path"`
+	LinkPath     string  `json:"link_path"`
+	RootPath     string  `json:"root_path"`
+	FileCategory string  `json:"file_category"`
+}
+
+type FileModifyEvent struct {
+	EventHeader
+
+	Pids         PidInfo `json:"pids"`
+	Path         string  `json:"path"`
+	RootPath     string  `json:"root_path"`
+	FileCategory string  `json:"file_category"`
+	Change       string  `json:"change"`
+	OldMode      int64   `json:"old_mode"`
+	NewMode      int64   `json:"new_mode"`
+	OldUid       int64   `json:"old_uid"`
+	NewUid       int64   `json:"new_uid"`
+	OldGid       int64   `json:"old_gid"`
+	NewGid       int64   `json:"new_gid"`
 }
 
 type FileDeleteEvent struct {
-	Pids PidInfo `json:"pids"`
-	Path string  `json:"path"`
+	EventHeader
+
+	Pids         PidInfo `json:"pids"`
+	Path         string  `json:"path"`
+	RootPath     string  `json:"root_path"`
+	FileCategory string  `json:"file_category"`
+	Dev          int64   `json:"dev"`
+	Inode        int64   `json:"inode"`
+	Size         int64   `json:"size"`
+	IsLastLink   string  `json:"is_last_link"`
+	ContainerId  string  `json:"container_id"`
+}
+
+// Converts a device number as returned by stat to the kernel's internal
+// encoding used in events, (major << 20) | minor
+func kernelDev(dev uint64) int64 {
+	major := (dev>>8)&0xfff | (dev>>32)&^uint64(0xfff)
+	minor := dev&0xff | (dev>>12)&^uint64(0xff)
+	return int64(major<<20 | minor)
 }
 
 type FileRenameEvent struct {
+	EventHeader
+
+	Pids           PidInfo  `json:"pids"`
+	OldPath        string   `json:"old_path"`
+	NewPath        string   `json:"new_path"`
+	RootPath       string   `json:"root_path"`
+	FileCategory   string   `json:"file_category"`
+	CrossDirectory string   `json:"cross_directory"`
+	Flags          []string `json:"flags"`
+	ContainerId    string   `json:"container_id"`
+}
+
+type FileCopyEndpoint struct {
+	Type  string   `json:"type"`
+	Path  string   `json:"path"`
+	Inode int64    `json:"inode"`
+	Net   *NetInfo `json:"net"`
+}
+
+type FileCopyEvent struct {
+	EventHeader
+
+	Pids         PidInfo          `json:"pids"`
+	Syscall      string           `json:"syscall"`
+	Bytes        int64            `json:"bytes"`
+	Source       FileCopyEndpoint `json:"source"`
+	Destination  FileCopyEndpoint `json:"destination"`
+	FileCategory string           `json:"file_category"`
+}
+
+type ProcessSetsidEvent struct {
+	EventHeader
+
 	Pids    PidInfo `json:"pids"`
-	OldPath string  `json:"old_path"`
-	NewPath string  `json:"new_path"`
+	OldPids PidInfo `json:"old_pids"`
 }
 
 type SetUidEvent struct {
-	Pids    PidInfo `json:"pids"`
-	NewRuid int64   `json:"new_ruid"`
-	NewEuid int64   `json:"new_euid"`
+	EventHeader
+
+	Pids             PidInfo `json:"pids"`
+	NewRuid          int64   `json:"new_ruid"`
+	NewEuid          int64   `json:"new_euid"`
+	NewContainerRuid int64   `json:"new_container_ruid"`
+	NewContainerEuid int64   `json:"new_container_euid"`
+
+	NewSuid           int64 `json:"new_suid"`
+	NewFsuid          int64 `json:"new_fsuid"`
+	NewContainerSuid  int64 `json:"new_container_suid"`
+	NewContainerFsuid int64 `json:"new_container_fsuid"`
 }
 
 type SetGidEvent struct {
+	EventHeader
+
+	Pids             PidInfo `json:"pids"`
+	NewRgid          int64   `json:"new_rgid"`
+	NewEgid          int64   `json:"new_egid"`
+	NewContainerRgid int64   `json:"new_container_rgid"`
+	NewContainerEgid int64   `json:"new_container_egid"`
+
+	NewSgid           int64 `json:"new_sgid"`
+	NewFsgid          int64 `json:"new_fsgid"`
+	NewContainerSgid  int64 `json:"new_container_sgid"`
+	NewContainerFsgid int64 `json:"new_container_fsgid"`
+}
+
+type ProcessSetSchedEvent struct {
+	EventHeader
+
+	Pids          PidInfo `json:"pids"`
+	Syscall       string  `json:"syscall"`
+	TargetType    string  `json:"target_type"`
+	TargetId      int64   `json:"target_id"`
+	Policy        string  `json:"policy"`
+	ResetOnFork   string  `json:"reset_on_fork"`
+	SchedPriority int64   `json:"sched_priority"`
+	Nice          int64   `json:"nice"`
+}
+
+type ProcessBpfLinkEvent struct {
+	EventHeader
+
+	Pids          PidInfo `json:"pids"`
+	Cmd           string  `json:"cmd"`
+	AttachType    string  `json:"attach_type"`
+	ProgId        int64   `json:"prog_id"`
+	LinkId        int64   `json:"link_id"`
+	Target        string  `json:"target"`
+	TargetIfindex int64   `json:"target_ifindex"`
+	Comm          string  `json:"comm"`
+}
+
+type FileOpenEvent struct {
+	EventHeader
+
+	Pids  PidInfo  `json:"pids"`
+	Path  string   `json:"path"`
+	Flags []string `json:"flags"`
+	Mode  int64    `json:"mode"`
+	Comm  string   `json:"comm"`
+}
+
+type FileTruncateEvent struct {
+	EventHeader
+
 	Pids    PidInfo `json:"pids"`
-	NewRgid int64   `json:"new_rgid"`
-	NewEgid int64   `json:"new_egid"`
+	Syscall string  `json:"syscall"`
+	Path    string  `json:"path"`
+	OldSize int64   `json:"old_size"`
+	NewSize int64   `json:"new_size"`
+	Comm    string  `json:"comm"`
+}
+
+type ChdirEvent struct {
+	EventHeader
+
+	Pids    PidInfo `json:"pids"`
+	Syscall string  `json:"syscall"`
+	Cwd     string  `json:"cwd"`
+	Comm    string  `json:"comm"`
+}
+
+type ProcessBpfSyscallEvent struct {
+	EventHeader
+
+	Pids     PidInfo `json:"pids"`
+	Cmd      string  `json:"cmd"`
+	ProgType string  `json:"prog_type"`
+	ProgId   int64   `json:"prog_id"`
+	MapType  string  `json:"map_type"`
+	MapId    int64   `json:"map_id"`
+	Name     string  `json:"name"`
+	Comm     string  `json:"comm"`
+}
+
+type ProcessMmSpoofEvent struct {
+	EventHeader
+
+	Pids        PidInfo `json:"pids"`
+	Field       string  `json:"field"`
+	ArgvSpoofed string  `json:"argv_spoofed"`
+	Value       int64   `json:"value"`
+	ExePath     string  `json:"exe_path"`
+	Comm        string  `json:"comm"`
+}
+
+type ProcessPtraceEvent struct {
+	EventHeader
+
+	Pids          PidInfo `json:"pids"`
+	Request       string  `json:"request"`
+	RequestNumber int64   `json:"request_number"`
+	TargetPid     int64   `json:"target_pid"`
+	Comm          string  `json:"comm"`
+}
+
+type ProcessSignalEvent struct {
+	EventHeader
+
+	Pids       PidInfo `json:"pids"`
+	Syscall    string  `json:"syscall"`
+	TargetPid  int64   `json:"target_pid"`
+	TargetTgid int64   `json:"target_tgid"`
+	Signal     int64   `json:"signal"`
+	Broadcast  string  `json:"broadcast"`
+	Comm       string  `json:"comm"`
+}
+
+type ProcessSetCapEvent struct {
+	EventHeader
+
+	Pids              PidInfo  `json:"pids"`
+	OldCapEffective   []string `json:"old_cap_effective"`
+	NewCapEffective   []string `json:"new_cap_effective"`
+	OldCapPermitted   []string `json:"old_cap_permitted"`
+	NewCapPermitted   []string `json:"new_cap_permitted"`
+	OldCapInheritable []string `json:"old_cap_inheritable"`
+	NewCapInheritable []string `json:"new_cap_inheritable"`
+}
+
+type ProcessMmapExecEvent struct {
+	EventHeader
+
+	Pids               PidInfo `json:"pids"`
+	Syscall            string  `json:"syscall"`
+	Addr               uint64  `json:"addr"`
+	Len                uint64  `json:"len"`
+	Prot               int64   `json:"prot"`
+	Flags              int64   `json:"flags"`
+	Anonymous          string  `json:"anonymous"`
+	WritableExecutable string  `json:"writable_executable"`
+	WriteToExec        string  `json:"write_to_exec"`
+	Path               string  `json:"path"`
+	Comm               string  `json:"comm"`
+}
+
+type ProcessMprotectEvent struct {
+	EventHeader
+
+	Pids           PidInfo `json:"pids"`
+	Addr           uint64  `json:"addr"`
+	Len            uint64  `json:"len"`
+	OldProt        int64   `json:"old_prot"`
+	NewProt        int64   `json:"new_prot"`
+	MadeExecutable string  `json:"made_executable"`
+	Comm           string  `json:"comm"`
+}
+
+type ProcessNamespaceEvent struct {
+	EventHeader
+
+	Pids          PidInfo    `json:"pids"`
+	NsFlags       []string   `json:"ns_flags"`
+	OldNamespaces Namespaces `json:"old_namespaces"`
+	NewNamespaces Namespaces `json:"new_namespaces"`
+	Comm          string     `json:"comm"`
+}
+
+type ModuleLoadEvent struct {
+	EventHeader
+
+	Pids    PidInfo `json:"pids"`
+	Syscall string  `json:"syscall"`
+	Name    string  `json:"name"`
+	Comm    string  `json:"comm"`
+}
+
+type SecurityTamperEvent struct {
+	EventHeader
+
+	Pids       PidInfo `json:"pids"`
+	Comm       string  `json:"comm"`
+	Op         string  `json:"op"`
+	Path       string  `json:"path"`
+	Dev        int64   `json:"dev"`
+	Inode      int64   `json:"inode"`
+	TargetPid  int64   `json:"target_pid"`
+	TargetComm string  `json:"target_comm"`
+	Signal     int64   `json:"signal"`
+}
+
+type MountEvent struct {
+	EventHeader
+
+	Pids        PidInfo `json:"pids"`
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	FsType      string  `json:"fs_type"`
+	Flags       int64   `json:"flags"`
+	Mntns       int64   `json:"mount_namespace"`
+}
+
+type FilesystemViewChangeEvent struct {
+	EventHeader
+
+	Pids     PidInfo `json:"pids"`
+	OldMntNs int64   `json:"old_mount_namespace"`
+	NewMntNs int64   `json:"new_mount_namespace"`
+	Comm     string  `json:"comm"`
+}
+
+type DeviceAccessEvent struct {
+	EventHeader
+
+	Pids        PidInfo `json:"pids"`
+	DeviceClass string  `json:"device_class"`
+	Path        string  `json:"path"`
+	Flags       int64   `json:"flags"`
+	AccessMode  string  `json:"access_mode"`
+	DeviceMajor int64   `json:"device_major"`
+	DeviceMinor int64   `json:"device_minor"`
+	Comm        string  `json:"comm"`
 }
 
 type ttyDevInfo struct {
@@ -128,31 +618,104 @@ type ttyDevInfo struct {
 }
 
 type TtyWriteEvent struct {
+	EventHeader
+
 	Pids      PidInfo    `json:"pids"`
 	Len       int64      `json:"tty_out_len"`
 	Truncated int64      `json:"tty_out_truncated"`
+	Offset    int64      `json:"tty_out_offset"`
+	TotalLen  int64      `json:"tty_out_total_len"`
+	Seq       int64      `json:"tty_write_seq"`
 	Out       string     `json:"tty_out"`
 	TtyDev    ttyDevInfo `json:"tty"`
 }
 
 type NetConnAttemptEvent struct {
+	EventHeader
+
+	Pids        PidInfo `json:"pids"`
+	Net         NetInfo `json:"net"`
+	ResolvedVia string  `json:"resolved_via"`
+	Comm        string  `json:"comm"`
+}
+
+type NetConnAcceptEvent struct {
+	EventHeader
+
+	Pids        PidInfo  `json:"pids"`
+	Net         NetInfo  `json:"net"`
+	AcceptFlags []string `json:"accept_flags"`
+	Comm        string   `json:"comm"`
+}
+
+type NetConnCloseEvent struct {
+	EventHeader
+
 	Pids PidInfo `json:"pids"`
 	Net  NetInfo `json:"net"`
 	Comm string  `json:"comm"`
 }
 
-type NetConnAcceptEvent struct {
+type NetUdpEvent struct {
+	EventHeader
+
 	Pids PidInfo `json:"pids"`
 	Net  NetInfo `json:"net"`
 	Comm string  `json:"comm"`
 }
 
-type NetConnCloseEvent struct {
+type NetDnsEvent struct {
+	EventHeader
+
+	Pids          PidInfo `json:"pids"`
+	Net           NetInfo `json:"net"`
+	TransactionId int64   `json:"transaction_id"`
+	Qname         string  `json:"qname"`
+	Qtype         string  `json:"qtype"`
+	Comm          string  `json:"comm"`
+}
+
+type DnsAnswer struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Ttl     int64  `json:"ttl"`
+	Address string `json:"address"`
+	Cname   string `json:"cname"`
+}
+
+type NetDnsResponseEvent struct {
+	EventHeader
+
+	Pids             PidInfo     `json:"pids"`
+	Net              NetInfo     `json:"net"`
+	TransactionId    int64       `json:"transaction_id"`
+	QueryKtimeNs     uint64      `json:"query_ktime_ns"`
+	Qname            string      `json:"qname"`
+	Qtype            string      `json:"qtype"`
+	Rcode            string      `json:"rcode"`
+	Truncated        string      `json:"truncated"`
+	Answers          []DnsAnswer `json:"answers"`
+	AnswersTruncated string      `json:"answers_truncated"`
+	Comm             string      `json:"comm"`
+}
+
+type NetBindEvent struct {
+	EventHeader
+
 	Pids PidInfo `json:"pids"`
 	Net  NetInfo `json:"net"`
 	Comm string  `json:"comm"`
 }
 
+type NetListenEvent struct {
+	EventHeader
+
+	Pids    PidInfo `json:"pids"`
+	Net     NetInfo `json:"net"`
+	Backlog int64   `json:"backlog"`
+	Comm    string  `json:"comm"`
+}
+
 func getJsonEventType(jsonLine string) (string, error) {
 	var jsonUnmarshaled struct {
 		EventType string `json:"event_type"`
@@ -167,9 +730,25 @@ func getJsonEventType(jsonLine string) (string, error) {
 }
 
 func runTestBin(binName string) []byte {
+	return runTestBinWith(binName, nil)
+}
+
+// started, if not nil, is called with the binary's pid as soon as it's running
+func runTestBinWith(binName string, started func(pid int)) []byte {
 	cmd := exec.Command(fmt.Sprintf("/%s", binName))
 
-	output, err := cmd.Output()
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	err := cmd.Start()
+	if err == nil {
+		if started != nil {
+			started(cmd.Process.Pid)
+		}
+		err = cmd.Wait()
+	}
+
+	output := stdout.Bytes()
 	if err != nil {
 		fmt.Printf("===== stderr of %s =====\n", binName)
 		fmt.Println(err)
@@ -193,6 +772,120 @@ func AssertPidInfoEqual(tpi TestPidInfo, pi PidInfo) {
 	AssertInt64Equal(pi.Sid, tpi.Sid)
 }
 
+// Returns addr in its canonical form (e.g. "::1" for "0:0:0:0:0:0:0:1"), or
+// as is if it isn't an IP address
+func normalizeIP(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+
+	return addr
+}
+
+func AssertIPEqual(expected, actual string) {
+	expectedIP, actualIP := net.ParseIP(expected), net.ParseIP(actual)
+	if expectedIP == nil || actualIP == nil {
+		TestFail(fmt.Sprintf("Test assertion failed, %q or %q isn't an IP address", actual, expected))
+	}
+	if !expectedIP.Equal(actualIP) {
+		TestFail(fmt.Sprintf("Test assertion failed, IP %s != %s", actual, expected))
+	}
+}
+
+// Returns a description of the first field identifying the connection that
+// differs between expected and actual, or "" if there's none. Addresses are
+// compared in their canonical form. DestAddrScope
+// and Bytes describe the event rather than the connection and are skipped, as
+// is SockInode, which differs between the two ends.
+func netInfoMismatch(expected, actual NetInfo) string {
+	fields := []struct {
+		name             string
+		expected, actual interface{}
+	}{
+		{"transport", expected.Transport, actual.Transport},
+		{"family", expected.Family, actual.Family},
+		{"source address", normalizeIP(expected.SourceAddr), normalizeIP(actual.SourceAddr)},
+		{"source port", expected.SourcePort, actual.SourcePort},
+		{"destination address", normalizeIP(expected.DestAddr), normalizeIP(actual.DestAddr)},
+		{"destination port", expected.DestPort, actual.DestPort},
+		{"network namespace", expected.NetNs, actual.NetNs},
+		{"unix path", expected.UnixPath, actual.UnixPath},
+	}
+
+	for _, f := range fields {
+		if f.expected != f.actual {
+			return fmt.Sprintf("%s %v != %v", f.name, f.actual, f.expected)
+		}
+	}
+
+	return ""
+}
+
+func AssertNetInfoEqual(expected, actual NetInfo) {
+	if mismatch := netInfoMismatch(expected, actual); mismatch != "" {
+		TestFail(fmt.Sprintf("Test assertion failed, %s", mismatch))
+	}
+}
+
+// Like AssertNetInfoEqual, but also accepts actual with source and
+// destination swapped, for events like NETWORK_CONNECTION_CLOSED that may be
+// reported from either end of a local connection.
+func AssertNetInfoEqualAnyDirection(expected, actual NetInfo) {
+	flipped := expected
+	flipped.SourceAddr, flipped.DestAddr = expected.DestAddr, expected.SourceAddr
+	flipped.SourcePort, flipped.DestPort = expected.DestPort, expected.SourcePort
+	if netInfoMismatch(flipped, actual) == "" {
+		return
+	}
+
+	AssertNetInfoEqual(expected, actual)
+}
+
+// Checks that child is a direct child of parent, both by pid and by entity
+// ID, so a parent that exited and had its pid reused doesn't pass
+func checkEntityRelationship(parent, child PidInfo) error {
+	if child.Ppid != parent.Tgid {
+		return fmt.Errorf("process %d has ppid %d, expected %d", child.Tgid, child.Ppid, parent.Tgid)
+	}
+	if parent.EntityId == "" || child.EntityId == "" {
+		return fmt.Errorf("missing entity ID (parent %d: %q, child %d: %q)", parent.Tgid,
+			parent.EntityId, child.Tgid, child.EntityId)
+	}
+	if child.EntityId == parent.EntityId {
+		return fmt.Errorf("parent %d and child %d have the same entity ID %s", parent.Tgid,
+			child.Tgid, child.EntityId)
+	}
+	if child.ParentEntityId != parent.EntityId {
+		return fmt.Errorf("process %d has parent entity ID %q, expected %q (entity ID of %d)",
+			child.Tgid, child.ParentEntityId, parent.EntityId, parent.Tgid)
+	}
+	return nil
+}
+
+// Events only carry a process' parent, so that's all of its ancestry that can
+// be checked
+func checkAncestryContains(pi PidInfo, tgid int64) error {
+	if pi.Ppid != tgid {
+		return fmt.Errorf("%d is not an ancestor of process %d (parent %d)", tgid, pi.Tgid, pi.Ppid)
+	}
+	if pi.ParentEntityId == "" {
+		return fmt.Errorf("process %d has no parent entity ID", pi.Tgid)
+	}
+	return nil
+}
+
+func AssertEntityRelationship(parent, child PidInfo) {
+	if err := checkEntityRelationship(parent, child); err != nil {
+		TestFail(fmt.Sprintf("Test assertion failed, %s", err))
+	}
+}
+
+func AssertAncestryContains(pi PidInfo, tgid int64) {
+	if err := checkAncestryContains(pi, tgid); err != nil {
+		TestFail(fmt.Sprintf("Test assertion failed, %s", err))
+	}
+}
+
 func AssertTrue(val bool) {
 	if !val {
 		TestFail(fmt.Sprintf("Expected %t to be true", val))
@@ -211,6 +904,18 @@ func AssertStringsEqual(a, b string) {
 	}
 }
 
+func AssertContainerIdEqual(a, b string) {
+	if a != b {
+		TestFail(fmt.Sprintf("Test assertion failed, container ID %q != %q", a, b))
+	}
+}
+
+func AssertStringNotEmpty(a string) {
+	if a == "" {
+		TestFail("Test assertion failed, string is empty")
+	}
+}
+
 func AssertInt64Equal(a, b int64) {
 	if a != b {
 		TestFail(fmt.Sprintf("Test assertion failed %d != %d", a, b))
@@ -268,13 +973,153 @@ func TestFail(v ...interface{}) {
 	fmt.Print("\n")
 
 	fmt.Println("BPF test failed, see errors and stacktrace above")
-	os.Exit(1)
+	panic(testFailure{strings.TrimSpace(fmt.Sprintln(v...))})
+}
+
+// Raised by TestFail to abort the test it's called from, see runTest
+type testFailure struct {
+	message string
+}
+
+// Raised by TestSkip, like testFailure
+type testSkip struct {
+	reason string
+}
+
+// Ends the current test without failing it, for tests that can't run here
+// (e.g. for lack of a capability or kernel feature)
+func TestSkip(v ...interface{}) {
+	panic(testSkip{strings.TrimSpace(fmt.Sprintln(v...))})
+}
+
+// One entry of the -report file
+type TestResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Message    string `json:"message"`
+}
+
+var (
+	resultsMu sync.Mutex
+	results   = []TestResult{}
+)
+
+// Set from the command line, see main
+var (
+	failFast   bool
+	reportPath string
+)
+
+func recordResult(result TestResult) {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+
+	results = append(results, result)
 }
 
-func AllTestsPassed() {
+// Runs the test f and records its result. A TestFail in f only fails this
+// test, so the caller carries on with the next one.
+func runTest(f interface{}, run func()) {
+	testFuncName := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	result := TestResult{Name: strings.TrimPrefix(testFuncName, "main."), Status: "passed"}
+	start := time.Now()
+
+	defer func() {
+		switch r := recover().(type) {
+		case nil:
+		case testFailure:
+			result.Status = "failed"
+			result.Message = r.message
+		case testSkip:
+			result.Status = "skipped"
+			result.Message = r.reason
+		default:
+			panic(r)
+		}
+		result.DurationMs = time.Since(start).Milliseconds()
+		recordResult(result)
+
+		if result.Status == "skipped" {
+			fmt.Printf("test skipped:  %s (%s)\n", testFuncName, result.Message)
+		} else {
+			fmt.Printf("test %s:  %s\n", result.Status, testFuncName)
+		}
+		if failFast && result.Status == "failed" {
+			FinishTests()
+		}
+	}()
+
+	run()
+}
+
+// Writes the JSON report to reportPath, unless it's empty, and exits with a
+// non-zero status if any test failed
+func FinishTests() {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+
+	if reportPath != "" {
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Println("Could not marshal test report: ", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(reportPath, b, 0644); err != nil {
+			fmt.Println("Could not write test report: ", err)
+			os.Exit(1)
+		}
+	}
+
+	var failed, skipped []string
+	for _, result := range results {
+		switch result.Status {
+		case "failed":
+			failed = append(failed, result.Name)
+		case "skipped":
+			skipped = append(skipped, result.Name)
+		}
+	}
+
+	if len(skipped) > 0 {
+		fmt.Printf("%d of %d BPF tests skipped: %s\n", len(skipped), len(results),
+			strings.Join(skipped, ", "))
+	}
+
+	if len(failed) > 0 {
+		fmt.Printf("%d of %d BPF tests failed: %s\n", len(failed), len(results),
+			strings.Join(failed, ", "))
+		os.Exit(1)
+	}
+
 	fmt.Println("ALL BPF TESTS PASSED")
 }
 
+// Returns true if the memory cgroup controller is available, which is needed
+// to OOM kill a process without putting the rest of the system at risk
+func IsMemoryCgroupSupported() bool {
+	file, err := os.Open("/proc/cgroups")
+	if err != nil {
+		TestFail(fmt.Sprintf("Could not open /proc/cgroups: %s", err))
+	}
+	defer file.Close()
+
+	// Format is: subsys_name hierarchy num_cgroups enabled
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 4 && fields[0] == "memory" {
+			return fields[3] == "1"
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		TestFail(fmt.Sprintf("Could not read from /proc/cgroups: %s", err))
+	}
+
+	return false
+}
+
 func IsOverlayFsSupported() bool {
 	file, err := os.Open("/proc/filesystems")
 	if err != nil {
@@ -298,25 +1143,105 @@ func IsOverlayFsSupported() bool {
 }
 
 func RunTest(f func()) {
-	testFuncName := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
-	f() // Will dump info and shutdown if test fails
-	fmt.Println("test passed: ", testFuncName)
+	runTest(f, f) // Will dump info and record a failure if test fails
 }
 
 func RunEventsTest(f func(*EventsTraceInstance), args ...string) {
-	testFuncName := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	RunEventsTestCase(TestCase{Func: f, Args: args})
+}
+
+// Like RunEventsTest, for a test case that can also be run by
+// RunTestsParallel
+func RunEventsTestCase(tc TestCase) {
+	runTest(tc.Func, func() {
+		ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
+		defer cancel()
+
+		et := NewEventsTrace(ctx, tc.Args...)
+		et.Start(ctx)
+		// Already stopped below unless the test failed or was skipped, in
+		// which case EventsTrace mustn't outlive it
+		defer et.Stop()
+
+		tc.Func(et) // Will dump info and record a failure if test fails
+
+		// Shuts down eventstrace and goroutines listening on stdout/stderr
+		cancel()
+
+		if err := et.Stop(); err != nil {
+			TestFail(fmt.Sprintf("Could not stop EventsTrace binary: %s", err))
+		}
+	})
+}
+
+// A test that can run alongside others, see RunTestsParallel. Args are the
+// EventsTrace arguments it needs, as passed to RunEventsTest.
+type TestCase struct {
+	Func func(*EventsTraceInstance)
+	Args []string
+}
+
+// Returns a NUL-terminated syscall.Utsname field as a string. Its fields are
+// int8 arrays on some architectures and uint8 arrays on others.
+func utsnameString[T int8 | uint8](chars []T) string {
+	var b strings.Builder
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		b.WriteByte(byte(c))
+	}
+
+	return b.String()
+}
+
+// Runs tests concurrently against a single EventsTrace instance started with
+// the union of their arguments. Each test only sees the events of the
+// processes it started with EventsTraceInstance.RunTestBin (and their
+// descendants), so tests must only look at those, start them with RunTestBin
+// and not depend on anything global (e.g. pausing, stats or config messages)
+// or on fixed resources another test uses.
+func RunTestsParallel(tests []TestCase) {
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
 
+	// Needed to route the events of forked processes
+	args := []string{"--process-fork"}
+	for _, tc := range tests {
+	next:
+		for _, arg := range tc.Args {
+			for _, a := range args {
+				if a == arg {
+					continue next
+				}
+			}
+			args = append(args, arg)
+		}
+	}
+
 	et := NewEventsTrace(ctx, args...)
 	et.Start(ctx)
+	demux := newEventDemux(et.StdoutChan, et.lost)
 
-	f(et) // Will dump info and shutdown if test fails
+	var wg sync.WaitGroup
+	for _, tc := range tests {
+		view := *et
+		view.StdoutChan = make(chan string, streamChanSize)
+		view.demux = demux
+
+		wg.Add(1)
+		go func(tc TestCase, view *EventsTraceInstance) {
+			defer wg.Done()
+
+			runTest(tc.Func, func() {
+				tc.Func(view) // Will dump info and record a failure if test fails
+			})
+		}(tc, &view)
+	}
+	wg.Wait()
 
 	// Shuts down eventstrace and goroutines listening on stdout/stderr
 	cancel()
 
-	fmt.Println("test passed: ", testFuncName)
-
 	if err := et.Stop(); err != nil {
 		TestFail(fmt.Sprintf("Could not stop EventsTrace binary: %s", err))
 	}